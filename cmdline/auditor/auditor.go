@@ -271,8 +271,15 @@ func fmtRow(info *audit.Info, rowid int64) string {
 	if dn == nil {
 		dn = ""
 	}
-	return fmt.Sprintf("[%s] client=%s dn=%s ip=%s server=%s sigtype=%s filename=%s key=%s rowid=%d",
+	var outcome string
+	if info.Attributes["sig.denied"] == true {
+		outcome = " DENIED"
+	} else if info.Attributes["sig.error"] != nil {
+		outcome = " FAILED"
+	}
+	return fmt.Sprintf("[%s]%s client=%s dn=%s ip=%s server=%s sigtype=%s filename=%s key=%s rowid=%d",
 		info.Attributes["sig.timestamp"],
+		outcome,
 		client,
 		dn,
 		ip,
@@ -0,0 +1,100 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package configcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+)
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration file",
+}
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the configuration for undefined tokens and missing files",
+	RunE:  checkCmd,
+}
+
+var ShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration with secrets redacted",
+	Long:  "Print the configuration as loaded, after merging included files and substituting environment variables. PINs, passwords and embedded private keys are replaced with ***.",
+	RunE:  showCmd,
+}
+
+var (
+	argJSON        bool
+	argShowSecrets bool
+)
+
+func init() {
+	shared.RootCmd.AddCommand(ConfigCmd)
+	ConfigCmd.AddCommand(CheckCmd)
+	ConfigCmd.AddCommand(ShowCmd)
+	ShowCmd.Flags().BoolVar(&argJSON, "json", false, "Print as JSON instead of YAML")
+	ShowCmd.Flags().BoolVar(&argShowSecrets, "unsafe-show-secrets", false, "Print secrets instead of redacting them. For local debugging only.")
+}
+
+func checkCmd(cmd *cobra.Command, args []string) error {
+	if err := shared.InitConfig(); err != nil {
+		return shared.Fail(err)
+	}
+	if err := shared.CurrentConfig.Validate(); err != nil {
+		return shared.Fail(fmt.Errorf("invalid configuration:\n%w", err))
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func showCmd(cmd *cobra.Command, args []string) error {
+	if err := shared.InitConfig(); err != nil {
+		return shared.Fail(err)
+	}
+	cfg := shared.CurrentConfig
+	if argShowSecrets {
+		fmt.Fprintln(os.Stderr, "WARNING: the output contains secrets")
+	} else {
+		cfg = cfg.Redacted()
+	}
+	blob, err := yaml.Marshal(cfg)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if argJSON {
+		// round-trip through YAML so the field names are the same
+		var doc any
+		if err := yaml.Unmarshal(blob, &doc); err != nil {
+			return shared.Fail(err)
+		}
+		blob, err = json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return shared.Fail(err)
+		}
+		blob = append(blob, '\n')
+	}
+	_, err = os.Stdout.Write(blob)
+	return err
+}
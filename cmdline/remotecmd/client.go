@@ -22,10 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -47,6 +49,7 @@ type ReaderGetter interface {
 type client struct {
 	config      *config.RemoteConfig
 	cli         *http.Client
+	tconf       *tls.Config
 	tokenSource oauth2.TokenSource
 }
 
@@ -78,13 +81,14 @@ func newClient() (*client, error) {
 	client := &client{
 		config: cfg,
 		cli:    &http.Client{Transport: transport},
+		tconf:  tconf,
 	}
 	if cfg.AccessToken != "" {
 		// static access token from environment
 		client.tokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.AccessToken})
 	}
 	if client.tokenSource == nil && tconf.GetClientCertificate == nil && !cfg.Interactive {
-		return nil, errors.New("remote.certfile and remote.keyfile must be set")
+		return nil, errors.New("remote.certfile and remote.keyfile, or remote.pkcs12file, must be set")
 	}
 	// in case of interactive auth, wait until we have metadata
 	return client, nil
@@ -206,6 +210,21 @@ func makeTLSConfig(cfg *config.RemoteConfig) (*tls.Config, error) {
 		return nil, err
 	}
 	x509tools.SetKeyLogFile(tconf)
+	if cfg.ServerPin != "" {
+		if err := pinServerCert(tconf, cfg.ServerPin); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Pkcs12File != "" {
+		tlscert, err := loadPkcs12(cfg)
+		if err != nil {
+			return nil, err
+		}
+		tconf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return tlscert, nil
+		}
+		return tconf, nil
+	}
 	if cfg.CertFile == "" && cfg.KeyFile == "" {
 		return tconf, nil
 	}
@@ -245,54 +264,128 @@ func makeTLSConfig(cfg *config.RemoteConfig) (*tls.Config, error) {
 	return tconf, nil
 }
 
-// Transact one request, trying multiple servers if necessary. Internal use only.
-func (cli *client) doRequest(bases []string, endpoint, method, encodings string, query *url.Values, bodyFile ReaderGetter) (response *http.Response, err error) {
-	minAttempts := shared.CurrentConfig.Remote.Retries
-	if len(bases) < minAttempts {
-		var repeated []string
-		for len(repeated) < minAttempts {
-			repeated = append(repeated, bases...)
+const (
+	defaultRetryDelay = time.Second
+	maxRetryDelay     = 30 * time.Second
+	maxRetryAfter     = 5 * time.Minute
+)
+
+// Transact one request, trying multiple servers if necessary. Connection
+// errors, 429 and 5xx responses are retried, and once every server has been
+// tried each further attempt is delayed with an exponential backoff. Internal
+// use only.
+func (cli *client) doRequest(bases []string, endpoint, method, encodings string, query *url.Values, bodyFile ReaderGetter) (*http.Response, error) {
+	attempts := cli.config.Retries
+	if attempts < len(bases) {
+		attempts = len(bases)
+	}
+	delay := defaultRetryDelay
+	if cli.config.RetryDelay > 0 {
+		delay = time.Duration(cli.config.RetryDelay * float64(time.Second))
+	}
+	var retryAfter time.Duration
+	for i := 0; i < attempts; i++ {
+		base := bases[i%len(bases)]
+		if i >= len(bases) {
+			// add jitter so that many clients don't all come back at once
+			wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+			fmt.Fprintf(os.Stderr, "retrying in %s (attempt %d of %d)\n", wait.Round(time.Millisecond), i+1, attempts)
+			time.Sleep(wait)
+			delay *= 2
+			if delay > maxRetryDelay {
+				delay = maxRetryDelay
+			}
+		}
+		var response *http.Response
+		var err error
+		response, retryAfter, encodings, err = cli.doOnce(base, endpoint, method, encodings, query, bodyFile)
+		if err == nil {
+			if i != 0 {
+				fmt.Fprintf(os.Stderr, "successfully contacted %s\n", base)
+			}
+			if err := compresshttp.DecompressResponse(response); err != nil {
+				return nil, err
+			}
+			return response, nil
+		} else if !retryable(err) {
+			return nil, err
+		} else if i+1 == attempts {
+			if attempts > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+			}
+			return nil, err
 		}
-		bases = repeated
+		fmt.Fprintf(os.Stderr, "%s\nrequest to %s failed\n", err, base)
 	}
+	panic("unreachable")
+}
 
-loop:
-	for i, base := range bases {
-		var request *http.Request
-		request, err = cli.buildRequest(base, endpoint, method, encodings, query, bodyFile)
+// Make a single attempt at a request against one server. If the server
+// doesn't accept the compressed request it is sent again uncompressed, and the
+// encodings to use for future attempts are returned.
+func (cli *client) doOnce(base, endpoint, method, encodings string, query *url.Values, bodyFile ReaderGetter) (*http.Response, time.Duration, string, error) {
+	for {
+		request, err := cli.buildRequest(base, endpoint, method, encodings, query, bodyFile)
 		if err != nil {
-			return nil, err
+			return nil, 0, encodings, err
 		}
-		response, err = cli.cli.Do(request)
+		response, err := cli.cli.Do(request)
 		if request.Body != nil {
 			request.Body.Close()
 		}
-		if err == nil {
-			if response.StatusCode < 300 {
-				if i != 0 {
-					fmt.Printf("successfully contacted %s\n", request.URL)
-				}
-				break loop
-			}
-			// HTTP error, probably a 503
-			err = httperror.FromResponse(response)
-		}
-		if response != nil && response.StatusCode == http.StatusNotAcceptable && encodings != "" {
+		if err != nil {
+			return nil, 0, encodings, explainTLSError(err)
+		} else if response.StatusCode < 300 {
+			return response, 0, encodings, nil
+		} else if response.StatusCode == http.StatusNotAcceptable && encodings != "" {
 			// try again without compression
+			response.Body.Close()
 			encodings = ""
-			goto loop
-		} else if httperror.Temporary(err) && i+1 < len(bases) {
-			fmt.Printf("%s\nunable to connect to %s; trying next server\n", err, request.URL)
-		} else {
-			return nil, err
-		}
-	}
-	if response != nil {
-		if err := compresshttp.DecompressResponse(response); err != nil {
-			return nil, err
+			continue
 		}
+		retryAfter := parseRetryAfter(response.Header.Get("Retry-After"))
+		return nil, retryAfter, encodings, explainAuthProblem(httperror.FromResponse(response), cli.tconf)
 	}
-	return
+}
+
+// Client errors are final, but server errors, connection failures and a busy
+// server might go away if retried
+func retryable(err error) bool {
+	var respErr httperror.ResponseError
+	var problem httperror.Problem
+	switch {
+	case errors.As(err, new(tlsAuthError)):
+		return false
+	case errors.As(err, &respErr):
+		return respErr.StatusCode >= 500 || respErr.StatusCode == http.StatusTooManyRequests
+	case errors.As(err, &problem):
+		return problem.Status >= 500 || problem.Status == http.StatusTooManyRequests
+	case errors.As(err, new(net.Error)):
+		return true
+	}
+	return httperror.Temporary(err)
+}
+
+// Parse a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = time.Until(t)
+	}
+	if d < 0 {
+		return 0
+	} else if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
 }
 
 func setDigestQueryParam(query url.Values) error {
@@ -41,6 +41,8 @@ func init() {
 type keyInfo struct {
 	X509Certificate string
 	PGPCertificate  string
+	// Default digest for the key, if it configures one
+	Hash string
 }
 
 func getKeyInfo(keyName string) (keyInfo, error) {
@@ -17,6 +17,7 @@
 package remotecmd
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"net/url"
@@ -26,18 +27,27 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
 var SignCmd = &cobra.Command{
 	Use:   "sign",
 	Short: "Sign a package using a remote signing server",
-	RunE:  signCmd,
+	Long: `Sign a package using a remote signing server.
+
+Most signature types upload the whole file to the server, streaming it rather
+than reading it into memory first. PE/COFF executables are instead digested
+locally and only the digest is uploaded, unless --upload-file is given. RPM,
+JAR, APPX, MSI and other container formats still require the upload because
+the server needs the package contents to build the signature.`,
+	RunE: signCmd,
 }
 
 var (
 	argIfUnsigned bool
 	argSigType    string
+	argUploadFile bool
 )
 
 func init() {
@@ -47,6 +57,7 @@ func init() {
 	SignCmd.Flags().StringVarP(&argOutput, "output", "o", "", "Output file. Defaults to same as --file.")
 	SignCmd.Flags().StringVarP(&argSigType, "sig-type", "T", "", "Specify signature type (default: auto-detect)")
 	SignCmd.Flags().BoolVar(&argIfUnsigned, "if-unsigned", false, "Skip signing if the file already has a signature")
+	SignCmd.Flags().BoolVar(&argUploadFile, "upload-file", false, "Upload the whole file even if the signature type can be signed from a local digest")
 	shared.AddDigestFlag(SignCmd)
 	shared.AddLateHook(func() {
 		signers.MergeFlags(SignCmd)
@@ -98,7 +109,8 @@ func signCmd(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 	// transform input if needed
-	hash, err := shared.GetDigest()
+	digestOnly := mod.DigestTransform != nil && !argUploadFile
+	hash, err := remoteDigest(digestOnly)
 	if err != nil {
 		return err
 	}
@@ -107,7 +119,25 @@ func signCmd(cmd *cobra.Command, args []string) (err error) {
 		Hash:  hash,
 		Flags: flags,
 	}
-	transform, err := mod.GetTransform(infile, opts)
+	// sign embedded files first
+	if mod.SignNested != nil {
+		nested, err := mod.SignNested(infile, opts, func(f *os.File, sigType string) error {
+			return signNested(flags, f, sigType)
+		})
+		if err != nil {
+			return shared.Fail(err)
+		} else if nested != nil {
+			defer os.Remove(nested.Name())
+			defer nested.Close()
+			infile = nested
+		}
+	}
+	var transform signers.Transformer
+	if digestOnly {
+		transform, err = mod.DigestTransform(infile, opts)
+	} else {
+		transform, err = mod.GetTransform(infile, opts)
+	}
 	if err != nil {
 		return shared.Fail(err)
 	}
@@ -119,7 +149,11 @@ func signCmd(cmd *cobra.Command, args []string) (err error) {
 	if err := flags.ToQuery(values); err != nil {
 		return shared.Fail(err)
 	}
-	if err := setDigestQueryParam(values); err != nil {
+	if digestOnly {
+		// the digest was already calculated so the server must use the same one
+		values.Add("digestonly", "1")
+		values.Add("digest", x509tools.HashNames[hash])
+	} else if err := setDigestQueryParam(values); err != nil {
 		return err
 	}
 	// do request
@@ -129,21 +163,79 @@ func signCmd(cmd *cobra.Command, args []string) (err error) {
 	}
 	defer response.Body.Close()
 	// apply the result
-	if err := transform.Apply(argOutput, response.Header.Get("Content-Type"), response.Body); err != nil {
-		return shared.Fail(err)
-	}
-	// if needed, do a final fixup step
-	if mod.Fixup != nil {
-		f, err := os.OpenFile(argOutput, os.O_RDWR, 0)
-		if err != nil {
-			return shared.Fail(err)
+	apply := func(output string) error {
+		if err := transform.Apply(output, response.Header.Get("Content-Type"), response.Body); err != nil {
+			return err
 		}
-		defer f.Close()
-		if err := mod.Fixup(f); err != nil {
-			return shared.Fail(err)
+		// if needed, do a final fixup step
+		if mod.Fixup != nil {
+			f, err := os.OpenFile(output, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return mod.Fixup(f)
 		}
+		return nil
+	}
+	if argOutput == "-" && !mod.StreamOutput {
+		err = shared.WriteToStdout(argFile, apply)
+	} else {
+		err = apply(argOutput)
+	}
+	if err != nil {
+		return shared.Fail(err)
 	}
 
 	fmt.Fprintf(os.Stderr, "Signed %s\n", argFile)
 	return nil
 }
+
+// signNested signs a file embedded in another one in-place, with the same key
+func signNested(outerFlags *signers.FlagValues, f *os.File, sigType string) error {
+	mod := signers.ByName(sigType)
+	if mod == nil {
+		return fmt.Errorf("no signer named %s", sigType)
+	}
+	flags := mod.FlagsFromValues(outerFlags)
+	transform, err := mod.GetTransform(f, signers.SignOpts{Path: f.Name(), Flags: flags})
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Add("key", argKeyName)
+	values.Add("filename", filepath.Base(argFile))
+	values.Add("sigtype", mod.Name)
+	if err := flags.ToQuery(values); err != nil {
+		return err
+	}
+	if err := setDigestQueryParam(values); err != nil {
+		return err
+	}
+	response, err := CallRemote("sign", "POST", &values, transform)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return transform.Apply(f.Name(), response.Header.Get("Content-Type"), response.Body)
+}
+
+// Pick the digest algorithm. If the digest is calculated locally then the
+// server can't apply the key's default, so ask it for the default instead.
+func remoteDigest(digestOnly bool) (crypto.Hash, error) {
+	if shared.ArgDigest != "" || !digestOnly {
+		return shared.GetDigest()
+	}
+	info, err := getKeyInfo(argKeyName)
+	if err != nil {
+		return 0, err
+	}
+	if info.Hash == "" {
+		return shared.GetDigest()
+	}
+	hash := x509tools.HashByName(info.Hash)
+	if hash == 0 {
+		return 0, fmt.Errorf("unsupported digest %q configured for key %s", info.Hash, argKeyName)
+	}
+	return hash, nil
+}
@@ -0,0 +1,153 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package remotecmd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/internal/httperror"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+)
+
+// tlsAuthError is returned when a connection fails because one side didn't
+// accept the other's certificate. Retrying won't help.
+type tlsAuthError struct {
+	Hint string
+	Err  error
+}
+
+func (e tlsAuthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Hint, e.Err)
+}
+
+func (e tlsAuthError) Unwrap() error {
+	return e.Err
+}
+
+func (tlsAuthError) ExitStatus() int {
+	return shared.ExitAuth
+}
+
+type serverPinError struct {
+	Fingerprint string
+}
+
+func (e serverPinError) Error() string {
+	return "server certificate fingerprint " + e.Fingerprint + " does not match remote.serverpin"
+}
+
+func (serverPinError) ExitStatus() int {
+	return shared.ExitAuth
+}
+
+// Load the client certificate and key from a PKCS#12 file
+func loadPkcs12(cfg *config.RemoteConfig) (*tls.Certificate, error) {
+	blob, err := os.ReadFile(cfg.Pkcs12File)
+	if err != nil {
+		return nil, fmt.Errorf("remote.pkcs12file: %w", err)
+	}
+	var cert *certloader.Certificate
+	if cfg.Pkcs12Password == "" {
+		cert, err = certloader.ParsePKCS12(blob, new(passprompt.PasswordPrompt))
+	} else {
+		password := cfg.Pkcs12Password
+		if getter, ok := passprompt.ParsePinSource(password); ok {
+			password, err = getter.GetPasswd("")
+			if err != nil {
+				return nil, fmt.Errorf("remote.pkcs12password: %w", err)
+			}
+		}
+		cert, err = certloader.ParsePKCS12Password(blob, password)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote.pkcs12file: %w", err)
+	}
+	tlscert := &tls.Certificate{PrivateKey: cert.PrivateKey, Leaf: cert.Leaf}
+	for _, c := range cert.Certificates {
+		tlscert.Certificate = append(tlscert.Certificate, c.Raw)
+	}
+	return tlscert, nil
+}
+
+// Require the server's leaf certificate to match a SHA-256 fingerprint, in
+// addition to the usual validation against the CA bundle
+func pinServerCert(tconf *tls.Config, pin string) error {
+	expected, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+	if err != nil || len(expected) != sha256.Size {
+		return errors.New("remote.serverpin must be the hex SHA-256 fingerprint of the server certificate")
+	}
+	tconf.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return serverPinError{}
+		}
+		digest := sha256.Sum256(state.PeerCertificates[0].Raw)
+		if subtle.ConstantTimeCompare(digest[:], expected) != 1 {
+			return serverPinError{Fingerprint: hex.EncodeToString(digest[:])}
+		}
+		return nil
+	}
+	return nil
+}
+
+// Translate certificate-related handshake failures into something that says
+// which side of the connection needs fixing
+func explainTLSError(err error) error {
+	var alert tls.AlertError
+	switch {
+	case errors.As(err, new(serverPinError)):
+		return tlsAuthError{Hint: "server certificate is not the pinned one; check remote.serverpin", Err: err}
+	case errors.As(err, new(*tls.CertificateVerificationError)):
+		return tlsAuthError{Hint: "unable to verify the server certificate; check remote.cacert", Err: err}
+	case errors.As(err, &alert):
+		// the alert numbers are from RFC 8446 section 6
+		switch alert {
+		case 42, 43, 44, 45, 46, 48, 116:
+			return tlsAuthError{Hint: "server rejected the client certificate; check remote.certfile and remote.keyfile or remote.pkcs12file", Err: err}
+		}
+	}
+	return err
+}
+
+// Add the client certificate's fingerprint to the server's complaint that it
+// doesn't know it, since that is what has to be added to the server config
+func explainAuthProblem(err error, tconf *tls.Config) error {
+	var problem httperror.Problem
+	if !errors.As(err, &problem) || problem.Type != httperror.ErrCertificateNotRecognized.Type || tconf.GetClientCertificate == nil {
+		return err
+	}
+	tlscert, _ := tconf.GetClientCertificate(nil)
+	if tlscert == nil || len(tlscert.Certificate) == 0 {
+		return err
+	}
+	leaf, parseErr := x509.ParseCertificate(tlscert.Certificate[0])
+	if parseErr != nil {
+		return err
+	}
+	digest := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	return fmt.Errorf("%w\nclient certificate fingerprint is %s; it must be listed in the server's clients configuration", err, strings.ToUpper(hex.EncodeToString(digest[:])))
+}
@@ -52,13 +52,16 @@ func MakeServer() (*daemon.Daemon, error) {
 	if shared.CurrentConfig.Server == nil {
 		return nil, errors.New("Missing server section in configuration file")
 	}
+	if err := shared.CurrentConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
 	if shared.CurrentConfig.Clients == nil {
 		return nil, errors.New("Missing clients section in configuration file")
 	}
 	if shared.CurrentConfig.Server.Listen == "" && shared.CurrentConfig.Server.ListenHTTP == "" {
 		shared.CurrentConfig.Server.Listen = ":6300"
 	}
-	if shared.CurrentConfig.Server.Listen != "" {
+	if shared.CurrentConfig.Server.Listen != "" || shared.CurrentConfig.Server.ListenGRPC != "" {
 		if shared.CurrentConfig.Server.KeyFile == "" {
 			return nil, errors.New("missing keyfile option in server configuration file")
 		}
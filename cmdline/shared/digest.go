@@ -30,17 +30,38 @@ var ArgDigest string
 const DefaultHash = "SHA-256"
 
 func AddDigestFlag(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&ArgDigest, "digest", DefaultHash, "Specify a digest algorithm")
+	cmd.Flags().StringVar(&ArgDigest, "digest", "", "Specify a digest algorithm (default: the key's configured digest, or "+DefaultHash+")")
 }
 
-func GetDigest() (hash crypto.Hash, err error) {
-	if ArgDigest == "" {
-		// TODO: figure out why this randomly started coming back blank
-		ArgDigest = DefaultHash
+// GetDigest returns the digest algorithm selected on the command line, or the
+// default if none was given
+func GetDigest() (crypto.Hash, error) {
+	return parseDigest(ArgDigest)
+}
+
+// GetKeyDigest is like GetDigest but falls back to the digest configured for
+// the named key
+func GetKeyDigest(keyName string) (crypto.Hash, error) {
+	if ArgDigest != "" {
+		return GetDigest()
+	}
+	if err := InitConfig(); err != nil {
+		return 0, err
+	}
+	keyConf, err := CurrentConfig.GetKey(keyName)
+	if err != nil {
+		return 0, err
+	}
+	return parseDigest(keyConf.Hash)
+}
+
+func parseDigest(name string) (hash crypto.Hash, err error) {
+	if name == "" {
+		name = DefaultHash
 	}
-	hash = x509tools.HashByName(ArgDigest)
+	hash = x509tools.HashByName(name)
 	if hash == 0 {
-		err = fmt.Errorf("unsupported digest \"%s\"", ArgDigest)
+		err = fmt.Errorf("unsupported digest \"%s\"", name)
 	}
 	return hash, err
 }
@@ -0,0 +1,92 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shared
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sassoftware/relic/v8/internal/httperror"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+// Exit statuses for failed commands. These are a stable interface for
+// scripts and follow sysexits.h where there is a matching code.
+const (
+	// ExitUsage is returned for bad command-line arguments
+	ExitUsage = 1
+	// ExitVerify is returned when a file does not verify or its signer is not
+	// trusted (EX_DATAERR)
+	ExitVerify = 65
+	// ExitUnavailable is returned when the server or token could not be
+	// reached or is too busy (EX_UNAVAILABLE)
+	ExitUnavailable = 69
+	// ExitFailure is returned for any other failure (EX_SOFTWARE)
+	ExitFailure = 70
+	// ExitAuth is returned when a PIN is wrong or locked, or the server
+	// refused the client's credentials (EX_NOPERM)
+	ExitAuth = 77
+	// ExitConfig is returned when a command names a token or key that is not
+	// defined in the configuration or does not exist in the token
+	// (EX_CONFIG)
+	ExitConfig = 78
+)
+
+// ExitStatuser can be implemented by errors that carry their own exit status
+type ExitStatuser interface {
+	ExitStatus() int
+}
+
+// exitStatus picks the exit status for a failed command, or returns fallback
+// if the error has no more specific status
+func exitStatus(err error, fallback int) int {
+	var statuser ExitStatuser
+	var respErr httperror.ResponseError
+	var problem httperror.Problem
+	switch {
+	case errors.As(err, &statuser):
+		return statuser.ExitStatus()
+	case errors.As(err, new(sigerrors.TokenNotFoundError)),
+		errors.As(err, new(sigerrors.KeyNotConfiguredError)),
+		errors.As(err, new(sigerrors.KeyNotFoundError)):
+		return ExitConfig
+	case errors.As(err, new(sigerrors.PinIncorrectError)),
+		errors.As(err, new(sigerrors.PinLockedError)):
+		return ExitAuth
+	case errors.As(err, &respErr):
+		return httpExitStatus(respErr.StatusCode, fallback)
+	case errors.As(err, &problem):
+		return httpExitStatus(problem.Status, fallback)
+	case errors.As(err, new(*net.OpError)),
+		errors.As(err, new(*net.DNSError)),
+		errors.Is(err, os.ErrDeadlineExceeded):
+		return ExitUnavailable
+	}
+	return fallback
+}
+
+func httpExitStatus(status, fallback int) int {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ExitAuth
+	case status == http.StatusTooManyRequests, status >= 500:
+		return ExitUnavailable
+	}
+	return fallback
+}
@@ -72,6 +72,6 @@ func Main() {
 	}
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitStatus(err, ExitUsage))
 	}
 }
@@ -0,0 +1,69 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteToStdout calls write with the path of a file in a new temporary
+// directory, then copies the result to standard output. Formats that patch the
+// input in place or otherwise need to seek in the output can't write to a pipe
+// directly so they are buffered here instead. It's an error for write to
+// produce more than one file, e.g. a signature next to the output.
+func WriteToStdout(input string, write func(output string) error) error {
+	dir, err := os.MkdirTemp("", "relic-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Base(input)
+	if input == "-" {
+		name = "stdin"
+	}
+	output := filepath.Join(dir, name)
+	if err := write(output); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var extra []string
+	for _, entry := range entries {
+		if entry.Name() != name {
+			extra = append(extra, entry.Name())
+		}
+	}
+	if len(extra) != 0 {
+		return fmt.Errorf("signing also produced %s, which can't be written to standard output", strings.Join(extra, ", "))
+	}
+	f, err := os.Open(output)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("signing did not produce an output file")
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
@@ -101,7 +101,7 @@ func OpenForPatching(inpath, outpath string) (*os.File, error) {
 func Fail(err error) error {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "ERROR:", err)
-		os.Exit(70)
+		os.Exit(exitStatus(err, ExitFailure))
 	}
 	return err
 }
@@ -0,0 +1,152 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var BenchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Measure how fast a key can sign",
+	Long: `Repeatedly sign a fixed digest with a key and report the throughput,
+latency percentiles and errors. Concurrent signers share the token's session
+pool, so set the token's "sessions" option to measure more than one at a time.`,
+	RunE: withTokens(benchmarkCmd),
+}
+
+var (
+	argBenchDuration    time.Duration
+	argBenchConcurrency int
+)
+
+func init() {
+	TokenCmd.AddCommand(BenchmarkCmd)
+	addKeyFlags(BenchmarkCmd)
+	BenchmarkCmd.Flags().DurationVar(&argBenchDuration, "duration", 10*time.Second, "How long to sign for")
+	BenchmarkCmd.Flags().IntVar(&argBenchConcurrency, "concurrency", 1, "Number of signatures to make at once")
+}
+
+type benchResult struct {
+	latencies []time.Duration
+	errors    int
+	lastErr   error
+}
+
+func benchmarkCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	if argBenchConcurrency < 1 || argBenchDuration <= 0 {
+		return errors.New("--concurrency and --duration must be positive")
+	}
+	tok, err := openTokenByKey(cmd.Context(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	key, err := tok.GetKey(context.Background(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	digest := sha256.Sum256([]byte("relic benchmark"))
+	var opts crypto.SignerOpts = crypto.SHA256
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		// Ed25519 signs the message itself
+		opts = crypto.Hash(0)
+	}
+	// make sure signing works at all before starting the clock
+	if _, err := key.SignContext(context.Background(), digest[:], opts); err != nil {
+		return shared.Fail(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), argBenchDuration)
+	defer cancel()
+	results := make([]benchResult, argBenchConcurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range results {
+		wg.Add(1)
+		go func(res *benchResult) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				t0 := time.Now()
+				_, err := key.SignContext(ctx, digest[:], opts)
+				if ctx.Err() != nil {
+					// interrupted by the deadline, don't count it
+					return
+				} else if err != nil {
+					res.errors++
+					res.lastErr = err
+					continue
+				}
+				res.latencies = append(res.latencies, time.Since(t0))
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	var all []time.Duration
+	var errCount int
+	var lastErr error
+	for _, res := range results {
+		all = append(all, res.latencies...)
+		errCount += res.errors
+		if res.lastErr != nil {
+			lastErr = res.lastErr
+		}
+	}
+	fmt.Printf("%d signatures in %s with concurrency %d: %.1f/sec\n",
+		len(all), elapsed.Round(time.Millisecond), argBenchConcurrency, float64(len(all))/elapsed.Seconds())
+	if len(all) != 0 {
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		fmt.Printf("latency: p50 %s  p90 %s  p99 %s  max %s\n",
+			percentile(all, 50), percentile(all, 90), percentile(all, 99), all[len(all)-1].Round(time.Microsecond))
+	}
+	if counter, ok := tok.(token.SessionCounter); ok {
+		stats := counter.SessionStats()
+		fmt.Printf("sessions: %d\n", stats.InUse+stats.Idle)
+	}
+	fmt.Printf("errors: %d\n", errCount)
+	if lastErr != nil {
+		fmt.Fprintln(os.Stderr, "last error:", lastErr)
+		tokensFrom(cmd.Context()).CloseAll()
+		os.Exit(1)
+	}
+	return nil
+}
+
+// percentile of a sorted list of durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Microsecond)
+}
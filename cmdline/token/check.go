@@ -0,0 +1,119 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that a key matches its configured certificates",
+	Long: `Open the token, load the key and the certificates configured for it, and
+confirm that the certificates belong to the key. Certificates that are expired
+or will expire soon are reported. Exits non-zero if anything is wrong, so it
+can be used as a preflight check before signing.`,
+	RunE: withTokens(checkCmd),
+}
+
+var argWarnDays int
+
+func init() {
+	TokenCmd.AddCommand(CheckCmd)
+	addKeyFlags(CheckCmd)
+	CheckCmd.Flags().IntVar(&argWarnDays, "warn-days", 30, "Warn if a certificate expires within N days")
+}
+
+func checkCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	tok, err := openTokenByKey(cmd.Context(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if d, ok := tok.(token.SlotDescriber); ok {
+		info := d.SlotInfo()
+		fmt.Printf("token: %s (serial %s, slot %d)\n", info.Label, info.Serial, info.ID)
+	}
+	key, err := tok.GetKey(cmd.Context(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	kconf := key.Config()
+	x509contents := key.Certificate()
+	if kconf.X509Certificate == "" && kconf.PgpCertificate == "" && len(x509contents) == 0 {
+		return shared.Fail(fmt.Errorf("key %q has no x509certificate or pgpcertificate configured and none is stored in the token", argKeyName))
+	}
+	cert, err := certloader.LoadTokenCertificates(key, kconf.X509Certificate, kconf.PgpCertificate, x509contents)
+	if err != nil {
+		source := "the token"
+		switch {
+		case kconf.X509Certificate != "" && kconf.PgpCertificate != "":
+			source = fmt.Sprintf("%s or %s", kconf.X509Certificate, kconf.PgpCertificate)
+		case kconf.X509Certificate != "":
+			source = kconf.X509Certificate
+		case kconf.PgpCertificate != "":
+			source = kconf.PgpCertificate
+		}
+		return shared.Fail(fmt.Errorf("key %q: checking certificate from %s: %w", argKeyName, source, err))
+	}
+	var problems int
+	now := time.Now()
+	soon := now.AddDate(0, 0, argWarnDays)
+	for i, c := range cert.Certificates {
+		what := "certificate"
+		if i != 0 {
+			what = "chain certificate"
+		}
+		fmt.Printf("%s: %s\n", what, x509tools.FormatSubject(c))
+		fmt.Printf("  fingerprint: %x\n", sha256.Sum256(c.Raw))
+		fmt.Printf("  valid: %s to %s\n", c.NotBefore.UTC().Format(time.RFC3339), c.NotAfter.UTC().Format(time.RFC3339))
+		switch {
+		case now.After(c.NotAfter):
+			fmt.Fprintf(os.Stderr, "ERROR: %s %s expired on %s\n", what, x509tools.FormatSubject(c), c.NotAfter.UTC().Format(time.RFC3339))
+			problems++
+		case now.Before(c.NotBefore):
+			fmt.Fprintf(os.Stderr, "ERROR: %s %s is not valid until %s\n", what, x509tools.FormatSubject(c), c.NotBefore.UTC().Format(time.RFC3339))
+			problems++
+		case soon.After(c.NotAfter):
+			fmt.Fprintf(os.Stderr, "WARNING: %s %s expires in %d days\n", what, x509tools.FormatSubject(c), int(c.NotAfter.Sub(now).Hours()/24))
+		}
+	}
+	if cert.PgpKey != nil {
+		fmt.Printf("pgp key: %X\n", cert.PgpKey.PrimaryKey.Fingerprint)
+		for name := range cert.PgpKey.Identities {
+			fmt.Printf("  uid: %s\n", name)
+		}
+	}
+	if problems != 0 {
+		return shared.Fail(fmt.Errorf("key %q: %d certificate problem(s) found", argKeyName, problems))
+	}
+	fmt.Println("OK")
+	return nil
+}
@@ -28,10 +28,9 @@ import (
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
 	"github.com/sassoftware/relic/v8/config"
-	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
 	"github.com/sassoftware/relic/v8/token"
-	"github.com/sassoftware/relic/v8/token/open"
 )
 
 var (
@@ -41,10 +40,12 @@ var (
 	argLabel     string
 	argRsaBits   uint
 	argEcdsaBits uint
+	argEd25519   bool
+	argCsrOut    string
+	argCsrCN     string
+	argKeyAttrs  []string
 )
 
-var tokenMap map[string]token.Token
-
 func addKeyFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Name of key section in config file to use")
 }
@@ -53,11 +54,16 @@ func addSelectOrGenerateFlags(cmd *cobra.Command) {
 	addKeyFlags(cmd)
 	cmd.Flags().StringVarP(&argToken, "token", "t", "", "Name of token to generate key in")
 	cmd.Flags().StringVarP(&argLabel, "label", "l", "", "Label to attach to generated key")
+	cmd.Flags().StringVar(&argId, "id", "", "Select an existing key by ID (hex, optionally colon-separated)")
 	cmd.Flags().UintVar(&argRsaBits, "generate-rsa", 0, "Generate a RSA key of the specified bit size, if needed")
-	cmd.Flags().UintVar(&argEcdsaBits, "generate-ecdsa", 0, "Generate an ECDSA key of the specified curve size, if needed")
+	cmd.Flags().UintVar(&argEcdsaBits, "generate-ecdsa", 0, "Generate an ECDSA key of the specified curve size (256, 384 or 521), if needed")
+	cmd.Flags().BoolVar(&argEd25519, "generate-ed25519", false, "Generate an Ed25519 key, if needed")
+	cmd.Flags().StringVar(&argCsrOut, "csr-out", "", "Write a certificate request for a newly generated key to this file, or - for stdout")
+	cmd.Flags().StringVar(&argCsrCN, "cn", "", "Subject commonName for the --csr-out request (default: from key config)")
+	cmd.Flags().StringArrayVar(&argKeyAttrs, "attribute", nil, "Set a PKCS#11 attribute on a newly generated key, e.g. extractable=false (may be repeated)")
 }
 
-// Update key config with values from --token and --label
+// Update key config with values from --token, --label and --id
 func newKeyConfig() (*config.KeyConfig, error) {
 	if err := shared.InitConfig(); err != nil {
 		return nil, err
@@ -70,8 +76,8 @@ func newKeyConfig() (*config.KeyConfig, error) {
 			return nil, err
 		}
 	} else {
-		if argToken == "" || argLabel == "" {
-			return nil, errors.New("Either --key, or --token and --label, must be set")
+		if argToken == "" || (argLabel == "" && argId == "") {
+			return nil, errors.New("Either --key, or --token and --label or --id, must be set")
 		}
 		argKeyName = fmt.Sprintf("new-key-%d", time.Now().UnixNano())
 		keyConf = shared.CurrentConfig.NewKey(argKeyName)
@@ -83,23 +89,32 @@ func newKeyConfig() (*config.KeyConfig, error) {
 		}
 		keyConf.SetToken(tokenConf)
 	}
+	// --label and --id each replace the configured selector, but if both are
+	// given then both must match
 	if argLabel != "" {
 		keyConf.Label = argLabel
-		keyConf.ID = ""
+		keyConf.ID = argId
+	}
+	if argId != "" {
+		keyConf.ID = argId
+		keyConf.Label = argLabel
 	}
 	return keyConf, nil
 }
 
-func selectOrGenerate() (key token.Key, err error) {
+func selectOrGenerate(ctx context.Context) (key token.Key, err error) {
 	keyConf, err := newKeyConfig()
 	if err != nil {
 		return nil, err
 	}
-	tok, err := openToken(keyConf.Token)
+	if err := applyKeyAttrs(keyConf.Token); err != nil {
+		return nil, err
+	}
+	tok, err := openToken(ctx, keyConf.Token)
 	if err != nil {
 		return nil, err
 	}
-	key, err = tok.GetKey(context.Background(), argKeyName)
+	key, err = tok.GetKey(ctx, argKeyName)
 	if err == nil {
 		fmt.Fprintln(os.Stderr, "Using existing key in token")
 		return key, nil
@@ -108,36 +123,79 @@ func selectOrGenerate() (key token.Key, err error) {
 	}
 	fmt.Fprintln(os.Stderr, "Generating a new key in token")
 	if argRsaBits != 0 {
-		return tok.Generate(argKeyName, token.KeyTypeRsa, argRsaBits)
+		key, err = tok.Generate(argKeyName, token.KeyTypeRsa, argRsaBits)
 	} else if argEcdsaBits != 0 {
-		return tok.Generate(argKeyName, token.KeyTypeEcdsa, argEcdsaBits)
+		key, err = tok.Generate(argKeyName, token.KeyTypeEcdsa, argEcdsaBits)
+	} else if argEd25519 {
+		key, err = tok.Generate(argKeyName, token.KeyTypeEd25519, 0)
 	} else {
-		return nil, errors.New("No matching key exists, specify --generate-rsa or --generate-ecdsa to generate one")
+		return nil, errors.New("No matching key exists, specify --generate-rsa, --generate-ecdsa or --generate-ed25519 to generate one")
+	}
+	if err != nil {
+		return nil, err
 	}
+	if ckaID := key.GetID(); len(ckaID) != 0 {
+		fmt.Fprintln(os.Stderr, "Generated key with CKA_ID:", x509tools.FormatKeyID(ckaID))
+	}
+	if argCsrOut != "" {
+		if err := writeCSR(key, keyConf); err != nil {
+			return nil, fmt.Errorf("writing certificate request: %w", err)
+		}
+	}
+	return key, nil
 }
 
-func openToken(tokenName string) (token.Token, error) {
-	tok, ok := tokenMap[tokenName]
-	if ok {
-		return tok, nil
+// Merge --attribute values into the token's keyattributes setting
+func applyKeyAttrs(tokenName string) error {
+	if len(argKeyAttrs) == 0 {
+		return nil
 	}
-	err := shared.InitConfig()
+	tokenConf, err := shared.CurrentConfig.GetToken(tokenName)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if tokenConf.Type != "pkcs11" {
+		return fmt.Errorf("--attribute is only supported for pkcs11 tokens, not %s", tokenConf.Type)
+	}
+	attrs := make(map[string]string, len(tokenConf.KeyAttributes)+len(argKeyAttrs))
+	for name, value := range tokenConf.KeyAttributes {
+		attrs[name] = value
+	}
+	for _, arg := range argKeyAttrs {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid --attribute %q: expected name=value", arg)
+		}
+		attrs[name] = value
+	}
+	tokenConf.KeyAttributes = attrs
+	return nil
+}
+
+// Write a certificate request for a newly generated key to --csr-out
+func writeCSR(key token.Key, keyConf *config.KeyConfig) error {
+	subject := token.SubjectFromConfig(keyConf)
+	if argCsrCN != "" {
+		subject.CommonName = argCsrCN
 	}
-	prompt := new(passprompt.PasswordPrompt)
-	tok, err = open.Token(shared.CurrentConfig, tokenName, prompt)
+	csr, err := token.GenerateCSR(key, subject)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if tokenMap == nil {
-		tokenMap = make(map[string]token.Token)
+	if argCsrOut == "-" {
+		_, err = os.Stdout.Write(csr)
+		return err
 	}
-	tokenMap[tokenName] = tok
-	return tok, nil
+	return os.WriteFile(argCsrOut, csr, 0644)
+}
+
+// openToken opens the named token, or returns it if the running command
+// already opened it
+func openToken(ctx context.Context, tokenName string) (token.Token, error) {
+	return tokensFrom(ctx).Open(tokenName)
 }
 
-func openTokenByKey(keyName string) (token.Token, error) {
+func openTokenByKey(ctx context.Context, keyName string) (token.Token, error) {
 	if keyName == "" {
 		return nil, errors.New("--key is a required parameter")
 	}
@@ -149,30 +207,13 @@ func openTokenByKey(keyName string) (token.Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	tok, err := openToken(keyConf.Token)
-	if err != nil {
-		return nil, err
-	}
-	return tok, nil
+	return openToken(ctx, keyConf.Token)
 }
 
-func openKey(keyName string) (token.Key, error) {
-	tok, err := openTokenByKey(keyName)
-	if err != nil {
-		return nil, err
-	}
-	key, err := tok.GetKey(context.Background(), keyName)
+func openKey(ctx context.Context, keyName string) (token.Key, error) {
+	tok, err := openTokenByKey(ctx, keyName)
 	if err != nil {
-		tok.Close()
 		return nil, err
 	}
-	return key, err
-}
-
-func formatKeyID(keyID []byte) string {
-	chunks := make([]string, len(keyID))
-	for i, j := range keyID {
-		chunks[i] = fmt.Sprintf("%02x", j)
-	}
-	return strings.Join(chunks, ":")
+	return tok.GetKey(ctx, keyName)
 }
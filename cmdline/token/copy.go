@@ -0,0 +1,145 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var CopyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy a key and its certificates to another token",
+	Long: `Copy a key and its certificates to another token.
+
+The private key is read out of the source token and imported into the
+destination, so it passes through this process. Keys marked sensitive are
+exported with C_WrapKey, which requires the key to be extractable. Keys that
+are not extractable can't be copied.`,
+	RunE: withTokens(copyCmd),
+}
+
+var argCopyFrom, argCopyTo string
+
+func init() {
+	TokenCmd.AddCommand(CopyCmd)
+	CopyCmd.Flags().StringVar(&argCopyFrom, "from", "", "Name of key section in config file to copy")
+	CopyCmd.Flags().StringVar(&argCopyTo, "to", "", "Name of token to copy the key to")
+	CopyCmd.Flags().StringVarP(&argLabel, "label", "l", "", "Label for the copied key (default: same as the source)")
+}
+
+func copyCmd(cmd *cobra.Command, args []string) error {
+	if argCopyFrom == "" || argCopyTo == "" {
+		return errors.New("--from and --to are required")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	srcConf, err := shared.CurrentConfig.GetKey(argCopyFrom)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	dstTokenConf, err := shared.CurrentConfig.GetToken(argCopyTo)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if srcConf.Token == dstTokenConf.Name() {
+		return errors.New("--to must name a different token than the one holding the key")
+	}
+	label := argLabel
+	if label == "" {
+		label = srcConf.Label
+	}
+	if label == "" {
+		return errors.New("--label is required because the source key has no label")
+	}
+	// export from source
+	srcTok, err := openToken(cmd.Context(), srcConf.Token)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	srcKey, err := srcTok.GetKey(context.Background(), argCopyFrom)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	exporter, ok := srcKey.(token.Exporter)
+	if !ok {
+		return shared.Fail(token.NotImplementedError{Op: "export", Type: srcTok.Config().Type})
+	}
+	privKey, err := exporter.Export()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	chain, err := sourceChain(srcKey)
+	if err != nil {
+		return shared.Fail(fmt.Errorf("reading certificates: %w", err))
+	}
+	// import into destination
+	dstName := fmt.Sprintf("new-key-%d", time.Now().UnixNano())
+	dstConf := shared.CurrentConfig.NewKey(dstName)
+	dstConf.SetToken(dstTokenConf)
+	dstConf.Label = label
+	dstTok, err := openToken(cmd.Context(), argCopyTo)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if _, err := dstTok.GetKey(context.Background(), dstName); err == nil {
+		return shared.Fail(fmt.Errorf("a key labelled %q already exists in token %s", label, argCopyTo))
+	} else if _, ok := err.(sigerrors.KeyNotFoundError); !ok {
+		return shared.Fail(err)
+	}
+	dstKey, err := dstTok.Import(dstName, privKey)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "Copied key to token %s with label %q\n", argCopyTo, label)
+	if ckaID := dstKey.GetID(); len(ckaID) != 0 {
+		fmt.Fprintln(os.Stderr, "Token CKA_ID: ", x509tools.FormatKeyID(ckaID))
+	}
+	if len(chain) == 0 {
+		fmt.Fprintln(os.Stderr, "No certificates are stored with the source key")
+		return nil
+	}
+	_, err = importCertificates(dstTok, dstKey, label, chain)
+	return shared.Fail(err)
+}
+
+// sourceChain returns the certificates stored alongside a key, leaf first
+func sourceChain(key token.Key) ([]*x509.Certificate, error) {
+	if reader, ok := key.(token.ChainReader); ok {
+		chain, err := reader.CertificateChain()
+		if errors.As(err, new(sigerrors.ErrNoCertificate)) {
+			return nil, nil
+		}
+		return chain, err
+	}
+	if blob := key.Certificate(); len(blob) != 0 {
+		return x509.ParseCertificates(blob)
+	}
+	return nil, nil
+}
@@ -0,0 +1,183 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var errDryRun = errors.New("dry run: signing skipped")
+
+// dryRunToken stands in for a real token during --dry-run. The key's public
+// half comes from the configured certificate, and signing records the digest
+// that would have been signed instead of touching the token.
+type dryRunToken struct {
+	key *dryRunKey
+}
+
+type dryRunKey struct {
+	keyConf *config.KeyConfig
+	pub     crypto.PublicKey
+
+	mu     sync.Mutex
+	digest []byte
+	hash   crypto.Hash
+}
+
+func newDryRunToken(keyName string) (*dryRunToken, error) {
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := certPublicKey(keyConf)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunToken{key: &dryRunKey{keyConf: keyConf, pub: pub}}, nil
+}
+
+// certPublicKey gets a key's public key from its configured certificate
+func certPublicKey(keyConf *config.KeyConfig) (crypto.PublicKey, error) {
+	switch {
+	case keyConf.X509Certificate != "":
+		blob, err := os.ReadFile(keyConf.X509Certificate)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return nil, err
+		}
+		return certs[0].PublicKey, nil
+	case keyConf.PgpCertificate != "":
+		f, err := os.Open(keyConf.PgpCertificate)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		keyring, err := openpgp.ReadArmoredKeyRing(f)
+		if err != nil {
+			if _, err := f.Seek(0, 0); err != nil {
+				return nil, err
+			}
+			keyring, err = openpgp.ReadKeyRing(f)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(keyring) != 1 {
+			return nil, fmt.Errorf("expected exactly 1 entity in pgp certificate %s", keyConf.PgpCertificate)
+		}
+		return keyring[0].PrimaryKey.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("key %q needs a x509certificate or pgpcertificate to use --dry-run", keyConf.Name())
+	}
+}
+
+func (t *dryRunToken) Close() error {
+	return nil
+}
+
+func (t *dryRunToken) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (t *dryRunToken) Config() *config.TokenConfig {
+	return nil
+}
+
+func (t *dryRunToken) ListKeys(opts token.ListOptions) error {
+	return token.NotImplementedError{Op: "list-keys", Type: "dry-run"}
+}
+
+func (t *dryRunToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: "dry-run"}
+}
+
+func (t *dryRunToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	return t.key, nil
+}
+
+func (t *dryRunToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: "dry-run"}
+}
+
+func (t *dryRunToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: "dry-run"}
+}
+
+func (t *dryRunToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: "dry-run"}
+}
+
+func (k *dryRunKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *dryRunKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+func (k *dryRunKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.digest == nil {
+		k.digest = append([]byte(nil), digest...)
+		k.hash = opts.HashFunc()
+	}
+	return nil, errDryRun
+}
+
+// result returns the first digest that was passed to Sign, if any
+func (k *dryRunKey) result() ([]byte, crypto.Hash) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.digest, k.hash
+}
+
+func (k *dryRunKey) Config() *config.KeyConfig {
+	return k.keyConf
+}
+
+func (k *dryRunKey) Certificate() []byte {
+	return nil
+}
+
+func (k *dryRunKey) GetID() []byte {
+	return nil
+}
+
+func (k *dryRunKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: "dry-run"}
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var ExportCertCmd = &cobra.Command{
+	Use:   "export-cert",
+	Short: "Print the certificate chain stored in the token for a key",
+	RunE:  withTokens(exportCertCmd),
+}
+
+var argCertOut string
+
+func init() {
+	TokenCmd.AddCommand(ExportCertCmd)
+	addKeyFlags(ExportCertCmd)
+	ExportCertCmd.Flags().StringVar(&argCertOut, "out", "-", "Write the PEM chain to this file instead of stdout")
+}
+
+func exportCertCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return err
+	}
+	tok, err := openToken(cmd.Context(), keyConf.Token)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	key, err := tok.GetKey(context.Background(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	reader, ok := key.(token.ChainReader)
+	if !ok {
+		return shared.Fail(token.NotImplementedError{Op: "export-cert", Type: tok.Config().Type})
+	}
+	chain, err := reader.CertificateChain()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if len(chain) == 1 {
+		fmt.Fprintln(os.Stderr, "warning: no issuer certificates were found in the token, only exporting the leaf")
+	}
+	var buf bytes.Buffer
+	for _, cert := range chain {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	if argCertOut == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(argCertOut, buf.Bytes(), 0644)
+	}
+	return shared.Fail(err)
+}
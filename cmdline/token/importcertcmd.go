@@ -0,0 +1,127 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var ImportCertCmd = &cobra.Command{
+	Use:   "import-cert",
+	Short: "Import a certificate chain for an existing key",
+	RunE:  withTokens(importCertCmd),
+}
+
+var argCertFile string
+
+func init() {
+	TokenCmd.AddCommand(ImportCertCmd)
+	addKeyFlags(ImportCertCmd)
+	ImportCertCmd.Flags().StringVar(&argCertFile, "cert", "", "Certificate chain to import: PEM, DER, or PKCS#7")
+}
+
+func importCertCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" || argCertFile == "" {
+		return errors.New("--key and --cert are required")
+	}
+	blob, err := os.ReadFile(argCertFile)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return err
+	}
+	tok, err := openToken(cmd.Context(), keyConf.Token)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	key, err := tok.GetKey(context.Background(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	imported, err := importCertificates(tok, key, keyConf.Label, certs)
+	if err != nil {
+		return shared.Fail(err)
+	} else if !imported {
+		return shared.Fail(errors.New("nothing imported"))
+	}
+	return nil
+}
+
+// importCertificates stores the leaf certificate alongside the key, with the
+// same CKA_ID, and any other certificates in the chain as separate objects.
+// The leaf is identified by matching it to the key's public key, and nothing
+// is written if no certificate matches.
+func importCertificates(tok token.Token, key token.Key, label string, certs []*x509.Certificate) (bool, error) {
+	var leaf *x509.Certificate
+	for _, cert := range certs {
+		if x509tools.SameKey(key.Public(), cert.PublicKey) {
+			leaf = cert
+			break
+		}
+	}
+	if leaf == nil {
+		return false, errors.New("none of the certificates match the key's public key")
+	}
+	var didSomething bool
+	name := x509tools.FormatSubject(leaf)
+	err := key.ImportCertificate(leaf)
+	if err == sigerrors.ErrExist {
+		fmt.Fprintln(os.Stderr, "Certificate already exists:", name)
+	} else if err != nil {
+		return false, fmt.Errorf("importing %s: %w", name, err)
+	} else {
+		fmt.Fprintln(os.Stderr, "Imported", name)
+		didSomething = true
+	}
+	for _, chain := range certs {
+		if chain == leaf {
+			continue
+		}
+		name = x509tools.FormatSubject(chain)
+		err = tok.ImportCertificate(chain, label)
+		if err == sigerrors.ErrExist {
+			fmt.Fprintln(os.Stderr, "Certificate already exists:", name)
+		} else if err != nil {
+			return didSomething, fmt.Errorf("importing %s: %w", name, err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Imported", name)
+			didSomething = true
+		}
+	}
+	return didSomething, nil
+}
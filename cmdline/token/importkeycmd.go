@@ -35,7 +35,7 @@ import (
 var ImportKeyCmd = &cobra.Command{
 	Use:   "import-key",
 	Short: "Import a private key to a token",
-	RunE:  importKeyCmd,
+	RunE:  withTokens(importKeyCmd),
 }
 
 var argPkcs12 bool
@@ -76,7 +76,7 @@ func importKeyCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	tok, err := openToken(keyConf.Token)
+	tok, err := openToken(cmd.Context(), keyConf.Token)
 	if err != nil {
 		return shared.Fail(err)
 	}
@@ -97,35 +97,15 @@ func importKeyCmd(cmd *cobra.Command, args []string) error {
 		didSomething = true
 	}
 	if cert.Leaf != nil {
-		name := x509tools.FormatSubject(cert.Leaf)
-		err := key.ImportCertificate(cert.Leaf)
-		if err == sigerrors.ErrExist {
-			fmt.Fprintln(os.Stderr, "Certificate already exists:", name)
-		} else if err != nil {
-			return shared.Fail(fmt.Errorf("importing %s: %w", name, err))
-		} else {
-			fmt.Fprintln(os.Stderr, "Imported", name)
-			didSomething = true
-		}
-		for _, chain := range cert.Chain() {
-			if chain == cert.Leaf {
-				continue
-			}
-			name = x509tools.FormatSubject(chain)
-			err = tok.ImportCertificate(chain, keyConf.Label)
-			if err == sigerrors.ErrExist {
-				fmt.Fprintln(os.Stderr, "Certificate already exists:", name)
-			} else if err != nil {
-				return shared.Fail(fmt.Errorf("importing %s: %w", name, err))
-			} else {
-				fmt.Fprintln(os.Stderr, "Imported", name)
-				didSomething = true
-			}
+		imported, err := importCertificates(tok, key, keyConf.Label, cert.Chain())
+		if err != nil {
+			return shared.Fail(err)
 		}
+		didSomething = didSomething || imported
 	}
 	if !didSomething {
 		return shared.Fail(errors.New("nothing imported"))
 	}
-	fmt.Fprintln(os.Stderr, "Token CKA_ID: ", formatKeyID(key.GetID()))
+	fmt.Fprintln(os.Stderr, "Token CKA_ID: ", x509tools.FormatKeyID(key.GetID()))
 	return nil
 }
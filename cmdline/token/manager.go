@@ -0,0 +1,234 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/token"
+	"github.com/sassoftware/relic/v8/token/open"
+)
+
+// tokenManager holds the tokens opened by one command so that each is opened
+// only once, even when several goroutines ask for it at the same time
+type tokenManager struct {
+	mu     sync.Mutex
+	tokens map[string]*managedToken
+	// tokens replaced by OpenFresh or evicted that are still open
+	retired []token.Token
+	// with --no-cache every Open makes a new connection
+	noCache bool
+	closed  bool
+}
+
+type managedToken struct {
+	// closed when the open attempt finishes
+	ready chan struct{}
+	tok   token.Token
+	err   error
+}
+
+type tokenManagerKey struct{}
+
+func newTokenManager() *tokenManager {
+	return &tokenManager{tokens: make(map[string]*managedToken)}
+}
+
+// withTokens wraps a command so that it has its own token manager in its
+// context, and every token it opened is closed when it returns
+func withTokens(run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		tokens := newTokenManager()
+		tokens.noCache = argNoCache
+		cmd.SetContext(context.WithValue(cmd.Context(), tokenManagerKey{}, tokens))
+		defer tokens.CloseAll()
+		return run(cmd, args)
+	}
+}
+
+// tokensFrom returns the token manager of the running command
+func tokensFrom(ctx context.Context) *tokenManager {
+	tokens, _ := ctx.Value(tokenManagerKey{}).(*tokenManager)
+	if tokens == nil {
+		panic("command does not have a token manager, wrap it with withTokens")
+	}
+	return tokens
+}
+
+// Get returns a token that was already opened, without waiting for one that
+// is still being opened
+func (m *tokenManager) Get(tokenName string) (token.Token, bool) {
+	m.mu.Lock()
+	mt := m.tokens[tokenName]
+	m.mu.Unlock()
+	if mt == nil {
+		return nil, false
+	}
+	select {
+	case <-mt.ready:
+		return mt.tok, mt.err == nil
+	default:
+		return nil, false
+	}
+}
+
+// Open returns the named token, opening it the first time it is asked for.
+// Callers that ask while it is being opened wait for that attempt and share
+// its result.
+func (m *tokenManager) Open(tokenName string) (token.Token, error) {
+	if m.noCache {
+		return m.OpenFresh(tokenName, false)
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("tokens were already closed")
+	}
+	mt := m.tokens[tokenName]
+	if mt == nil {
+		mt = &managedToken{ready: make(chan struct{})}
+		m.tokens[tokenName] = mt
+		m.mu.Unlock()
+		mt.tok, mt.err = openNamedToken(tokenName)
+		close(mt.ready)
+	} else {
+		m.mu.Unlock()
+		<-mt.ready
+	}
+	return mt.tok, mt.err
+}
+
+// OpenFresh opens a new connection to the named token, bypassing the cache,
+// and makes it the one that Open returns from then on. If evict is set then
+// the connection it replaces is closed, otherwise it is left open for anyone
+// still using it until CloseAll.
+func (m *tokenManager) OpenFresh(tokenName string, evict bool) (token.Token, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("tokens were already closed")
+	}
+	old := m.tokens[tokenName]
+	mt := &managedToken{ready: make(chan struct{})}
+	m.tokens[tokenName] = mt
+	m.mu.Unlock()
+	mt.tok, mt.err = openNamedToken(tokenName)
+	close(mt.ready)
+	if old != nil {
+		select {
+		case <-old.ready:
+			m.replaced(old, evict)
+		default:
+			// still opening, so wait for it in the background to close it
+			go func() {
+				<-old.ready
+				m.replaced(old, evict)
+			}()
+		}
+	}
+	return mt.tok, mt.err
+}
+
+// replaced disposes of a connection that OpenFresh superseded. It is closed if
+// evict is set or CloseAll already ran, otherwise it is retired until CloseAll.
+func (m *tokenManager) replaced(old *managedToken, evict bool) {
+	if old.tok == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if evict || m.closed {
+		old.tok.Close()
+	} else {
+		m.retired = append(m.retired, old.tok)
+	}
+}
+
+// Evict forgets a token that stopped working, so that the next Open makes a
+// new connection. Other goroutines may still be using it, so it is retired and
+// closed by CloseAll instead of now. Nothing happens if it was already evicted.
+func (m *tokenManager) Evict(tok token.Token) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, mt := range m.tokens {
+		select {
+		case <-mt.ready:
+		default:
+			continue
+		}
+		if mt.tok == tok {
+			delete(m.tokens, name)
+			m.retired = append(m.retired, tok)
+			return
+		}
+	}
+}
+
+// CloseAll closes every token that was opened, returning the first error. A
+// token that is still being opened, such as one that ping gave up waiting for,
+// is left alone.
+func (m *tokenManager) CloseAll() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	var firstErr error
+	for name, mt := range m.tokens {
+		select {
+		case <-mt.ready:
+		default:
+			continue
+		}
+		if mt.tok != nil {
+			if err := mt.tok.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		delete(m.tokens, name)
+	}
+	for _, tok := range m.retired {
+		if err := tok.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.retired = nil
+	return firstErr
+}
+
+func openNamedToken(tokenName string) (token.Token, error) {
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	var prompt passprompt.PasswordGetter = new(passprompt.PasswordPrompt)
+	if tokenConf, err := shared.CurrentConfig.GetToken(tokenName); err == nil {
+		if tokenConf.Pin != nil {
+			// PIN may refer to a file or command instead of being a literal value
+			if getter, ok := passprompt.ParsePinSource(*tokenConf.Pin); ok {
+				prompt = getter
+			}
+		}
+		if argKeyring {
+			tokenConf.UseKeyring = true
+		}
+	}
+	return open.Token(shared.CurrentConfig, tokenName, prompt)
+}
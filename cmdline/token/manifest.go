@@ -0,0 +1,124 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+)
+
+// signManifest lists files to sign in one run of "relic sign --manifest"
+type signManifest struct {
+	Files []manifestEntry `yaml:"files"`
+}
+
+type manifestEntry struct {
+	Input  string `yaml:"input"`  // File to sign, relative to the manifest
+	Output string `yaml:"output"` // Where to write the result, defaults to signing the input in place
+	Key    string `yaml:"key"`    // Name of key section in config file to use
+	Type   string `yaml:"type"`   // Signature type, auto-detected if empty
+}
+
+// loadManifest parses a manifest and checks every entry before anything is
+// signed, then opens the tokens for all of the keys it uses
+func loadManifest(cmd *cobra.Command, path string) ([]signJob, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest signManifest
+	dec := yaml.NewDecoder(bytes.NewReader(blob))
+	dec.KnownFields(true)
+	if err := dec.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	} else if len(manifest.Files) == 0 {
+		return nil, fmt.Errorf("%s: no files listed", path)
+	}
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	base := filepath.Dir(path)
+	var problems []string
+	jobs := make([]signJob, len(manifest.Files))
+	outputs := make(map[string]int)
+	for i, entry := range manifest.Files {
+		job, err := manifestJob(cmd, base, entry)
+		if err == nil {
+			if j, ok := outputs[job.output]; ok {
+				err = fmt.Errorf("same output as entry %d", j+1)
+			}
+			outputs[job.output] = i
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d (%s): %s", i+1, entry.Input, err))
+		}
+		jobs[i] = job
+	}
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("%s: %d invalid entries:\n  %s", path, len(problems), strings.Join(problems, "\n  "))
+	}
+	if !argDryRun {
+		for i := range jobs {
+			jobs[i].tok, err = openTokenByKey(cmd.Context(), jobs[i].keyName)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", jobs[i].keyName, err)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+func manifestJob(cmd *cobra.Command, base string, entry manifestEntry) (signJob, error) {
+	if entry.Input == "" || entry.Key == "" {
+		return signJob{}, errors.New("input and key are required")
+	}
+	job := signJob{
+		input:   resolvePath(base, entry.Input),
+		output:  resolvePath(base, entry.Output),
+		keyName: entry.Key,
+		sigType: entry.Type,
+	}
+	if entry.Output == "" {
+		job.output = job.input
+	}
+	if _, err := shared.CurrentConfig.GetKey(entry.Key); err != nil {
+		return job, err
+	}
+	var err error
+	job.hash, err = shared.GetKeyDigest(entry.Key)
+	if err != nil {
+		return job, err
+	}
+	_, _, err = checkJob(cmd, job)
+	return job, err
+}
+
+func resolvePath(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
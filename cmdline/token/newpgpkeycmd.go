@@ -32,13 +32,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/token"
 )
 
 var NewPgpKeyCmd = &cobra.Command{
 	Use:   "pgp-generate",
 	Short: "Generate a new PGP key from token",
-	RunE:  newPgpKeyCmd,
+	RunE:  withTokens(newPgpKeyCmd),
 }
 
 var (
@@ -113,7 +114,7 @@ func newPgpKeyCmd(cmd *cobra.Command, args []string) error {
 	if uid == nil {
 		return errors.New("Invalid user ID")
 	}
-	key, err := selectOrGenerate()
+	key, err := selectOrGenerate(cmd.Context())
 	if err != nil {
 		return err
 	}
@@ -122,7 +123,7 @@ func newPgpKeyCmd(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	fingerprint := hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])
-	fmt.Fprintln(os.Stderr, "Token CKA_ID: ", formatKeyID(key.GetID()))
+	fmt.Fprintln(os.Stderr, "Token CKA_ID: ", x509tools.FormatKeyID(key.GetID()))
 	fmt.Fprintln(os.Stderr, "PGP ID:       ", strings.ToUpper(fingerprint))
 	writer, err := armor.Encode(os.Stdout, openpgp.PublicKeyType, nil)
 	if err != nil {
@@ -18,33 +18,107 @@ package token
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
 )
 
+var (
+	argOpenTimeout int
+	argPingTokens  []string
+)
+
 var PingCmd = &cobra.Command{
 	Use:   "ping",
 	Short: "Check whether a token is working",
-	RunE:  pingCmd,
+	Long: `Open each token and check that it is still logged in, printing how long
+the check took. Exits non-zero if any token fails or doesn't answer within
+--timeout.`,
+	RunE: withTokens(pingCmd),
+}
+
+// the original top-level spelling, "relic ping"
+var pingCompatCmd = &cobra.Command{
+	Use:    "ping",
+	Short:  PingCmd.Short,
+	Hidden: true,
+	RunE:   withTokens(pingCmd),
 }
 
 func init() {
-	shared.RootCmd.AddCommand(PingCmd)
-	PingCmd.Flags().StringVarP(&argToken, "token", "t", "", "Name of token section in config file to use")
+	TokenCmd.AddCommand(PingCmd)
+	shared.RootCmd.AddCommand(pingCompatCmd)
+	for _, cmd := range []*cobra.Command{PingCmd, pingCompatCmd} {
+		cmd.Flags().StringArrayVarP(&argPingTokens, "token", "t", nil, "Name of token section in config file to use. May be given more than once.")
+		cmd.Flags().IntVar(&argOpenTimeout, "timeout", 0, "Give up if opening or checking the token takes more than N seconds")
+	}
 }
 
 func pingCmd(cmd *cobra.Command, args []string) error {
-	token, err := openToken(argToken)
-	if err != nil {
-		return shared.Fail(err)
+	if len(argPingTokens) == 0 {
+		return errors.New("--token is required")
 	}
-	if err := token.Ping(context.Background()); err != nil {
+	if err := shared.InitConfig(); err != nil {
 		return shared.Fail(err)
-	} else {
-		fmt.Println("OK")
+	}
+	failed := false
+	for _, tokenName := range argPingTokens {
+		latency, err := pingToken(cmd.Context(), tokenName)
+		if err != nil {
+			fmt.Printf("%s: ERROR: %s\n", tokenName, err)
+			failed = true
+		} else {
+			fmt.Printf("%s: OK %s\n", tokenName, latency.Round(time.Microsecond))
+		}
+	}
+	if failed {
+		tokensFrom(cmd.Context()).CloseAll()
+		os.Exit(1)
 	}
 	return nil
 }
+
+// Open a token if needed and ping it, returning how long the ping took.
+// Calls into the token can't always be interrupted, so if --timeout is
+// reached the attempt is left running in the background.
+func pingToken(ctx context.Context, tokenName string) (time.Duration, error) {
+	tokenConf, err := shared.CurrentConfig.GetToken(tokenName)
+	if err != nil {
+		return 0, err
+	}
+	var timeout <-chan time.Time
+	if argOpenTimeout != 0 {
+		tokenConf.OpenTimeout = argOpenTimeout
+		d := time.Duration(argOpenTimeout) * time.Second
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+		timeout = time.After(d)
+	}
+	type result struct {
+		latency time.Duration
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		tok, err := openToken(ctx, tokenName)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		start := time.Now()
+		err = tok.Ping(ctx)
+		done <- result{time.Since(start), err}
+	}()
+	select {
+	case res := <-done:
+		return res.latency, res.err
+	case <-timeout:
+		return 0, fmt.Errorf("no response within %d seconds", argOpenTimeout)
+	}
+}
@@ -0,0 +1,321 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var RotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace a key with a new one, keeping the old one for verification",
+	Long: `Replace a key with a new one, keeping the old one for verification.
+
+Rotation takes two steps. The first generates a new key in the same token,
+writes a certificate request for it, and adds it to the configuration as
+NAME-next:
+
+  relic token rotate --key NAME --generate-rsa 3072 --csr-out NAME.csr
+
+Once the certificate has been issued, the second step installs it:
+
+  relic token rotate --key NAME --cert NAME.crt --grace-days 30
+
+NAME then refers to the new key, so sign commands and server clients pick it up
+without changes. The old key stays in the configuration as NAME-YYYYMMDD,
+marked deprecated so that it can no longer sign. "relic verify --key NAME"
+accepts signatures from both until the grace period ends.
+
+The configuration file that defines the key is rewritten in place. Comments
+are kept but the file is otherwise reformatted.`,
+	RunE: withTokens(rotateCmd),
+}
+
+var argGraceDays uint
+
+func init() {
+	TokenCmd.AddCommand(RotateCmd)
+	addKeyFlags(RotateCmd)
+	RotateCmd.Flags().StringVarP(&argLabel, "label", "l", "", "Label for the new key (default: the old label with today's date appended)")
+	RotateCmd.Flags().UintVar(&argRsaBits, "generate-rsa", 0, "Generate a RSA key of the specified bit size")
+	RotateCmd.Flags().UintVar(&argEcdsaBits, "generate-ecdsa", 0, "Generate an ECDSA key of the specified curve size (256, 384 or 521)")
+	RotateCmd.Flags().BoolVar(&argEd25519, "generate-ed25519", false, "Generate an Ed25519 key")
+	RotateCmd.Flags().StringVar(&argCsrOut, "csr-out", "-", "Write the certificate request for the new key to this file, or - for stdout")
+	RotateCmd.Flags().StringVar(&argCsrCN, "cn", "", "Subject commonName for the certificate request (default: from key config)")
+	RotateCmd.Flags().StringVar(&argCertFile, "cert", "", "Install this certificate for the new key and retire the old one")
+	RotateCmd.Flags().UintVar(&argGraceDays, "grace-days", 30, "Number of days to keep accepting signatures from the old key, or 0 for no limit")
+}
+
+func rotateCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if keyConf.Alias != "" {
+		return fmt.Errorf("key %s is an alias, rotate %s instead", argKeyName, keyConf.Alias)
+	} else if keyConf.Deprecated {
+		return fmt.Errorf("key %s was already rotated out", argKeyName)
+	}
+	if argCertFile != "" {
+		return shared.Fail(installRotatedKey(cmd.Context(), keyConf))
+	}
+	return shared.Fail(generateRotatedKey(cmd.Context(), keyConf))
+}
+
+// generateRotatedKey makes the new key and adds it to the configuration as
+// NAME-next
+func generateRotatedKey(ctx context.Context, keyConf *config.KeyConfig) error {
+	nextName := keyConf.Name() + "-next"
+	if _, err := shared.CurrentConfig.GetKey(nextName); err == nil {
+		return fmt.Errorf("key %s is already defined; finish the rotation with --cert, or remove it to start over", nextName)
+	}
+	var keyType token.KeyType
+	var bits uint
+	switch {
+	case argRsaBits != 0:
+		keyType, bits = token.KeyTypeRsa, argRsaBits
+	case argEcdsaBits != 0:
+		keyType, bits = token.KeyTypeEcdsa, argEcdsaBits
+	case argEd25519:
+		keyType = token.KeyTypeEd25519
+	default:
+		return errors.New("specify --generate-rsa, --generate-ecdsa or --generate-ed25519")
+	}
+	label := argLabel
+	if label == "" {
+		base := keyConf.Label
+		if base == "" {
+			base = keyConf.Name()
+		}
+		label = base + "-" + time.Now().Format("20060102")
+	}
+	tokenConf, err := shared.CurrentConfig.GetToken(keyConf.Token)
+	if err != nil {
+		return err
+	}
+	nextConf := shared.CurrentConfig.NewKey(nextName)
+	nextConf.SetToken(tokenConf)
+	nextConf.Label = label
+	tok, err := openToken(ctx, keyConf.Token)
+	if err != nil {
+		return err
+	}
+	subject, err := rotatedSubject(ctx, tok, keyConf)
+	if err != nil {
+		return err
+	}
+	if _, err := tok.GetKey(ctx, nextName); err == nil {
+		return fmt.Errorf("a key labelled %q already exists in token %s", label, keyConf.Token)
+	} else if _, ok := err.(sigerrors.KeyNotFoundError); !ok {
+		return err
+	}
+	key, err := tok.Generate(nextName, keyType, bits)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Generated key in token %s with label %q\n", keyConf.Token, label)
+	settings := map[string]any{"token": keyConf.Token, "label": label}
+	if ckaID := key.GetID(); len(ckaID) != 0 {
+		fmt.Fprintln(os.Stderr, "Token CKA_ID: ", x509tools.FormatKeyID(ckaID))
+		// select by ID only if the old key was
+		if keyConf.ID != "" {
+			settings["id"] = x509tools.FormatKeyID(ckaID)
+		}
+	}
+	path, err := shared.CurrentConfig.EditKeys([]config.KeyChange{{Name: nextName, Set: settings}})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added key %s to %s\n", nextName, path)
+	csr, err := token.GenerateCSR(key, subject)
+	if err != nil {
+		return fmt.Errorf("writing certificate request: %w", err)
+	}
+	if argCsrOut == "-" {
+		_, err = os.Stdout.Write(csr)
+		return err
+	}
+	return os.WriteFile(argCsrOut, csr, 0644)
+}
+
+// rotatedSubject picks the subject for the new key's certificate request:
+// --cn, or the key config, or else the old key's certificate
+func rotatedSubject(ctx context.Context, tok token.Token, keyConf *config.KeyConfig) (pkix.Name, error) {
+	subject := token.SubjectFromConfig(keyConf)
+	if argCsrCN != "" {
+		subject.CommonName = argCsrCN
+	}
+	if subject.CommonName != "" {
+		return subject, nil
+	}
+	var chain []*x509.Certificate
+	if keyConf.X509Certificate != "" {
+		blob, err := os.ReadFile(keyConf.X509Certificate)
+		if err != nil {
+			return subject, err
+		}
+		chain, err = certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return subject, err
+		}
+	} else {
+		key, err := tok.GetKey(ctx, keyConf.Name())
+		if err != nil {
+			return subject, err
+		}
+		chain, err = sourceChain(key)
+		if err != nil {
+			return subject, err
+		}
+	}
+	if len(chain) == 0 {
+		return subject, errors.New("--cn is required because the key has no commonname setting or certificate")
+	}
+	return chain[0].Subject, nil
+}
+
+// installRotatedKey points the key at NAME-next and its new certificate, and
+// keeps the old key as a deprecated entry
+func installRotatedKey(ctx context.Context, keyConf *config.KeyConfig) error {
+	keyName := keyConf.Name()
+	nextName := keyName + "-next"
+	nextConf, err := shared.CurrentConfig.GetKey(nextName)
+	if err != nil {
+		return fmt.Errorf("%w: run without --cert first to generate the new key", err)
+	}
+	now := time.Now()
+	oldName := keyName + "-" + now.Format("20060102")
+	if _, err := shared.CurrentConfig.GetKey(oldName); err == nil {
+		return fmt.Errorf("key %s is already defined", oldName)
+	}
+	blob, err := os.ReadFile(argCertFile)
+	if err != nil {
+		return err
+	}
+	certs, err := certloader.ParseX509Certificates(blob)
+	if err != nil {
+		return err
+	}
+	tok, err := openToken(ctx, nextConf.Token)
+	if err != nil {
+		return err
+	}
+	key, err := tok.GetKey(ctx, nextName)
+	if err != nil {
+		return err
+	}
+	var leaf *x509.Certificate
+	for _, cert := range certs {
+		if x509tools.SameKey(key.Public(), cert.PublicKey) {
+			leaf = cert
+			break
+		}
+	}
+	if leaf == nil {
+		return fmt.Errorf("none of the certificates in %s match key %s", argCertFile, nextName)
+	}
+	// the old location moves to a new entry, along with its certificates
+	deprecated := map[string]any{
+		"token":      keyConf.Token,
+		"deprecated": true,
+		"replacedby": keyName,
+	}
+	for name, value := range map[string]string{
+		"label":           keyConf.Label,
+		"id":              keyConf.ID,
+		"keyfile":         keyConf.KeyFile,
+		"x509certificate": keyConf.X509Certificate,
+		"pgpcertificate":  keyConf.PgpCertificate,
+	} {
+		if value != "" {
+			deprecated[name] = value
+		}
+	}
+	if len(keyConf.ExtraCerts) != 0 {
+		deprecated["extracerts"] = keyConf.ExtraCerts
+	}
+	if argGraceDays != 0 {
+		deprecated["retireafter"] = now.AddDate(0, 0, int(argGraceDays)).Format("2006-01-02")
+	}
+	current := map[string]any{
+		"label":          nextConf.Label,
+		"id":             nil,
+		"keyfile":        nil,
+		"pgpcertificate": nil,
+	}
+	if nextConf.ID != "" {
+		current["id"] = nextConf.ID
+	}
+	// store the certificate the same way the old key did, falling back to
+	// the file if the token can't hold certificates
+	certPath := ""
+	if keyConf.X509Certificate == "" {
+		if _, err := importCertificates(tok, key, nextConf.Label, certs); errors.As(err, new(token.NotImplementedError)) {
+			certPath = argCertFile
+		} else if err != nil {
+			return err
+		}
+	} else {
+		certPath = argCertFile
+	}
+	if certPath != "" {
+		certPath, err = filepath.Abs(certPath)
+		if err != nil {
+			return err
+		}
+		current["x509certificate"] = certPath
+		fmt.Fprintln(os.Stderr, "Using certificate", x509tools.FormatSubject(leaf))
+	}
+	path, err := shared.CurrentConfig.EditKeys([]config.KeyChange{
+		{Name: oldName, Set: deprecated},
+		{Name: keyName, Set: current},
+		{Name: nextName, Remove: true},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Key %s now uses the new key, and the old one is kept as %s in %s\n", keyName, oldName, path)
+	if retire, ok := deprecated["retireafter"]; ok {
+		fmt.Fprintf(os.Stderr, "Signatures from %s are accepted by \"relic verify --key %s\" until %s\n", oldName, keyName, retire)
+	}
+	if keyConf.PgpCertificate != "" {
+		fmt.Fprintf(os.Stderr, "Key %s had a PGP certificate, create a new one with \"relic token pgp-generate\"\n", keyName)
+	}
+	return nil
+}
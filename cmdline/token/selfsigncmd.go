@@ -0,0 +1,100 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+var TokenSelfSignCmd = &cobra.Command{
+	Use:   "self-sign",
+	Short: "Create a self-signed X509 certificate for a token key and store it in the token",
+	Long: `Create a self-signed X509 certificate for a token key and store it in the token
+
+The key is generated first if it doesn't exist and one of the --generate
+options is given. The certificate is imported next to the key, with the same
+CKA_ID, and also written to stdout.`,
+	RunE: withTokens(tokenSelfSignCmd),
+}
+
+var (
+	argDays      uint
+	argUsage     string
+	argAuthority bool
+)
+
+func init() {
+	TokenCmd.AddCommand(TokenSelfSignCmd)
+	addSelectOrGenerateFlags(TokenSelfSignCmd)
+	x509tools.AddRequestFlags(TokenSelfSignCmd)
+	TokenSelfSignCmd.Flags().Lookup("cn").Usage = "Subject commonName (same as --commonName)"
+	// like x509-self-sign, but with defaults suited to a code signing key
+	TokenSelfSignCmd.Flags().UintVar(&argDays, "days", 365, "Number of days before certificate expires")
+	TokenSelfSignCmd.Flags().StringVarP(&argUsage, "key-usage", "U", "codeSigning", "Key usage, one of: serverAuth clientAuth codeSigning emailProtection keyCertSign")
+	TokenSelfSignCmd.Flags().BoolVar(&argAuthority, "cert-authority", false, "Mark the certificate as a CA in its basic constraints")
+	TokenSelfSignCmd.Flags().StringVar(&x509tools.ArgSerial, "serial", "", "Set the serial number of the certificate. Random if not specified.")
+}
+
+func tokenSelfSignCmd(cmd *cobra.Command, args []string) error {
+	// --cn and --commonName mean the same thing here
+	if x509tools.ArgCommonName == "" {
+		x509tools.ArgCommonName = argCsrCN
+	}
+	if x509tools.ArgCommonName == "" {
+		return errors.New("--cn is required")
+	}
+	if argCsrOut != "" {
+		return errors.New("--csr-out can't be used with self-sign")
+	}
+	x509tools.ArgExpireDays = argDays
+	x509tools.ArgKeyUsage = argUsage
+	x509tools.ArgCertAuthority = argAuthority
+	key, err := selectOrGenerate(cmd.Context())
+	if err != nil {
+		return shared.Fail(err)
+	}
+	certPEM, err := x509tools.MakeCertificate(rand.Reader, key)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	certs, err := certloader.ParseX509Certificates([]byte(certPEM))
+	if err != nil {
+		return shared.Fail(err)
+	}
+	// write it out first so it isn't lost if the token won't store it
+	os.Stdout.WriteString(certPEM)
+	tok, err := openToken(cmd.Context(), key.Config().Token)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	if _, err := importCertificates(tok, key, key.Config().Label, certs); err != nil {
+		return shared.Fail(err)
+	}
+	if ckaID := key.GetID(); len(ckaID) != 0 {
+		fmt.Fprintln(os.Stderr, "CKA_ID:", x509tools.FormatKeyID(ckaID))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/token/open"
+)
+
+var SetPinCmd = &cobra.Command{
+	Use:   "set-pin",
+	Short: "Change the PIN of a token",
+	RunE:  withTokens(setPinCmd),
+}
+
+var argSO bool
+
+func init() {
+	TokenCmd.AddCommand(SetPinCmd)
+	SetPinCmd.Flags().BoolVar(&argSO, "so", false, "Change the security officer PIN instead of the user PIN")
+}
+
+func setPinCmd(cmd *cobra.Command, args []string) error {
+	if argToken == "" {
+		return errors.New("--token is required")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	who := "user"
+	if argSO {
+		who = "SO"
+	}
+	prompt := new(passprompt.PasswordPrompt)
+	oldPin, err := prompt.GetPasswd(fmt.Sprintf("Current %s PIN for token %s: ", who, argToken))
+	if err != nil {
+		return shared.Fail(err)
+	} else if oldPin == "" {
+		return shared.Fail(errors.New("aborted"))
+	}
+	newPin, err := prompt.GetPasswd(fmt.Sprintf("New %s PIN: ", who))
+	if err != nil {
+		return shared.Fail(err)
+	} else if newPin == "" {
+		return shared.Fail(errors.New("aborted"))
+	}
+	confirm, err := prompt.GetPasswd(fmt.Sprintf("Confirm new %s PIN: ", who))
+	if err != nil {
+		return shared.Fail(err)
+	} else if confirm != newPin {
+		return shared.Fail(errors.New("PINs do not match"))
+	}
+	if err := open.SetPIN(shared.CurrentConfig, argToken, argSO, oldPin, newPin); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Printf("%s PIN changed for token %s\n", who, argToken)
+	return nil
+}
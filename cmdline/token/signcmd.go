@@ -19,29 +19,65 @@ package token
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
 	"github.com/sassoftware/relic/v8/internal/signinit"
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
 	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/token"
 )
 
 var SignCmd = &cobra.Command{
-	Use:   "sign",
+	Use:   "sign [flags] [file or glob...]",
 	Short: "Sign a package using a token",
-	RunE:  signCmd,
+	Long: `Sign a package using a token.
+
+With --manifest, sign every file listed in a YAML file, each with its own key
+and output. Relative paths are resolved from the directory holding the
+manifest. Every entry is checked before anything is signed, and tokens are
+opened once and shared between the entries that use them:
+
+  files:
+    - input: dist/setup.exe
+      key: authenticode
+    - input: dist/app.rpm
+      output: signed/app.rpm
+      key: rpmkey
+      type: rpm`,
+	RunE: withTokens(signCmd),
 }
 
 var (
 	argIfUnsigned bool
 	argSigType    string
 	argOutput     string
+	argJobs       int
+	argFailFast   bool
+	argDryRun     bool
+	argManifest   string
+	argInPlace    bool
 )
 
+// returned by signFileTo when --if-unsigned skips a file
+var errAlreadySigned = errors.New("already signed")
+
+// signJob is one file to sign and the key and options to sign it with
+type signJob struct {
+	input, output string
+	keyName       string
+	sigType       string
+	tok           token.Token
+	hash          crypto.Hash
+}
+
 func init() {
 	shared.RootCmd.AddCommand(SignCmd)
 	addKeyFlags(SignCmd)
@@ -49,6 +85,11 @@ func init() {
 	SignCmd.Flags().StringVarP(&argOutput, "output", "o", "", "Output file")
 	SignCmd.Flags().StringVarP(&argSigType, "sig-type", "T", "", "Specify signature type (default: auto-detect)")
 	SignCmd.Flags().BoolVar(&argIfUnsigned, "if-unsigned", false, "Skip signing if the file already has a signature")
+	SignCmd.Flags().IntVarP(&argJobs, "jobs", "j", 4, "Number of files to sign concurrently when signing multiple files")
+	SignCmd.Flags().BoolVar(&argFailFast, "fail-fast", false, "Stop signing remaining files after the first failure")
+	SignCmd.Flags().BoolVar(&argDryRun, "dry-run", false, "Print the digest that would be signed without opening the token or writing any output")
+	SignCmd.Flags().StringVar(&argManifest, "manifest", "", "Sign the files listed in a YAML manifest, each with its own key and output")
+	SignCmd.Flags().BoolVar(&argInPlace, "in-place", false, "Sign into a temporary file and only replace the original, keeping its mode and owner, once signing succeeds")
 	shared.AddDigestFlag(SignCmd)
 	shared.AddLateHook(func() {
 		signers.MergeFlags(SignCmd)
@@ -56,91 +97,344 @@ func init() {
 }
 
 func signCmd(cmd *cobra.Command, args []string) error {
-	if argFile == "" || argKeyName == "" {
-		return errors.New("--file and --key are required")
-	}
-	if argOutput == "" {
-		argOutput = argFile
+	if argManifest != "" {
+		if argFile != "" || argKeyName != "" || argOutput != "" || argSigType != "" || len(args) != 0 {
+			return errors.New("--manifest can't be combined with --file, --key, --output, --sig-type or file arguments")
+		}
+		jobs, err := loadManifest(cmd, argManifest)
+		if err != nil {
+			return shared.Fail(err)
+		}
+		return signFiles(cmd, jobs)
 	}
-	mod, err := signers.ByFile(argFile, argSigType)
+	files, err := signInputs(args)
 	if err != nil {
 		return shared.Fail(err)
 	}
-	if mod.Sign == nil {
-		return shared.Fail(fmt.Errorf("can't sign files of type: %s", mod.Name))
+	if len(files) == 0 || argKeyName == "" {
+		return errors.New("--file and --key are required")
 	}
-	flags, err := mod.FlagsFromCmdline(cmd.Flags())
-	if err != nil {
-		return shared.Fail(err)
+	if len(files) > 1 && argOutput != "" {
+		return errors.New("--output can't be used when signing multiple files")
 	}
-	hash, err := shared.GetDigest()
+	if argInPlace && (argOutput != "" || files[0] == "-") {
+		return errors.New("--in-place can't be used with --output or standard input")
+	}
+	hash, err := shared.GetKeyDigest(argKeyName)
 	if err != nil {
 		return shared.Fail(err)
 	}
-	token, err := openTokenByKey(argKeyName)
+	var tok token.Token
+	if !argDryRun {
+		tok, err = openTokenByKey(cmd.Context(), argKeyName)
+		if err != nil {
+			return shared.Fail(err)
+		}
+	}
+	if len(files) == 1 {
+		output := argOutput
+		if output == "" {
+			output = files[0]
+		}
+		job := signJob{input: files[0], output: output, keyName: argKeyName, sigType: argSigType, tok: tok, hash: hash}
+		if err := signFile(cmd.Context(), cmd, job); err == errAlreadySigned {
+			return nil
+		} else if err != nil {
+			return shared.Fail(err)
+		}
+		if !argDryRun {
+			fmt.Fprintln(os.Stderr, "Signed", files[0])
+		}
+		return nil
+	}
+	var jobs []signJob
+	for _, file := range files {
+		if file == "-" {
+			return shared.Fail(errors.New("standard input can't be used when signing multiple files"))
+		}
+		jobs = append(jobs, signJob{input: file, output: file, keyName: argKeyName, sigType: argSigType, tok: tok, hash: hash})
+	}
+	return signFiles(cmd, jobs)
+}
+
+// signInputs expands --file and any positional arguments into a list of files
+func signInputs(args []string) ([]string, error) {
+	var files []string
+	if argFile != "" {
+		files = append(files, argFile)
+	}
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		} else if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", arg)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// signFiles signs each file using a bounded pool of workers, sharing tokens
+// between files that use the same one, and reports any failures at the end
+func signFiles(cmd *cobra.Command, jobs []signJob) error {
+	workers := argJobs
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  int
+		skipped int
+	)
+	errs := make([]error, len(jobs))
+	queue := make(chan int)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				err := signFile(ctx, cmd, jobs[i])
+				mu.Lock()
+				if err == errAlreadySigned {
+					skipped++
+				} else if err != nil {
+					errs[i] = err
+					failed++
+					if argFailFast {
+						cancel()
+					}
+				} else if !argDryRun {
+					fmt.Fprintln(os.Stderr, "Signed", jobs[i].input)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	var started int
+feed:
+	for i := range jobs {
+		select {
+		case queue <- i:
+			started++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED %s: %s\n", jobs[i].input, err)
+		}
+	}
+	if started < len(jobs) {
+		fmt.Fprintf(os.Stderr, "%d files were skipped after the first failure\n", len(jobs)-started)
+	}
+	switch {
+	case failed != 0:
+		return shared.Fail(fmt.Errorf("%d of %d files failed to sign", failed, len(jobs)))
+	case argDryRun:
+	case skipped != 0:
+		fmt.Fprintf(os.Stderr, "Signed %d files, skipped %d that were already signed\n", len(jobs)-skipped, skipped)
+	default:
+		fmt.Fprintf(os.Stderr, "Signed %d files\n", len(jobs))
+	}
+	return nil
+}
+
+// signFile signs one input file and writes the result to its output. It
+// returns errAlreadySigned if --if-unsigned skipped the file.
+func signFile(ctx context.Context, cmd *cobra.Command, job signJob) error {
+	mod, flags, err := checkJob(cmd, job)
 	if err != nil {
-		return shared.Fail(err)
+		return err
 	}
-	cert, opts, err := signinit.Init(context.Background(), mod, token, argKeyName, hash, flags)
+	err = signFileOutput(ctx, mod, flags, job)
+	if staleToken(err) && job.tok != nil && !argDryRun && job.input != "-" {
+		// the token's connection went away, e.g. when an HSM fails over, so
+		// drop it and try once more with a new one. stdin can't be read
+		// twice, so that isn't retried.
+		fmt.Fprintf(os.Stderr, "Token connection was lost (%s), reconnecting\n", err)
+		tokensFrom(cmd.Context()).Evict(job.tok)
+		job.tok, err = openTokenByKey(cmd.Context(), job.keyName)
+		if err != nil {
+			return err
+		}
+		err = signFileOutput(ctx, mod, flags, job)
+	}
+	return err
+}
+
+// signFileOutput signs one input file, writing the result to a temporary file
+// or stdout as needed
+func signFileOutput(ctx context.Context, mod *signers.Signer, flags *signers.FlagValues, job signJob) error {
+	var err error
+	switch {
+	case argDryRun:
+		err = signFileTo(ctx, mod, flags, job)
+	case argInPlace && job.output == job.input:
+		err = atomicfile.ReplaceFile(job.input, func(tempPath string) error {
+			job.output = tempPath
+			return signFileTo(ctx, mod, flags, job)
+		})
+	case job.output == "-" && !mod.StreamOutput:
+		err = shared.WriteToStdout(job.input, func(output string) error {
+			job.output = output
+			return signFileTo(ctx, mod, flags, job)
+		})
+	default:
+		err = signFileTo(ctx, mod, flags, job)
+	}
+	return err
+}
+
+// signFileTo signs one input file and writes the result to job.output
+func signFileTo(ctx context.Context, mod *signers.Signer, flags *signers.FlagValues, job signJob) error {
+	var err error
+	file, output, tok, hash := job.input, job.output, job.tok, job.hash
+	var dryRun *dryRunToken
+	if argDryRun {
+		dryRun, err = newDryRunToken(job.keyName)
+		if err != nil {
+			return err
+		}
+		tok = dryRun
+		output = ""
+	}
+	cert, opts, err := signinit.Init(ctx, mod, tok, job.keyName, hash, flags)
 	if err != nil {
-		return shared.Fail(err)
+		return err
 	}
-	opts.Path = argFile
-	infile, err := shared.OpenForPatching(argFile, argOutput)
+	opts.Path = file
+	infile, err := shared.OpenForPatching(file, output)
 	if err != nil {
-		return shared.Fail(err)
+		return err
 	} else if infile == os.Stdin {
 		if !mod.AllowStdin {
-			return shared.Fail(errors.New("this signature type does not support reading from stdin"))
+			return errors.New("this signature type does not support reading from stdin")
 		}
 	} else {
 		defer infile.Close()
 	}
 	if argIfUnsigned {
 		if infile == os.Stdin {
-			return shared.Fail(errors.New("cannot use --if-unsigned with standard input"))
+			return errors.New("cannot use --if-unsigned with standard input")
 		}
 		if signed, err := mod.IsSigned(infile); err != nil {
-			return shared.Fail(err)
+			return err
 		} else if signed {
-			fmt.Fprintf(os.Stderr, "skipping already-signed file: %s\n", argFile)
-			return nil
+			fmt.Fprintf(os.Stderr, "skipping already-signed file: %s\n", file)
+			return errAlreadySigned
 		}
 		if _, err := infile.Seek(0, 0); err != nil {
-			return shared.Fail(fmt.Errorf("rewinding input file: %w", err))
+			return fmt.Errorf("rewinding input file: %w", err)
+		}
+	}
+	// sign embedded files first. this is skipped for a dry run because the
+	// outer digest isn't known until the nested signatures are made.
+	if mod.SignNested != nil && dryRun == nil {
+		nested, err := mod.SignNested(infile, *opts, func(f *os.File, sigType string) error {
+			return signNested(ctx, tok, job.keyName, hash, opts.Flags, f, sigType)
+		})
+		if err != nil {
+			return err
+		} else if nested != nil {
+			defer os.Remove(nested.Name())
+			defer nested.Close()
+			infile = nested
 		}
 	}
 	// transform the input, sign the stream, and apply the result
 	transform, err := mod.GetTransform(infile, *opts)
 	if err != nil {
-		return shared.Fail(err)
+		return err
 	}
 	stream, err := transform.GetReader()
 	if err != nil {
-		return shared.Fail(err)
+		return err
 	}
 	blob, err := mod.Sign(stream, cert, *opts)
-	if err != nil {
-		return shared.Fail(err)
+	if dryRun != nil {
+		// signers may wrap the error, so look at what the key saw instead
+		digest, digestHash := dryRun.key.result()
+		if digest == nil {
+			if err == nil {
+				err = errors.New("signer did not use the key")
+			}
+			return err
+		}
+		fmt.Printf("%s: %s %x\n", file, digestHash, digest)
+		return nil
+	} else if err != nil {
+		return err
 	}
 	mimeType := opts.Audit.GetMimeType()
-	if err := transform.Apply(argOutput, mimeType, bytes.NewReader(blob)); err != nil {
-		return shared.Fail(err)
+	if err := transform.Apply(output, mimeType, bytes.NewReader(blob)); err != nil {
+		return err
 	}
 	// if needed, do a final fixup step
 	if mod.Fixup != nil {
-		f, err := os.OpenFile(argOutput, os.O_RDWR, 0)
+		f, err := os.OpenFile(output, os.O_RDWR, 0)
 		if err != nil {
-			return shared.Fail(err)
+			return err
 		}
 		defer f.Close()
 		if err := mod.Fixup(f); err != nil {
-			return shared.Fail(err)
+			return err
 		}
 	}
-	if err := signinit.PublishAudit(opts.Audit); err != nil {
+	return signinit.PublishAudit(opts.Audit)
+}
+
+// checkJob picks the signer for a job and checks that it can sign the file
+// with the job's digest and the command-line options
+func checkJob(cmd *cobra.Command, job signJob) (*signers.Signer, *signers.FlagValues, error) {
+	mod, err := signers.ByFile(job.input, job.sigType)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mod.Sign == nil {
+		return nil, nil, fmt.Errorf("can't sign files of type: %s", mod.Name)
+	}
+	if err := mod.CheckHash(job.hash); err != nil {
+		return nil, nil, err
+	}
+	flags, err := mod.FlagsFromCmdline(cmd.Flags())
+	if err != nil {
+		return nil, nil, err
+	}
+	return mod, flags, nil
+}
+
+// signNested signs a file embedded in another one in-place, with the same key
+func signNested(ctx context.Context, tok token.Token, keyName string, hash crypto.Hash, outerFlags *signers.FlagValues, f *os.File, sigType string) error {
+	mod := signers.ByName(sigType)
+	if mod == nil {
+		return fmt.Errorf("no signer named %s", sigType)
+	}
+	cert, opts, err := signinit.Init(ctx, mod, tok, keyName, hash, mod.FlagsFromValues(outerFlags))
+	if err != nil {
 		return err
 	}
-	fmt.Fprintln(os.Stderr, "Signed", argFile)
-	return nil
+	opts.Path = f.Name()
+	transform, err := mod.GetTransform(f, *opts)
+	if err != nil {
+		return err
+	}
+	stream, err := transform.GetReader()
+	if err != nil {
+		return err
+	}
+	blob, err := mod.Sign(stream, cert, *opts)
+	if err != nil {
+		return err
+	}
+	if err := transform.Apply(f.Name(), opts.Audit.GetMimeType(), bytes.NewReader(blob)); err != nil {
+		return err
+	}
+	return signinit.PublishAudit(opts.Audit)
 }
@@ -0,0 +1,165 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/internal/signinit"
+	"github.com/sassoftware/relic/v8/lib/audit"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+var SignDigestCmd = &cobra.Command{
+	Use:   "sign-digest [flags] [file]",
+	Short: "Sign precomputed digests with a token key",
+	Long: `Sign precomputed digests with a token key.
+
+Digests are read one per line as hex from the named file, or from standard
+input if none is given. Anything after the digest on a line is kept, so the
+output of sha256sum can be used directly. For each digest a line is written
+with the digest, the base64 signature and the rest of the input line:
+
+  relic sign-digest -k mykey < SHA256SUMS
+
+The signature is made by the key directly over the digest, without any
+package format around it: PKCS#1 v1.5 (or PSS with --pss, or if the key
+configures it) for RSA keys and ASN.1 for ECDSA keys. An audit record is
+written for each signature.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: withTokens(signDigestCmd),
+}
+
+var argPss, argNoPss bool
+
+func init() {
+	shared.RootCmd.AddCommand(SignDigestCmd)
+	addKeyFlags(SignDigestCmd)
+	SignDigestCmd.Flags().BoolVar(&argPss, "pss", false, "Make RSA-PSS signatures, even if the selected key doesn't configure it")
+	SignDigestCmd.Flags().BoolVar(&argNoPss, "no-pss", false, "Make PKCS#1 v1.5 signatures even if the selected key configures RSA-PSS")
+	shared.AddDigestFlag(SignDigestCmd)
+	// accept --digest-algo as another name for --digest, and --rsa-pss for --pss
+	SignDigestCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		switch name {
+		case "digest-algo":
+			name = "digest"
+		case "rsa-pss":
+			name = "pss"
+		}
+		return pflag.NormalizedName(name)
+	})
+}
+
+func signDigestCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	input := "-"
+	if len(args) != 0 {
+		input = args[0]
+	}
+	hash, err := shared.GetKeyDigest(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	f, err := shared.OpenFile(input)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	defer f.Close()
+	ctx := cmd.Context()
+	tok, err := openTokenByKey(ctx, argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	// InitKey refuses keys that were rotated out
+	cert, kconf, err := signinit.InitKey(ctx, tok, argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	var opts crypto.SignerOpts = hash
+	if signinit.UsePSS(kconf, argPss, argNoPss) {
+		if err := signinit.CheckPSS(cert); err != nil {
+			return shared.Fail(err)
+		}
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	signer := func(digest []byte, name string) ([]byte, error) {
+		sig, err := cert.Signer().Sign(rand.Reader, digest, opts)
+		if err != nil {
+			return nil, err
+		}
+		auditInfo := audit.New(kconf.Name(), "digest", hash)
+		if cert.Leaf != nil {
+			auditInfo.SetX509Cert(cert.Leaf)
+		}
+		if cert.PgpKey != nil {
+			auditInfo.SetPgpCert(cert.PgpKey)
+		}
+		auditInfo.Attributes["sig.digest"] = hex.EncodeToString(digest)
+		if name = strings.TrimSpace(name); name != "" {
+			auditInfo.Attributes["client.filename"] = name
+		}
+		return sig, signinit.PublishAudit(auditInfo)
+	}
+	return shared.Fail(signDigests(f, os.Stdout, hash, signer))
+}
+
+// Read hex digests a line at a time and write each one back with its
+// signature. sign is also passed the rest of the line, usually a file name.
+func signDigests(r io.Reader, w io.Writer, hash crypto.Hash, sign func(digest []byte, name string) ([]byte, error)) error {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		digestHex, rest, _ := strings.Cut(line, " ")
+		digest, err := hex.DecodeString(digestHex)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid digest: %w", lineNo, err)
+		} else if len(digest) != hash.Size() {
+			return fmt.Errorf("line %d: digest is %d bytes but %s is %d bytes", lineNo, len(digest), x509tools.HashNames[hash], hash.Size())
+		}
+		sig, err := sign(digest, rest)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		out := digestHex + " " + base64.StdEncoding.EncodeToString(sig)
+		if rest != "" {
+			out += " " + rest
+		}
+		if _, err := fmt.Fprintln(w, out); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignDigests(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	d1 := sha256.Sum256([]byte("one"))
+	d2 := sha256.Sum256([]byte("two"))
+	input := "# SHA256SUMS\n" +
+		hex.EncodeToString(d1[:]) + "  one.txt\n" +
+		"\n" +
+		hex.EncodeToString(d2[:]) + "\n"
+	var names []string
+	sign := func(digest []byte, name string) ([]byte, error) {
+		names = append(names, name)
+		return key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	var out bytes.Buffer
+	require.NoError(t, signDigests(strings.NewReader(input), &out, crypto.SHA256, sign))
+	assert.Equal(t, []string{" one.txt", ""}, names)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	for i, digest := range [][]byte{d1[:], d2[:]} {
+		words := strings.Fields(lines[i])
+		require.GreaterOrEqual(t, len(words), 2)
+		assert.Equal(t, hex.EncodeToString(digest), words[0])
+		sig, err := base64.StdEncoding.DecodeString(words[1])
+		require.NoError(t, err)
+		assert.True(t, ecdsa.VerifyASN1(&key.PublicKey, digest, sig), "line %d", i+1)
+	}
+	assert.True(t, strings.HasSuffix(lines[0], " one.txt"), lines[0])
+}
+
+func TestSignDigestsErrors(t *testing.T) {
+	sign := func(digest []byte, name string) ([]byte, error) {
+		return []byte("sig"), nil
+	}
+	d := sha256.Sum256([]byte("one"))
+	cases := []struct {
+		name, input, err string
+	}{
+		{"bad hex", "zz\n", "line 1: invalid digest"},
+		{"wrong size", "# comment\n0102\n", "line 2: digest is 2 bytes but SHA-256 is 32 bytes"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := signDigests(strings.NewReader(c.input), new(bytes.Buffer), crypto.SHA256, sign)
+			assert.ErrorContains(t, err, c.err)
+		})
+	}
+	failing := func(digest []byte, name string) ([]byte, error) {
+		return nil, errors.New("token is gone")
+	}
+	var out bytes.Buffer
+	err := signDigests(strings.NewReader(hex.EncodeToString(d[:])+"\n"), &out, crypto.SHA256, failing)
+	assert.EqualError(t, err, "line 1: token is gone")
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/internal/signinit"
+	"github.com/sassoftware/relic/v8/lib/ociregistry"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/cosign"
+)
+
+var SignImageCmd = &cobra.Command{
+	Use:   "sign-image [flags] IMAGE",
+	Short: "Sign a container image in a registry using a token",
+	Long: `Sign a container image in a registry using a token.
+
+The image manifest is fetched from the registry and signed in the same format
+as cosign. The signature is then pushed to the image's repository under the
+sha256-<digest>.sig tag, where "cosign verify" looks for it:
+
+  relic sign-image -k mykey registry.example.com/team/app:1.0
+
+Registry credentials are read from the docker configuration written by
+"docker login", including any credential helpers it names.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withTokens(signImageCmd),
+}
+
+var argImageOptional string
+
+func init() {
+	shared.RootCmd.AddCommand(SignImageCmd)
+	addKeyFlags(SignImageCmd)
+	SignImageCmd.Flags().StringVar(&argImageOptional, "optional", "", "extra JSON options to sign")
+	shared.AddDigestFlag(SignImageCmd)
+}
+
+func signImageCmd(cmd *cobra.Command, args []string) error {
+	if argKeyName == "" {
+		return errors.New("--key is required")
+	}
+	image, err := ociregistry.ParseReference(args[0])
+	if err != nil {
+		return err
+	}
+	mod := signers.ByName("cosign")
+	if mod == nil {
+		return errors.New("cosign signer is not available")
+	}
+	hash, err := shared.GetKeyDigest(argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	} else if hash != crypto.SHA256 {
+		// registries and cosign name images by their SHA-256 digest
+		return shared.Fail(errors.New("container images must be signed with --digest SHA256"))
+	}
+	ctx := context.Background()
+	client := &ociregistry.Client{UserAgent: config.UserAgent}
+	desc, manifest, err := client.GetManifest(ctx, image)
+	if err != nil {
+		return shared.Fail(fmt.Errorf("resolving %s: %w", image, err))
+	} else if desc.Digest.Algorithm() != digest.SHA256 {
+		return shared.Fail(fmt.Errorf("resolving %s: can't sign a %s digest", image, desc.Digest.Algorithm()))
+	}
+	tok, err := openTokenByKey(cmd.Context(), argKeyName)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	flags := mod.FlagsFromValues(&signers.FlagValues{Values: map[string]string{"optional": argImageOptional}})
+	cert, opts, err := signinit.Init(ctx, mod, tok, argKeyName, hash, flags)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	opts.Path = image.String()
+	artifact, err := mod.Sign(bytes.NewReader(manifest), cert, *opts)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	sigRef, err := cosign.PushSignature(ctx, client, image, artifact)
+	if err != nil {
+		return shared.Fail(fmt.Errorf("pushing signature: %w", err))
+	}
+	if err := signinit.PublishAudit(opts.Audit); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Fprintln(os.Stderr, "Signed", image.WithDigest(desc.Digest))
+	fmt.Fprintln(os.Stderr, "Pushed signature to", sigRef)
+	return nil
+}
@@ -27,7 +27,7 @@ var SignPgpCmd = &cobra.Command{
 	Use:   "sign-pgp",
 	Short: "Create PGP signatures",
 	Long:  "This command is vaguely compatible with the gpg command-line and accepts (and mostly, ignores) many of gpg's options. It can thus be used as a drop-in replacement for tools that use gpg to make signatures.",
-	RunE:  signPgpCmd,
+	RunE:  withTokens(signPgpCmd),
 }
 
 func init() {
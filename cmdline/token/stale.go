@@ -0,0 +1,41 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"errors"
+
+	"github.com/miekg/pkcs11"
+)
+
+// error codes meaning the token's connection is gone, for example because an
+// HSM failed over to another member, and it has to be opened again
+var staleErrors = map[pkcs11Error]bool{
+	pkcs11.CKR_CRYPTOKI_NOT_INITIALIZED: true,
+	pkcs11.CKR_DEVICE_ERROR:             true,
+	pkcs11.CKR_DEVICE_REMOVED:           true,
+	pkcs11.CKR_SESSION_CLOSED:           true,
+	pkcs11.CKR_SESSION_HANDLE_INVALID:   true,
+	pkcs11.CKR_TOKEN_NOT_PRESENT:        true,
+	pkcs11.CKR_USER_NOT_LOGGED_IN:       true,
+}
+
+// staleToken returns true if err means the token must be opened again
+func staleToken(err error) bool {
+	var e pkcs11Error
+	return errors.As(err, &e) && staleErrors[e]
+}
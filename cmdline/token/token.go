@@ -22,11 +22,13 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
 	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/token"
 	"github.com/sassoftware/relic/v8/token/open"
 )
@@ -39,13 +41,19 @@ var TokenCmd = &cobra.Command{
 var TokensCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List tokens provided by a driver",
-	RunE:  tokensCmd,
+	RunE:  withTokens(tokensCmd),
 }
 
 var ContentsCmd = &cobra.Command{
 	Use:   "contents",
 	Short: "List keys in a token",
-	RunE:  contentsCmd,
+	RunE:  withTokens(contentsCmd),
+}
+
+var ListKeysCmd = &cobra.Command{
+	Use:   "list-keys",
+	Short: "List the label, ID, and type of each key in a token",
+	RunE:  withTokens(listKeysCmd),
 }
 
 var (
@@ -53,6 +61,9 @@ var (
 	argProvider string
 	argId       string
 	argValues   bool
+	argJSON     bool
+	argNoCache  bool
+	argKeyring  bool
 )
 
 func init() {
@@ -66,6 +77,15 @@ func init() {
 	ContentsCmd.Flags().StringVarP(&argLabel, "label", "l", "", "Display objects with this label only")
 	ContentsCmd.Flags().StringVarP(&argId, "id", "i", "", "Display objects with this ID only")
 	ContentsCmd.Flags().BoolVarP(&argValues, "values", "v", false, "Show contents of objects")
+	ContentsCmd.Flags().BoolVar(&argJSON, "json", false, "Output objects and their attributes as JSON (pkcs11 only)")
+
+	TokenCmd.AddCommand(ListKeysCmd)
+
+	// "relic token" subcommands, and the other commands that open tokens
+	for _, cmd := range []*cobra.Command{TokenCmd, ImportKeyCmd, NewPgpKeyCmd, pingCompatCmd, SignCmd, SignDigestCmd, SignImageCmd, SignPgpCmd, ReqCmd, SelfSignCmd, SignCsrCmd} {
+		cmd.PersistentFlags().BoolVar(&argNoCache, "no-cache", false, "Open a new connection to the token every time one is needed instead of reusing it")
+		cmd.PersistentFlags().BoolVar(&argKeyring, "keyring", false, "Read the token PIN from the system keyring, offering to save it there after it is entered")
+	}
 
 	shared.AddLateHook(addProviderTypeHelp) // deferred so token providers can init()
 }
@@ -125,7 +145,10 @@ func contentsCmd(cmd *cobra.Command, args []string) error {
 	if argProvider != "" {
 		tokenConf.Provider = argProvider
 	}
-	tok, err := openToken(argToken)
+	if argJSON && tokenConf.Type != "pkcs11" {
+		return errors.New("--json is only supported for pkcs11 tokens")
+	}
+	tok, err := openToken(cmd.Context(), argToken)
 	if err != nil {
 		return err
 	}
@@ -134,5 +157,30 @@ func contentsCmd(cmd *cobra.Command, args []string) error {
 		Label:  argLabel,
 		ID:     argId,
 		Values: argValues,
+		JSON:   argJSON,
 	}))
 }
+
+func listKeysCmd(cmd *cobra.Command, args []string) error {
+	if argToken == "" {
+		return errors.New("--token is required")
+	}
+	tok, err := openToken(cmd.Context(), argToken)
+	if err != nil {
+		return shared.Fail(err)
+	}
+	infos, err := tok.EnumerateKeys()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "LABEL\tID\tTYPE\tBITS\tSOURCE")
+	for _, info := range infos {
+		bits := ""
+		if info.Bits != 0 {
+			bits = fmt.Sprint(info.Bits)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Label, x509tools.FormatKeyID(info.ID), info.Type, bits, info.Source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/token/open"
+)
+
+var UnlockCmd = &cobra.Command{
+	Use:     "unlock",
+	Aliases: []string{"reset-lockout"},
+	Short:   "Set a new user PIN as the security officer, clearing a PIN lockout",
+	RunE:    withTokens(unlockCmd),
+}
+
+var argUnlockYes bool
+
+func init() {
+	TokenCmd.AddCommand(UnlockCmd)
+	UnlockCmd.Flags().BoolVar(&argSO, "so", false, "Log in as the security officer (required)")
+	UnlockCmd.Flags().BoolVarP(&argUnlockYes, "yes", "y", false, "Don't ask for confirmation before resetting the user PIN")
+}
+
+func unlockCmd(cmd *cobra.Command, args []string) error {
+	if argToken == "" {
+		return errors.New("--token is required")
+	} else if !argSO {
+		return errors.New("--so is required; only the security officer can reset the user PIN")
+	}
+	if err := shared.InitConfig(); err != nil {
+		return err
+	}
+	if _, err := shared.CurrentConfig.GetToken(argToken); err != nil {
+		return shared.Fail(err)
+	}
+	if !argUnlockYes {
+		ok, err := confirmReset(argToken)
+		if err != nil {
+			return shared.Fail(err)
+		} else if !ok {
+			return shared.Fail(errors.New("aborted"))
+		}
+	}
+	prompt := new(passprompt.PasswordPrompt)
+	soPin, err := prompt.GetPasswd(fmt.Sprintf("SO PIN for token %s: ", argToken))
+	if err != nil {
+		return shared.Fail(err)
+	} else if soPin == "" {
+		return shared.Fail(errors.New("aborted"))
+	}
+	newPin, err := prompt.GetPasswd("New user PIN: ")
+	if err != nil {
+		return shared.Fail(err)
+	} else if newPin == "" {
+		return shared.Fail(errors.New("aborted"))
+	}
+	confirm, err := prompt.GetPasswd("Confirm new user PIN: ")
+	if err != nil {
+		return shared.Fail(err)
+	} else if confirm != newPin {
+		return shared.Fail(errors.New("PINs do not match"))
+	}
+	if err := open.ResetPIN(shared.CurrentConfig, argToken, soPin, newPin); err != nil {
+		return shared.Fail(err)
+	}
+	fmt.Printf("user PIN reset for token %s\n", argToken)
+	return nil
+}
+
+// Ask before replacing the user PIN, since anything that has the old one
+// saved will stop working
+func confirmReset(tokenName string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "This will replace the user PIN of token %s. Continue? [y/N] ", tokenName)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -48,7 +48,7 @@ var SelfSignCmd = &cobra.Command{
 var SignCsrCmd = &cobra.Command{
 	Use:   "x509-sign",
 	Short: "Create a X509 certificate from a certificate signing request",
-	RunE:  signCsrCmd,
+	RunE:  withTokens(signCsrCmd),
 }
 
 func init() {
@@ -73,7 +73,7 @@ func x509Cmd(cmd *cobra.Command, args []string) error {
 	if x509tools.ArgCommonName == "" {
 		return errors.New("--commonName is required")
 	}
-	key, err := selectOrGenerate()
+	key, err := selectOrGenerate(cmd.Context())
 	if err != nil {
 		return err
 	}
@@ -88,7 +88,7 @@ func x509Cmd(cmd *cobra.Command, args []string) error {
 	}
 	os.Stdout.WriteString(result)
 	if ckaID := key.GetID(); len(ckaID) != 0 {
-		fmt.Println("CKA_ID:", formatKeyID(ckaID))
+		fmt.Println("CKA_ID:", x509tools.FormatKeyID(ckaID))
 	}
 	return nil
 }
@@ -101,7 +101,7 @@ func signCsrCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	key, err := openKey(argKeyName)
+	key, err := openKey(cmd.Context(), argKeyName)
 	if err != nil {
 		return err
 	}
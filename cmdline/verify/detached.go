@@ -0,0 +1,142 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+
+	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+// signatures are read into memory, so refuse anything unreasonably large
+const maxSignatureSize = 64 << 20
+
+// verifyDetached checks a detached PKCS#7 or PGP signature against contents
+// read from stdin, or from --content if given. The contents are digested as
+// they are read so they don't need to fit in memory or be seekable.
+func verifyDetached(sigPath string, opts signers.VerifyOpts, trust *trustStore) ([]*signers.Signature, error) {
+	blob, err := readSignature(sigPath)
+	if err != nil {
+		return nil, err
+	}
+	content := io.Reader(os.Stdin)
+	if opts.Content != "" {
+		f, err := os.Open(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		content = f
+	}
+	fileType := magic.Detect(bytes.NewReader(blob))
+	mod := signers.ByMagic(fileType)
+	var sigs []*signers.Signature
+	switch fileType {
+	case magic.FileTypePKCS7:
+		psd, err := pkcs7.Unmarshal(blob)
+		if err != nil {
+			return nil, err
+		}
+		var sig pkcs7.Signature
+		if opts.NoDigests {
+			sig, err = psd.Content.Verify(nil, true)
+		} else {
+			sig, err = psd.Content.VerifyDetached(content)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := pkcs9.VerifyOptionalTimestamp(sig)
+		if err != nil {
+			return nil, err
+		}
+		hash, _ := x509tools.PkixDigestToHash(ts.SignerInfo.DigestAlgorithm)
+		sigs = []*signers.Signature{{Hash: hash, X509Signature: &ts}}
+	case magic.FileTypePGP:
+		reader := io.Reader(bytes.NewReader(blob))
+		if blob[0] == '-' {
+			block, err := armor.Decode(reader)
+			if err != nil {
+				return nil, err
+			}
+			reader = block.Body
+		}
+		sig, err := pgptools.VerifyDetached(reader, content, opts.TrustedPgp)
+		if err != nil {
+			if _, ok := err.(pgptools.ErrNoKey); ok {
+				return nil, fmt.Errorf("%w; use --cert to specify known keys", err)
+			} else if sig != nil {
+				return nil, fmt.Errorf("bad signature from %s(%x) [%s]: %w", pgptools.EntityName(sig.Key.Entity), sig.Key.PublicKey.KeyId, sig.CreationTime, err)
+			}
+			return nil, err
+		}
+		sigs = []*signers.Signature{{
+			CreationTime: sig.CreationTime,
+			Hash:         sig.Hash,
+			SignerPgp:    sig.Key.Entity,
+		}}
+	default:
+		return nil, errors.New("not a detached PKCS#7 or PGP signature")
+	}
+	return checkSignatures(sigPath, sigs, opts, trust, mod.ExtKeyUsage)
+}
+
+// readSignature reads a signature from a file, or from an inherited file
+// descriptor given as fd:N
+func readSignature(path string) ([]byte, error) {
+	var f *os.File
+	if fdStr, ok := strings.CutPrefix(path, "fd:"); ok {
+		fd, err := strconv.ParseUint(fdStr, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor %q", path)
+		} else if fd == 0 {
+			return nil, errors.New("the signature cannot be read from stdin, which holds the signed contents")
+		}
+		f = os.NewFile(uintptr(fd), path)
+	} else if path == "-" {
+		return nil, errors.New("the signature cannot be read from stdin, which holds the signed contents")
+	} else {
+		var err error
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer f.Close()
+	blob, err := io.ReadAll(io.LimitReader(f, maxSignatureSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading signature: %w", err)
+	} else if len(blob) > maxSignatureSize {
+		return nil, errors.New("signature is too large")
+	} else if len(blob) == 0 {
+		return nil, errors.New("signature is empty")
+	}
+	return blob, nil
+}
@@ -0,0 +1,129 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+// Verification result for one input file in --output json mode
+type jsonResult struct {
+	File string `json:"file"`
+	// the signatures are intact
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// with --recursive, the file is a signable type but has no signature
+	Unsigned bool `json:"unsigned,omitempty"`
+	// the signers' certificate chains were checked and are trusted
+	Trusted    bool            `json:"trusted"`
+	TrustError string          `json:"trust_error,omitempty"`
+	Signatures []jsonSignature `json:"signatures"`
+}
+
+type jsonSignature struct {
+	Package     string     `json:"package,omitempty"`
+	SigInfo     string     `json:"sig_info,omitempty"`
+	Signer      string     `json:"signer"`
+	Issuer      string     `json:"issuer,omitempty"`
+	Fingerprint string     `json:"fingerprint,omitempty"`
+	Digest      string     `json:"digest,omitempty"`
+	Algorithm   string     `json:"algorithm,omitempty"`
+	SigningTime *time.Time `json:"signing_time,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"`
+	Timestamper string     `json:"timestamper,omitempty"`
+}
+
+func newJSONResult(path string, sigs []*signers.Signature, err error, untrusted bool) *jsonResult {
+	result := &jsonResult{
+		File:       path,
+		Valid:      err == nil || untrusted,
+		Trusted:    err == nil && !argNoChain,
+		Signatures: []jsonSignature{},
+	}
+	if untrusted {
+		result.TrustError = err.Error()
+	} else if err != nil {
+		result.Error = err.Error()
+	}
+	for _, sig := range sigs {
+		js := jsonSignature{
+			Package: sig.Package,
+			SigInfo: sig.SigInfo,
+			Signer:  sig.SignerName(),
+		}
+		if sig.Hash != 0 {
+			js.Digest = sig.Hash.String()
+		}
+		if !sig.CreationTime.IsZero() {
+			t := sig.CreationTime
+			js.SigningTime = &t
+		}
+		if xs := sig.X509Signature; xs != nil {
+			cert := xs.Certificate
+			js.Signer = x509tools.FormatSubject(cert)
+			js.Issuer = x509tools.FormatIssuer(cert)
+			fp := sha256.Sum256(cert.Raw)
+			js.Fingerprint = hex.EncodeToString(fp[:])
+			js.Algorithm = cert.PublicKeyAlgorithm.String()
+			if cs := xs.CounterSignature; cs != nil {
+				t := cs.SigningTime
+				js.Timestamp = &t
+				js.Timestamper = x509tools.FormatSubject(cs.Certificate)
+			}
+		} else if sig.SignerPgp != nil {
+			js.Fingerprint = hex.EncodeToString(sig.SignerPgp.PrimaryKey.Fingerprint)
+			js.Algorithm = pgpAlgorithm(sig.SignerPgp.PrimaryKey.PubKeyAlgo)
+		}
+		result.Signatures = append(result.Signatures, js)
+	}
+	return result
+}
+
+func pgpAlgorithm(algo packet.PublicKeyAlgorithm) string {
+	switch algo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly:
+		return "RSA"
+	case packet.PubKeyAlgoDSA:
+		return "DSA"
+	case packet.PubKeyAlgoECDSA:
+		return "ECDSA"
+	case packet.PubKeyAlgoEdDSA:
+		return "EdDSA"
+	default:
+		return fmt.Sprintf("PGP algorithm %d", algo)
+	}
+}
+
+// writeJSON writes the results as a JSON array with one element per input file
+func writeJSON(results []*jsonResult) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if results == nil {
+		results = []*jsonResult{}
+	}
+	return enc.Encode(results)
+}
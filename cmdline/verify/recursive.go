@@ -0,0 +1,117 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+// Tally of files seen by --recursive
+type treeSummary struct {
+	signed, unsigned, invalid, notSignable int
+}
+
+// verifyTrees walks each directory and verifies every regular file in it.
+// Files that no signer recognizes are only counted. Symlinks are not followed.
+func verifyTrees(roots []string, opts signers.VerifyOpts, trust *trustStore) error {
+	var summary treeSummary
+	var results []*jsonResult
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			} else if !d.Type().IsRegular() {
+				return nil
+			}
+			fileOpts := opts
+			if fileOpts.Content == "" {
+				fileOpts.Content = detachedContent(path)
+			}
+			sigs, err := verifyOne(path, fileOpts, trust)
+			unsigned := errors.As(err, new(sigerrors.NotSignedError))
+			switch {
+			case errors.Is(err, errUnknownType):
+				summary.notSignable++
+				return nil
+			case unsigned:
+				summary.unsigned++
+			case err != nil:
+				summary.invalid++
+			default:
+				summary.signed++
+			}
+			if argOutput == "json" {
+				result := newJSONResult(path, sigs, err, errors.As(err, new(trustError)))
+				result.Unsigned = unsigned
+				results = append(results, result)
+			} else if unsigned {
+				fmt.Printf("%s UNSIGNED: %s\n", path, err)
+			} else {
+				printResult(path, sigs, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return shared.Fail(err)
+		}
+	}
+	w := os.Stdout
+	if argOutput == "json" {
+		if results == nil {
+			results = []*jsonResult{}
+		}
+		if err := writeJSON(results); err != nil {
+			return shared.Fail(err)
+		}
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "%d signed, %d unsigned, %d invalid, %d not signable\n", summary.signed, summary.unsigned, summary.invalid, summary.notSignable)
+	rc := 0
+	if summary.invalid != 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: 1 or more files did not validate")
+		rc = shared.ExitVerify
+	}
+	if summary.unsigned != 0 && argRequireSigned {
+		fmt.Fprintln(os.Stderr, "ERROR: 1 or more signable files are not signed")
+		rc = shared.ExitVerify
+	}
+	os.Exit(rc)
+	return nil
+}
+
+// detachedContent returns the file that a detached signature such as
+// foo.tar.gz.asc was made from, if it is next to the signature
+func detachedContent(path string) string {
+	switch filepath.Ext(path) {
+	case ".asc", ".sig", ".p7s", ".jws":
+	default:
+		return ""
+	}
+	content := path[:len(path)-len(filepath.Ext(path))]
+	if st, err := os.Stat(content); err == nil && st.Mode().IsRegular() {
+		return content
+	}
+	return ""
+}
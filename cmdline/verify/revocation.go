@@ -0,0 +1,88 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/revocation"
+)
+
+// Configure revocation checking from --revocation or the trust section
+func (t *trustStore) setRevocation(tconf *config.TrustConfig) error {
+	mode := argRevocation
+	if mode == "" {
+		mode = tconf.Revocation
+	}
+	switch mode {
+	case "", "none":
+		return nil
+	case "soft":
+	case "hard":
+		t.hardFail = true
+	default:
+		return fmt.Errorf("invalid revocation mode %q, expected soft, hard or none", mode)
+	}
+	if argNoChain {
+		return errors.New("revocation can't be checked with --no-trust-chain")
+	}
+	t.revocation = new(revocation.Checker)
+	if tconf.RevocationTTL > 0 {
+		t.revocation.TTL = time.Duration(tconf.RevocationTTL) * time.Second
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		t.revocation.CacheDir = filepath.Join(dir, "relic", "revocation")
+	}
+	return nil
+}
+
+// Check every certificate in the signer's chain, except the root, for
+// revocation. Timestamped signatures are checked as of the timestamp, so
+// revoking a certificate doesn't invalidate what was signed before.
+func (t *trustStore) checkRevocation(path string, sig *pkcs9.TimestampedSignature, roots *x509.CertPool, usage x509.ExtKeyUsage) error {
+	if t.revocation == nil {
+		return nil
+	}
+	var at time.Time
+	if sig.CounterSignature != nil {
+		at = sig.CounterSignature.SigningTime
+	}
+	chain, err := sig.Signature.BuildChain(roots, t.intermediates, usage, at)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		err := t.revocation.Check(context.Background(), chain[i], chain[i+1], at)
+		if err == nil {
+			continue
+		}
+		if errors.As(err, new(revocation.UnavailableError)) && !t.hardFail {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", path, err)
+			continue
+		}
+		return err
+	}
+	return nil
+}
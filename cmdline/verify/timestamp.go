@@ -0,0 +1,80 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+)
+
+// Load trusted timestamp authority roots from --tsa-cert
+func loadTsaCerts() (*x509.CertPool, error) {
+	if len(argTsaCerts) == 0 {
+		return nil, nil
+	}
+	trusted, err := certloader.LoadAnyCerts(argTsaCerts)
+	if err != nil {
+		return nil, err
+	} else if len(trusted.X509Certs) == 0 {
+		return nil, errors.New("no X.509 certificates found in --tsa-cert")
+	}
+	pool := x509.NewCertPool()
+	for _, cert := range trusted.X509Certs {
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// Check that a signature has a timestamp issued by a trusted timestamp
+// authority, and that the signing certificate was valid at that time. The
+// timestamp is validated against --tsa-cert if given, otherwise against the
+// same roots as the signature.
+func checkTimestamp(sig *pkcs9.TimestampedSignature, roots *x509.CertPool, trust *trustStore) error {
+	cs := sig.CounterSignature
+	if cs == nil {
+		return errors.New("signature is not timestamped")
+	}
+	if trust.tsaRoots != nil {
+		roots = trust.tsaRoots
+	}
+	if err := cs.VerifyChain(roots, trust.intermediates); err != nil {
+		return fmt.Errorf("validating timestamp: %w", err)
+	}
+	cert := sig.Certificate
+	if cs.SigningTime.Before(cert.NotBefore) || cs.SigningTime.After(cert.NotAfter) {
+		return fmt.Errorf("signing certificate was not valid at the timestamp time %s (valid %s to %s)",
+			cs.SigningTime, cert.NotBefore, cert.NotAfter)
+	}
+	return nil
+}
+
+// Verify the certificate chain of a signature and its timestamp. If a separate
+// pool of timestamp authority roots was given then the timestamp is validated
+// against that instead.
+func verifyChain(sig *pkcs9.TimestampedSignature, roots *x509.CertPool, trust *trustStore, usage x509.ExtKeyUsage) error {
+	if trust.tsaRoots == nil || sig.CounterSignature == nil {
+		return sig.VerifyChain(roots, trust.intermediates, usage)
+	}
+	if err := sig.CounterSignature.VerifyChain(trust.tsaRoots, trust.intermediates); err != nil {
+		return fmt.Errorf("validating timestamp: %w", err)
+	}
+	return sig.Signature.VerifyChain(roots, trust.intermediates, usage, sig.CounterSignature.SigningTime)
+}
@@ -0,0 +1,234 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package verify
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/authenticode"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/revocation"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+// trustStore is what signing certificates are checked against, gathered from
+// the command line and the trust section of the configuration
+type trustStore struct {
+	intermediates []*x509.Certificate
+	tsaRoots      *x509.CertPool
+	fingerprints  map[string]bool
+	revocation    *revocation.Checker
+	hardFail      bool
+	efiDB         *authenticode.SignatureDatabase
+}
+
+// trustError means that the signature itself is valid but the signer isn't
+// trusted
+type trustError struct {
+	err error
+}
+
+func (e trustError) Error() string {
+	return e.err.Error()
+}
+
+func (e trustError) Unwrap() error {
+	return e.err
+}
+
+// Load the trust section of the configuration file, if there is one. Unlike
+// most commands, verify works without a configuration.
+func loadTrustConfig() (*config.TrustConfig, error) {
+	if shared.ArgConfig == "" {
+		if _, err := os.Stat(config.DefaultConfig()); err != nil {
+			return nil, nil
+		}
+	}
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	return shared.CurrentConfig.Trust, nil
+}
+
+func loadCerts() (signers.VerifyOpts, *trustStore, error) {
+	opts := signers.VerifyOpts{
+		NoChain:        argNoChain,
+		NoDigests:      argNoIntegrityCheck,
+		Content:        argContent,
+		AllowedSigners: argAllowedSigners,
+	}
+	trust := new(trustStore)
+	tconf, err := loadTrustConfig()
+	if err != nil {
+		return opts, nil, err
+	} else if tconf == nil {
+		tconf = new(config.TrustConfig)
+	}
+	trusted, err := certloader.LoadAnyCerts(append(tconf.Roots, argTrustedCerts...))
+	if err != nil {
+		return opts, nil, err
+	}
+	opts.TrustedX509 = trusted.X509Certs
+	keyCerts, err := loadKeyCerts(argKeyName)
+	if err != nil {
+		return opts, nil, err
+	}
+	opts.TrustedX509 = append(opts.TrustedX509, keyCerts...)
+	opts.TrustedPgp = trusted.PGPCerts
+	if len(opts.TrustedX509) > 0 {
+		if argAlsoSystem || tconf.SystemRoots {
+			opts.TrustedPool, err = x509.SystemCertPool()
+			if err != nil {
+				return opts, nil, err
+			}
+		} else {
+			opts.TrustedPool = x509.NewCertPool()
+		}
+		for _, cert := range opts.TrustedX509 {
+			opts.TrustedPool.AddCert(cert)
+		}
+	}
+	if len(tconf.Intermediates) != 0 {
+		extra, err := certloader.LoadAnyCerts(tconf.Intermediates)
+		if err != nil {
+			return opts, nil, err
+		}
+		trust.intermediates = extra.X509Certs
+	}
+	trust.tsaRoots, err = loadTsaCerts()
+	if err != nil {
+		return opts, nil, err
+	}
+	for _, fp := range append(tconf.Fingerprints, argFingerprints...) {
+		fp = strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+		if _, err := hex.DecodeString(fp); err != nil || fp == "" {
+			return opts, nil, fmt.Errorf("invalid signer fingerprint %q", fp)
+		}
+		if trust.fingerprints == nil {
+			trust.fingerprints = make(map[string]bool)
+		}
+		trust.fingerprints[fp] = true
+	}
+	for _, cert := range keyCerts {
+		sum := sha256.Sum256(cert.Raw)
+		if trust.fingerprints == nil {
+			trust.fingerprints = make(map[string]bool)
+		}
+		trust.fingerprints[hex.EncodeToString(sum[:])] = true
+	}
+	if err := trust.setRevocation(tconf); err != nil {
+		return opts, nil, err
+	}
+	trust.efiDB, err = loadEFIDatabase(argEFIDatabase)
+	if err != nil {
+		return opts, nil, err
+	}
+	return opts, trust, nil
+}
+
+// Load the leaf certificates of a configured key and of the deprecated keys
+// it replaced that are still in their grace period. The certificates are
+// trusted directly, so signatures from them pass without a chain to a root.
+func loadKeyCerts(keyName string) ([]*x509.Certificate, error) {
+	if keyName == "" {
+		return nil, nil
+	}
+	if err := shared.InitConfig(); err != nil {
+		return nil, err
+	}
+	keyConf, err := shared.CurrentConfig.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	// an alias has no keys of its own that were rotated out
+	target := keyConf.Name()
+	if keyConf.Alias != "" {
+		target = keyConf.Alias
+	}
+	var leaves []*x509.Certificate
+	for _, kc := range append([]*config.KeyConfig{keyConf}, shared.CurrentConfig.PreviousKeys(target, time.Now())...) {
+		if kc.X509Certificate == "" {
+			return nil, fmt.Errorf("key %s has no x509certificate file to verify against, use --cert or --signer-fingerprint instead", kc.Name())
+		}
+		blob, err := os.ReadFile(kc.X509Certificate)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := certloader.ParseX509Certificates(blob)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kc.Name(), err)
+		}
+		leaves = append(leaves, certs[0])
+	}
+	return leaves, nil
+}
+
+// Load Secure Boot db files, which may be EFI signature lists such as the
+// output of efi-readvar, or plain certificates
+func loadEFIDatabase(paths []string) (*authenticode.SignatureDatabase, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	db := new(authenticode.SignatureDatabase)
+	for _, path := range paths {
+		blob, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if lists, err := authenticode.ParseSignatureLists(blob); err == nil {
+			db.Certificates = append(db.Certificates, lists.Certificates...)
+		} else if certs, err2 := certloader.ParseX509Certificates(blob); err2 == nil {
+			db.Certificates = append(db.Certificates, certs...)
+		} else {
+			return nil, fmt.Errorf("%s: not an EFI signature list or certificate: %w", path, err)
+		}
+	}
+	if len(db.Certificates) == 0 {
+		return nil, errors.New("--efi-db files contain no certificates")
+	}
+	return db, nil
+}
+
+// Check the signer against the list of allowed fingerprints, if there is one
+func (t *trustStore) checkPinned(sig *signers.Signature) error {
+	if t.fingerprints == nil {
+		return nil
+	}
+	var fp string
+	switch {
+	case sig.X509Signature != nil:
+		sum := sha256.Sum256(sig.X509Signature.Certificate.Raw)
+		fp = hex.EncodeToString(sum[:])
+	case sig.SignerPgp != nil:
+		fp = hex.EncodeToString(sig.SignerPgp.PrimaryKey.Fingerprint)
+	default:
+		return fmt.Errorf("signer %s can't be checked against the allowed fingerprints", sig.SignerName())
+	}
+	if !t.fingerprints[fp] {
+		return fmt.Errorf("signer %s with fingerprint %s is not allowed", sig.SignerName(), fp)
+	}
+	return nil
+}
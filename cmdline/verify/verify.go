@@ -26,7 +26,6 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
-	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/lib/pgptools"
 	"github.com/sassoftware/relic/v8/lib/x509tools"
@@ -46,6 +45,17 @@ var (
 	argShowCerts        bool
 	argContent          string
 	argTrustedCerts     []string
+	argCheckTimestamp   bool
+	argTsaCerts         []string
+	argOutput           string
+	argFingerprints     []string
+	argRevocation       string
+	argSignature        string
+	argAllowedSigners   string
+	argKeyName          string
+	argRecursive        bool
+	argRequireSigned    bool
+	argEFIDatabase      []string
 )
 
 func init() {
@@ -55,22 +65,64 @@ func init() {
 	VerifyCmd.Flags().BoolVar(&argAlsoSystem, "system-store", false, "When --cert is used, append rather than replace the system trust store")
 	VerifyCmd.Flags().BoolVar(&argShowCerts, "show-certs", false, "Dump certificate chain from signature")
 	VerifyCmd.Flags().StringVar(&argContent, "content", "", "Specify file containing contents for detached signatures")
+	VerifyCmd.Flags().StringVar(&argSignature, "signature", "", "Verify this detached PKCS#7 or PGP signature, or fd:N to read it from a file descriptor, against contents read from stdin or --content")
 	VerifyCmd.Flags().StringArrayVar(&argTrustedCerts, "cert", nil, "Add a trusted root certificate (PEM, DER, PKCS#7, or PGP)")
+	VerifyCmd.Flags().BoolVar(&argCheckTimestamp, "check-timestamp", false, "Require a valid timestamp and check that the signing certificate was valid at the time it was signed")
+	VerifyCmd.Flags().StringVarP(&argOutput, "output", "o", "text", "Output format: text or json")
+	VerifyCmd.Flags().StringArrayVar(&argTsaCerts, "tsa-cert", nil, "Add a trusted timestamp authority root certificate (default: same as --cert)")
+	VerifyCmd.Flags().StringArrayVar(&argFingerprints, "signer-fingerprint", nil, "Only accept signers with this certificate SHA-256 or PGP key fingerprint (hex)")
+	VerifyCmd.Flags().StringVar(&argAllowedSigners, "allowed-signers", "", "Only accept SSH signatures and certificates from signers listed in this ssh-keygen allowed signers file")
+	VerifyCmd.Flags().StringVarP(&argKeyName, "key", "k", "", "Only accept signers using the certificate of this configured key, or of a key it replaced that is still in its grace period")
+	VerifyCmd.Flags().BoolVarP(&argRecursive, "recursive", "r", false, "Verify every file in the given directories and report how many are signed, unsigned, invalid, or not a signable type")
+	VerifyCmd.Flags().BoolVar(&argRequireSigned, "require-signed", false, "With --recursive, fail if any file of a signable type is unsigned")
+	VerifyCmd.Flags().StringArrayVar(&argEFIDatabase, "efi-db", nil, "Check EFI images the way UEFI Secure Boot does, against the certificates in this db file (EFI signature list, PEM or DER)")
+	VerifyCmd.Flags().StringVar(&argRevocation, "revocation", "", "Check whether signing certificates were revoked: soft (warn if the status is unavailable), hard (fail), or none")
 }
 
 func verifyCmd(cmd *cobra.Command, args []string) error {
-	if len(args) == 0 {
+	if argSignature != "" {
+		if len(args) != 0 {
+			return errors.New("--signature reads the signed contents from stdin or --content and does not take file arguments")
+		}
+	} else if len(args) == 0 {
 		return errors.New("Expected 1 or more files")
 	}
-	opts, err := loadCerts()
+	if argRecursive && argSignature != "" {
+		return errors.New("--recursive and --signature can't be used together")
+	} else if argRequireSigned && !argRecursive {
+		return errors.New("--require-signed requires --recursive")
+	}
+	opts, trust, err := loadCerts()
 	if err != nil {
 		return err
 	}
+	if argOutput != "" && argOutput != "text" && argOutput != "json" {
+		return fmt.Errorf("unknown output format %q", argOutput)
+	}
+	if argRecursive {
+		return verifyTrees(args, opts, trust)
+	}
 	rc := 0
+	var results []*jsonResult
+	verify := verifyOne
+	if argSignature != "" {
+		verify = verifyDetached
+		args = []string{argSignature}
+	}
 	for _, path := range args {
-		if err := verifyOne(path, opts); err != nil {
-			fmt.Printf("%s ERROR: %s\n", path, err)
-			rc = 1
+		sigs, err := verify(path, opts, trust)
+		if argOutput == "json" {
+			results = append(results, newJSONResult(path, sigs, err, errors.As(err, new(trustError))))
+		} else {
+			printResult(path, sigs, err)
+		}
+		if err != nil {
+			rc = shared.ExitVerify
+		}
+	}
+	if argOutput == "json" {
+		if err := writeJSON(results); err != nil {
+			return shared.Fail(err)
 		}
 	}
 	if rc != 0 {
@@ -80,44 +132,119 @@ func verifyCmd(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func verifyOne(path string, opts signers.VerifyOpts) error {
+var errUnknownType = errors.New("unknown filetype")
+
+// verifyOne checks the signatures in a file, including their certificate
+// chains, and returns them if they are all valid. If the signatures are valid
+// but a signer isn't trusted then they are returned with a trustError.
+func verifyOne(path string, opts signers.VerifyOpts, trust *trustStore) ([]*signers.Signature, error) {
 	f, err := shared.OpenFile(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer f.Close()
 	fileType, compression := magic.DetectCompressed(f)
 	opts.FileName = path
 	opts.Compression = compression
 	if _, err := f.Seek(0, 0); err != nil {
-		return err
+		return nil, err
 	}
 	mod := signers.ByMagic(fileType)
 	if mod == nil {
 		mod = signers.ByFileName(path)
+		if mod != nil && mod.VerifyStream == nil {
+			// the module wants the file as-is, e.g. a Helm chart
+			opts.Compression = magic.CompressedNone
+		}
 	}
 	if mod == nil {
-		return errors.New("unknown filetype")
+		return nil, errUnknownType
+	} else if mod.Verify == nil && mod.VerifyStream == nil {
+		return nil, fmt.Errorf("%s signatures cannot be verified", mod.Name)
 	}
 	var sigs []*signers.Signature
 	if mod.VerifyStream != nil {
 		r, err2 := magic.Decompress(f, opts.Compression)
 		if err2 != nil {
-			return err
+			return nil, err2
 		}
 		sigs, err = mod.VerifyStream(r, opts)
 	} else {
 		if opts.Compression != magic.CompressedNone {
-			return errors.New("cannot verify compressed file")
+			return nil, errors.New("cannot verify compressed file")
 		}
 		sigs, err = mod.Verify(f, opts)
 	}
 	if err != nil {
 		if _, ok := err.(pgptools.ErrNoKey); ok {
-			return fmt.Errorf("%w; use --cert to specify known keys", err)
+			return nil, fmt.Errorf("%w; use --cert to specify known keys", err)
+		}
+		return nil, err
+	}
+	if trust.efiDB != nil {
+		return checkEFISignatures(mod, sigs, trust)
+	}
+	return checkSignatures(path, sigs, opts, trust, mod.ExtKeyUsage)
+}
+
+// checkEFISignatures applies the Secure Boot db check in place of the usual
+// chain and timestamp checks
+func checkEFISignatures(mod *signers.Signer, sigs []*signers.Signature, trust *trustStore) ([]*signers.Signature, error) {
+	if mod.Name != "pe-coff" {
+		return nil, fmt.Errorf("--efi-db only applies to EFI images, not %s", mod.Name)
+	}
+	for _, sig := range sigs {
+		if err := trust.efiDB.VerifyChain(sig.X509Signature.Certificate, sig.X509Signature.Intermediates); err != nil {
+			return sigs, trustError{err}
+		}
+		if err := trust.checkPinned(sig); err != nil {
+			return sigs, trustError{err}
+		}
+	}
+	return sigs, nil
+}
+
+// checkSignatures applies the timestamp, chain, revocation and pinning checks
+// to valid signatures
+func checkSignatures(path string, sigs []*signers.Signature, opts signers.VerifyOpts, trust *trustStore, usage x509.ExtKeyUsage) ([]*signers.Signature, error) {
+	for _, sig := range sigs {
+		if sig.X509Signature != nil && argCheckTimestamp {
+			if err := checkTimestamp(sig.X509Signature, opts.TrustedPool, trust); err != nil {
+				return sigs, trustError{err}
+			}
+		}
+		if sig.X509Signature != nil && !opts.NoChain {
+			if err := verifyChain(sig.X509Signature, opts.TrustedPool, trust, usage); err != nil {
+				if e := new(x509.UnknownAuthorityError); errors.As(err, e) && argOutput != "json" {
+					fmt.Printf("While validating certificate:\n Subject: %s\n Issuer:  %s\n Serial:  %X\n", x509tools.FormatSubject(e.Cert), x509tools.FormatIssuer(e.Cert), e.Cert.SerialNumber)
+				}
+				return sigs, trustError{err}
+			}
+			if err := trust.checkRevocation(path, sig.X509Signature, opts.TrustedPool, usage); err != nil {
+				return sigs, trustError{err}
+			}
+		}
+		if err := trust.checkPinned(sig); err != nil {
+			return sigs, trustError{err}
 		}
-		return err
 	}
+	return sigs, nil
+}
+
+// printResult writes the human-readable report for one file
+func printResult(path string, sigs []*signers.Signature, err error) {
+	if errors.As(err, new(trustError)) {
+		printSignatures(path, sigs, "UNTRUSTED")
+		fmt.Printf("%s UNTRUSTED: %s\n", path, err)
+	} else if err != nil {
+		fmt.Printf("%s ERROR: %s\n", path, err)
+	} else {
+		printSignatures(path, sigs, "OK")
+	}
+}
+
+// printSignatures writes the human-readable report for a verified file
+func printSignatures(path string, sigs []*signers.Signature, status string) {
 	sawCerts := make(map[string]bool)
 	for _, sig := range sigs {
 		var si, pkg, ts string
@@ -133,54 +260,16 @@ func verifyOne(path string, opts signers.VerifyOpts) error {
 				showCert(cert.Raw, sawCerts)
 			}
 		}
-		if sig.X509Signature != nil && !opts.NoChain {
-			if err := sig.X509Signature.VerifyChain(opts.TrustedPool, nil, x509.ExtKeyUsageAny); err != nil {
-				if e := new(x509.UnknownAuthorityError); errors.As(err, e) {
-					fmt.Printf("While validating certificate:\n Subject: %s\n Issuer:  %s\n Serial:  %X\n", x509tools.FormatSubject(e.Cert), x509tools.FormatIssuer(e.Cert), e.Cert.SerialNumber)
-				}
-				return err
-			}
-		}
 		if sig.X509Signature != nil && sig.X509Signature.CounterSignature != nil {
-			fmt.Printf("%s: OK -%s %s%s\n", path, si, pkg, sig.SignerName())
-			fmt.Printf("%s(timestamp): OK - `%s` [%s]\n", path, x509tools.FormatSubject(sig.X509Signature.CounterSignature.Certificate), sig.X509Signature.CounterSignature.SigningTime)
+			fmt.Printf("%s: %s -%s %s%s\n", path, status, si, pkg, sig.SignerName())
+			fmt.Printf("%s(timestamp): %s - `%s` [%s]\n", path, status, x509tools.FormatSubject(sig.X509Signature.CounterSignature.Certificate), sig.X509Signature.CounterSignature.SigningTime)
 		} else {
 			if !sig.CreationTime.IsZero() {
 				ts = fmt.Sprintf(" [%s]", sig.CreationTime)
 			}
-			fmt.Printf("%s: OK -%s %s%s%s\n", path, si, pkg, sig.SignerName(), ts)
-		}
-	}
-	return nil
-}
-
-func loadCerts() (signers.VerifyOpts, error) {
-	opts := signers.VerifyOpts{
-		NoChain:   argNoChain,
-		NoDigests: argNoIntegrityCheck,
-		Content:   argContent,
-	}
-	trusted, err := certloader.LoadAnyCerts(argTrustedCerts)
-	if err != nil {
-		return opts, err
-	}
-	opts.TrustedX509 = trusted.X509Certs
-	opts.TrustedPgp = trusted.PGPCerts
-	if len(opts.TrustedX509) > 0 {
-		if argAlsoSystem {
-			var err error
-			opts.TrustedPool, err = x509.SystemCertPool()
-			if err != nil {
-				return opts, err
-			}
-		} else {
-			opts.TrustedPool = x509.NewCertPool()
-		}
-		for _, cert := range opts.TrustedX509 {
-			opts.TrustedPool.AddCert(cert)
+			fmt.Printf("%s: %s -%s %s%s%s\n", path, status, si, pkg, sig.SignerName(), ts)
 		}
 	}
-	return opts, nil
 }
 
 func showCert(blob []byte, seen map[string]bool) {
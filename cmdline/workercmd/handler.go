@@ -96,6 +96,7 @@ func (h *handler) healthCheck() {
 
 type handler struct {
 	token    *tokencache.Cache
+	sessions token.SessionCounter
 	cookie   []byte
 	shutdown func()
 }
@@ -114,6 +115,7 @@ func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		resp.Err = err.Error()
 		switch e := err.(type) {
 		case pkcs11Error:
+			resp.ErrCode = uint(e)
 			if fatalErrors[e] {
 				log.Err(err).Msg("terminating worker due to token error")
 				go h.shutdown()
@@ -159,6 +161,11 @@ func (h *handler) handle(rw http.ResponseWriter, req *http.Request) (resp worker
 	}
 	switch req.URL.Path {
 	case workerrpc.Ping:
+		resp.Pid = os.Getpid()
+		if h.sessions != nil {
+			stats := h.sessions.SessionStats()
+			resp.Sessions = &stats
+		}
 		return resp, h.token.Ping(ctx)
 	case workerrpc.GetKey:
 		key, err := h.token.GetKey(ctx, rr.KeyName)
@@ -35,6 +35,7 @@ import (
 	"github.com/sassoftware/relic/v8/internal/activation"
 	"github.com/sassoftware/relic/v8/internal/activation/activatecmd"
 	"github.com/sassoftware/relic/v8/internal/zhttp"
+	"github.com/sassoftware/relic/v8/token"
 	"github.com/sassoftware/relic/v8/token/open"
 	"github.com/sassoftware/relic/v8/token/tokencache"
 )
@@ -87,13 +88,15 @@ func runWorker(tokenName string) error {
 		return c.Str("token", tokenName).Int("pid", os.Getpid())
 	})
 	tconf := tok.Config()
+	sessions, _ := tok.(token.SessionCounter)
 	if tconf.RateLimit != 0 {
 		tok = tokencache.NewLimiter(tok, tconf.RateLimit, tconf.RateBurst)
 	}
 	expiry := time.Second * time.Duration(cfg.Server.TokenCacheSeconds)
 	handler := &handler{
-		token:  tokencache.New(tok, expiry),
-		cookie: cookie,
+		token:    tokencache.New(tok, expiry),
+		sessions: sessions,
+		cookie:   cookie,
 	}
 	srv := &http.Server{Handler: handler}
 	wg := new(sync.WaitGroup)
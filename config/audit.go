@@ -0,0 +1,65 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	AuditSinkFile   = "file"
+	AuditSinkSyslog = "syslog"
+	AuditSinkHTTP   = "http"
+)
+
+func (a *AuditSinkConfig) normalize(config *Config) error {
+	switch a.Type {
+	case AuditSinkFile:
+		if a.Path == "" {
+			return errors.New("server.audit.path is required for the file sink")
+		}
+	case AuditSinkSyslog:
+		if a.Network != "" && a.Address == "" {
+			return errors.New("server.audit.address is required for remote syslog")
+		}
+		if a.Tag == "" {
+			a.Tag = "relic"
+		}
+	case AuditSinkHTTP:
+		if a.URL == "" {
+			return errors.New("server.audit.url is required for the http sink")
+		}
+		if a.BatchSize <= 0 {
+			a.BatchSize = 100
+		}
+		if a.FlushInterval <= 0 {
+			a.FlushInterval = 5
+		}
+		if a.MaxQueue <= 0 {
+			a.MaxQueue = 10000
+		}
+	default:
+		return fmt.Errorf("server.audit.type must be one of %s, %s or %s", AuditSinkFile, AuditSinkSyslog, AuditSinkHTTP)
+	}
+	if a.SigningKey != "" {
+		if _, err := config.GetKey(a.SigningKey); err != nil {
+			return fmt.Errorf("server.audit.signingkey: %w", err)
+		}
+	}
+	return nil
+}
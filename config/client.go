@@ -16,7 +16,10 @@
 
 package config
 
-import "crypto/x509"
+import (
+	"crypto/x509"
+	"strings"
+)
 
 func (cl *ClientConfig) Match(incoming []*x509.Certificate) (bool, error) {
 	if cl.certs == nil || len(incoming) == 0 {
@@ -40,3 +43,47 @@ func (cl *ClientConfig) Match(incoming []*x509.Certificate) (bool, error) {
 	}
 	return false, err
 }
+
+// Sources of roles derived from a client certificate
+const (
+	RolesFromOU    = "ou"
+	RolesFromDNS   = "dns"
+	RolesFromEmail = "email"
+	RolesFromURI   = "uri"
+)
+
+func validRoleSource(source string) bool {
+	switch strings.ToLower(source) {
+	case RolesFromOU, RolesFromDNS, RolesFromEmail, RolesFromURI:
+		return true
+	}
+	return false
+}
+
+// CertRoles returns the roles granted by the contents of a client certificate
+// according to RolesFrom. Each role is prefixed with its source, e.g.
+// "ou:Release Engineering" or "dns:build01.example.com", so that a
+// certificate can't claim a role that was configured by name.
+func (cl *ClientConfig) CertRoles(leaf *x509.Certificate) []string {
+	var roles []string
+	for _, source := range cl.RolesFrom {
+		source = strings.ToLower(source)
+		var values []string
+		switch source {
+		case RolesFromOU:
+			values = leaf.Subject.OrganizationalUnit
+		case RolesFromDNS:
+			values = leaf.DNSNames
+		case RolesFromEmail:
+			values = leaf.EmailAddresses
+		case RolesFromURI:
+			for _, u := range leaf.URIs {
+				values = append(values, u.String())
+			}
+		}
+		for _, value := range values {
+			roles = append(roles, source+":"+value)
+		}
+	}
+	return roles
+}
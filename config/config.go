@@ -26,11 +26,16 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
 
 const (
 	defaultSigXchg = "relic.signatures"
 	sigKey         = "relic.signatures"
+
+	// Values for TimestampType
+	TimestampTypeRFC3161 = "rfc3161"
+	TimestampTypeLegacy  = "legacy"
 )
 
 var (
@@ -42,42 +47,64 @@ var (
 )
 
 type TokenConfig struct {
-	Type       string  // Provider type: file or pkcs11 (default)
-	Provider   string  // Path to PKCS#11 provider module (required)
-	Label      string  // Select a token by label
-	Serial     string  // Select a token by serial number
-	Pin        *string // PIN to use, otherwise will be prompted. Can be empty. (optional)
-	Timeout    int     // (server) Terminate command after N seconds (default 60)
-	Retries    int     // (server) Retry failed commands N times (default 5)
-	RateLimit  float64 // (server) limit token operations per second
-	RateBurst  int     // (server) allow burst of operations before limit kicks in
-	User       *uint   // User argument for PKCS#11 login (optional)
-	UseKeyring bool    // Read PIN from system keyring
+	Type        string  // Provider type: file or pkcs11 (default)
+	Provider    string  // Path to PKCS#11 provider module (required), or directory of key files for "file" tokens
+	Label       string  // Select a token by label
+	Serial      string  // Select a token by serial number, taking precedence over label
+	Pin         *string // PIN to use, otherwise will be prompted. Can be empty, "file:/path", "|command", or "protected" for a PIN pad. (optional)
+	Timeout     int     // (server) Terminate command after N seconds (default 60)
+	OpenTimeout int     // Give up if initializing, finding, opening a session on or logging in to the token takes more than N seconds
+	Retries     int     // (server) Retry failed commands N times (default 5)
+	RateLimit   float64 // (server) limit token operations per second
+	RateBurst   int     // (server) allow burst of operations before limit kicks in
+	User        *uint   // User argument for PKCS#11 login (optional)
+	UseKeyring  bool    // Read PIN from system keyring
+	Sessions    int     // (pkcs11) Maximum number of concurrent signing sessions (default 1)
+	Mount       string  // (vault) Mount path of the transit secrets engine (default transit)
+	RoleID      string  // (vault) Use AppRole auth with this role ID. PIN is the secret ID.
+	Hierarchy   string  // (tpm) Hierarchy to create keys under: owner (default), endorsement, platform or null
+	Region      string  // (aws) Override the region from the SDK environment and shared config
+	Profile     string  // (aws) Named profile to use from the shared config files
+	// (pkcs11) Override attributes of generated private keys, e.g. extractable: false
+	KeyAttributes map[string]string
 
 	name string
 }
 
 type KeyConfig struct {
 	Token           string   // Token section to use for this key (linux)
-	Alias           string   // This is an alias for another key
+	Alias           string   // This is an alias for another key. Token, label and ID come from that key, other unset values are inherited from it
 	Label           string   // Select a key by label
-	ID              string   // Select a key by ID (hex notation)
+	ID              string   // Select a key by ID (hex notation, colons optional)
 	PgpCertificate  string   // Path to PGP certificate associated with this key
 	X509Certificate string   // Path to X.509 certificate associated with this key
-	KeyFile         string   // For "file" tokens, path to the private key
+	ExtraCerts      []string // Paths to intermediate certificates to include in signatures along with x509certificate
+	KeyFile         string   // For "file" tokens, path to the private key (default: <provider>/<label>.key)
 	IsPkcs12        bool     // If true, key file contains PKCS#12 key and certificate chain
 	Roles           []string // List of user roles that can use this key
+	Hash            string   // Default digest algorithm if none is specified, e.g. SHA-512 or SHA3-256 (default SHA-256)
+	PSS             bool     // If true, use RSA-PSS padding for PKCS#7 signatures
 	Timestamp       bool     // If true, attach a timestamped countersignature when possible
 	Timestamper     string   // If set, use the named timestamper to countersign
+	TimestampURL    string   // If set, countersign using this RFC 3161 server instead of the timestamp section's URLs
+	TimestampType   string   // Timestamp format for Authenticode signatures: rfc3161 (default) or legacy
 	Hide            bool     // If true, then omit this key from 'remote list-keys'
-
-	name  string
-	token *TokenConfig
+	CommonName      string   // Subject commonName for requests made when generating this key
+	Organization    string   // Subject organization for requests made when generating this key
+	ApkLineage      string   // Path to an APK signing certificate lineage from "apksigner rotate", implies v3 signatures
+	Deprecated      bool     // Set by "relic token rotate" on a replaced key. It can't sign, but "relic verify --key" accepts its certificate until retireafter
+	RetireAfter     string   // For deprecated keys, the date (YYYY-MM-DD or RFC 3339) after which their signatures are no longer accepted
+	ReplacedBy      string   // For deprecated keys, the key that signs in their place
+
+	name   string
+	token  *TokenConfig
+	target *KeyConfig // the key this one is an alias of
 }
 
 type ServerConfig struct {
 	Listen     string // Port to listen for TLS connections
 	ListenHTTP string // Port to listen for plaintext connections
+	ListenGRPC string // Port to listen for gRPC over TLS, using the same key and certificate
 	KeyFile    string // Path to TLS key file
 	CertFile   string // Path to TLS certificate chain
 	LogFile    string // Optional error log
@@ -94,10 +121,21 @@ type ServerConfig struct {
 	TokenCheckTimeout  int
 	TokenCacheSeconds  int
 
+	HealthzTimeout      int // Seconds to wait for each token to answer /healthz
+	HealthzCacheSeconds int // Seconds to reuse a /healthz result
+
 	ReadHeaderTimeout int
 	ReadTimeout       int
 	WriteTimeout      int
 
+	DrainDelay      int // Seconds to report "draining" before refusing new connections
+	ShutdownTimeout int // Seconds to wait for in-flight requests when stopping
+
+	MaxRequests       int // Sign requests to run at once across all clients (default: unlimited)
+	MaxClientRequests int // Sign requests to run at once for each client (default: unlimited)
+	MaxQueuedRequests int // Sign requests waiting for a turn before more are refused (default: unlimited)
+	QueueTimeout      int // Seconds a sign request waits for its turn before it is refused (default: 60)
+
 	// URLs to all servers in the cluster. If a client uses DirectoryURL to
 	// point to this server (or a load balancer), then we will give them these
 	// URLs as a means to distribute load without needing a middle-box.
@@ -107,6 +145,26 @@ type ServerConfig struct {
 	TrustedProxies []string
 
 	AzureAD *ServerAzureConfig
+
+	// Optional sink for structured audit events
+	Audit *AuditSinkConfig
+}
+
+type AuditSinkConfig struct {
+	Type string // Where to send events: file, syslog or http
+
+	Path string // file: path of the JSON lines log
+
+	Network string // syslog: "udp" or "tcp" to use a remote server, or empty for the local daemon
+	Address string // syslog: host:port of the remote server
+	Tag     string // syslog: tag for log messages (default: relic)
+
+	URL           string // http: endpoint that receives batches of events as a JSON array
+	BatchSize     int    // http: send as soon as this many events are queued (default: 100)
+	FlushInterval int    // http: seconds to wait before sending a partial batch (default: 5)
+	MaxQueue      int    // http: events to hold while the endpoint is failing (default: 10000)
+
+	SigningKey string // Optional name of a key used to sign each event
 }
 
 type ServerAzureConfig struct {
@@ -119,18 +177,23 @@ type ClientConfig struct {
 	Nickname    string   // Name that appears in audit log entries
 	Roles       []string // List of roles that this client possesses
 	Certificate string   // Optional CA certificate(s) that sign client certs instead of using fingerprint-based auth
+	RolesFrom   []string // Also grant roles derived from the client certificate: "ou", "dns", "email" or "uri"
 
 	certs *x509.CertPool
 }
 
 type RemoteConfig struct {
-	URL            string `yaml:",omitempty"` // URL of remote server
-	DirectoryURL   string `yaml:",omitempty"` // URL of directory server
-	KeyFile        string `yaml:",omitempty"` // Path to TLS client key file
-	CertFile       string `yaml:",omitempty"` // Path to TLS client certificate or embedded certificate
-	CaCert         string `yaml:",omitempty"` // Path to CA certificate or embedded certificate
-	ConnectTimeout int    `yaml:",omitempty"` // Connection timeout in seconds
-	Retries        int    `yaml:",omitempty"` // Attempt an operation (at least) N times
+	URL            string  `yaml:",omitempty"` // URL of remote server
+	DirectoryURL   string  `yaml:",omitempty"` // URL of directory server
+	KeyFile        string  `yaml:",omitempty"` // Path to TLS client key file
+	CertFile       string  `yaml:",omitempty"` // Path to TLS client certificate or embedded certificate
+	Pkcs12File     string  `yaml:",omitempty"` // Path to PKCS#12 file with the TLS client key and certificate, instead of keyfile and certfile
+	Pkcs12Password string  `yaml:",omitempty"` // Password for pkcs12file, "file:/path" or "|command" (default: prompt)
+	CaCert         string  `yaml:",omitempty"` // Path to CA certificate or embedded certificate
+	ServerPin      string  `yaml:",omitempty"` // Require the server's TLS certificate to have this SHA-256 fingerprint (hex)
+	ConnectTimeout int     `yaml:",omitempty"` // Connection timeout in seconds
+	Retries        int     `yaml:",omitempty"` // Attempt an operation (at least) N times
+	RetryDelay     float64 `yaml:",omitempty"` // Seconds to wait before the first retry, doubling each time (default 1)
 
 	AccessToken string `yaml:"-"`
 	Interactive bool
@@ -145,6 +208,17 @@ type TimestampConfig struct {
 	Memcache  []string // host:port of memcached to use for caching timestamps
 	RateLimit float64  // limit timestamp requests per second
 	RateBurst int      // allow burst of requests before limit kicks in
+
+	TimestampType string // Default timestamp format for Authenticode signatures: rfc3161 or legacy
+}
+
+type TrustConfig struct {
+	Roots         []string // Files of trusted root certificates (PEM, DER, PKCS#7 or PGP) for "relic verify"
+	Intermediates []string // Files of intermediate certificates to use when building chains
+	SystemRoots   bool     // Also trust the system certificate store
+	Fingerprints  []string // If set, only accept signers whose certificate SHA-256 or PGP key fingerprint (hex) is listed
+	Revocation    string   // Check signing certificates against OCSP or CRLs: "soft" warns if the status can't be fetched, "hard" fails
+	RevocationTTL int      // Seconds to cache OCSP and CRL responses for (default 3600)
 }
 
 type AmqpConfig struct {
@@ -163,23 +237,33 @@ type Config struct {
 	Remote    *RemoteConfig            `yaml:",omitempty"`
 	Timestamp *TimestampConfig         `yaml:",omitempty"`
 	Amqp      *AmqpConfig              `yaml:",omitempty"`
+	Trust     *TrustConfig             `yaml:",omitempty"`
 
 	AuditFile string `yaml:",omitempty"` // Optional log file for signatures
 	PinFile   string `yaml:",omitempty"` // Optional YAML file with additional token PINs
 
-	path string
+	Include []string `yaml:",omitempty"` // Files or globs of more configuration to merge in, relative to this file
+
+	path  string
+	lines map[string]location
 }
 
 func ReadFile(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
+	l := &loader{
+		seen:   make(map[string]bool),
+		lines:  make(map[string]location),
+		origin: make(map[string]string),
+	}
+	if err := l.load(path); err != nil {
 		return nil, err
 	}
 	config := new(Config)
-	err = yaml.Unmarshal(data, config)
-	if err != nil {
-		return nil, err
+	if l.root != nil {
+		if err := l.root.Decode(config); err != nil {
+			return nil, err
+		}
 	}
+	config.lines = l.lines
 	return config, config.Normalize(path)
 }
 
@@ -199,6 +283,11 @@ func (config *Config) Normalize(path string) error {
 		} else if len(fingerprint) != 64 {
 			return errors.New("Client keys must be hex-encoded SHA256 digests of the public key")
 		}
+		for _, source := range client.RolesFrom {
+			if !validRoleSource(source) {
+				return fmt.Errorf("client %s: unknown rolesfrom value %q", fingerprint, source)
+			}
+		}
 		lower := strings.ToLower(fingerprint)
 		normalized[lower] = client
 	}
@@ -232,6 +321,11 @@ func (config *Config) Normalize(path string) error {
 			keyConf.token = config.Tokens[keyConf.Token]
 		}
 	}
+	for keyName := range config.Keys {
+		if err := config.resolveAlias(keyName); err != nil {
+			return err
+		}
+	}
 	if s := config.Server; s != nil {
 		if s.TokenCheckInterval == 0 {
 			s.TokenCheckInterval = 60
@@ -245,6 +339,12 @@ func (config *Config) Normalize(path string) error {
 		if s.TokenCacheSeconds == 0 {
 			s.TokenCacheSeconds = 600
 		}
+		if s.HealthzTimeout == 0 {
+			s.HealthzTimeout = 10
+		}
+		if s.HealthzCacheSeconds == 0 {
+			s.HealthzCacheSeconds = 5
+		}
 		if s.ReadHeaderTimeout == 0 {
 			s.ReadHeaderTimeout = 10
 		}
@@ -254,6 +354,17 @@ func (config *Config) Normalize(path string) error {
 		if s.WriteTimeout == 0 {
 			s.WriteTimeout = 600
 		}
+		if s.ShutdownTimeout == 0 {
+			s.ShutdownTimeout = 300
+		}
+		if s.QueueTimeout == 0 {
+			s.QueueTimeout = 60
+		}
+		if s.Audit != nil {
+			if err := s.Audit.normalize(config); err != nil {
+				return err
+			}
+		}
 	}
 	if r := config.Remote; r != nil {
 		if r.ConnectTimeout == 0 {
@@ -267,12 +378,9 @@ func (config *Config) Normalize(path string) error {
 }
 
 func (config *Config) GetToken(tokenName string) (*TokenConfig, error) {
-	if config.Tokens == nil {
-		return nil, errors.New("No tokens defined in configuration")
-	}
 	tokenConf, ok := config.Tokens[tokenName]
 	if !ok {
-		return nil, fmt.Errorf("Token \"%s\" not found in configuration", tokenName)
+		return nil, sigerrors.TokenNotFoundError{Name: tokenName}
 	}
 	return tokenConf, nil
 }
@@ -289,12 +397,7 @@ func (config *Config) NewToken(name string) *TokenConfig {
 func (config *Config) GetKey(keyName string) (*KeyConfig, error) {
 	keyConf, ok := config.Keys[keyName]
 	if !ok {
-		return nil, fmt.Errorf("Key \"%s\" not found in configuration", keyName)
-	} else if keyConf.Alias != "" {
-		keyConf, ok = config.Keys[keyConf.Alias]
-		if !ok {
-			return nil, fmt.Errorf("Alias \"%s\" points to undefined key \"%s\"", keyName, keyConf.Alias)
-		}
+		return nil, sigerrors.KeyNotConfiguredError{Name: keyName}
 	}
 	if keyConf.Token == "" {
 		return nil, fmt.Errorf("Key \"%s\" does not specify required value 'token'", keyName)
@@ -323,13 +426,12 @@ func (config *Config) GetTimestampConfig() (*TimestampConfig, error) {
 	return tconf, nil
 }
 
-// ListServedTokens returns a list of token names that are accessible by at least one role
+// ListServedTokens returns a list of token names used by any key. Keys without
+// roles are open to every client, so every key is served.
 func (config *Config) ListServedTokens() []string {
 	names := make(map[string]bool)
 	for _, key := range config.Keys {
-		if len(key.Roles) != 0 {
-			names[key.Token] = true
-		}
+		names[key.Token] = true
 	}
 	ret := make([]string, 0, len(names))
 	for name := range names {
@@ -0,0 +1,45 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+func TestNotConfigured(t *testing.T) {
+	cfg := new(Config)
+	cfg.NewToken("tok")
+	cfg.NewKey("key").Token = "tok"
+
+	_, err := cfg.GetToken("tok")
+	require.NoError(t, err)
+	_, err = cfg.GetToken("missing")
+	assert.True(t, errors.As(err, new(sigerrors.TokenNotFoundError)))
+	assert.EqualError(t, err, `Token "missing" not found in configuration`)
+
+	_, err = cfg.GetKey("key")
+	require.NoError(t, err)
+	_, err = cfg.GetKey("missing")
+	assert.True(t, errors.As(err, new(sigerrors.KeyNotConfiguredError)))
+	assert.False(t, errors.As(err, new(sigerrors.KeyNotFoundError)))
+}
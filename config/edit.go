@@ -0,0 +1,173 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+)
+
+// KeyChange is an edit to one entry of the keys section
+type KeyChange struct {
+	Name string
+	// Set replaces these settings, adding any that aren't there. Settings
+	// named with a nil value are removed.
+	Set map[string]any
+	// Remove deletes the entry. Set is ignored.
+	Remove bool
+}
+
+// EditKeys rewrites the configuration file that defines the keys being
+// changed, adding new entries to the same file. Only YAML files can be
+// edited, and all the existing keys must come from the same file. Comments
+// are kept, but the file is otherwise reformatted. The loaded configuration
+// is not updated, so read the file again to see the result. Returns the path
+// that was changed.
+func (config *Config) EditKeys(changes []KeyChange) (string, error) {
+	path := ""
+	for _, change := range changes {
+		if loc := config.lines["keys."+change.Name]; loc.file != "" {
+			if path != "" && path != loc.file {
+				return "", fmt.Errorf("keys are defined in different files %s and %s", path, loc.file)
+			}
+			path = loc.file
+		}
+	}
+	if path == "" {
+		path = config.path
+	}
+	if path == "" {
+		return "", errors.New("configuration was not read from a file")
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".toml":
+		return "", fmt.Errorf("%s: only YAML configuration files can be edited", path)
+	}
+	// start from the file itself, not the interpolated and merged document
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	doc, err := parseYAML(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+	keys := mappingValue(root, "keys")
+	if keys == nil {
+		keys = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, scalarNode("keys"), keys)
+	} else if keys.Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%s: keys is not a mapping", path)
+	}
+	for _, change := range changes {
+		if err := applyKeyChange(keys, change); err != nil {
+			return "", fmt.Errorf("%s: key %s: %w", path, change.Name, err)
+		}
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	err = atomicfile.ReplaceFile(path, func(tempPath string) error {
+		return os.WriteFile(tempPath, buf.Bytes(), 0600)
+	})
+	return path, err
+}
+
+func applyKeyChange(keys *yaml.Node, change KeyChange) error {
+	i := mappingIndex(keys, change.Name)
+	if change.Remove {
+		if i < 0 {
+			return errors.New("not defined in this file")
+		}
+		keys.Content = append(keys.Content[:i], keys.Content[i+2:]...)
+		return nil
+	}
+	var entry *yaml.Node
+	if i < 0 {
+		entry = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys.Content = append(keys.Content, scalarNode(change.Name), entry)
+	} else {
+		entry = keys.Content[i+1]
+		if entry.Kind != yaml.MappingNode {
+			return errors.New("not a mapping")
+		}
+	}
+	for _, name := range sortedKeys(change.Set) {
+		value := change.Set[name]
+		j := mappingIndex(entry, name)
+		if value == nil {
+			if j >= 0 {
+				entry.Content = append(entry.Content[:j], entry.Content[j+2:]...)
+			}
+			continue
+		}
+		node := new(yaml.Node)
+		if err := node.Encode(value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if j >= 0 {
+			// keep any comment attached to the old value
+			node.LineComment = entry.Content[j+1].LineComment
+			entry.Content[j+1] = node
+		} else {
+			entry.Content = append(entry.Content, scalarNode(name), node)
+		}
+	}
+	return nil
+}
+
+func mappingIndex(node *yaml.Node, name string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(node *yaml.Node, name string) *yaml.Node {
+	if i := mappingIndex(node, name); i >= 0 {
+		return node.Content[i+1]
+	}
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
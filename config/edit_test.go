@@ -0,0 +1,99 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditKeys(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"relic.yml": `
+include: [keys.yml]
+tokens:
+  hsm:
+    type: file
+`,
+		"keys.yml": `
+keys:
+  # release signing
+  release:
+    token: hsm
+    label: release
+    id: "01" # old
+    hash: sha256
+`,
+	})
+	cfg, err := ReadFile(filepath.Join(dir, "relic.yml"))
+	require.NoError(t, err)
+	path, err := cfg.EditKeys([]KeyChange{
+		{Name: "release-old", Set: map[string]any{"token": "hsm", "label": "release", "deprecated": true, "replacedby": "release", "retireafter": "2026-02-01"}},
+		{Name: "release", Set: map[string]any{"label": "release-2", "id": nil}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "keys.yml"), path)
+	blob, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(blob), "# release signing")
+	cfg, err = ReadFile(filepath.Join(dir, "relic.yml"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "release-2", cfg.Keys["release"].Label)
+	assert.Empty(t, cfg.Keys["release"].ID)
+	assert.Equal(t, "sha256", cfg.Keys["release"].Hash)
+	old := cfg.Keys["release-old"]
+	require.NotNil(t, old)
+	assert.True(t, old.Deprecated)
+
+	retire, err := old.RetireTime()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 2, 0, 0, 0, 0, time.Local), retire)
+	assert.Len(t, cfg.PreviousKeys("release", retire.Add(-time.Second)), 1)
+	assert.Empty(t, cfg.PreviousKeys("release", retire))
+	assert.Empty(t, cfg.PreviousKeys("release-old", time.Time{}))
+
+	_, err = cfg.EditKeys([]KeyChange{{Name: "release-old", Remove: true}})
+	require.NoError(t, err)
+	cfg, err = ReadFile(filepath.Join(dir, "relic.yml"))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Keys, 1)
+}
+
+func TestEditKeysRejected(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"relic.toml": "[keys.release]\ntoken = \"hsm\"\n",
+	})
+	cfg, err := ReadFile(filepath.Join(dir, "relic.toml"))
+	require.NoError(t, err)
+	_, err = cfg.EditKeys([]KeyChange{{Name: "release", Set: map[string]any{"label": "x"}}})
+	assert.ErrorContains(t, err, "only YAML configuration files can be edited")
+
+	cfg = new(Config)
+	cfg.NewKey("release").RetireAfter = "soon"
+	cfg.Keys["release"].ReplacedBy = "missing"
+	_, err = cfg.Keys["release"].RetireTime()
+	assert.ErrorContains(t, err, "invalid retireafter")
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "keys.release.retireafter")
+	assert.ErrorContains(t, err, "keys.release.replacedby")
+}
@@ -0,0 +1,91 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Parse a configuration file into a YAML document. JSON and TOML files are
+// converted so that they are decoded, interpolated and validated exactly as
+// YAML is. The format is chosen by the file extension, or for other names by
+// the content, with YAML as the default.
+func parseDocument(path string, data []byte) (*yaml.Node, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return parseJSON(data)
+	case ".toml":
+		return parseTOML(data)
+	case ".yml", ".yaml":
+		return parseYAML(data)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) != 0 && trimmed[0] == '{' {
+		return parseJSON(data)
+	}
+	doc, err := parseYAML(data)
+	if err == nil && (len(doc.Content) == 0 || doc.Content[0].Kind == yaml.MappingNode) {
+		return doc, nil
+	}
+	// TOML usually fails to parse as YAML, or parses as something other than
+	// a mapping
+	if tdoc, terr := parseTOML(data); terr == nil {
+		return tdoc, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("expected a mapping at the top level")
+	}
+	return nil, err
+}
+
+func parseYAML(data []byte) (*yaml.Node, error) {
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func parseJSON(data []byte) (*yaml.Node, error) {
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return toDocument(m)
+}
+
+func parseTOML(data []byte) (*yaml.Node, error) {
+	var m map[string]any
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return toDocument(m)
+}
+
+func toDocument(m map[string]any) (*yaml.Node, error) {
+	value := new(yaml.Node)
+	if err := value.Encode(m); err != nil {
+		return nil, err
+	}
+	return &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{value}}, nil
+}
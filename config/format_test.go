@@ -0,0 +1,146 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlConfig = `
+tokens:
+  hsm:
+    provider: /usr/lib64/softhsm/libsofthsm.so
+    pin: "123456"
+    timeout: 30
+keys:
+  release:
+    token: hsm
+    label: release
+    roles: [builder, admin]
+    timestamp: true
+  nightly:
+    alias: release
+    roles: [builder]
+  legacy:
+    token: hsm
+    label: legacy
+    deprecated: true
+    replacedby: release
+  legacy-nightly:
+    alias: legacy
+server:
+  listen: ":6300"
+  siblings:
+    - https://one.example.com
+    - https://two.example.com
+clients:
+  E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855:
+    nickname: builder
+    roles: [builder]
+`
+
+const jsonConfig = `{
+	"tokens": {
+		"hsm": {"provider": "/usr/lib64/softhsm/libsofthsm.so", "pin": "123456", "timeout": 30}
+	},
+	"keys": {
+		"release": {"token": "hsm", "label": "release", "roles": ["builder", "admin"], "timestamp": true},
+		"nightly": {"alias": "release", "roles": ["builder"]},
+		"legacy": {"token": "hsm", "label": "legacy", "deprecated": true, "replacedby": "release"},
+		"legacy-nightly": {"alias": "legacy"}
+	},
+	"server": {
+		"listen": ":6300",
+		"siblings": ["https://one.example.com", "https://two.example.com"]
+	},
+	"clients": {
+		"E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855": {"nickname": "builder", "roles": ["builder"]}
+	}
+}`
+
+const tomlConfig = `
+[tokens.hsm]
+provider = "/usr/lib64/softhsm/libsofthsm.so"
+pin = "123456"
+timeout = 30
+
+[keys.release]
+token = "hsm"
+label = "release"
+roles = ["builder", "admin"]
+timestamp = true
+
+[keys.nightly]
+alias = "release"
+roles = ["builder"]
+
+[keys.legacy]
+token = "hsm"
+label = "legacy"
+deprecated = true
+replacedby = "release"
+
+[keys.legacy-nightly]
+alias = "legacy"
+
+[server]
+listen = ":6300"
+siblings = ["https://one.example.com", "https://two.example.com"]
+
+[clients.E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855]
+nickname = "builder"
+roles = ["builder"]
+`
+
+func readString(t *testing.T, name, contents string) *Config {
+	fp := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(fp, []byte(contents), 0600))
+	cfg, err := ReadFile(fp)
+	require.NoError(t, err)
+	// these only differ by where the file was and how it was laid out
+	cfg.path = ""
+	cfg.lines = nil
+	return cfg
+}
+
+func TestFormats(t *testing.T) {
+	expected := readString(t, "relic.yml", yamlConfig)
+	assert.Equal(t, "/usr/lib64/softhsm/libsofthsm.so", expected.Tokens["hsm"].Provider)
+	assert.Equal(t, []string{"builder"}, expected.Keys["nightly"].Roles)
+	assert.False(t, expected.Keys["nightly"].Deprecated)
+	assert.True(t, expected.Keys["legacy-nightly"].Deprecated)
+	assert.Equal(t, "release", expected.Keys["legacy-nightly"].ReplacedBy)
+	for _, tc := range []struct {
+		name, contents string
+	}{
+		{"relic.json", jsonConfig},
+		{"relic.toml", tomlConfig},
+		// detected by content
+		{"relic.conf", yamlConfig},
+		{"relic.cfg", jsonConfig},
+		{"relic", tomlConfig},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, expected, readString(t, tc.name, tc.contents))
+		})
+	}
+}
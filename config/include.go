@@ -0,0 +1,187 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Top-level sections whose entries are merged from included files, rather
+// than the whole section being replaced
+var mergedSections = map[string]bool{
+	"tokens":  true,
+	"keys":    true,
+	"clients": true,
+}
+
+// Where a setting was read from
+type location struct {
+	file string
+	line int
+}
+
+// loader reads a configuration file and the files it includes into a single
+// document
+type loader struct {
+	root  *yaml.Node
+	seen  map[string]bool
+	lines map[string]location
+	// which file each token, key and client was defined in
+	origin map[string]string
+}
+
+// Read a file, interpolate it, and merge it and everything it includes into
+// the document being built
+func (l *loader) load(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.seen[abs] {
+		return fmt.Errorf("%s: included more than once", path)
+	}
+	l.seen[abs] = true
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := interpolateNode(doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+	includes, err := l.merge(path, node)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range includes {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: include %q: %w", path, pattern, err)
+		} else if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: included file %s does not exist", path, pattern)
+		}
+		// Glob returns matches sorted, so conf.d style numbering works
+		for _, match := range matches {
+			if err := l.load(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Merge the top-level mapping of one file into the document, returning what
+// the file includes. Entries of tokens, keys and clients may only be defined
+// once; other sections are replaced by later files.
+func (l *loader) merge(path string, node *yaml.Node) ([]string, error) {
+	var includes []string
+	first := l.root == nil
+	if first {
+		l.root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name := key.Value
+		if name == "include" {
+			if err := value.Decode(&includes); err != nil {
+				return nil, fmt.Errorf("%s:%d: include: %w", path, key.Line, err)
+			}
+			if !first {
+				// only the main file's include list ends up in the Config
+				continue
+			}
+		}
+		existing := l.lookup(name)
+		switch {
+		case existing == nil:
+			l.root.Content = append(l.root.Content, key, value)
+			l.record(path, key, value, name)
+		case mergedSections[name] && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				entryKey, entryValue := value.Content[j], value.Content[j+1]
+				entry := name + "." + entryKey.Value
+				if prev, ok := l.origin[entry]; ok {
+					return nil, fmt.Errorf("%s:%d: %s is already defined in %s", path, entryKey.Line, entry, prev)
+				}
+				existing.Content = append(existing.Content, entryKey, entryValue)
+				l.record(path, entryKey, entryValue, entry)
+			}
+		default:
+			l.replace(name, value)
+			l.forget(name)
+			l.record(path, key, value, name)
+		}
+	}
+	return includes, nil
+}
+
+func (l *loader) lookup(name string) *yaml.Node {
+	for i := 0; i+1 < len(l.root.Content); i += 2 {
+		if l.root.Content[i].Value == name {
+			return l.root.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func (l *loader) replace(name string, value *yaml.Node) {
+	for i := 0; i+1 < len(l.root.Content); i += 2 {
+		if l.root.Content[i].Value == name {
+			l.root.Content[i+1] = value
+		}
+	}
+}
+
+// Remember where a setting and everything under it came from
+func (l *loader) record(path string, key, value *yaml.Node, name string) {
+	l.lines[name] = location{file: path, line: key.Line}
+	if mergedSections[name] && value.Kind == yaml.MappingNode {
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			l.origin[name+"."+value.Content[j].Value] = path
+		}
+	}
+	recordLines(value, name, func(setting string, line int) {
+		l.lines[setting] = location{file: path, line: line}
+	})
+}
+
+// Drop the locations of a section that was replaced
+func (l *loader) forget(name string) {
+	for setting := range l.lines {
+		if strings.HasPrefix(setting, name+".") {
+			delete(l.lines, setting)
+		}
+	}
+}
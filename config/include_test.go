@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, contents := range files {
+		fp := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0700))
+		require.NoError(t, os.WriteFile(fp, []byte(contents), 0600))
+	}
+	return dir
+}
+
+func TestInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"relic.yml": `
+include: ["conf.d/*.yml", "server.toml"]
+tokens:
+  hsm:
+    type: file
+server:
+  listen: ":6300"
+  numworkers: 4
+`,
+		"conf.d/10-alpha.yml": `
+keys:
+  alpha:
+    token: hsm
+    label: alpha
+`,
+		"conf.d/20-beta.yml": `
+tokens:
+  beta:
+    type: file
+keys:
+  beta:
+    token: beta
+    keyfile: /nonexistent
+`,
+		"server.toml": `
+[server]
+listen = ":6400"
+`,
+	})
+	cfg, err := ReadFile(filepath.Join(dir, "relic.yml"))
+	require.NoError(t, err)
+	assert.Len(t, cfg.Tokens, 2)
+	assert.Len(t, cfg.Keys, 2)
+	assert.Equal(t, "hsm", cfg.Keys["alpha"].Token)
+	// later files replace whole sections other than tokens, keys and clients
+	assert.Equal(t, ":6400", cfg.Server.Listen)
+	assert.Zero(t, cfg.Server.NumWorkers)
+	// problems are reported against the file they came from
+	err = cfg.Validate()
+	var verrs ValidationErrors
+	require.ErrorAs(t, err, &verrs)
+	require.Len(t, verrs, 1)
+	assert.Equal(t, filepath.Join(dir, "conf.d/20-beta.yml"), verrs[0].File)
+	assert.Equal(t, 8, verrs[0].Line)
+	assert.Equal(t, "keys.beta.keyfile", verrs[0].Setting)
+}
+
+func TestIncludeDuplicate(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"relic.yml": `
+include: [team.yml]
+keys:
+  alpha:
+    token: hsm
+`,
+		"team.yml": `
+keys:
+  alpha:
+    token: other
+`,
+	})
+	_, err := ReadFile(filepath.Join(dir, "relic.yml"))
+	assert.ErrorContains(t, err, "keys.alpha is already defined in")
+
+	dir = writeFiles(t, map[string]string{
+		"relic.yml": "include: [missing.yml]\n",
+	})
+	_, err = ReadFile(filepath.Join(dir, "relic.yml"))
+	assert.ErrorContains(t, err, "does not exist")
+
+	dir = writeFiles(t, map[string]string{
+		"relic.yml": "include: [relic.yml]\n",
+	})
+	_, err = ReadFile(filepath.Join(dir, "relic.yml"))
+	assert.ErrorContains(t, err, "included more than once")
+}
@@ -0,0 +1,88 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ${NAME} for an environment variable or ${file:/path} for the contents of a file
+var interpolateRe = regexp.MustCompile(`\$\{(file:[^}]+|[A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Replace ${NAME} and ${file:/path} references in a config value. A reference
+// to an unset variable or unreadable file is an error rather than becoming
+// empty. Any other use of $ is left alone.
+func interpolate(value string) (string, error) {
+	var firstErr error
+	result := interpolateRe.ReplaceAllStringFunc(value, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		if path, ok := strings.CutPrefix(name, "file:"); ok {
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return ""
+			}
+			return strings.TrimRight(string(contents), "\r\n")
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok && firstErr == nil {
+			firstErr = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return result, firstErr
+}
+
+// Interpolate every value in a YAML document before it is decoded
+func interpolateNode(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			if err := interpolateNode(child); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		// only values, not keys
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := interpolateNode(node.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		value, err := interpolate(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		if node.Style == 0 {
+			// resolve the type again so that e.g. numbers can be interpolated
+			node.Tag = ""
+		}
+	}
+	return nil
+}
@@ -16,7 +16,10 @@
 
 package config
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 const defaultTimeout = 60 * time.Second
 
@@ -35,3 +38,121 @@ func (keyConf *KeyConfig) SetToken(tokenConf *TokenConfig) {
 	keyConf.Token = tokenConf.name
 	keyConf.token = tokenConf
 }
+
+// RetireTime parses retireafter. The zero time means the key never retires.
+func (keyConf *KeyConfig) RetireTime() (time.Time, error) {
+	if keyConf.RetireAfter == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, keyConf.RetireAfter); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", keyConf.RetireAfter, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid retireafter %q: expected YYYY-MM-DD or RFC 3339", keyConf.RetireAfter)
+	}
+	// the whole day is included
+	return t.AddDate(0, 0, 1), nil
+}
+
+// PreviousKeys returns the deprecated keys that were replaced by the named
+// key and are still within their grace period, sorted by name
+func (config *Config) PreviousKeys(keyName string, now time.Time) []*KeyConfig {
+	var previous []*KeyConfig
+	for _, name := range sortedKeys(config.Keys) {
+		keyConf := config.Keys[name]
+		if !keyConf.Deprecated || keyConf.ReplacedBy != keyName {
+			continue
+		}
+		if retire, err := keyConf.RetireTime(); err != nil || (!retire.IsZero() && !now.Before(retire)) {
+			continue
+		}
+		previous = append(previous, keyConf)
+	}
+	return previous
+}
+
+// Follow a key alias to the section that defines the physical key and copy
+// its location into the alias
+func (config *Config) resolveAlias(keyName string) error {
+	keyConf := config.Keys[keyName]
+	if keyConf.Alias == "" {
+		return nil
+	}
+	if keyConf.Token != "" || keyConf.Label != "" || keyConf.ID != "" || keyConf.KeyFile != "" {
+		return fmt.Errorf("key %q is an alias and can't also set token, label, id or keyfile", keyName)
+	}
+	seen := map[string]bool{keyName: true}
+	target := keyConf
+	for target.Alias != "" {
+		if seen[target.Alias] {
+			return fmt.Errorf("alias %q is part of a loop", keyName)
+		}
+		seen[target.Alias] = true
+		next := config.Keys[target.Alias]
+		if next == nil {
+			return fmt.Errorf("alias %q points to undefined key %q", keyName, target.Alias)
+		}
+		target = next
+	}
+	keyConf.inherit(target)
+	keyConf.target = target
+	return nil
+}
+
+// Copy the key location from another key, and any settings this one doesn't
+// have
+func (keyConf *KeyConfig) inherit(target *KeyConfig) {
+	keyConf.Token = target.Token
+	keyConf.token = target.token
+	keyConf.Label = target.Label
+	keyConf.ID = target.ID
+	keyConf.KeyFile = target.KeyFile
+	keyConf.IsPkcs12 = target.IsPkcs12
+	if keyConf.PgpCertificate == "" {
+		keyConf.PgpCertificate = target.PgpCertificate
+	}
+	if keyConf.X509Certificate == "" {
+		keyConf.X509Certificate = target.X509Certificate
+	}
+	if keyConf.ExtraCerts == nil {
+		keyConf.ExtraCerts = target.ExtraCerts
+	}
+	if keyConf.ApkLineage == "" {
+		keyConf.ApkLineage = target.ApkLineage
+	}
+	if keyConf.Roles == nil {
+		keyConf.Roles = target.Roles
+	}
+	if keyConf.Hash == "" {
+		keyConf.Hash = target.Hash
+	}
+	if keyConf.Timestamper == "" {
+		keyConf.Timestamper = target.Timestamper
+	}
+	if keyConf.TimestampURL == "" {
+		keyConf.TimestampURL = target.TimestampURL
+	}
+	if keyConf.TimestampType == "" {
+		keyConf.TimestampType = target.TimestampType
+	}
+	if keyConf.CommonName == "" {
+		keyConf.CommonName = target.CommonName
+	}
+	if keyConf.Organization == "" {
+		keyConf.Organization = target.Organization
+	}
+	// a deprecated key can't sign under another name either
+	if !keyConf.Deprecated && target.Deprecated {
+		keyConf.Deprecated = true
+		if keyConf.ReplacedBy == "" {
+			keyConf.ReplacedBy = target.ReplacedBy
+		}
+		if keyConf.RetireAfter == "" {
+			keyConf.RetireAfter = target.RetireAfter
+		}
+	}
+	keyConf.PSS = keyConf.PSS || target.PSS
+	keyConf.Timestamp = keyConf.Timestamp || target.Timestamp
+	keyConf.Hide = keyConf.Hide || target.Hide
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces secrets in a redacted configuration
+const RedactedValue = "***"
+
+// Redacted returns a copy of the configuration with PINs, passwords, embedded
+// private keys and credentials in URLs replaced by RedactedValue, so that it
+// can be printed for debugging. PINs read from a file keep the "file:" path
+// since the path itself is not a secret.
+func (config *Config) Redacted() *Config {
+	c := *config
+	if config.Tokens != nil {
+		c.Tokens = make(map[string]*TokenConfig, len(config.Tokens))
+		for name, tokenConf := range config.Tokens {
+			t := *tokenConf
+			if t.Pin != nil {
+				pin := redactSecret(*t.Pin)
+				t.Pin = &pin
+			}
+			c.Tokens[name] = &t
+		}
+	}
+	if config.Server != nil {
+		s := *config.Server
+		s.KeyFile = redactKey(s.KeyFile)
+		if s.Audit != nil {
+			a := *s.Audit
+			a.URL = redactURL(a.URL)
+			s.Audit = &a
+		}
+		c.Server = &s
+	}
+	if config.Remote != nil {
+		r := *config.Remote
+		r.KeyFile = redactKey(r.KeyFile)
+		r.Pkcs12Password = redactSecret(r.Pkcs12Password)
+		if r.AccessToken != "" {
+			r.AccessToken = RedactedValue
+		}
+		c.Remote = &r
+	}
+	if config.Amqp != nil {
+		a := *config.Amqp
+		a.URL = redactURL(a.URL)
+		a.KeyFile = redactKey(a.KeyFile)
+		c.Amqp = &a
+	}
+	return &c
+}
+
+// Redact a PIN or password unless it is empty, "protected", or names the
+// file it is read from
+func redactSecret(value string) string {
+	if value == "" || value == "protected" || strings.HasPrefix(value, "file:") {
+		return value
+	}
+	return RedactedValue
+}
+
+// Redact a key file setting that holds the key itself rather than a path
+func redactKey(value string) string {
+	if strings.Contains(value, "-----BEGIN") {
+		return RedactedValue
+	}
+	return value
+}
+
+// Redact the password in a URL's userinfo
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	// build it by hand as url.UserPassword would escape the placeholder
+	userinfo := url.User(u.User.Username()).String() + ":" + RedactedValue + "@"
+	u.User = nil
+	return strings.Replace(u.String(), "://", "://"+userinfo, 1)
+}
@@ -0,0 +1,244 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem with one setting in the configuration
+type ValidationError struct {
+	File string
+	Line int
+	// Dotted path to the setting, e.g. keys.mykey.token
+	Setting string
+	Err     error
+}
+
+func (e ValidationError) Error() string {
+	if e.Line != 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", e.File, e.Line, e.Setting, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.File, e.Setting, e.Err)
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors holds every problem found by Validate
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks that the configuration is usable without opening any
+// tokens: that keys refer to defined tokens and that the files named by
+// tokens, keys and the server exist. All problems are returned together as
+// ValidationErrors.
+func (config *Config) Validate() error {
+	v := &validator{config: config}
+	for _, tokenName := range sortedKeys(config.Tokens) {
+		tokenConf := config.Tokens[tokenName]
+		prefix := "tokens." + tokenName
+		switch tokenConf.Type {
+		case "pkcs11":
+			if tokenConf.Provider == "" {
+				v.add(prefix+".provider", errors.New("path to the PKCS#11 provider module is required"))
+			} else {
+				v.checkFile(prefix+".provider", tokenConf.Provider, false)
+			}
+		case "file":
+			if tokenConf.Provider != "" {
+				v.checkFile(prefix+".provider", tokenConf.Provider, true)
+			}
+		case "tpm":
+			switch strings.ToLower(tokenConf.Hierarchy) {
+			case "", "owner", "endorsement", "platform", "null":
+			default:
+				v.add(prefix+".hierarchy", fmt.Errorf("unknown hierarchy %q", tokenConf.Hierarchy))
+			}
+		}
+		if len(tokenConf.KeyAttributes) != 0 && tokenConf.Type != "pkcs11" {
+			v.add(prefix+".keyattributes", fmt.Errorf("only supported for pkcs11 tokens, not %s", tokenConf.Type))
+		}
+	}
+	for _, keyName := range sortedKeys(config.Keys) {
+		keyConf := config.Keys[keyName]
+		prefix := "keys." + keyName
+		// for aliases, only check what the alias itself sets
+		target := keyConf.target
+		if target == nil {
+			target = new(KeyConfig)
+		}
+		own := func(value, inherited string) string {
+			if value == inherited {
+				return ""
+			}
+			return value
+		}
+		if keyConf.target != nil {
+			// the token was checked on the key being aliased
+		} else if keyConf.Token == "" {
+			v.add(prefix+".token", errors.New("token is required"))
+		} else if config.Tokens[keyConf.Token] == nil {
+			v.add(prefix+".token", fmt.Errorf("token %q is not defined", keyConf.Token))
+		}
+		if ts := own(keyConf.Timestamper, target.Timestamper); ts != "" && (config.Timestamp == nil || config.Timestamp.NamedURLs[ts] == nil) {
+			v.add(prefix+".timestamper", fmt.Errorf("timestamper %q is not defined", ts))
+		}
+		v.checkTimestampType(prefix+".timestamptype", own(keyConf.TimestampType, target.TimestampType))
+		v.checkFile(prefix+".keyfile", own(keyConf.KeyFile, target.KeyFile), false)
+		v.checkFile(prefix+".x509certificate", own(keyConf.X509Certificate, target.X509Certificate), false)
+		v.checkFile(prefix+".pgpcertificate", own(keyConf.PgpCertificate, target.PgpCertificate), false)
+		if keyConf.target == nil || !slices.Equal(keyConf.ExtraCerts, target.ExtraCerts) {
+			for _, fp := range keyConf.ExtraCerts {
+				v.checkFile(prefix+".extracerts", fp, false)
+			}
+		}
+		v.checkFile(prefix+".apklineage", own(keyConf.ApkLineage, target.ApkLineage), false)
+		if _, err := keyConf.RetireTime(); err != nil {
+			v.add(prefix+".retireafter", err)
+		}
+		if keyConf.ReplacedBy != "" && config.Keys[keyConf.ReplacedBy] == nil {
+			v.add(prefix+".replacedby", fmt.Errorf("key %q is not defined", keyConf.ReplacedBy))
+		}
+	}
+	if s := config.Server; s != nil {
+		v.checkFile("server.keyfile", s.KeyFile, false)
+		v.checkFile("server.certfile", s.CertFile, false)
+	}
+	if t := config.Timestamp; t != nil {
+		v.checkFile("timestamp.cacert", t.CaCert, false)
+		v.checkTimestampType("timestamp.timestamptype", t.TimestampType)
+	}
+	if t := config.Trust; t != nil {
+		for _, fp := range t.Roots {
+			v.checkFile("trust.roots", fp, false)
+		}
+		for _, fp := range t.Intermediates {
+			v.checkFile("trust.intermediates", fp, false)
+		}
+	}
+	if len(v.errs) != 0 {
+		return v.errs
+	}
+	return nil
+}
+
+type validator struct {
+	config *Config
+	errs   ValidationErrors
+}
+
+func (v *validator) add(setting string, err error) {
+	loc := v.config.locate(setting)
+	if loc.file == "" {
+		loc.file = v.config.path
+	}
+	v.errs = append(v.errs, ValidationError{
+		File:    loc.file,
+		Line:    loc.line,
+		Setting: setting,
+		Err:     err,
+	})
+}
+
+func (v *validator) checkTimestampType(setting, tsType string) {
+	switch tsType {
+	case "", TimestampTypeRFC3161, TimestampTypeLegacy:
+	default:
+		v.add(setting, fmt.Errorf("unknown timestamp type %q", tsType))
+	}
+}
+
+// Check that a file, or a directory if dir is set, exists and can be read
+func (v *validator) checkFile(setting, path string, dir bool) {
+	if path == "" {
+		return
+	}
+	st, err := os.Stat(path)
+	switch {
+	case err != nil:
+		v.add(setting, err)
+	case dir && !st.IsDir():
+		v.add(setting, fmt.Errorf("%s is not a directory", path))
+	case !dir && st.IsDir():
+		v.add(setting, fmt.Errorf("%s is a directory", path))
+	case !dir:
+		f, err := os.Open(path)
+		if err != nil {
+			v.add(setting, err)
+			return
+		}
+		f.Close()
+	}
+}
+
+// Find where a setting was defined, or failing that the nearest enclosing
+// section
+func (config *Config) locate(setting string) location {
+	for setting != "" {
+		if loc := config.lines[setting]; loc.line != 0 {
+			return loc
+		}
+		i := strings.LastIndexByte(setting, '.')
+		if i < 0 {
+			break
+		}
+		setting = setting[:i]
+	}
+	return location{}
+}
+
+// Walk a YAML document and report the line of each mapping key by its dotted
+// path
+func recordLines(node *yaml.Node, prefix string, record func(setting string, line int)) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name := key.Value
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		record(name, key.Line)
+		recordLines(value, name, record)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
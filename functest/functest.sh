@@ -106,7 +106,7 @@ echo
 ### appx
 pkg="App1_1.0.3.0_x64.appx"
 $client verify --cert "testkeys/ralph.crt" "packages/$pkg"
-$relic remote sign -k rsa2048 -f "packages/$pkg" -o "$signed/$pkg"
+$relic remote sign -k rsa2048 -f "packages/$pkg" -o "$signed/$pkg" --rewrite-publisher
 $verify_2048x "$signed/$pkg"
 echo
 
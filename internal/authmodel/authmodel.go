@@ -23,6 +23,9 @@ type UserInfo interface {
 	// AuditContext amends an audit record with the authenticated user's name
 	// and other relevant details
 	AuditContext(info *audit.Info)
+	// Identity names the client so that concurrent requests from the same
+	// caller can be grouped together
+	Identity() string
 }
 
 // New creates an authenticator based on the provided server configuration
@@ -52,14 +55,18 @@ func Middleware(a Authenticator) func(http.Handler) http.Handler {
 			} else if info == nil {
 				panic("authenticator returned nil without an error")
 			}
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, ctxKeyUserInfo, info)
-			r = r.WithContext(ctx)
+			r = r.WithContext(WithUserInfo(r.Context(), info))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// WithUserInfo returns a context carrying the authenticated user, for servers
+// that authenticate outside of Middleware
+func WithUserInfo(ctx context.Context, info UserInfo) context.Context {
+	return context.WithValue(ctx, ctxKeyUserInfo, info)
+}
+
 // RequestInfo returns information about the calling user
 func RequestInfo(req *http.Request) UserInfo {
 	info, ok := req.Context().Value(ctxKeyUserInfo).(UserInfo)
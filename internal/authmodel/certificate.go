@@ -60,7 +60,7 @@ func (a *CertificateAuth) Authenticate(req *http.Request) (UserInfo, error) {
 
 	user := &CertificateInfo{
 		Name:  client.Nickname,
-		Roles: client.Roles,
+		Roles: append(client.CertRoles(cert), client.Roles...),
 	}
 	if user.Name == "" {
 		user.Name = encoded[:12]
@@ -91,7 +91,21 @@ func (c *CertificateInfo) AuditContext(info *audit.Info) {
 	}
 }
 
+// Identity is the client's nickname, plus the certificate subject when the
+// client was matched through a CA
+func (c *CertificateInfo) Identity() string {
+	if c.Subject != "" {
+		return c.Name + "/" + c.Subject
+	}
+	return c.Name
+}
+
+// Allowed checks whether any of the client's roles can use the key. Keys
+// without roles can be used by every authenticated client.
 func (c *CertificateInfo) Allowed(keyConf *config.KeyConfig) bool {
+	if len(keyConf.Roles) == 0 {
+		return true
+	}
 	for _, keyRole := range keyConf.Roles {
 		for _, clientRole := range c.Roles {
 			if keyRole == clientRole {
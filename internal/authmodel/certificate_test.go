@@ -0,0 +1,87 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authmodel
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func makeClientCert(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "build01", OrganizationalUnit: []string{"Release"}},
+		DNSNames:     []string{"build01.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestCertificateRoles(t *testing.T) {
+	cert := makeClientCert(t)
+	auth := &CertificateAuth{Config: &config.Config{
+		Clients: map[string]*config.ClientConfig{
+			fingerprint(cert): {
+				Nickname:  "build01",
+				Roles:     []string{"builders"},
+				RolesFrom: []string{"ou", "dns"},
+			},
+		},
+	}}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	user, err := auth.Authenticate(req)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		roles   []string
+		allowed bool
+	}{
+		{"certificate OU", []string{"ou:Release"}, true},
+		{"certificate DNS name", []string{"other", "dns:build01.example.com"}, true},
+		{"configured role", []string{"builders"}, true},
+		{"no overlap", []string{"ou:Other", "testers"}, false},
+		{"certificate value without source", []string{"Release"}, false},
+		{"no roles", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.allowed, user.Allowed(&config.KeyConfig{Roles: c.roles}))
+		})
+	}
+}
@@ -158,6 +158,14 @@ func (i *PolicyInfo) AuditContext(info *audit.Info) {
 	}
 }
 
+// Identity is the token subject, qualified by its issuer if there is one
+func (i *PolicyInfo) Identity() string {
+	if iss, ok := i.Claims["iss"].(string); ok && iss != "" {
+		return iss + " " + i.Subject
+	}
+	return i.Subject
+}
+
 type policyRequest struct {
 	Input policyInput `json:"input"`
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/sassoftware/relic/v8/internal/zhttp"
@@ -22,6 +24,9 @@ type Problem struct {
 	// error-specific
 	Param  string   `json:"param,omitempty"`
 	Errors []string `json:"errors,omitempty"`
+
+	// RetryAfter is sent as a Retry-After header if set
+	RetryAfter time.Duration `json:"-"`
 }
 
 func (e Problem) Error() string {
@@ -44,6 +49,9 @@ func (e Problem) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 	blob, _ := json.MarshalIndent(e, "", "  ")
 	rw.Header().Set("Content-Type", "application/problem+json")
+	if e.RetryAfter > 0 {
+		rw.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
 	rw.WriteHeader(e.Status)
 	_, _ = rw.Write(blob)
 }
@@ -98,6 +106,17 @@ func MissingParameterError(param string) Problem {
 	}
 }
 
+// KeyForbiddenError is returned both for keys that don't exist and keys the
+// client isn't authorized for, so that key names can't be probed
+func KeyForbiddenError(keyName string) Problem {
+	return Problem{
+		Status: http.StatusForbidden,
+		Type:   ProblemBase + "key-forbidden",
+		Detail: "Key \"" + keyName + "\" does not exist or the client is not authorized to use it",
+		Param:  "key",
+	}
+}
+
 func BadParameterError(err error) Problem {
 	return Problem{
 		Status: http.StatusBadRequest,
@@ -106,6 +125,14 @@ func BadParameterError(err error) Problem {
 	}
 }
 
+func UnsupportedDigestError(err error) Problem {
+	return Problem{
+		Status: http.StatusBadRequest,
+		Type:   ProblemBase + "unknown-digest-algorithm",
+		Detail: err.Error(),
+	}
+}
+
 func TokenAuthorizationError(code int, errors []string) Problem {
 	p := Problem{
 		Status: code,
@@ -120,6 +147,18 @@ func TokenAuthorizationError(code int, errors []string) Problem {
 	return p
 }
 
+// TooManyRequestsError is returned when the server is too busy to accept a
+// request, either because its queue is full or because the request waited too
+// long for its turn
+func TooManyRequestsError(detail string, retryAfter time.Duration) Problem {
+	return Problem{
+		Status:     http.StatusTooManyRequests,
+		Type:       ProblemBase + "too-many-requests",
+		Detail:     detail,
+		RetryAfter: retryAfter,
+	}
+}
+
 func NoCertificateError(certType string) Problem {
 	return Problem{
 		Status: http.StatusBadRequest,
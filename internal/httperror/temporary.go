@@ -15,7 +15,8 @@ func Temporary(err error) bool {
 	if err == nil {
 		return false
 	}
-	if e, ok := err.(temporary); ok && e.Temporary() {
+	var e temporary
+	if errors.As(err, &e) && e.Temporary() {
 		return true
 	}
 	switch {
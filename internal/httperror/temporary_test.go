@@ -0,0 +1,47 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package httperror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemporary(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("oops"), false},
+		{"unavailable", ResponseError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"wrapped unavailable", fmt.Errorf("key %q: %w", "foo", ResponseError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"wrapped not found", fmt.Errorf("key %q: %w", "foo", ResponseError{StatusCode: http.StatusNotFound}), false},
+		{"wrapped deadline", fmt.Errorf("sign: %w", context.DeadlineExceeded), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Temporary(c.err))
+		})
+	}
+}
@@ -19,7 +19,11 @@ package signinit
 import (
 	"context"
 	"crypto"
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
@@ -31,6 +35,16 @@ import (
 	"github.com/sassoftware/relic/v8/token"
 )
 
+// chain problems already reported, so a server doesn't repeat them for every
+// request
+var warned sync.Map
+
+func warnOnce(keyName, warning string) {
+	if _, loaded := warned.LoadOrStore(keyName+"\x00"+warning, true); !loaded {
+		fmt.Fprintf(os.Stderr, "Warning: key %s: %s\n", keyName, warning)
+	}
+}
+
 // InitKey loads the cert chain for a key
 func InitKey(ctx context.Context, tok token.Token, keyName string) (*certloader.Certificate, *config.KeyConfig, error) {
 	key, err := tok.GetKey(ctx, keyName)
@@ -38,12 +52,34 @@ func InitKey(ctx context.Context, tok token.Token, keyName string) (*certloader.
 		return nil, nil, err
 	}
 	kconf := key.Config()
-	// parse certificates
-	cert, err := certloader.LoadTokenCertificates(key, kconf.X509Certificate, kconf.PgpCertificate, key.Certificate())
+	if kconf.Deprecated {
+		if kconf.ReplacedBy != "" {
+			return nil, nil, fmt.Errorf("key %s was rotated out and can only be used to verify; sign with %s instead", keyName, kconf.ReplacedBy)
+		}
+		return nil, nil, fmt.Errorf("key %s was rotated out and can only be used to verify", keyName)
+	}
+	// parse certificates. Signatures made with the result are bound to ctx so
+	// that a request's deadline reaches the token.
+	cert, err := certloader.LoadTokenCertificates(token.WithContext(ctx, key), kconf.X509Certificate, kconf.PgpCertificate, key.Certificate())
 	if err != nil {
 		return nil, nil, err
 	}
 	cert.KeyName = keyName
+	if len(kconf.ExtraCerts) != 0 {
+		warnings, err := cert.LoadExtraCerts(kconf.ExtraCerts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading extra certificates: %w", err)
+		}
+		for _, warning := range warnings {
+			warnOnce(keyName, warning)
+		}
+	}
+	if kconf.ApkLineage != "" {
+		cert.ApkLineage, err = os.ReadFile(kconf.ApkLineage)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading APK lineage: %w", err)
+		}
+	}
 	return cert, kconf, nil
 }
 
@@ -58,6 +94,14 @@ func Init(ctx context.Context, mod *signers.Signer, tok token.Token, keyName str
 	auditInfo := audit.New(kconf.Name(), mod.Name, hash)
 	now := time.Now().UTC()
 	auditInfo.SetTimestamp(now)
+	// the audit log records when the signature was actually made
+	signTime := now
+	if v := flags.GetString("sign-time"); v != "" {
+		signTime, err = signers.ParseSignTime(v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	if cert.Leaf != nil {
 		auditInfo.SetX509Cert(cert.Leaf)
 	} else if mod.CertTypes&signers.CertTypeX509 != 0 {
@@ -68,20 +112,33 @@ func Init(ctx context.Context, mod *signers.Signer, tok token.Token, keyName str
 	} else if mod.CertTypes&signers.CertTypePgp != 0 {
 		return nil, nil, sigerrors.ErrNoCertificate{Type: "pgp"}
 	}
-	if (kconf.Timestamp || kconf.Timestamper != "") && !flags.GetBool("no-timestamp") {
+	if UsePSS(kconf, flags.GetBool("pss"), flags.GetBool("no-pss")) {
+		if err := CheckPSS(cert); err != nil {
+			return nil, nil, err
+		}
+		cert.PSS = true
+	}
+	wantTimestamp := kconf.Timestamp || kconf.Timestamper != "" || kconf.TimestampURL != "" || flags.GetBool("timestamp")
+	if wantTimestamp && !flags.GetBool("no-timestamp") {
 		t, err := GetTimestamper()
 		if err != nil {
 			return nil, nil, err
 		}
 		// select the desired timestamp service (or use the default if empty)
+		legacy, err := legacyTimestamps(kconf)
+		if err != nil {
+			return nil, nil, err
+		}
 		cert.Timestamper = namedTimestamper{
 			client: t,
 			name:   kconf.Timestamper,
+			url:    kconf.TimestampURL,
+			legacy: legacy,
 		}
 	}
 	opts := signers.SignOpts{
 		Hash:  hash,
-		Time:  now,
+		Time:  signTime,
 		Audit: auditInfo,
 		Flags: flags,
 	}
@@ -89,6 +146,22 @@ func Init(ctx context.Context, mod *signers.Signer, tok token.Token, keyName str
 	return cert, &opts, nil
 }
 
+// UsePSS reports whether to sign with RSA-PSS padding, given the key
+// configuration and the --pss and --no-pss flags
+func UsePSS(kconf *config.KeyConfig, pss, noPSS bool) bool {
+	return (kconf.PSS && !noPSS) || pss
+}
+
+// CheckPSS returns an error if cert can't make RSA-PSS signatures
+func CheckPSS(cert *certloader.Certificate) error {
+	if signer := cert.Signer(); signer == nil {
+		return errors.New("RSA-PSS requires a private key")
+	} else if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return errors.New("RSA-PSS requires a RSA key")
+	}
+	return nil
+}
+
 func PublishAudit(info *audit.Info) error {
 	aconf := shared.CurrentConfig.Amqp
 	if aconf != nil && aconf.URL != "" {
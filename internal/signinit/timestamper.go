@@ -15,9 +15,11 @@ package signinit
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/lib/pkcs7"
 	"github.com/sassoftware/relic/v8/lib/pkcs9"
 	"github.com/sassoftware/relic/v8/lib/pkcs9/tsclient"
@@ -39,9 +41,10 @@ func GetTimestamper() (pkcs9.Timestamper, error) {
 }
 
 func newTimestamper() (timestamper pkcs9.Timestamper, err error) {
-	tsconf, err := shared.CurrentConfig.GetTimestampConfig()
-	if err != nil {
-		return nil, err
+	tsconf := shared.CurrentConfig.Timestamp
+	if tsconf == nil {
+		// keys may name their own timestamp server
+		tsconf = new(config.TimestampConfig)
 	}
 	timestamper, err = tsclient.New(tsconf)
 	if err != nil {
@@ -50,14 +53,40 @@ func newTimestamper() (timestamper pkcs9.Timestamper, err error) {
 	return timestamper, nil
 }
 
-// wrapper that selects a named timestamp service
+// wrapper that selects a named timestamp service, or a key's own server
 type namedTimestamper struct {
 	client pkcs9.Timestamper
 	name   string
+	url    string
+	legacy bool
 }
 
 func (t namedTimestamper) Timestamp(ctx context.Context, req *pkcs9.Request) (*pkcs7.ContentInfoSignedData, error) {
 	r2 := *req
 	r2.Name = t.name
+	if t.url != "" {
+		r2.URLs = []string{t.url}
+	}
+	if t.legacy && req.Authenticode {
+		// only Authenticode signatures can carry a legacy timestamp
+		r2.Legacy = true
+	}
 	return t.client.Timestamp(ctx, &r2)
 }
+
+// legacyTimestamps returns true if the key or the timestamp configuration
+// selects Microsoft-style timestamps for Authenticode signatures
+func legacyTimestamps(kconf *config.KeyConfig) (bool, error) {
+	tsType := kconf.TimestampType
+	if tsType == "" && shared.CurrentConfig.Timestamp != nil {
+		tsType = shared.CurrentConfig.Timestamp.TimestampType
+	}
+	switch tsType {
+	case "", config.TimestampTypeRFC3161:
+		return false, nil
+	case config.TimestampTypeLegacy:
+		return true, nil
+	default:
+		return false, fmt.Errorf("key %q: unknown timestamp type %q", kconf.Name(), tsType)
+	}
+}
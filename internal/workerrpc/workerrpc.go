@@ -16,6 +16,8 @@
 
 package workerrpc
 
+import "github.com/sassoftware/relic/v8/token"
+
 const (
 	Ping   = "/ping"
 	GetKey = "/getKey"
@@ -38,4 +40,10 @@ type Response struct {
 	Err       string
 	Retryable bool
 	Usage     bool
+	// PKCS#11 return value, if the error came from the token
+	ErrCode uint
+	// Worker process that handled the request and its session pool state,
+	// returned by ping
+	Pid      int
+	Sessions *token.SessionStats
 }
@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package atomicfile
+
+import (
+	"os"
+	"syscall"
+)
+
+func copyOwner(info os.FileInfo, path string) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if cur, err := os.Stat(path); err == nil {
+		if st2, ok := cur.Sys().(*syscall.Stat_t); ok && st2.Uid == st.Uid && st2.Gid == st.Gid {
+			return nil
+		}
+	}
+	return os.Chown(path, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,57 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReplaceFile safely rewrites an existing file. A temporary path in the same
+// directory is passed to write, and only if it succeeds is the result given
+// the original's mode and ownership and renamed over it. If anything fails the
+// original is left untouched and the temporary file is removed.
+func ReplaceFile(path string, write func(tempPath string) error) (err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	} else if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", path)
+	}
+	tempfile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempfile.Name()
+	tempfile.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(tempPath)
+		}
+	}()
+	if err := write(tempPath); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyOwner(info, tempPath); err != nil {
+		return fmt.Errorf("preserving ownership of %s: %w", path, err)
+	}
+	return os.Rename(tempPath, path)
+}
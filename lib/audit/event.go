@@ -0,0 +1,83 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package audit
+
+import (
+	"time"
+)
+
+// Outcomes of a signing request
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDenied  = "denied"
+)
+
+// Event is the structured form of an audit record that is sent to a Sink
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	Key       string    `json:"key"`
+	SigType   string    `json:"sig_type"`
+	Digest    string    `json:"digest,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	ClientDN  string    `json:"client_dn,omitempty"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Filename  string    `json:"filename,omitempty"`
+	// All attributes of the original record
+	Attributes map[string]interface{} `json:"attributes"`
+
+	// Hex SHA-256 digest of the previous signed event, and the signature over
+	// this event with Signature left empty. Only set when the sink has a
+	// signing key.
+	Prev      string `json:"prev,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Event converts the audit record to a structured event
+func (info *Info) Event() *Event {
+	if info.Attributes["perf.elapsed.ms"] == nil && !info.StartTime.IsZero() {
+		info.Attributes["perf.elapsed.ms"] = time.Since(info.StartTime).Nanoseconds() / 1e6
+	}
+	str := func(name string) string {
+		s, _ := info.Attributes[name].(string)
+		return s
+	}
+	ev := &Event{
+		Timestamp:  info.StartTime,
+		Result:     ResultSuccess,
+		Error:      str("sig.error"),
+		Key:        str("sig.keyname"),
+		SigType:    str("sig.type"),
+		Digest:     str("sig.hash"),
+		Client:     str("client.name"),
+		ClientDN:   str("client.dn"),
+		ClientIP:   str("client.ip"),
+		Filename:   str("client.filename"),
+		Attributes: info.Attributes,
+	}
+	if t, ok := info.Attributes["sig.timestamp"].(time.Time); ok {
+		ev.Timestamp = t
+	}
+	if info.Attributes["sig.denied"] == true {
+		ev.Result = ResultDenied
+	} else if ev.Error != "" {
+		ev.Result = ResultFailure
+	}
+	return ev
+}
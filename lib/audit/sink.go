@@ -0,0 +1,117 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package audit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+// Sink receives an audit event for each signing request
+type Sink interface {
+	Send(*Event) error
+	Close() error
+}
+
+// NewSink creates the sink selected by the server configuration
+func NewSink(conf *config.AuditSinkConfig) (Sink, error) {
+	switch conf.Type {
+	case config.AuditSinkFile:
+		return &fileSink{path: conf.Path}, nil
+	case config.AuditSinkSyslog:
+		return newSyslogSink(conf)
+	case config.AuditSinkHTTP:
+		return newHTTPSink(conf), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink type %q", conf.Type)
+	}
+}
+
+// Append events to a file as JSON lines
+type fileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileSink) Send(ev *Event) error {
+	blob, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	blob = append(blob, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(blob); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return f.Sync()
+}
+
+func (s *fileSink) Close() error {
+	return nil
+}
+
+// SignedSink signs each event before passing it on, and chains it to the
+// previous event by digest so that altered, removed or reordered entries can
+// be detected. The chain restarts with an empty Prev each time the server
+// starts.
+func SignedSink(sink Sink, signer crypto.Signer) Sink {
+	return &signedSink{Sink: sink, signer: signer}
+}
+
+type signedSink struct {
+	Sink
+	signer crypto.Signer
+	mu     sync.Mutex
+	prev   []byte
+}
+
+func (s *signedSink) Send(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev.Prev = hex.EncodeToString(s.prev)
+	ev.Signature = ""
+	blob, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(blob)
+	sig, err := s.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("signing audit event: %w", err)
+	}
+	ev.Signature = base64.StdEncoding.EncodeToString(sig)
+	if err := s.Sink.Send(ev); err != nil {
+		return err
+	}
+	s.prev = digest[:]
+	return nil
+}
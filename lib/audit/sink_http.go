@@ -0,0 +1,182 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+const (
+	httpSinkTimeout  = 30 * time.Second
+	httpSinkMinDelay = time.Second
+	httpSinkMaxDelay = time.Minute
+)
+
+// POST events to a HTTP endpoint in batches. Events stay queued until the
+// endpoint accepts them, so an outage delays delivery instead of losing
+// records, up to the configured queue size.
+type httpSink struct {
+	url       string
+	cli       *http.Client
+	batchSize int
+	maxQueue  int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	queue   []*Event
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newHTTPSink(conf *config.AuditSinkConfig) *httpSink {
+	s := &httpSink{
+		url:       conf.URL,
+		cli:       &http.Client{Timeout: httpSinkTimeout},
+		batchSize: conf.BatchSize,
+		maxQueue:  conf.MaxQueue,
+		interval:  time.Duration(conf.FlushInterval) * time.Second,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *httpSink) Send(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) >= s.maxQueue {
+		return errors.New("audit event queue is full")
+	}
+	s.queue = append(s.queue, ev)
+	if len(s.queue) >= s.batchSize {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close stops the background sender after one last attempt to deliver
+// whatever is still queued
+func (s *httpSink) Close() error {
+	close(s.done)
+	<-s.stopped
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) != 0 {
+		return fmt.Errorf("%d audit events were not delivered", len(s.queue))
+	}
+	return nil
+}
+
+func (s *httpSink) loop() {
+	defer close(s.stopped)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	delay := httpSinkMinDelay
+	for {
+		var stopping bool
+		select {
+		case <-t.C:
+		case <-s.wake:
+		case <-s.done:
+			stopping = true
+		}
+		for {
+			batch := s.peek()
+			if len(batch) == 0 {
+				break
+			}
+			if err := s.post(batch); err != nil {
+				log.Error().Err(err).Int("queued", s.queued()).Msg("failed to send audit events")
+				if stopping {
+					return
+				}
+				// back off, but still allow a prompt shutdown
+				select {
+				case <-time.After(delay):
+				case <-s.done:
+					stopping = true
+				}
+				delay *= 2
+				if delay > httpSinkMaxDelay {
+					delay = httpSinkMaxDelay
+				}
+				continue
+			}
+			s.pop(len(batch))
+			delay = httpSinkMinDelay
+		}
+		if stopping {
+			return
+		}
+	}
+}
+
+func (s *httpSink) peek() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.queue)
+	if n > s.batchSize {
+		n = s.batchSize
+	}
+	return s.queue[:n:n]
+}
+
+func (s *httpSink) pop(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = s.queue[n:]
+}
+
+func (s *httpSink) queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *httpSink) post(batch []*Event) error {
+	blob, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := s.cli.Post(s.url, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint returned %s", resp.Status)
+	}
+	return nil
+}
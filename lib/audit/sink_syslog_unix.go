@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(conf *config.AuditSinkConfig) (Sink, error) {
+	w, err := syslog.Dial(conf.Network, conf.Address, syslog.LOG_INFO|syslog.LOG_AUTH, conf.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w}, nil
+}
+
+func (s syslogSink) Send(ev *Event) error {
+	blob, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if ev.Result == ResultSuccess {
+		return s.w.Info(string(blob))
+	}
+	return s.w.Warning(string(blob))
+}
+
+func (s syslogSink) Close() error {
+	return s.w.Close()
+}
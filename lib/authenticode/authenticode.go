@@ -47,6 +47,12 @@ func makePeIndirect(imprint []byte, hash crypto.Hash, oid asn1.ObjectIdentifier)
 }
 
 func signIndirect(ctx context.Context, indirect interface{}, hash crypto.Hash, cert *certloader.Certificate, params *OpusParams) (*pkcs9.TimestampedSignature, error) {
+	return signIndirectNested(ctx, indirect, hash, cert, params, nil)
+}
+
+// signIndirectNested is like signIndirect and, if nested is not nil, adds that
+// signature to the unauthenticated attributes of this one
+func signIndirectNested(ctx context.Context, indirect interface{}, hash crypto.Hash, cert *certloader.Certificate, params *OpusParams, nested []byte) (*pkcs9.TimestampedSignature, error) {
 	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), hash)
 	if err := sig.SetContent(OidSpcIndirectDataContent, indirect); err != nil {
 		return nil, err
@@ -58,6 +64,11 @@ func signIndirect(ctx context.Context, indirect interface{}, hash crypto.Hash, c
 	if err != nil {
 		return nil, err
 	}
+	if nested != nil {
+		if err := psd.Content.SignerInfos[0].UnauthenticatedAttributes.Add(OidSpcNestedSignature, asn1.RawValue{FullBytes: nested}); err != nil {
+			return nil, err
+		}
+	}
 	return pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, true)
 }
 
@@ -19,11 +19,15 @@ package authenticode
 import (
 	"context"
 	"crypto"
+	"crypto/hmac"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 	"unicode/utf16"
 
@@ -83,6 +87,12 @@ func (cat *Catalog) Sign(ctx context.Context, cert *certloader.Certificate, para
 }
 
 func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
+	return cat.AddMember("", indirect)
+}
+
+// AddMember adds an entry to the catalog for a file with the given name and
+// digest. The name may be empty.
+func (cat *Catalog) AddMember(name string, indirect SpcIndirectDataContentPe) error {
 	sha2 := !indirect.MessageDigest.DigestAlgorithm.Algorithm.Equal(x509tools.OidDigestSHA1)
 	if sha2 && cat.Version == 1 {
 		return errors.New("can't add SHA2 digest to v1 catalog")
@@ -92,10 +102,26 @@ func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
 		return err
 	}
 	indirectEntry := CertTrustValue{Attribute: OidSpcIndirectDataContent, Value: makeSet(indirectBytes)}
+	var extra []CertTrustValue
+	if name != "" {
+		nameEnc, err := asn1.Marshal(CatalogNameValue{
+			Name:  x509tools.ToBMPString("File"),
+			Flags: catalogAttrFlags,
+			Value: utf16le(name + "\x00"),
+		})
+		if err != nil {
+			return err
+		}
+		extra = append(extra, CertTrustValue{Attribute: OidCatalogNameValue, Value: makeSet(nameEnc)})
+	}
 	value := indirect.MessageDigest.Digest
 	if cat.Version == 1 {
+		classID := CryptSipCreateIndirectData
+		if !indirect.Data.Type.Equal(OidSpcPeImageData) {
+			classID = CryptSipCreateIndirectDataFlat
+		}
 		memberInfo := CertTrustMemberInfoV1{
-			ClassID:  x509tools.ToBMPString(CryptSipCreateIndirectData),
+			ClassID:  x509tools.ToBMPString(classID),
 			Unknown1: 512,
 		}
 		memberInfoEnc, err := asn1.Marshal(memberInfo)
@@ -105,7 +131,7 @@ func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
 		catValue := CertTrustValue{Attribute: OidCatalogMemberInfo, Value: makeSet(memberInfoEnc)}
 		cat.Sha1Entries = append(cat.Sha1Entries, CertTrustEntry{
 			Tag:    tagV1(value),
-			Values: []CertTrustValue{indirectEntry, catValue},
+			Values: append([]CertTrustValue{indirectEntry, catValue}, extra...),
 		})
 	} else {
 		// this supposed to always be empty?
@@ -114,26 +140,164 @@ func (cat *Catalog) Add(indirect SpcIndirectDataContentPe) error {
 		if sha2 {
 			cat.Sha2Entries = append(cat.Sha2Entries, CertTrustEntry{
 				Tag:    value,
-				Values: []CertTrustValue{catValue, indirectEntry},
+				Values: append([]CertTrustValue{catValue, indirectEntry}, extra...),
 			})
 		} else {
 			cat.Sha1Entries = append(cat.Sha1Entries, CertTrustEntry{
 				Tag:    value,
-				Values: []CertTrustValue{catValue},
+				Values: append([]CertTrustValue{catValue}, extra...),
 			})
 		}
 	}
 	return nil
 }
 
+// MarshalUnsigned returns the catalog wrapped in a PKCS#7 structure with no
+// signers, suitable for signing later by the "cat" signer
+func (cat *Catalog) MarshalUnsigned() ([]byte, error) {
+	cinfo, err := pkcs7.NewContentInfo(OidCertTrustList, cat.makeCatalog())
+	if err != nil {
+		return nil, err
+	}
+	psd := &pkcs7.ContentInfoSignedData{
+		ContentType: pkcs7.OidSignedData,
+		Content: pkcs7.SignedData{
+			Version:                    1,
+			DigestAlgorithmIdentifiers: []pkix.AlgorithmIdentifier{},
+			ContentInfo:                cinfo,
+			SignerInfos:                []pkcs7.SignerInfo{},
+		},
+	}
+	return psd.Marshal()
+}
+
+// DigestCatalogMember calculates the digest of a file for use as a catalog
+// member. PE images are digested the same way as for an embedded signature so
+// that the catalog can stand in for one, and other files are digested whole.
+func DigestCatalogMember(r io.ReadSeeker, hash crypto.Hash) (indirect SpcIndirectDataContentPe, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if head[0] == 'M' && head[1] == 'Z' {
+		digest, err2 := DigestPE(r, hash, false)
+		if err2 == nil {
+			return digest.GetIndirect()
+		}
+		// not actually a PE image, so hash it as a flat file
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+	}
+	d := hash.New()
+	if _, err = io.Copy(d, r); err != nil {
+		return
+	}
+	return makePeIndirect(d.Sum(nil), hash, OidSpcCabImageData)
+}
+
+// CatalogMember describes a catalog entry matching a file
+type CatalogMember struct {
+	Name  string
+	Hash  crypto.Hash
+	Image bool
+}
+
+// ParseCatalog returns the certificate trust list inside a security catalog
+func ParseCatalog(psd *pkcs7.ContentInfoSignedData) (*CertTrustList, error) {
+	if !psd.Content.ContentInfo.ContentType.Equal(OidCertTrustList) {
+		return nil, errors.New("not a security catalog")
+	}
+	ctl := new(CertTrustList)
+	if err := psd.Content.ContentInfo.Unmarshal(ctl); err != nil {
+		return nil, fmt.Errorf("unmarshaling catalog: %w", err)
+	}
+	return ctl, nil
+}
+
+// FindMember looks for a catalog entry matching the contents of r. Returns nil
+// if there isn't one.
+func (ctl *CertTrustList) FindMember(r io.ReadSeeker) (*CatalogMember, error) {
+	digests := make(map[crypto.Hash]SpcIndirectDataContentPe)
+	for _, entry := range ctl.Entries {
+		var indirect SpcIndirectDataContentPe
+		var name string
+		for _, value := range entry.Values {
+			var err error
+			switch {
+			case value.Attribute.Equal(OidSpcIndirectDataContent):
+				_, err = asn1.Unmarshal(value.Value.Bytes, &indirect)
+			case value.Attribute.Equal(OidCatalogNameValue):
+				var nv CatalogNameValue
+				if _, err = asn1.Unmarshal(value.Value.Bytes, &nv); err == nil && fromBMPString(nv.Name) == "File" {
+					name = strings.TrimRight(fromUTF16LE(nv.Value), "\x00")
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unmarshaling catalog entry: %w", err)
+			}
+		}
+		if len(indirect.MessageDigest.Digest) == 0 {
+			// entries with no digest info can't be matched reliably
+			continue
+		}
+		hash, err := x509tools.PkixDigestToHashE(indirect.MessageDigest.DigestAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		digest, ok := digests[hash]
+		if !ok {
+			if _, err := r.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			digest, err = DigestCatalogMember(r, hash)
+			if err != nil {
+				return nil, err
+			}
+			digests[hash] = digest
+		}
+		if digest.Data.Type.Equal(indirect.Data.Type) && hmac.Equal(digest.MessageDigest.Digest, indirect.MessageDigest.Digest) {
+			return &CatalogMember{
+				Name:  name,
+				Hash:  hash,
+				Image: indirect.Data.Type.Equal(OidSpcPeImageData),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
 func tagV1(value []byte) []byte {
 	// The tag is a UTF-16-LE encoding of the hex of the imprint
-	runes := utf16.Encode([]rune(hex.EncodeToString(value)))
-	tag := make([]byte, 2*len(runes))
+	return utf16le(hex.EncodeToString(value))
+}
+
+func utf16le(value string) []byte {
+	runes := utf16.Encode([]rune(value))
+	encoded := make([]byte, 2*len(runes))
 	for i, r := range runes {
-		binary.LittleEndian.PutUint16(tag[i*2:], r)
+		binary.LittleEndian.PutUint16(encoded[i*2:], r)
+	}
+	return encoded
+}
+
+func fromUTF16LE(encoded []byte) string {
+	runes := make([]uint16, len(encoded)/2)
+	for i := range runes {
+		runes[i] = binary.LittleEndian.Uint16(encoded[i*2:])
+	}
+	return string(utf16.Decode(runes))
+}
+
+func fromBMPString(raw asn1.RawValue) string {
+	runes := make([]uint16, len(raw.Bytes)/2)
+	for i := range runes {
+		runes[i] = binary.BigEndian.Uint16(raw.Bytes[i*2:])
 	}
-	return tag
+	return string(utf16.Decode(runes))
 }
 
 func makeSet(contents []byte) asn1.RawValue {
@@ -0,0 +1,123 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+// UEFI Secure Boot signature databases: https://uefi.org/specs/UEFI/2.10/32_Secure_Boot_and_Driver_Signing.html
+
+// EFI_CERT_X509_GUID a5c059a1-94e4-4aa7-87b5-ab155c2bf072
+var efiCertX509 = []byte{0xa1, 0x59, 0xc0, 0xa5, 0xe4, 0x94, 0xa7, 0x4a, 0x87, 0xb5, 0xab, 0x15, 0x5c, 0x2b, 0xf0, 0x72}
+
+const (
+	// size of an EFI_SIGNATURE_LIST before its header and entries
+	efiListHeaderSize = 28
+	// the owner GUID that starts each EFI_SIGNATURE_DATA
+	efiOwnerSize = 16
+	// the attributes at the start of a file read from efivarfs
+	efivarAttrSize = 4
+)
+
+// SignatureDatabase is the set of certificates trusted by UEFI Secure Boot,
+// such as the contents of the db variable
+type SignatureDatabase struct {
+	Certificates []*x509.Certificate
+}
+
+// ParseSignatureLists parses a series of EFI_SIGNATURE_LIST structures, as
+// written by efi-readvar or read from efivarfs. Only X.509 entries are kept,
+// so lists of image hashes are skipped.
+func ParseSignatureLists(blob []byte) (*SignatureDatabase, error) {
+	db, err := parseSignatureLists(blob)
+	if err != nil && len(blob) > efivarAttrSize {
+		// efivarfs puts the variable's attributes first
+		if db2, err2 := parseSignatureLists(blob[efivarAttrSize:]); err2 == nil {
+			return db2, nil
+		}
+	}
+	return db, err
+}
+
+func parseSignatureLists(blob []byte) (*SignatureDatabase, error) {
+	db := new(SignatureDatabase)
+	if len(blob) == 0 {
+		return nil, errors.New("signature list is empty")
+	}
+	for len(blob) != 0 {
+		if len(blob) < efiListHeaderSize {
+			return nil, errors.New("invalid signature list: truncated header")
+		}
+		listSize := int(binary.LittleEndian.Uint32(blob[16:20]))
+		headerSize := int(binary.LittleEndian.Uint32(blob[20:24]))
+		entrySize := int(binary.LittleEndian.Uint32(blob[24:28]))
+		if listSize > len(blob) || efiListHeaderSize+headerSize > listSize || entrySize <= efiOwnerSize {
+			return nil, errors.New("invalid signature list: bad sizes")
+		}
+		entries := blob[efiListHeaderSize+headerSize : listSize]
+		if len(entries)%entrySize != 0 {
+			return nil, errors.New("invalid signature list: entries do not fill the list")
+		}
+		if bytes.Equal(blob[:16], efiCertX509) {
+			for ; len(entries) != 0; entries = entries[entrySize:] {
+				cert, err := x509.ParseCertificate(entries[efiOwnerSize:entrySize])
+				if err != nil {
+					return nil, fmt.Errorf("invalid signature list: %w", err)
+				}
+				db.Certificates = append(db.Certificates, cert)
+			}
+		}
+		blob = blob[listSize:]
+	}
+	return db, nil
+}
+
+// VerifyChain checks a signer the way UEFI firmware does: it is trusted if
+// it, or a certificate it chains to through the intermediates, is in the
+// database or was issued by a certificate in the database. The database
+// certificates need not be roots, and validity periods and key usages are not
+// checked.
+func (db *SignatureDatabase) VerifyChain(leaf *x509.Certificate, intermediates []*x509.Certificate) error {
+	cert := leaf
+	// bound the walk in case the intermediates form a loop
+	for depth := 0; depth <= len(intermediates); depth++ {
+		for _, trusted := range db.Certificates {
+			if bytes.Equal(cert.Raw, trusted.Raw) || cert.CheckSignatureFrom(trusted) == nil {
+				return nil
+			}
+		}
+		var issuer *x509.Certificate
+		for _, candidate := range intermediates {
+			if candidate != cert && !bytes.Equal(candidate.Raw, cert.Raw) && cert.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		cert = issuer
+	}
+	return fmt.Errorf("signer %s is not trusted by the signature database", x509tools.FormatSubject(leaf))
+}
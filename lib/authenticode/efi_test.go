@@ -0,0 +1,156 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"debug/pe"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+)
+
+// makeEFIImage builds a minimal PE32+ EFI application with two sections,
+// optionally listing them in the section table in the opposite order from
+// where they are in the file
+func makeEFIImage(t *testing.T, reversed bool) []byte {
+	const fileAlign = 0x200
+	var buf bytes.Buffer
+	dos := make([]byte, dosHeaderSize)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], dosHeaderSize)
+	buf.Write(dos)
+	buf.WriteString("PE\x00\x00")
+	sections := []pe.SectionHeader32{
+		{Name: [8]uint8{'.', 't', 'e', 'x', 't'}, VirtualSize: 16, VirtualAddress: 0x1000, SizeOfRawData: fileAlign, PointerToRawData: fileAlign, Characteristics: 0x60000020},
+		{Name: [8]uint8{'.', 'd', 'a', 't', 'a'}, VirtualSize: 16, VirtualAddress: 0x2000, SizeOfRawData: fileAlign, PointerToRawData: 2 * fileAlign, Characteristics: 0xc0000040},
+	}
+	fh := pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     uint16(len(sections)),
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader64{})),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	}
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, fh))
+	opt := pe.OptionalHeader64{
+		Magic:               optHeaderMagicPE32Plus,
+		AddressOfEntryPoint: 0x1000,
+		SectionAlignment:    0x1000,
+		FileAlignment:       fileAlign,
+		SizeOfImage:         0x3000,
+		SizeOfHeaders:       fileAlign,
+		Subsystem:           pe.IMAGE_SUBSYSTEM_EFI_APPLICATION,
+		NumberOfRvaAndSizes: 16,
+	}
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, opt))
+	if reversed {
+		sections[0], sections[1] = sections[1], sections[0]
+	}
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, sections))
+	buf.Write(make([]byte, fileAlign-buf.Len()))
+	text := make([]byte, fileAlign)
+	copy(text, []byte{0x31, 0xc0, 0xc3}) // xor eax, eax; ret
+	buf.Write(text)
+	data := make([]byte, fileAlign)
+	copy(data, "hello")
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func makeRSACert(t *testing.T, name string) *certloader.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certloader.Certificate{Leaf: cert, Certificates: []*x509.Certificate{cert}, PrivateKey: key}
+}
+
+// wrap a certificate in an EFI_SIGNATURE_LIST
+func makeSignatureList(cert *x509.Certificate) []byte {
+	entry := append(make([]byte, efiOwnerSize), cert.Raw...)
+	list := append([]byte{}, efiCertX509...)
+	list = binary.LittleEndian.AppendUint32(list, uint32(efiListHeaderSize+len(entry)))
+	list = binary.LittleEndian.AppendUint32(list, 0)
+	list = binary.LittleEndian.AppendUint32(list, uint32(len(entry)))
+	return append(list, entry...)
+}
+
+func TestSignEFI(t *testing.T) {
+	cert := makeRSACert(t, "db signer")
+	for _, reversed := range []bool{false, true} {
+		image := makeEFIImage(t, reversed)
+		digest, err := DigestPE(bytes.NewReader(image), crypto.SHA256, false)
+		require.NoError(t, err)
+		assert.True(t, digest.IsEFI())
+		ts, err := digest.SignImprint(context.Background(), cert, nil)
+		require.NoError(t, err)
+		patch, err := digest.MakePatch(ts.Raw)
+		require.NoError(t, err)
+		signed, err := patch.ApplyBytes(image)
+		require.NoError(t, err)
+		// the certificate table is 8-byte aligned at the end of the file
+		assert.Zero(t, len(signed)%8)
+
+		sigs, err := VerifyPE(bytes.NewReader(signed), false)
+		require.NoError(t, err)
+		require.Len(t, sigs, 1)
+		assert.Equal(t, crypto.SHA256, sigs[0].ImageHashFunc)
+
+		tampered := bytes.Replace(signed, []byte("hello"), []byte("HELLO"), 1)
+		_, err = VerifyPE(bytes.NewReader(tampered), false)
+		assert.ErrorContains(t, err, "digest mismatch")
+	}
+}
+
+func TestSignatureDatabase(t *testing.T) {
+	cert := makeRSACert(t, "db signer")
+	other := makeRSACert(t, "someone else")
+	// efivarfs files start with the variable attributes
+	for _, blob := range [][]byte{
+		append(makeSignatureList(other.Leaf), makeSignatureList(cert.Leaf)...),
+		append([]byte{7, 0, 0, 0}, makeSignatureList(cert.Leaf)...),
+	} {
+		db, err := ParseSignatureLists(blob)
+		require.NoError(t, err)
+		assert.NoError(t, db.VerifyChain(cert.Leaf, nil))
+	}
+	db, err := ParseSignatureLists(makeSignatureList(other.Leaf))
+	require.NoError(t, err)
+	assert.ErrorContains(t, db.VerifyChain(cert.Leaf, nil), "not trusted by the signature database")
+	_, err = ParseSignatureLists([]byte("not a signature list at all"))
+	assert.Error(t, err)
+}
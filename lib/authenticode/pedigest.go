@@ -26,6 +26,7 @@ import (
 	"hash"
 	"io"
 	"io/ioutil"
+	"sort"
 )
 
 // PE-COFF: https://www.microsoft.com/en-us/download/details.aspx?id=19509
@@ -37,7 +38,9 @@ type PEDigest struct {
 	Imprint    []byte
 	PageHashes []byte
 	Hash       crypto.Hash
-	markers    *peHeaderValues
+	// existing certificate table, if the image was already signed
+	CertTable []byte
+	markers   *peHeaderValues
 }
 
 const dosHeaderSize = 64
@@ -68,7 +71,11 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 		return nil, err
 	}
 	digester := setupDigester(hash, buf.Bytes(), hvals, sections, doPageHash)
-	// Hash sections
+	// Hash sections in file order, which isn't always table order. Tools that
+	// add sections to EFI images like systemd-stub may append them out of order.
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].PointerToRawData < sections[j].PointerToRawData
+	})
 	nextSection := hvals.sizeOfHdr
 	for i, sh := range sections {
 		if sh.SizeOfRawData == 0 {
@@ -83,7 +90,7 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 		nextSection += int64(sh.SizeOfRawData)
 	}
 	// Hash trailer after the sections and cert table
-	origSize, err := readTrailer(r, digester.imageDigest, nextSection, hvals.certStart, hvals.certSize)
+	origSize, certTable, err := readTrailer(r, digester.imageDigest, nextSection, hvals.certStart, hvals.certSize)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +105,7 @@ func DigestPE(r io.Reader, hash crypto.Hash, doPageHash bool) (*PEDigest, error)
 	if err != nil {
 		return nil, err
 	}
-	return &PEDigest{origSize, certStart, imprint, pagehashes, hash, hvals}, nil
+	return &PEDigest{origSize, certStart, imprint, pagehashes, hash, certTable, hvals}, nil
 }
 
 type imageHasher struct {
@@ -136,6 +143,23 @@ func setupDigester(hash crypto.Hash, header []byte, hvals *peHeaderValues, secti
 	return h
 }
 
+// IsEFI returns true if the image is an EFI application or driver, such as a
+// boot loader that is checked by UEFI Secure Boot
+func (pd *PEDigest) IsEFI() bool {
+	return pd.markers != nil && isEFISubsystem(pd.markers.subsystem)
+}
+
+func isEFISubsystem(subsystem uint16) bool {
+	switch subsystem {
+	case pe.IMAGE_SUBSYSTEM_EFI_APPLICATION,
+		pe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER,
+		pe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER,
+		pe.IMAGE_SUBSYSTEM_EFI_ROM:
+		return true
+	}
+	return false
+}
+
 func (h *imageHasher) section(r io.Reader, sh pe.SectionHeader32) error {
 	if !h.doPageHash {
 		_, err := io.CopyN(h.imageDigest, r, int64(sh.SizeOfRawData))
@@ -257,6 +281,7 @@ func readOptHeader(r io.Reader, d io.Writer, peStart int64, fh *pe.FileHeader) (
 		dd4Start = 128
 		hvals.sizeOfHdr = int64(opt.SizeOfHeaders)
 		hvals.fileAlign = opt.FileAlignment
+		hvals.subsystem = opt.Subsystem
 	case optHeaderMagicPE32Plus:
 		// PE32+
 		var opt pe.OptionalHeader64
@@ -270,6 +295,7 @@ func readOptHeader(r io.Reader, d io.Writer, peStart int64, fh *pe.FileHeader) (
 		dd4Start = 144
 		hvals.sizeOfHdr = int64(opt.SizeOfHeaders)
 		hvals.fileAlign = opt.FileAlignment
+		hvals.subsystem = opt.Subsystem
 	default:
 		return nil, errors.New("unrecognized optional header magic")
 	}
@@ -318,24 +344,25 @@ func readSections(r io.Reader, d io.Writer, fh *pe.FileHeader, hvals *peHeaderVa
 	return sections, nil
 }
 
-func readTrailer(r io.Reader, d io.Writer, lastSection, certStart, certSize int64) (int64, error) {
+func readTrailer(r io.Reader, d io.Writer, lastSection, certStart, certSize int64) (int64, []byte, error) {
 	if certSize == 0 {
 		n, err := io.Copy(d, r)
-		return lastSection + n, err
+		return lastSection + n, nil, err
 	}
 	if certStart < lastSection {
-		return 0, errors.New("existing signature overlaps with PE sections")
+		return 0, nil, errors.New("existing signature overlaps with PE sections")
 	}
 	if _, err := io.CopyN(d, r, certStart-lastSection); err != nil {
-		return 0, err
+		return 0, nil, err
 	}
-	if _, err := io.CopyN(ioutil.Discard, r, certSize); err != nil {
-		return 0, err
+	certTable := make([]byte, certSize)
+	if _, err := io.ReadFull(r, certTable); err != nil {
+		return 0, nil, err
 	}
 	if n, _ := io.Copy(ioutil.Discard, r); n > 0 {
-		return 0, errors.New("trailing garbage after existing certificate")
+		return 0, nil, errors.New("trailing garbage after existing certificate")
 	}
-	return certStart, nil
+	return certStart, certTable, nil
 }
 
 type peHeaderValues struct {
@@ -353,4 +380,6 @@ type peHeaderValues struct {
 	fileAlign uint32
 	// file offset and size of the certificate table
 	certStart, certSize int64
+	// IMAGE_SUBSYSTEM_*
+	subsystem uint16
 }
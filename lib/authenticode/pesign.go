@@ -32,11 +32,7 @@ import (
 
 // Sign the digest and return an Authenticode structure
 func (pd *PEDigest) Sign(ctx context.Context, cert *certloader.Certificate, params *OpusParams) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
-	indirect, err := pd.GetIndirect()
-	if err != nil {
-		return nil, nil, err
-	}
-	ts, err := signIndirect(ctx, indirect, pd.Hash, cert, params)
+	ts, err := pd.SignImprint(ctx, cert, params)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -47,6 +43,36 @@ func (pd *PEDigest) Sign(ctx context.Context, cert *certloader.Certificate, para
 	return patch, ts, nil
 }
 
+// SignImprint signs the digest and returns the Authenticode signature without
+// making a patch. Only Imprint, PageHashes and Hash are used, so this works on
+// a digest that was calculated elsewhere.
+func (pd *PEDigest) SignImprint(ctx context.Context, cert *certloader.Certificate, params *OpusParams) (*pkcs9.TimestampedSignature, error) {
+	indirect, err := pd.GetIndirect()
+	if err != nil {
+		return nil, err
+	}
+	return signIndirect(ctx, indirect, pd.Hash, cert, params)
+}
+
+// SignImprintNested signs the digest like SignImprint, and nests a second
+// signature over inner inside it. Windows versions that don't understand the
+// outer digest algorithm, such as SHA-1-only Windows Vista and 7, verify the
+// nested signature instead. inner must be a digest of the same image.
+func (pd *PEDigest) SignImprintNested(ctx context.Context, inner *PEDigest, cert *certloader.Certificate, params *OpusParams) (*pkcs9.TimestampedSignature, error) {
+	if inner.Hash == pd.Hash {
+		return nil, errors.New("nested signature must use a different digest algorithm")
+	}
+	innerSig, err := inner.SignImprint(ctx, cert, params)
+	if err != nil {
+		return nil, err
+	}
+	indirect, err := pd.GetIndirect()
+	if err != nil {
+		return nil, err
+	}
+	return signIndirectNested(ctx, indirect, pd.Hash, cert, params, innerSig.Raw)
+}
+
 func (pd *PEDigest) GetIndirect() (indirect SpcIndirectDataContentPe, err error) {
 	indirect, err = makePeIndirect(pd.Imprint, pd.Hash, OidSpcPeImageData)
 	if err != nil {
@@ -69,7 +95,7 @@ func (pd *PEDigest) imprintPageHashes(indirect *SpcIndirectDataContentPe) error
 	case crypto.SHA256:
 		attr.Type = OidSpcPageHashV2
 	default:
-		return errors.New("unsupported page hash type")
+		return errors.New("page hashes require a SHA1 or SHA-256 digest")
 	}
 	attr.Hashes = make([][]byte, 1)
 	attr.Hashes[0] = pd.PageHashes
@@ -90,6 +116,21 @@ func (pd *PEDigest) imprintPageHashes(indirect *SpcIndirectDataContentPe) error
 // Create a patchset that will add or replace the signature from a previously
 // digested image with a new one
 func (pd *PEDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
+	return pd.makePatch(nil, sig)
+}
+
+// Create a patchset that will add a signature to a previously digested image,
+// keeping any signatures that are already in its certificate table
+func (pd *PEDigest) MakeAppendPatch(sig []byte) (*binpatch.PatchSet, error) {
+	existing := pd.CertTable
+	if n := len(existing) % 8; n != 0 {
+		// each entry starts on an 8-byte boundary
+		existing = append(existing[:len(existing):len(existing)], make([]byte, 8-n)...)
+	}
+	return pd.makePatch(existing, sig)
+}
+
+func (pd *PEDigest) makePatch(existing, sig []byte) (*binpatch.PatchSet, error) {
 	// pack new cert table
 	padded := (len(sig) + 7) / 8 * 8
 	info := certInfo{
@@ -102,6 +143,7 @@ func (pd *PEDigest) MakePatch(sig []byte) (*binpatch.PatchSet, error) {
 	if pad2 != 0 {
 		buf.Write(make([]byte, pad2))
 	}
+	_, _ = buf.Write(existing)
 	_ = binary.Write(&buf, binary.LittleEndian, info)
 	_, _ = buf.Write(sig)
 	_, _ = buf.Write(make([]byte, padded-len(sig)))
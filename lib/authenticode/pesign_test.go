@@ -0,0 +1,59 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package authenticode
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignNested(t *testing.T) {
+	cert := makeRSACert(t, "dual signer")
+	image := makeEFIImage(t, false)
+	outer, err := DigestPE(bytes.NewReader(image), crypto.SHA256, false)
+	require.NoError(t, err)
+	inner, err := DigestPE(bytes.NewReader(image), crypto.SHA1, false)
+	require.NoError(t, err)
+	ts, err := outer.SignImprintNested(context.Background(), inner, cert, nil)
+	require.NoError(t, err)
+	patch, err := outer.MakePatch(ts.Raw)
+	require.NoError(t, err)
+	signed, err := patch.ApplyBytes(image)
+	require.NoError(t, err)
+
+	// both are reported, the nested one after the one that holds it
+	sigs, err := VerifyPE(bytes.NewReader(signed), false)
+	require.NoError(t, err)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, crypto.SHA256, sigs[0].ImageHashFunc)
+	assert.False(t, sigs[0].Nested)
+	assert.Equal(t, crypto.SHA1, sigs[1].ImageHashFunc)
+	assert.True(t, sigs[1].Nested)
+
+	// the SHA-1 digest of the image is checked too
+	tampered := bytes.Replace(signed, []byte("hello"), []byte("HELLO"), 1)
+	_, err = VerifyPE(bytes.NewReader(tampered), false)
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	_, err = outer.SignImprintNested(context.Background(), outer, cert, nil)
+	assert.Error(t, err)
+}
@@ -39,6 +39,8 @@ type PESignature struct {
 	ImageHashFunc crypto.Hash
 	PageHashes    []byte
 	PageHashFunc  crypto.Hash
+	// Nested is true if this signature was found inside another one
+	Nested bool
 }
 
 // Extract and verify the signature from a PE/COFF image file. Does not check X509 chains.
@@ -105,18 +107,24 @@ func checkSignatures(blob []byte, image io.ReadSeeker) ([]PESignature, error) {
 		if err != nil {
 			return nil, err
 		}
-		allhashes[sig.ImageHashFunc] = true
-		if len(sig.PageHashes) > 0 {
-			phvalues[sig.PageHashFunc] = sig.PageHashes
-			allhashes[sig.PageHashFunc] = true
+		nested, err := nestedSignatures(sig)
+		if err != nil {
+			return nil, err
 		}
-		sigs = append(sigs, *sig)
-		imageDigest := sig.Indirect.MessageDigest.Digest
-		if existing := values[sig.ImageHashFunc]; existing == nil {
-			values[sig.ImageHashFunc] = imageDigest
-		} else if !hmac.Equal(imageDigest, existing) {
-			// they can't both be right...
-			return nil, fmt.Errorf("digest mismatch: %x != %x", imageDigest, existing)
+		for _, sig := range append([]*PESignature{sig}, nested...) {
+			allhashes[sig.ImageHashFunc] = true
+			if len(sig.PageHashes) > 0 {
+				phvalues[sig.PageHashFunc] = sig.PageHashes
+				allhashes[sig.PageHashFunc] = true
+			}
+			sigs = append(sigs, *sig)
+			imageDigest := sig.Indirect.MessageDigest.Digest
+			if existing := values[sig.ImageHashFunc]; existing == nil {
+				values[sig.ImageHashFunc] = imageDigest
+			} else if !hmac.Equal(imageDigest, existing) {
+				// they can't both be right...
+				return nil, fmt.Errorf("digest mismatch: %x != %x", imageDigest, existing)
+			}
 		}
 	}
 	if image == nil {
@@ -183,6 +191,27 @@ func checkSignature(der []byte) (*PESignature, error) {
 	return pesig, nil
 }
 
+// Verify signatures nested in the unauthenticated attributes of an outer one.
+// Only one level of nesting is checked, as Windows does.
+func nestedSignatures(outer *PESignature) ([]*PESignature, error) {
+	var blobs []asn1.RawValue
+	if err := outer.SignerInfo.UnauthenticatedAttributes.GetAll(OidSpcNestedSignature, &blobs); errors.As(err, &pkcs7.ErrNoAttribute{}) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("parsing nested signature: %w", err)
+	}
+	sigs := make([]*PESignature, 0, len(blobs))
+	for _, blob := range blobs {
+		sig, err := checkSignature(blob.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("nested signature: %w", err)
+		}
+		sig.Nested = true
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
 func GetOpusInfo(si *pkcs7.SignerInfo) (*SpcSpOpusInfo, error) {
 	opus := new(SpcSpOpusInfo)
 	err := si.AuthenticatedAttributes.GetOne(OidSpcSpOpusInfo, opus)
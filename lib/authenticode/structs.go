@@ -17,6 +17,7 @@
 package authenticode
 
 import (
+	"crypto"
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/binary"
@@ -24,6 +25,9 @@ import (
 	"unicode/utf16"
 )
 
+// Hashes lists the digest algorithms that can be used in Authenticode signatures
+var Hashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
 var (
 	OidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
 	OidSpcStatementType       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 11}
@@ -34,6 +38,7 @@ var (
 	OidSpcSipInfo             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 30}
 	OidSpcPageHashV1          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 3, 1}
 	OidSpcPageHashV2          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 3, 2}
+	OidSpcNestedSignature     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 4, 1}
 	OidSpcCabPageHash         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 5, 1}
 	OidCertTrustList          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 1}
 	OidCatalogList            = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 12, 1, 1}
@@ -57,6 +62,8 @@ var (
 
 	// This one is used in V1 security catalogs
 	CryptSipCreateIndirectData = "{C689AAB8-8E78-11D0-8C47-00C04FC295EE}"
+	// and this one for catalog members that aren't PE images
+	CryptSipCreateIndirectDataFlat = "{DE351A42-8E59-11D0-8C47-00C04FC295EE}"
 
 	// Filenames for MSI streams holding signature data
 	msiDigitalSignature   = "\x05DigitalSignature"
@@ -177,6 +184,16 @@ type CertTrustMemberInfoV1 struct {
 	Unknown1 int
 }
 
+// CRYPTCAT_ATTR_AUTHENTICATED | CRYPTCAT_ATTR_NAMEASCII | CRYPTCAT_ATTR_DATAASCII
+const catalogAttrFlags = 0x10010001
+
+// CatalogNameValue is a named attribute of a catalog or one of its members
+type CatalogNameValue struct {
+	Name  asn1.RawValue // BMPString
+	Flags int
+	Value []byte // UTF-16-LE, NUL terminated
+}
+
 type CertTrustAttributes struct {
 	// TODO
 }
@@ -178,6 +178,28 @@ func (p *PatchSet) Apply(infile *os.File, outpath string) error {
 	return infile.Truncate(size)
 }
 
+// ApplyBytes applies a PatchSet to an in-memory copy of the input and returns
+// the result
+func (p *PatchSet) ApplyBytes(blob []byte) ([]byte, error) {
+	sort.Sort(sorter{p})
+	var out bytes.Buffer
+	var pos int64
+	for i, patch := range p.Patches {
+		if patch.Offset < pos {
+			return nil, errors.New("patches out of order")
+		}
+		end := patch.Offset + int64(patch.OldSize)
+		if end > int64(len(blob)) {
+			return nil, errors.New("patch extends past end of input")
+		}
+		out.Write(blob[pos:patch.Offset])
+		out.Write(p.Blobs[i])
+		pos = end
+	}
+	out.Write(blob[pos:])
+	return out.Bytes(), nil
+}
+
 // Apply a patch by writing the patched result to a new file. This is the
 // fallback case whenever an in-place write isn't possible.
 func (p *PatchSet) applyRewrite(infile *os.File, outpath string) error {
@@ -47,6 +47,9 @@ type Certificate struct {
 	PrivateKey   crypto.PrivateKey
 	Timestamper  pkcs9.Timestamper
 	KeyName      string
+	ApkLineage   []byte
+	PSS          bool // Use RSA-PSS for PKCS#7 signatures
+	IncludeChain bool // Chain certificates were configured explicitly, include them even where only the leaf is the default
 }
 
 // Return the X509 certificates in the chain up to, but not including, the root CA certificate
@@ -87,7 +90,11 @@ func (s *Certificate) Signer() crypto.Signer {
 	if s.PrivateKey == nil {
 		return nil
 	}
-	return s.PrivateKey.(crypto.Signer)
+	signer := s.PrivateKey.(crypto.Signer)
+	if s.PSS {
+		return x509tools.PSSSigner{Signer: signer}
+	}
+	return signer
 }
 
 // Return a tls.Certificate structure containing the X509 certificate chain and
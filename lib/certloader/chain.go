@@ -0,0 +1,97 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certloader
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// LoadExtraCerts reads additional chain certificates from files and adds them
+// to the certificate's chain. Problems with the resulting chain are returned
+// as warnings.
+func (s *Certificate) LoadExtraCerts(paths []string) ([]string, error) {
+	var extra []*x509.Certificate
+	for _, fp := range paths {
+		blob, err := os.ReadFile(fp)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := ParseX509Certificates(blob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fp, err)
+		}
+		extra = append(extra, certs...)
+	}
+	return s.AddExtraCerts(extra), nil
+}
+
+// AddExtraCerts adds certificates such as intermediates that are not stored
+// with the leaf, and sets IncludeChain. The chain is reordered from the leaf
+// towards the root and duplicates are dropped. A warning is returned for each certificate that the
+// leaf does not chain through, since that means an issuer is missing.
+func (s *Certificate) AddExtraCerts(extra []*x509.Certificate) []string {
+	s.IncludeChain = true
+	var pool []*x509.Certificate
+	for _, cert := range append(s.Certificates, extra...) {
+		if cert == s.Leaf || containsCert(pool, cert) || (s.Leaf != nil && cert.Equal(s.Leaf)) {
+			continue
+		}
+		pool = append(pool, cert)
+	}
+	if s.Leaf == nil {
+		s.Certificates = pool
+		return []string{"extra certificates were given but there is no leaf certificate"}
+	}
+	chain := []*x509.Certificate{s.Leaf}
+	used := make([]bool, len(pool))
+	for cur := s.Leaf; !bytes.Equal(cur.RawIssuer, cur.RawSubject); {
+		next := -1
+		for i, cert := range pool {
+			if !used[i] && bytes.Equal(cert.RawSubject, cur.RawIssuer) && cur.CheckSignatureFrom(cert) == nil {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		used[next] = true
+		cur = pool[next]
+		chain = append(chain, cur)
+	}
+	var warnings []string
+	for i, cert := range pool {
+		if !used[i] {
+			warnings = append(warnings, fmt.Sprintf("certificate %q is not in the chain of %q; an intermediate may be missing", cert.Subject, s.Leaf.Subject))
+			chain = append(chain, cert)
+		}
+	}
+	s.Certificates = chain
+	return warnings
+}
+
+func containsCert(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package certloader
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func makeCert(t *testing.T, name string, issuer *testCA, isCA bool) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	parent, signer := template, crypto.Signer(key)
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func TestAddExtraCerts(t *testing.T) {
+	root := makeCert(t, "root", nil, true)
+	inter := makeCert(t, "intermediate", root, true)
+	leaf := makeCert(t, "leaf", inter, false)
+
+	cert := &Certificate{Leaf: leaf.cert, Certificates: []*x509.Certificate{leaf.cert}}
+	warnings := cert.AddExtraCerts([]*x509.Certificate{root.cert, inter.cert, inter.cert})
+	assert.Empty(t, warnings)
+	assert.Equal(t, []*x509.Certificate{leaf.cert, inter.cert, root.cert}, cert.Certificates)
+	assert.Equal(t, []*x509.Certificate{leaf.cert, inter.cert}, cert.Chain())
+
+	// the intermediate is missing
+	cert = &Certificate{Leaf: leaf.cert, Certificates: []*x509.Certificate{leaf.cert}}
+	warnings = cert.AddExtraCerts([]*x509.Certificate{root.cert})
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, []*x509.Certificate{leaf.cert, root.cert}, cert.Certificates)
+}
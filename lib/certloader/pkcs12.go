@@ -39,17 +39,24 @@ func ParsePKCS12(blob []byte, prompt passprompt.PasswordGetter) (*Certificate, e
 			}
 			triedEmpty = true
 		}
-		priv, leaf, chain, err := pkcs12.DecodeChain(blob, password)
+		cert, err := ParsePKCS12Password(blob, password)
 		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
 			continue
-		} else if err != nil {
-			return nil, err
 		}
-		certs := append([]*x509.Certificate{leaf}, chain...)
-		return &Certificate{
-			PrivateKey:   priv,
-			Leaf:         leaf,
-			Certificates: certs,
-		}, nil
+		return cert, err
+	}
+}
+
+// ParsePKCS12Password parses a PKCS12 file using a known password
+func ParsePKCS12Password(blob []byte, password string) (*Certificate, error) {
+	priv, leaf, chain, err := pkcs12.DecodeChain(blob, password)
+	if err != nil {
+		return nil, err
 	}
+	certs := append([]*x509.Certificate{leaf}, chain...)
+	return &Certificate{
+		PrivateKey:   priv,
+		Leaf:         leaf,
+		Certificates: certs,
+	}, nil
 }
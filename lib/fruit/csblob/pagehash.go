@@ -19,6 +19,9 @@ const (
 	HashSHA512
 )
 
+// Hashes lists the digest algorithms that can be used in a code directory
+var Hashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384}
+
 func hashFunc(hashType HashType, hashLen uint8) (h crypto.Hash, err error) {
 	switch hashType {
 	case HashSHA1:
@@ -22,8 +22,9 @@ type SignatureParams struct {
 	Pages        io.Reader // read page contents
 	OldSignature io.Reader // read the existing signature, if any, after the pages
 	HashFunc     crypto.Hash
-	InfoPlist    []byte // manifest to bind to signature
-	Resources    []byte // CodeResources to bind to signature
+	InfoPlist    []byte    // manifest to bind to signature
+	Resources    []byte    // CodeResources to bind to signature
+	SigningTime  time.Time // signing-time attribute (default: now)
 
 	// the following are copied from the old signature if empty
 	Flags            SignatureFlags
@@ -214,7 +215,11 @@ func Sign(ctx context.Context, cert *certloader.Certificate, params *SignaturePa
 	if err := addPlistHashes(builder, plistHashes); err != nil {
 		return nil, nil, fmt.Errorf("adding cdhash plist: %w", err)
 	}
-	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, time.Now().UTC()); err != nil {
+	signingTime := params.SigningTime
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+	if err := builder.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, signingTime.UTC()); err != nil {
 		return nil, nil, err
 	}
 	psd, err := builder.Sign()
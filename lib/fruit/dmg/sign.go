@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/sassoftware/relic/v8/lib/binpatch"
 	"github.com/sassoftware/relic/v8/lib/certloader"
@@ -20,6 +21,7 @@ type SignatureParams struct {
 	Requirements    []byte // requirements to embed in signature
 	SigningIdentity string
 	TeamIdentifier  string
+	SigningTime     time.Time // signing-time attribute (default: now)
 }
 
 func Sign(ctx context.Context, rsfBytes []byte, r io.Reader, cert *certloader.Certificate, params *SignatureParams) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
@@ -37,6 +39,7 @@ func Sign(ctx context.Context, rsfBytes []byte, r io.Reader, cert *certloader.Ce
 		Requirements:    params.Requirements,
 		SigningIdentity: params.SigningIdentity,
 		TeamIdentifier:  params.TeamIdentifier,
+		SigningTime:     params.SigningTime,
 		Pages:           io.LimitReader(nr, bundleSize),
 		RepSpecific:     rsf.ForHashing(),
 	}
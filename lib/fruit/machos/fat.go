@@ -0,0 +1,111 @@
+package machos
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/fruit/csblob"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+)
+
+const (
+	fatMagic     = 0xcafebabe
+	fatHeaderLen = 8
+	fatArchLen   = 20
+	// more arches than this is probably a Java class file, which has the same magic
+	maxFatArches = 32
+)
+
+type fatArch struct {
+	CPUType    uint32
+	CPUSubtype uint32
+	Offset     uint32
+	Size       uint32
+	Align      uint32
+}
+
+// IsFat returns true if the header is that of a fat (universal) binary
+func IsFat(header []byte) bool {
+	return len(header) >= 4 && binary.BigEndian.Uint32(header) == fatMagic
+}
+
+// SignFat signs each architecture of a fat binary and returns a patch that
+// rewrites the file with the signed slices. Slices are moved as needed to make
+// room for their signatures.
+func SignFat(ctx context.Context, r io.Reader, cert *certloader.Certificate, params *csblob.SignatureParams) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	arches, err := parseFat(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+	slices := make([][]byte, len(arches))
+	var tsig *pkcs9.TimestampedSignature
+	for i, arch := range arches {
+		// each slice needs its own copy since signing fills in defaults
+		archParams := *params
+		patch, sig, err := Sign(ctx, bytes.NewReader(blob[arch.Offset:arch.Offset+arch.Size]), cert, &archParams)
+		if err != nil {
+			return nil, nil, fmt.Errorf("arch %d.%d: %w", arch.CPUType, arch.CPUSubtype, err)
+		}
+		slices[i], err = patch.ApplyBytes(blob[arch.Offset : arch.Offset+arch.Size])
+		if err != nil {
+			return nil, nil, err
+		}
+		if tsig == nil {
+			tsig = sig
+			params.SigningIdentity = archParams.SigningIdentity
+			params.TeamIdentifier = archParams.TeamIdentifier
+		}
+	}
+	// lay out the new file, keeping each slice's alignment
+	var out bytes.Buffer
+	out.Write(blob[:fatHeaderLen+fatArchLen*len(arches)])
+	for i, arch := range arches {
+		align := 1 << arch.Align
+		if pad := out.Len() % align; pad != 0 {
+			out.Write(make([]byte, align-pad))
+		}
+		if int64(out.Len())+int64(len(slices[i])) > 1<<32-1 {
+			return nil, nil, errors.New("signed fat binary is too large")
+		}
+		hdr := out.Bytes()[fatHeaderLen+fatArchLen*i:]
+		binary.BigEndian.PutUint32(hdr[8:], uint32(out.Len()))
+		binary.BigEndian.PutUint32(hdr[12:], uint32(len(slices[i])))
+		out.Write(slices[i])
+	}
+	patch := binpatch.New()
+	patch.Add(0, int64(len(blob)), out.Bytes())
+	return patch, tsig, nil
+}
+
+func parseFat(blob []byte) ([]fatArch, error) {
+	if len(blob) < fatHeaderLen || !IsFat(blob) {
+		return nil, errors.New("not a fat binary")
+	}
+	count := binary.BigEndian.Uint32(blob[4:])
+	if count == 0 || count > maxFatArches {
+		return nil, fmt.Errorf("invalid fat binary arch count %d", count)
+	}
+	arches := make([]fatArch, count)
+	if err := binary.Read(bytes.NewReader(blob[fatHeaderLen:]), binary.BigEndian, arches); err != nil {
+		return nil, err
+	}
+	end := uint64(fatHeaderLen + fatArchLen*int(count))
+	for _, arch := range arches {
+		if uint64(arch.Offset) < end || uint64(arch.Offset)+uint64(arch.Size) > uint64(len(blob)) {
+			return nil, errors.New("fat binary arch is out of bounds")
+		} else if arch.Align > 16 {
+			return nil, fmt.Errorf("invalid fat binary alignment 2^%d", arch.Align)
+		}
+	}
+	return arches, nil
+}
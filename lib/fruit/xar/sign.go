@@ -24,6 +24,9 @@ import (
 	"github.com/sassoftware/relic/v8/lib/pkcs9"
 )
 
+// Hashes lists the digest algorithms that can be used in a xar table of contents
+var Hashes = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA512}
+
 type SignatureParams struct {
 	HashFunc crypto.Hash
 }
@@ -54,6 +54,13 @@ const (
 	FileTypeMachOFat
 	FileTypeIPA
 	FileTypeXAR
+	FileTypeNuGet
+	// A zip archive that isn't recognizably one kind of package, either
+	// because it has none of their markers or because it has several
+	FileTypeZip
+
+	// types allocated by Register start here
+	fileTypeRegistered
 )
 
 const (
@@ -62,6 +69,26 @@ const (
 	CompressedXz
 )
 
+// sniffSize is how much of the file is given to registered detectors
+const sniffSize = 4096
+
+type detector struct {
+	fileType FileType
+	test     func(prefix []byte) bool
+}
+
+var detectors []detector
+
+// Register a function that recognizes an additional file type from the first
+// few kilobytes of its contents, and allocate a new FileType for it. The
+// builtin types are checked first. Not safe to call concurrently with Detect,
+// so call it from an init function.
+func Register(test func(prefix []byte) bool) FileType {
+	ftype := fileTypeRegistered + FileType(len(detectors))
+	detectors = append(detectors, detector{ftype, test})
+	return ftype
+}
+
 func hasPrefix(br *bufio.Reader, blob []byte) bool {
 	return atPosition(br, blob, 0)
 }
@@ -127,6 +154,14 @@ func Detect(r io.Reader) FileType {
 	case hasPrefix(br, []byte{0x89}), hasPrefix(br, []byte{0xc2}), hasPrefix(br, []byte{0xc4}):
 		return FileTypePGP
 	}
+	if len(detectors) != 0 {
+		prefix, _ := br.Peek(sniffSize)
+		for _, d := range detectors {
+			if d.test(prefix) {
+				return d.fileType
+			}
+		}
+	}
 	return FileTypeUnknown
 }
 
@@ -188,7 +223,7 @@ func detectZip(f *os.File) FileType {
 	if err != nil {
 		return FileTypeUnknown
 	}
-	var isJar bool
+	found := make(map[FileType]bool)
 	for _, zf := range inz.File {
 		name := zf.Name
 		if strings.HasPrefix(name, "/") {
@@ -197,26 +232,34 @@ func detectZip(f *os.File) FileType {
 		name = path.Clean(name)
 		switch name {
 		case "AndroidManifest.xml":
-			return FileTypeAPK
+			found[FileTypeAPK] = true
 		case "AppManifest.xaml":
-			return FileTypeXAP
+			found[FileTypeXAP] = true
 		case "AppxManifest.xml", "AppxMetadata/AppxBundleManifest.xml":
-			return FileTypeAPPX
+			found[FileTypeAPPX] = true
 		case "extension.vsixmanifest":
-			return FileTypeVSIX
+			found[FileTypeVSIX] = true
 		case "META-INF/MANIFEST.MF":
-			// APKs are also JARs so save this for last
-			isJar = true
+			found[FileTypeJAR] = true
 		}
 		switch {
+		case path.Dir(name) == "." && strings.HasSuffix(name, ".nuspec"):
+			found[FileTypeNuGet] = true
 		case strings.HasSuffix(name, ".app/Info.plist"):
-			return FileTypeIPA
+			found[FileTypeIPA] = true
 		case strings.HasSuffix(name, ".app/Contents/Info.plist"):
-			return FileTypeIPA
+			found[FileTypeIPA] = true
 		}
 	}
-	if isJar {
-		return FileTypeJAR
+	if len(found) > 1 {
+		// other formats that build on JAR keep its manifest
+		delete(found, FileTypeJAR)
+	}
+	if len(found) != 1 {
+		return FileTypeZip
+	}
+	for ftype := range found {
+		return ftype
 	}
 	return FileTypeUnknown
 }
@@ -0,0 +1,84 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package magic
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectIgnoresName(t *testing.T) {
+	for _, tc := range []struct {
+		path     string
+		expected FileType
+	}{
+		{"../../functest/packages/WindowsFormsApplication1.exe", FileTypePECOFF},
+		{"../../functest/packages/rocky-basesystem-11-13.el9.noarch.rpm", FileTypeRPM},
+		{"../../functest/packages/zlib1g_1.2.8.dfsg-5_i386.deb", FileTypeDEB},
+		{"../../functest/packages/hello.jar", FileTypeJAR},
+		{"../../functest/packages/dummy.apk", FileTypeAPK},
+		{"../../functest/packages/VSIXProject1.vsix", FileTypeVSIX},
+	} {
+		t.Run(filepath.Base(tc.path), func(t *testing.T) {
+			blob, err := os.ReadFile(tc.path)
+			require.NoError(t, err)
+			fp := filepath.Join(t.TempDir(), "foo.dat")
+			require.NoError(t, os.WriteFile(fp, blob, 0644))
+			f, err := os.Open(fp)
+			require.NoError(t, err)
+			defer f.Close()
+			ftype, compression := DetectCompressed(f)
+			assert.Equal(t, tc.expected, ftype)
+			assert.Equal(t, CompressedNone, compression)
+		})
+	}
+}
+
+func TestDetectZip(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		files    []string
+		expected FileType
+	}{
+		{"jar", []string{"META-INF/MANIFEST.MF", "Hello.class"}, FileTypeJAR},
+		{"apk", []string{"META-INF/MANIFEST.MF", "AndroidManifest.xml"}, FileTypeAPK},
+		{"plain", []string{"readme.txt"}, FileTypeZip},
+		{"ambiguous", []string{"AndroidManifest.xml", "extension.vsixmanifest"}, FileTypeZip},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fp := filepath.Join(t.TempDir(), "test.zip")
+			f, err := os.Create(fp)
+			require.NoError(t, err)
+			defer f.Close()
+			w := zip.NewWriter(f)
+			for _, name := range tc.files {
+				_, err := w.Create(name)
+				require.NoError(t, err)
+			}
+			require.NoError(t, w.Close())
+			_, err = f.Seek(0, 0)
+			require.NoError(t, err)
+			ftype, _ := DetectCompressed(f)
+			assert.Equal(t, tc.expected, ftype)
+		})
+	}
+}
@@ -0,0 +1,373 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package ociregistry is a small client for the OCI distribution API, enough
+// to resolve an image and push signatures next to it
+package ociregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	oci "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// manifests larger than this are refused, as recommended by the spec
+const maxManifestSize = 4 * 1024 * 1024
+
+// legacy docker manifest types that registries still serve
+const (
+	dockerManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerListType     = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var manifestTypes = []string{
+	oci.MediaTypeImageManifest,
+	oci.MediaTypeImageIndex,
+	dockerManifestType,
+	dockerListType,
+}
+
+// Client talks to registries using the OCI distribution API. The zero value
+// is ready to use.
+type Client struct {
+	HTTPClient *http.Client
+	// Credentials returns the username and password for a registry, or empty
+	// strings to connect anonymously. The default is DockerCredentials.
+	Credentials func(registry string) (username, password string, err error)
+	UserAgent   string
+
+	mu sync.Mutex
+	// Authorization header for each repository that needed one
+	auth map[string]string
+}
+
+// ResponseError is returned when the registry answers with an unexpected
+// status
+type ResponseError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	Errors     []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *ResponseError) Error() string {
+	m := fmt.Sprintf("registry: %s %s: %s", e.Method, e.URL, e.Status)
+	for _, detail := range e.Errors {
+		m += fmt.Sprintf(": %s: %s", detail.Code, detail.Message)
+	}
+	return m
+}
+
+// IsNotFound returns true if the error is a 404 from the registry
+func IsNotFound(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+func responseError(resp *http.Response) error {
+	defer resp.Body.Close()
+	e := &ResponseError{
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.String(),
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+	}
+	blob, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = json.Unmarshal(blob, e)
+	return e
+}
+
+// GetManifest fetches the manifest named by a reference and returns a
+// descriptor for it along with its contents. If the reference has a digest
+// then the manifest is checked against it.
+func (c *Client) GetManifest(ctx context.Context, ref Reference) (oci.Descriptor, []byte, error) {
+	resp, err := c.do(ctx, ref, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, ref.url("manifests", ref.Identifier()), nil)
+		if err == nil {
+			req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+		}
+		return req, err
+	})
+	if err != nil {
+		return oci.Descriptor{}, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return oci.Descriptor{}, nil, responseError(resp)
+	}
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return oci.Descriptor{}, nil, err
+	} else if len(blob) > maxManifestSize {
+		return oci.Descriptor{}, nil, fmt.Errorf("manifest for %s exceeds %d bytes", ref, maxManifestSize)
+	}
+	desc := oci.Descriptor{Digest: ref.Digest, Size: int64(len(blob))}
+	if desc.Digest == "" {
+		desc.Digest = digest.FromBytes(blob)
+		if d, err := digest.Parse(resp.Header.Get("Docker-Content-Digest")); err == nil && d.Algorithm() == desc.Digest.Algorithm() && d != desc.Digest {
+			return oci.Descriptor{}, nil, fmt.Errorf("manifest for %s does not match the digest reported by the registry", ref)
+		}
+	} else if err := desc.Digest.Validate(); err != nil {
+		return oci.Descriptor{}, nil, err
+	} else if desc.Digest.Algorithm().FromBytes(blob) != desc.Digest {
+		return oci.Descriptor{}, nil, fmt.Errorf("manifest for %s does not match its digest", ref)
+	}
+	var mt struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(blob, &mt); err == nil && mt.MediaType != "" {
+		desc.MediaType = mt.MediaType
+	} else {
+		desc.MediaType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	}
+	return desc, blob, nil
+}
+
+// PutManifest uploads a manifest under the tag or digest of ref
+func (c *Client) PutManifest(ctx context.Context, ref Reference, mediaType string, blob []byte) (oci.Descriptor, error) {
+	resp, err := c.do(ctx, ref, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, ref.url("manifests", ref.Identifier()), bytes.NewReader(blob))
+		if err == nil {
+			req.Header.Set("Content-Type", mediaType)
+		}
+		return req, err
+	})
+	if err != nil {
+		return oci.Descriptor{}, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return oci.Descriptor{}, responseError(resp)
+	}
+	resp.Body.Close()
+	return oci.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(blob), Size: int64(len(blob))}, nil
+}
+
+// PutBlob uploads a blob to the repository of ref, unless it is already there
+func (c *Client) PutBlob(ctx context.Context, ref Reference, mediaType string, blob []byte) (oci.Descriptor, error) {
+	desc := oci.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	resp, err := c.do(ctx, ref, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodHead, ref.url("blobs", desc.Digest.String()), nil)
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+	// start an upload, then finish it in one request
+	resp, err = c.do(ctx, ref, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodPost, ref.url("blobs", "uploads")+"/", nil)
+	})
+	if err != nil {
+		return desc, err
+	} else if resp.StatusCode != http.StatusAccepted {
+		return desc, responseError(resp)
+	}
+	resp.Body.Close()
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return desc, fmt.Errorf("registry returned an invalid upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest.String())
+	location.RawQuery = q.Encode()
+	resp, err = c.do(ctx, ref, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPut, location.String(), bytes.NewReader(blob))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+		return req, err
+	})
+	if err != nil {
+		return desc, err
+	} else if resp.StatusCode != http.StatusCreated {
+		return desc, responseError(resp)
+	}
+	resp.Body.Close()
+	return desc, nil
+}
+
+func (r Reference) url(kind, name string) string {
+	return r.scheme() + "://" + r.host() + "/v2/" + r.Repository + "/" + kind + "/" + name
+}
+
+// do sends a request, authenticating and sending it again if the registry
+// asks for credentials
+func (c *Client) do(ctx context.Context, ref Reference, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	key := ref.Registry + "/" + ref.Repository
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		if c.UserAgent != "" {
+			req.Header.Set("User-Agent", c.UserAgent)
+		}
+		c.mu.Lock()
+		authz := c.auth[key]
+		c.mu.Unlock()
+		if authz != "" {
+			req.Header.Set("Authorization", authz)
+		}
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return nil, err
+		} else if resp.StatusCode != http.StatusUnauthorized || attempt != 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authz, err = c.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.auth == nil {
+			c.auth = make(map[string]string)
+		}
+		c.auth[key] = authz
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// authorize answers a WWW-Authenticate challenge and returns the
+// Authorization header to send
+func (c *Client) authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	getCreds := c.Credentials
+	if getCreds == nil {
+		getCreds = DockerCredentials
+	}
+	username, password, err := getCreds(ref.Registry)
+	if err != nil {
+		return "", fmt.Errorf("getting credentials for %s: %w", ref.Registry, err)
+	}
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if username == "" {
+			return "", fmt.Errorf("registry %s requires a login", ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)), nil
+	case "bearer":
+		return c.fetchToken(ctx, ref, params, username, password)
+	default:
+		return "", fmt.Errorf("registry %s asked for unsupported authentication %q", ref.Registry, challenge)
+	}
+}
+
+// fetchToken gets a bearer token for pulling from and pushing to the
+// repository, as described by the docker token authentication spec
+func (c *Client) fetchToken(ctx context.Context, ref Reference, params map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("registry %s sent an invalid token realm", ref.Registry)
+	}
+	q := realm.Query()
+	if service := params["service"]; service != "" {
+		q.Set("service", service)
+	}
+	q.Set("scope", "repository:"+ref.Repository+":pull,push")
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", responseError(resp)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tok); err != nil {
+		return "", fmt.Errorf("reading token from %s: %w", realm.Host, err)
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	if tok.Token == "" {
+		return "", fmt.Errorf("no token was returned by %s", realm.Host)
+	}
+	return "Bearer " + tok.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme, in lower
+// case, and its parameters
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := make(map[string]string)
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		var name string
+		name, rest, _ = strings.Cut(rest, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// quoted values may contain commas
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\`, "")
+			rest = rest[min(end+1, len(rest)):]
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+			rest = "," + rest
+		}
+		params[name] = strings.TrimSpace(value)
+		_, rest, _ = strings.Cut(rest, ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return strings.ToLower(scheme), params
+}
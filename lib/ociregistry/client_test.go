@@ -0,0 +1,176 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ociregistry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	oci "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// fakeRegistry stores manifests and blobs in memory and requires a bearer
+// token from its own token endpoint
+type fakeRegistry struct {
+	*httptest.Server
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[digest.Digest][]byte
+	tokens    int
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[digest.Digest][]byte),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) serve(rw http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.URL.Path == "/token" {
+		if user, pass, _ := req.BasicAuth(); user != "user" || pass != "pass" {
+			http.Error(rw, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("scope") != "repository:team/app:pull,push" {
+			http.Error(rw, "bad scope", http.StatusBadRequest)
+			return
+		}
+		r.tokens++
+		_ = json.NewEncoder(rw).Encode(map[string]string{"token": "t0ken"})
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer t0ken" {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="`+r.URL+`/token",service="fake"`)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/team/app/")
+	switch {
+	case strings.HasPrefix(path, "manifests/"):
+		name := strings.TrimPrefix(path, "manifests/")
+		if req.Method == http.MethodPut {
+			blob, _ := io.ReadAll(req.Body)
+			d := digest.FromBytes(blob)
+			r.manifests[name] = blob
+			r.manifests[d.String()] = blob
+			rw.Header().Set("Docker-Content-Digest", d.String())
+			rw.WriteHeader(http.StatusCreated)
+			return
+		}
+		blob, ok := r.manifests[name]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			_, _ = rw.Write([]byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`))
+			return
+		}
+		rw.Header().Set("Content-Type", oci.MediaTypeImageManifest)
+		rw.Header().Set("Docker-Content-Digest", digest.FromBytes(blob).String())
+		_, _ = rw.Write(blob)
+	case path == "blobs/uploads/" && req.Method == http.MethodPost:
+		rw.Header().Set("Location", "/upload/1?state=abc")
+		rw.WriteHeader(http.StatusAccepted)
+	case strings.HasPrefix(path, "blobs/") && req.Method == http.MethodHead:
+		if _, ok := r.blobs[digest.Digest(strings.TrimPrefix(path, "blobs/"))]; !ok {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	case strings.HasPrefix(req.URL.Path, "/upload/") && req.Method == http.MethodPut:
+		blob, _ := io.ReadAll(req.Body)
+		d := digest.Digest(req.URL.Query().Get("digest"))
+		if req.URL.Query().Get("state") != "abc" || digest.FromBytes(blob) != d {
+			http.Error(rw, "bad upload", http.StatusBadRequest)
+			return
+		}
+		r.blobs[d] = blob
+		rw.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func (r *fakeRegistry) ref(t *testing.T, name string) Reference {
+	ref, err := ParseReference(strings.TrimPrefix(r.URL, "http://") + "/team/app" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func TestClient(t *testing.T) {
+	reg := newFakeRegistry(t)
+	client := &Client{Credentials: func(registry string) (string, string, error) {
+		return "user", "pass", nil
+	}}
+	ctx := context.Background()
+	// push and pull back a blob and manifest
+	layer := []byte("layer contents")
+	layerDesc, err := client.PutBlob(ctx, reg.ref(t, ""), "application/octet-stream", layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reg.blobs[layerDesc.Digest]) != string(layer) {
+		t.Fatal("blob was not uploaded")
+	}
+	// already present, so not uploaded again
+	if _, err := client.PutBlob(ctx, reg.ref(t, ""), "application/octet-stream", layer); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ := json.Marshal(oci.Manifest{MediaType: oci.MediaTypeImageManifest, Layers: []oci.Descriptor{layerDesc}})
+	pushed, err := client.PutManifest(ctx, reg.ref(t, ":1.0"), oci.MediaTypeImageManifest, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, blob, err := client.GetManifest(ctx, reg.ref(t, ":1.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != pushed.Digest || desc.MediaType != oci.MediaTypeImageManifest || string(blob) != string(manifest) {
+		t.Errorf("unexpected manifest %+v", desc)
+	}
+	if _, _, err := client.GetManifest(ctx, reg.ref(t, "@"+pushed.Digest.String())); err != nil {
+		t.Error(err)
+	}
+	if reg.tokens != 1 {
+		t.Errorf("expected the token to be reused, fetched %d", reg.tokens)
+	}
+	// errors
+	_, _, err = client.GetManifest(ctx, reg.ref(t, ":missing"))
+	if !IsNotFound(err) || !strings.Contains(err.Error(), "MANIFEST_UNKNOWN") {
+		t.Errorf("expected not found, got %v", err)
+	}
+	wrong := digest.FromString("something else")
+	reg.manifests[wrong.String()] = manifest
+	if _, _, err := client.GetManifest(ctx, reg.ref(t, "@"+wrong.String())); err == nil {
+		t.Error("expected digest mismatch")
+	}
+	anon := &Client{Credentials: func(string) (string, string, error) { return "", "", nil }}
+	if _, _, err := anon.GetManifest(ctx, reg.ref(t, ":1.0")); err == nil {
+		t.Error("expected anonymous access to be refused")
+	}
+}
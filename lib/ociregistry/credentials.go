@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ociregistry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// docker hub credentials are saved under its legacy index URL
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DockerCredentials looks up the username and password for a registry in the
+// docker client configuration written by "docker login", running the
+// credential helper it names if there is one. Empty strings are returned if
+// no credentials are saved for the registry.
+func DockerCredentials(registry string) (username, password string, err error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	blob, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", err
+	}
+	var conf dockerConfig
+	if err := json.Unmarshal(blob, &conf); err != nil {
+		return "", "", fmt.Errorf("reading docker config: %w", err)
+	}
+	return conf.lookup(registry)
+}
+
+func (conf *dockerConfig) lookup(registry string) (username, password string, err error) {
+	key := registry
+	if registry == DefaultRegistry {
+		key = dockerHubAuthKey
+	}
+	if helper := conf.CredHelpers[key]; helper != "" {
+		return runCredentialHelper(helper, key)
+	}
+	if conf.CredsStore != "" {
+		username, password, err = runCredentialHelper(conf.CredsStore, key)
+		if err != nil || username != "" {
+			return username, password, err
+		}
+	}
+	for name, auth := range conf.Auths {
+		if authHost(name) != registry {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("reading docker config: credentials for %s: %w", name, err)
+			}
+			username, password, _ = strings.Cut(string(decoded), ":")
+			return username, password, nil
+		}
+		return auth.Username, auth.Password, nil
+	}
+	return "", "", nil
+}
+
+// authHost reduces a key of the auths section, which may be a URL, to the
+// registry it names
+func authHost(name string) string {
+	name = strings.TrimPrefix(name, "https://")
+	name = strings.TrimPrefix(name, "http://")
+	name, _, _ = strings.Cut(name, "/")
+	switch name {
+	case "index.docker.io", "registry-1.docker.io":
+		return DefaultRegistry
+	}
+	return name
+}
+
+// runCredentialHelper gets credentials from a docker-credential-* program
+func runCredentialHelper(helper, serverURL string) (username, password string, err error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("docker-credential-%s: %w: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return "", "", fmt.Errorf("docker-credential-%s: %w", helper, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
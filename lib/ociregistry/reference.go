@@ -0,0 +1,135 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ociregistry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// DefaultRegistry is assumed for references that don't name a registry
+const DefaultRegistry = "docker.io"
+
+var (
+	repoPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagPattern  = regexp.MustCompile(`^\w[\w.-]{0,127}$`)
+)
+
+// Reference names a repository in a registry and a tag or digest in it
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     digest.Digest
+}
+
+// ParseReference parses an image reference such as
+// registry.example.com/team/app:1.0 or app@sha256:... using the same defaults
+// as docker: docker.io for the registry, library/ for single-component names
+// on docker.io, and the "latest" tag if there is neither a tag nor a digest.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	name := s
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		d, err := digest.Parse(name[i+1:])
+		if err != nil {
+			return ref, fmt.Errorf("invalid image reference %q: %w", s, err)
+		}
+		ref.Digest = d
+		name = name[:i]
+	}
+	// a colon after the last slash starts the tag, otherwise it's a port
+	if i := strings.LastIndexByte(name, ':'); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !tagPattern.MatchString(ref.Tag) {
+			return ref, fmt.Errorf("invalid image reference %q: invalid tag", s)
+		}
+	}
+	// the first component names the registry if it looks like a host
+	if i := strings.IndexByte(name, '/'); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		ref.Registry = name[:i]
+		name = name[i+1:]
+	} else {
+		ref.Registry = DefaultRegistry
+	}
+	if ref.Registry == DefaultRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	if !repoPattern.MatchString(name) {
+		return ref, fmt.Errorf("invalid image reference %q: invalid repository name", s)
+	}
+	ref.Repository = name
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Identifier returns the digest if there is one, and otherwise the tag
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest.String()
+	}
+	return r.Tag
+}
+
+// WithTag returns a reference to a tag in the same repository
+func (r Reference) WithTag(tag string) Reference {
+	return Reference{Registry: r.Registry, Repository: r.Repository, Tag: tag}
+}
+
+// WithDigest returns a reference to a digest in the same repository
+func (r Reference) WithDigest(d digest.Digest) Reference {
+	return Reference{Registry: r.Registry, Repository: r.Repository, Digest: d}
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest.String()
+	}
+	return s
+}
+
+// host returns the address of the registry's API
+func (r Reference) host() string {
+	if r.Registry == DefaultRegistry {
+		return "registry-1.docker.io"
+	}
+	return r.Registry
+}
+
+// scheme is plain http for registries on the loopback interface, as with
+// docker's default insecure registries, and https for everything else
+func (r Reference) scheme() string {
+	host := r.Registry
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	switch strings.Trim(host, "[]") {
+	case "localhost", "127.0.0.1", "::1":
+		return "http"
+	}
+	return "https"
+}
@@ -0,0 +1,103 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ociregistry
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	const sum = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	for _, tc := range []struct {
+		in, registry, repo, tag, digest string
+	}{
+		{"alpine", "docker.io", "library/alpine", "latest", ""},
+		{"alpine:3.20", "docker.io", "library/alpine", "3.20", ""},
+		{"team/app", "docker.io", "team/app", "latest", ""},
+		{"registry.example.com/team/app:1.0", "registry.example.com", "team/app", "1.0", ""},
+		{"localhost:5000/app", "localhost:5000", "app", "latest", ""},
+		{"localhost/app@" + sum, "localhost", "app", "", sum},
+		{"ghcr.io/org/app:v1@" + sum, "ghcr.io", "org/app", "v1", sum},
+	} {
+		ref, err := ParseReference(tc.in)
+		if err != nil {
+			t.Errorf("%s: %s", tc.in, err)
+			continue
+		}
+		if ref.Registry != tc.registry || ref.Repository != tc.repo || ref.Tag != tc.tag || ref.Digest.String() != tc.digest {
+			t.Errorf("%s: got %+v", tc.in, ref)
+		}
+	}
+	for _, bad := range []string{"", "UPPER/case", "app:bad tag", "app@sha256:1234", "app:"} {
+		if _, err := ParseReference(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestReferenceScheme(t *testing.T) {
+	for registry, scheme := range map[string]string{
+		"localhost:5000":       "http",
+		"127.0.0.1:5000":       "http",
+		"[::1]:5000":           "http",
+		"docker.io":            "https",
+		"registry.example.com": "https",
+	} {
+		if got := (Reference{Registry: registry}).scheme(); got != scheme {
+			t.Errorf("%s: expected %s, got %s", registry, scheme, got)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	if scheme != "bearer" {
+		t.Errorf("unexpected scheme %q", scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}
+	for name, value := range expected {
+		if params[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, params[name])
+		}
+	}
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	if scheme != "basic" || params["realm"] != "registry" {
+		t.Errorf("unexpected challenge %q %v", scheme, params)
+	}
+}
+
+func TestDockerCredentials(t *testing.T) {
+	conf := &dockerConfig{Auths: map[string]dockerAuth{
+		dockerHubAuthKey:               {Auth: "aHViOnNlY3JldA=="},
+		"https://registry.example.com": {Username: "user", Password: "pass"},
+	}}
+	for registry, expected := range map[string][2]string{
+		"docker.io":            {"hub", "secret"},
+		"registry.example.com": {"user", "pass"},
+		"other.example.com":    {"", ""},
+	} {
+		username, password, err := conf.lookup(registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if username != expected[0] || password != expected[1] {
+			t.Errorf("%s: got %q %q", registry, username, password)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ostree
+
+// implement just enough of the GVariant serialization format to read and write
+// detached commit metadata
+// https://developer.gnome.org/documentation/specifications/gvariant-specification-1.0.html
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed GVariant data")
+
+// size of framing offsets in a container of the given total size
+func offsetSize(size int) int {
+	switch n := uint64(size); {
+	case n == 0:
+		return 0
+	case n <= 0xff:
+		return 1
+	case n <= 0xffff:
+		return 2
+	case n <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// pick the smallest offset size that can address the framed container
+func framedSize(bodySize, offsets int) int {
+	for _, size := range []int{1, 2, 4} {
+		if uint64(bodySize+size*offsets) <= 1<<(8*size)-1 {
+			return size
+		}
+	}
+	return 8
+}
+
+func readOffset(blob []byte, size int) int {
+	switch size {
+	case 1:
+		return int(blob[0])
+	case 2:
+		return int(binary.LittleEndian.Uint16(blob))
+	case 4:
+		return int(binary.LittleEndian.Uint32(blob))
+	default:
+		return int(binary.LittleEndian.Uint64(blob))
+	}
+}
+
+func writeOffset(buf *bytes.Buffer, value, size int) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(value))
+	buf.Write(b[:size])
+}
+
+func align(n, alignment int) int {
+	return (n + alignment - 1) &^ (alignment - 1)
+}
+
+// split an array of variable-size elements
+func parseArray(blob []byte, alignment int) ([][]byte, error) {
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	osize := offsetSize(len(blob))
+	if len(blob) < osize {
+		return nil, errMalformed
+	}
+	tableStart := readOffset(blob[len(blob)-osize:], osize)
+	if tableStart > len(blob) || (len(blob)-tableStart)%osize != 0 {
+		return nil, errMalformed
+	}
+	count := (len(blob) - tableStart) / osize
+	elems := make([][]byte, count)
+	start := 0
+	for i := 0; i < count; i++ {
+		end := readOffset(blob[tableStart+i*osize:], osize)
+		start = align(start, alignment)
+		if start > end || end > tableStart {
+			return nil, errMalformed
+		}
+		elems[i] = blob[start:end]
+		start = end
+	}
+	return elems, nil
+}
+
+// join an array of variable-size elements
+func marshalArray(elems [][]byte, alignment int) []byte {
+	var body bytes.Buffer
+	ends := make([]int, len(elems))
+	for i, elem := range elems {
+		body.Write(make([]byte, align(body.Len(), alignment)-body.Len()))
+		body.Write(elem)
+		ends[i] = body.Len()
+	}
+	if len(elems) == 0 {
+		return nil
+	}
+	osize := framedSize(body.Len(), len(elems))
+	for _, end := range ends {
+		writeOffset(&body, end, osize)
+	}
+	return body.Bytes()
+}
+
+// split a {sv} dictionary entry into its key and variant
+func parseDictEntry(blob []byte) (string, []byte, error) {
+	osize := offsetSize(len(blob))
+	if len(blob) < osize+1 {
+		return "", nil, errMalformed
+	}
+	keyEnd := readOffset(blob[len(blob)-osize:], osize)
+	valueStart := align(keyEnd, 8)
+	if keyEnd < 1 || valueStart > len(blob)-osize || blob[keyEnd-1] != 0 {
+		return "", nil, errMalformed
+	}
+	return string(blob[:keyEnd-1]), blob[valueStart : len(blob)-osize], nil
+}
+
+func marshalDictEntry(key string, variant []byte) []byte {
+	var body bytes.Buffer
+	body.WriteString(key)
+	body.WriteByte(0)
+	keyEnd := body.Len()
+	body.Write(make([]byte, align(keyEnd, 8)-keyEnd))
+	body.Write(variant)
+	writeOffset(&body, keyEnd, framedSize(body.Len(), 1))
+	return body.Bytes()
+}
+
+// split a variant into its value and type signature
+func parseVariant(blob []byte) ([]byte, string, error) {
+	i := bytes.LastIndexByte(blob, 0)
+	if i < 0 {
+		return nil, "", errMalformed
+	}
+	return blob[:i], string(blob[i+1:]), nil
+}
+
+func marshalVariant(value []byte, sigType string) []byte {
+	ret := make([]byte, 0, len(value)+1+len(sigType))
+	ret = append(ret, value...)
+	ret = append(ret, 0)
+	return append(ret, sigType...)
+}
@@ -0,0 +1,141 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Read and write detached GPG signatures on OSTree commits, as used by Flatpak.
+// Signatures are kept in the commit's detached metadata file
+// (objects/XX/YYYY.commitmeta) under the key "ostree.gpgsigs".
+package ostree
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gpgSigsKey  = "ostree.gpgsigs"
+	gpgSigsType = "aay"
+
+	commitSuffix     = ".commit"
+	commitMetaSuffix = ".commitmeta"
+)
+
+// Metadata holds the entries of a commit's detached metadata. Entries other
+// than signatures are kept as-is.
+type Metadata struct {
+	Entries []MetadataEntry
+}
+
+type MetadataEntry struct {
+	Key     string
+	Variant []byte
+}
+
+// ParseMetadata parses a detached metadata file, which is a GVariant of type a{sv}
+func ParseMetadata(blob []byte) (*Metadata, error) {
+	items, err := parseArray(blob, 8)
+	if err != nil {
+		return nil, fmt.Errorf("parsing commit metadata: %w", err)
+	}
+	m := new(Metadata)
+	for _, item := range items {
+		key, variant, err := parseDictEntry(item)
+		if err != nil {
+			return nil, fmt.Errorf("parsing commit metadata: %w", err)
+		}
+		m.Entries = append(m.Entries, MetadataEntry{Key: key, Variant: variant})
+	}
+	return m, nil
+}
+
+// Marshal serializes the metadata
+func (m *Metadata) Marshal() []byte {
+	items := make([][]byte, len(m.Entries))
+	for i, entry := range m.Entries {
+		items[i] = marshalDictEntry(entry.Key, entry.Variant)
+	}
+	return marshalArray(items, 8)
+}
+
+// Signatures returns the binary detached PGP signatures in the metadata
+func (m *Metadata) Signatures() ([][]byte, error) {
+	for _, entry := range m.Entries {
+		if entry.Key != gpgSigsKey {
+			continue
+		}
+		value, sigType, err := parseVariant(entry.Variant)
+		if err != nil {
+			return nil, err
+		} else if sigType != gpgSigsType {
+			return nil, fmt.Errorf("unexpected type %q for %s", sigType, gpgSigsKey)
+		}
+		return parseArray(value, 1)
+	}
+	return nil, nil
+}
+
+// AddSignature appends a binary detached PGP signature to the metadata
+func (m *Metadata) AddSignature(sig []byte) error {
+	sigs, err := m.Signatures()
+	if err != nil {
+		return err
+	}
+	sigs = append(sigs, sig)
+	variant := marshalVariant(marshalArray(sigs, 1), gpgSigsType)
+	for i, entry := range m.Entries {
+		if entry.Key == gpgSigsKey {
+			m.Entries[i].Variant = variant
+			return nil
+		}
+	}
+	m.Entries = append(m.Entries, MetadataEntry{Key: gpgSigsKey, Variant: variant})
+	return nil
+}
+
+// MetadataPath returns the path of the detached metadata for a commit object
+func MetadataPath(commitPath string) string {
+	return strings.TrimSuffix(commitPath, commitSuffix) + commitMetaSuffix
+}
+
+// ReadMetadata reads the detached metadata for a commit object, returning
+// empty metadata if there is none yet
+func ReadMetadata(commitPath string) (*Metadata, error) {
+	blob, err := os.ReadFile(MetadataPath(commitPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return new(Metadata), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseMetadata(blob)
+}
+
+// CheckCommit verifies that the contents of a commit object match the
+// checksum in its file name
+func CheckCommit(commitPath string, contents []byte) error {
+	name := filepath.Base(commitPath)
+	if !strings.HasSuffix(name, commitSuffix) {
+		return nil
+	}
+	checksum := filepath.Base(filepath.Dir(commitPath)) + strings.TrimSuffix(name, commitSuffix)
+	if calculated := sha256.Sum256(contents); hex.EncodeToString(calculated[:]) != checksum {
+		return fmt.Errorf("commit object does not match its checksum %s", checksum)
+	}
+	return nil
+}
@@ -23,6 +23,8 @@ import "errors"
 
 var errNotFound = errors.New("keyring support not available")
 
+const keyringSupported = false
+
 func keyringGet(service, user string) (string, error) {
 	return "", errNotFound
 }
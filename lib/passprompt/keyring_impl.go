@@ -25,6 +25,8 @@ import (
 
 var errNotFound = keyring.ErrNotFound
 
+const keyringSupported = true
+
 func keyringGet(service, user string) (string, error) {
 	return keyring.Get(service, user)
 }
@@ -17,27 +17,51 @@
 package passprompt
 
 import (
+	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
 
+// Maximum number of times to prompt for a password before giving up
+const MaxAttempts = 3
+
 type LoginFunc func(string) (bool, error)
 
+// Login tries passwords until one works. If keyringService is set, the system
+// keyring is tried first without counting as an attempt, and a password typed
+// at the prompt is offered to be saved there afterwards.
 func Login(login LoginFunc, getter PasswordGetter, keyringService, keyringUser, initialPrompt, failPrefix string) error {
 	keyringFirst := keyringService != ""
+	canSave := keyringFirst && keyringSupported
 	prompt := initialPrompt
+	var attempts int
 	for {
 		var password string
 		var err error
+		fromKeyring := false
 		if keyringFirst {
 			keyringFirst = false
 			password, err = keyringGet(keyringService, keyringUser)
 			if err == errNotFound {
 				continue
 			} else if err != nil {
-				return fmt.Errorf("keyring error: %w", err)
+				// no usable keyring, such as when there is no Secret Service
+				// running, so just prompt
+				fmt.Fprintf(os.Stderr, "Warning: keyring error: %s\n", err)
+				canSave = false
+				continue
 			}
+			fromKeyring = true
 		} else if getter != nil {
+			if attempts >= MaxAttempts {
+				return sigerrors.PinIncorrectError{}
+			}
+			attempts++
 			password, err = getter.GetPasswd(prompt)
 			if err != nil {
 				return err
@@ -51,14 +75,50 @@ func Login(login LoginFunc, getter PasswordGetter, keyringService, keyringUser,
 		if err != nil {
 			return err
 		} else if ok {
-			if keyringService != "" {
-				err := keyringSet(keyringService, keyringUser, password)
-				if err != nil {
+			if canSave && !fromKeyring {
+				if err := offerSave(keyringService, keyringUser, password); err != nil {
 					return fmt.Errorf("keyring error: %w", err)
 				}
 			}
 			return nil
 		}
-		prompt = failPrefix + initialPrompt
+		if attempts > 0 {
+			prompt = fmt.Sprintf("%s(%d of %d attempts remaining) %s", failPrefix, MaxAttempts-attempts, MaxAttempts, initialPrompt)
+		}
+	}
+}
+
+// keyring entries the user chose not to save, so they are only asked once
+var declined sync.Map
+
+// used by tests to answer the offer to save
+var confirmSave = askYesNo
+
+// Offer to save a password that was typed at the prompt in the keyring
+func offerSave(service, user, password string) error {
+	key := service + "\x00" + user
+	if _, ok := declined.Load(key); ok {
+		return nil
+	}
+	ok, err := confirmSave("Save PIN in the system keyring? [y/N] ")
+	if err != nil {
+		return err
+	} else if !ok {
+		declined.Store(key, true)
+		return nil
+	}
+	return keyringSet(service, user, password)
+}
+
+func askYesNo(prompt string) (bool, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
 	}
+	return false, nil
 }
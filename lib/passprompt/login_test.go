@@ -0,0 +1,91 @@
+//go:build linux || darwin || (windows && amd64)
+// +build linux darwin windows,amd64
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package passprompt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+type fakePrompt struct {
+	answers []string
+	calls   int
+}
+
+func (p *fakePrompt) GetPasswd(prompt string) (string, error) {
+	if p.calls >= len(p.answers) {
+		return "", errors.New("unexpected prompt")
+	}
+	p.calls++
+	return p.answers[p.calls-1], nil
+}
+
+func TestLoginKeyring(t *testing.T) {
+	keyring.MockInit()
+	var offers int
+	answer := true
+	confirmSave = func(string) (bool, error) {
+		offers++
+		return answer, nil
+	}
+	defer func() { confirmSave = askYesNo }()
+	login := func(pin string) (bool, error) { return pin == "1234", nil }
+	const service, user = "relic", "hsm.00000001"
+
+	// first use prompts, with a retry after a wrong PIN, and offers to save it
+	prompt := &fakePrompt{answers: []string{"0000", "1234"}}
+	require.NoError(t, Login(login, prompt, service, user, "PIN: ", ""))
+	assert.Equal(t, 2, prompt.calls)
+	assert.Equal(t, 1, offers)
+	saved, err := keyring.Get(service, user)
+	require.NoError(t, err)
+	assert.Equal(t, "1234", saved)
+
+	// then it's read silently
+	prompt = &fakePrompt{}
+	require.NoError(t, Login(login, prompt, service, user, "PIN: ", ""))
+	assert.Zero(t, prompt.calls)
+	assert.Equal(t, 1, offers)
+
+	// a stale PIN in the keyring doesn't use up one of the attempts, and the
+	// one typed instead replaces it
+	require.NoError(t, keyring.Set(service, user, "9999"))
+	prompt = &fakePrompt{answers: []string{"0000", "0000", "1234"}}
+	require.NoError(t, Login(login, prompt, service, user, "PIN: ", ""))
+	assert.Equal(t, 3, prompt.calls)
+	assert.Equal(t, 2, offers)
+	saved, _ = keyring.Get(service, user)
+	assert.Equal(t, "1234", saved)
+
+	// once declined it isn't offered again
+	answer = false
+	const other = "other.00000001"
+	for i := 0; i < 2; i++ {
+		prompt = &fakePrompt{answers: []string{"1234"}}
+		require.NoError(t, Login(login, prompt, service, other, "PIN: ", ""))
+	}
+	assert.Equal(t, 3, offers)
+	_, err = keyring.Get(service, other)
+	assert.ErrorIs(t, err, keyring.ErrNotFound)
+}
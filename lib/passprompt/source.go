@@ -0,0 +1,77 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package passprompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	filePrefix    = "file:"
+	commandPrefix = "|"
+)
+
+// Read a password from a file
+type FileGetter struct {
+	Path string
+}
+
+func (g FileGetter) GetPasswd(prompt string) (string, error) {
+	if info, err := os.Stat(g.Path); err == nil && info.Mode().Perm()&0o004 != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: PIN file %s is world-readable\n", g.Path)
+	}
+	blob, err := os.ReadFile(g.Path)
+	if err != nil {
+		return "", fmt.Errorf("reading PIN file: %w", err)
+	}
+	return strings.TrimRight(string(blob), "\r\n"), nil
+}
+
+// Read a password from the standard output of a command
+type CommandGetter struct {
+	Command []string
+}
+
+func (g CommandGetter) GetPasswd(prompt string) (string, error) {
+	if len(g.Command) == 0 {
+		return "", errors.New("PIN command is empty")
+	}
+	cmd := exec.Command(g.Command[0], g.Command[1:]...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running PIN command: %w", err)
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+// ParsePinSource returns a getter if a configured PIN refers to a file
+// ("file:/path") or a command ("|command arg..."), or false if the PIN should
+// be used literally.
+func ParsePinSource(pin string) (PasswordGetter, bool) {
+	switch {
+	case strings.HasPrefix(pin, filePrefix):
+		return FileGetter{Path: strings.TrimPrefix(pin, filePrefix)}, true
+	case strings.HasPrefix(pin, commandPrefix):
+		return CommandGetter{Command: strings.Fields(strings.TrimPrefix(pin, commandPrefix))}, true
+	}
+	return nil, false
+}
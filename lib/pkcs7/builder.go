@@ -40,6 +40,9 @@ type SignatureBuilder struct {
 // Build a PKCS#7 signature procedurally. Returns a structure that can have
 // content and attributes attached to it.
 func NewBuilder(privKey crypto.Signer, certs []*x509.Certificate, opts crypto.SignerOpts) *SignatureBuilder {
+	if pss, ok := privKey.(x509tools.PSSSigner); ok {
+		opts = pss.SignerOpts(opts)
+	}
 	return &SignatureBuilder{
 		privateKey: privKey,
 		signerOpts: opts,
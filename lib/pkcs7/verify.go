@@ -18,12 +18,15 @@ package pkcs7
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/hmac"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/asn1"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"math/big"
 	"time"
 
@@ -90,6 +93,56 @@ func (sd *SignedData) Verify(externalContent []byte, skipDigests bool) (Signatur
 	return sig, nil
 }
 
+// VerifyDetached verifies a detached signature over content read from r. The
+// content is hashed as it is read so it does not need to fit in memory. As
+// with Verify, X509 chains are not validated.
+func (sd *SignedData) VerifyDetached(r io.Reader) (Signature, error) {
+	if content, err := sd.ContentInfo.Bytes(); err != nil {
+		return Signature{}, err
+	} else if content != nil {
+		return Signature{}, errors.New("pkcs7: signature is not detached")
+	}
+	if len(sd.SignerInfos) == 0 {
+		return Signature{}, sigerrors.NotSignedError{Type: "pkcs7"}
+	}
+	// hash the content once for each digest the signers used
+	digesters := make(map[crypto.Hash]hash.Hash)
+	var writers []io.Writer
+	for _, si := range sd.SignerInfos {
+		alg, err := x509tools.PkixDigestToHashE(si.DigestAlgorithm)
+		if err != nil {
+			return Signature{}, fmt.Errorf("pkcs7: %w", err)
+		}
+		if digesters[alg] == nil {
+			d := alg.New()
+			digesters[alg] = d
+			writers = append(writers, d)
+		}
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return Signature{}, err
+	}
+	certs, certErr := sd.Certificates.Parse()
+	var sig Signature
+	for _, si := range sd.SignerInfos {
+		alg, _ := x509tools.PkixDigestToHashE(si.DigestAlgorithm)
+		cert, err := si.VerifyDigest(digesters[alg].Sum(nil), certs)
+		if err != nil {
+			if errors.As(err, &MissingCertificateError{}) && certErr != nil {
+				err = certErr
+			}
+			return Signature{}, err
+		}
+		sig = Signature{
+			SignerInfo:    &si,
+			Certificate:   cert,
+			Intermediates: certs,
+			CertError:     certErr,
+		}
+	}
+	return sig, nil
+}
+
 // Find the certificate that signed this SignerInfo from the bucket of certs
 func (si *SignerInfo) FindCertificate(certs []*x509.Certificate) (*x509.Certificate, error) {
 	is := si.IssuerAndSerialNumber
@@ -124,6 +177,17 @@ func (si *SignerInfo) Verify(content []byte, skipDigests bool, certs []*x509.Cer
 		w.Write(content)
 		digest = w.Sum(nil)
 	}
+	return si.VerifyDigest(digest, certs)
+}
+
+// VerifyDigest verifies the signature contained in this SignerInfo given the
+// digest of the content, and returns the leaf certificate. If digest is nil
+// then the content is not checked. X509 chains are not validated.
+func (si *SignerInfo) VerifyDigest(digest []byte, certs []*x509.Certificate) (*x509.Certificate, error) {
+	hash, err := x509tools.PkixDigestToHashE(si.DigestAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs7: %w", err)
+	}
 	if len(si.AuthenticatedAttributes) != 0 {
 		// check the content digest against the messageDigest attribute
 		var md []byte
@@ -167,6 +231,13 @@ func (si *SignerInfo) Verify(content []byte, skipDigests bool, certs []*x509.Cer
 // PKCS#9 trusted timestamp was found, pass that timestamp in currentTime to
 // validate the chain as of the time of the signature.
 func (info Signature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage, currentTime time.Time) error {
+	_, err := info.BuildChain(roots, extraCerts, usage, currentTime)
+	return err
+}
+
+// BuildChain is like VerifyChain but returns the verified chain, starting with
+// the signing certificate and ending with the root
+func (info Signature) BuildChain(roots *x509.CertPool, extraCerts []*x509.Certificate, usage x509.ExtKeyUsage, currentTime time.Time) ([]*x509.Certificate, error) {
 	pool := x509.NewCertPool()
 	for _, cert := range extraCerts {
 		pool.AddCert(cert)
@@ -180,13 +251,13 @@ func (info Signature) VerifyChain(roots *x509.CertPool, extraCerts []*x509.Certi
 		CurrentTime:   currentTime,
 		KeyUsages:     []x509.ExtKeyUsage{usage},
 	}
-	_, err := info.Certificate.Verify(opts)
+	chains, err := info.Certificate.Verify(opts)
 	if err == nil {
-		return nil
+		return chains[0], nil
 	}
 	if e := new(x509.UnknownAuthorityError); errors.As(err, e) && info.CertError != nil {
 		// surface a saved cert parse error
-		return fmt.Errorf("%w: after failing to parse a bundled certificate: %s", err, info.CertError)
+		return nil, fmt.Errorf("%w: after failing to parse a bundled certificate: %s", err, info.CertError)
 	}
-	return err
+	return nil, err
 }
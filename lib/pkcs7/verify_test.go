@@ -0,0 +1,67 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDetached(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	content := bytes.Repeat([]byte("content "), 100000)
+	digest := sha256.Sum256(content)
+	sb := NewBuilder(key, []*x509.Certificate{cert}, crypto.SHA256)
+	require.NoError(t, sb.SetDetachedContent(OidData, digest[:]))
+	psd, err := sb.Sign()
+	require.NoError(t, err)
+	blob, err := psd.Marshal()
+	require.NoError(t, err)
+	psd, err = Unmarshal(blob)
+	require.NoError(t, err)
+
+	sig, err := psd.Content.VerifyDetached(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, cert.Raw, sig.Certificate.Raw)
+
+	_, err = psd.Content.VerifyDetached(bytes.NewReader(content[1:]))
+	assert.Error(t, err)
+}
@@ -35,4 +35,9 @@ type Request struct {
 	Legacy bool
 	// Name optionally selects a different pool of timestamp servers.
 	Name string
+	// URLs optionally replaces the configured timestamp servers entirely.
+	URLs []string
+	// Authenticode indicates that the timestamp is for an Authenticode
+	// signature, which can accept either kind of timestamp
+	Authenticode bool
 }
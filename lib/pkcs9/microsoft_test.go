@@ -0,0 +1,118 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pkcs9
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+)
+
+func makeCert(t *testing.T, cn string) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+// testdata/legacy-response.b64 is the response from Microsoft's legacy
+// timestamp server for the signature on functest/packages/hyperv.cat
+const legacyCatalog = "../../functest/packages/hyperv.cat"
+
+// loadCatalog returns the test catalog with its timestamp removed
+func loadCatalog(t *testing.T) *pkcs7.ContentInfoSignedData {
+	blob, err := os.ReadFile(legacyCatalog)
+	require.NoError(t, err)
+	psd, err := pkcs7.Unmarshal(blob)
+	require.NoError(t, err)
+	si := &psd.Content.SignerInfos[0]
+	var attrs pkcs7.AttributeList
+	for _, attr := range si.UnauthenticatedAttributes {
+		if !attr.Type.Equal(OidAttributeCounterSign) {
+			attrs = append(attrs, attr)
+		}
+	}
+	si.UnauthenticatedAttributes = attrs
+	return psd
+}
+
+func loadLegacyResponse(t *testing.T) *pkcs7.ContentInfoSignedData {
+	body, err := os.ReadFile("testdata/legacy-response.b64")
+	require.NoError(t, err)
+	token, err := ParseLegacyResponse(body)
+	require.NoError(t, err)
+	return token
+}
+
+func TestLegacyTimestamp(t *testing.T) {
+	psd := loadCatalog(t)
+	token := loadLegacyResponse(t)
+	signingTime := time.Date(2010, 11, 20, 19, 35, 21, 0, time.UTC)
+	cs, err := VerifyMicrosoftToken(token, psd.Content.SignerInfos[0].EncryptedDigest)
+	require.NoError(t, err)
+	assert.True(t, signingTime.Equal(cs.SigningTime))
+	assert.Equal(t, crypto.SHA1, cs.Hash)
+	require.NoError(t, AddLegacyStamp(&psd.Content, *token))
+
+	// round trip and check that the counter-signature is recognized
+	blob, err := psd.Marshal()
+	require.NoError(t, err)
+	psd2, err := pkcs7.Unmarshal(blob)
+	require.NoError(t, err)
+	sig, err := psd2.Content.Verify(nil, false)
+	require.NoError(t, err)
+	ts, err := VerifyOptionalTimestamp(sig)
+	require.NoError(t, err)
+	if assert.NotNil(t, ts.CounterSignature) {
+		assert.True(t, signingTime.Equal(ts.CounterSignature.SigningTime))
+		assert.Equal(t, "Microsoft Time-Stamp Service", ts.CounterSignature.Certificate.Subject.CommonName)
+	}
+}
+
+func TestLegacyTimestampMismatch(t *testing.T) {
+	key, cert := makeCert(t, "signer")
+	sb := pkcs7.NewBuilder(key, []*x509.Certificate{cert}, crypto.SHA256)
+	require.NoError(t, sb.SetContentData([]byte("hello")))
+	psd, err := sb.Sign()
+	require.NoError(t, err)
+	token := loadLegacyResponse(t)
+	_, err = VerifyMicrosoftToken(token, psd.Content.SignerInfos[0].EncryptedDigest)
+	assert.Error(t, err)
+	assert.Error(t, AddLegacyStamp(&psd.Content, *token))
+	assert.Empty(t, psd.Content.SignerInfos[0].UnauthenticatedAttributes)
+}
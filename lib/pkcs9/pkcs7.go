@@ -36,11 +36,21 @@ func TimestampAndMarshal(ctx context.Context, psd *pkcs7.ContentInfoSignedData,
 		if err != nil {
 			return nil, err
 		}
-		token, err := timestamper.Timestamp(ctx, &Request{EncryptedDigest: signerInfo.EncryptedDigest, Hash: hash})
+		token, err := timestamper.Timestamp(ctx, &Request{
+			EncryptedDigest: signerInfo.EncryptedDigest,
+			Hash:            hash,
+			Authenticode:    authenticode,
+		})
 		if err != nil {
 			return nil, err
 		}
-		if authenticode {
+		legacy := token.Content.ContentInfo.ContentType.Equal(pkcs7.OidData)
+		if legacy && !authenticode {
+			return nil, errors.New("legacy timestamps can only be attached to Authenticode signatures")
+		}
+		if legacy {
+			err = AddLegacyStamp(&psd.Content, *token)
+		} else if authenticode {
 			err = AddStampToSignedAuthenticode(signerInfo, *token)
 		} else {
 			err = AddStampToSignedData(signerInfo, *token)
@@ -75,6 +85,27 @@ func AddStampToSignedAuthenticode(signerInfo *pkcs7.SignerInfo, token pkcs7.Cont
 	return signerInfo.UnauthenticatedAttributes.Add(OidSpcTimeStampToken, token)
 }
 
+// Attach a legacy Microsoft timestamp to a PKCS#7 signature. The
+// timestamper's SignerInfo becomes a counter-signature of the primary
+// SignerInfo, and its certificates are merged into the primary signature.
+func AddLegacyStamp(sd *pkcs7.SignedData, token pkcs7.ContentInfoSignedData) error {
+	if len(sd.SignerInfos) != 1 || len(token.Content.SignerInfos) != 1 {
+		return errors.New("expected exactly one SignerInfo")
+	}
+	content, err := token.Content.ContentInfo.Bytes()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(content, sd.SignerInfos[0].EncryptedDigest) {
+		return errors.New("timestamp does not match the enclosing signature")
+	}
+	if err := sd.SignerInfos[0].UnauthenticatedAttributes.Add(OidAttributeCounterSign, token.Content.SignerInfos[0]); err != nil {
+		return err
+	}
+	sd.Certificates = append(sd.Certificates, token.Content.Certificates...)
+	return nil
+}
+
 // Validated timestamp token
 type CounterSignature struct {
 	pkcs7.Signature
@@ -94,5 +94,8 @@ func cacheKey(req *pkcs9.Request) string {
 		prefix = "msft"
 	}
 	prefix += req.Name
+	for _, url := range req.URLs {
+		prefix += "|" + url
+	}
 	return fmt.Sprintf("%s-%d-%x", prefix, req.Hash, d.Sum(nil))
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
@@ -88,6 +89,8 @@ func New(conf *config.TimestampConfig) (t pkcs9.Timestamper, err error) {
 func (c tsClient) Timestamp(ctx context.Context, req *pkcs9.Request) (*pkcs7.ContentInfoSignedData, error) {
 	var urls []string
 	switch {
+	case len(req.URLs) != 0:
+		urls = req.URLs
 	case req.Name != "":
 		urls = c.conf.NamedURLs[req.Name]
 		if len(urls) == 0 {
@@ -116,7 +119,7 @@ func (c tsClient) Timestamp(ctx context.Context, req *pkcs9.Request) (*pkcs7.Con
 			log.Printf("warning: timestamping failed: %s\n  trying next server %s...\n", err, url)
 		}
 		var token *pkcs7.ContentInfoSignedData
-		token, err = c.do(ctx, url, req, imprint)
+		token, err = c.doWithRetry(ctx, url, req, imprint)
 		if err == nil {
 			return token, nil
 		}
@@ -127,6 +130,51 @@ func (c tsClient) Timestamp(ctx context.Context, req *pkcs9.Request) (*pkcs7.Con
 	return nil, fmt.Errorf("timestamping failed: %w", err)
 }
 
+// doWithRetry makes a request to one server, retrying with a backoff if the
+// failure looks temporary
+func (c tsClient) doWithRetry(ctx context.Context, url string, req *pkcs9.Request, imprint []byte) (*pkcs7.ContentInfoSignedData, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		token, err := c.do(ctx, url, req, imprint)
+		if err == nil || attempt >= maxRetries || !temporary(err) || ctx.Err() != nil {
+			return token, err
+		}
+		log.Printf("warning: timestamping failed: %s\n  retrying in %s...\n", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+const (
+	maxRetries = 2
+	retryDelay = time.Second
+)
+
+type statusError struct {
+	URL        string
+	Status     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s: HTTP %s\n%s", e.URL, e.Status, e.Body)
+}
+
+// temporary returns true if a request that failed with err might succeed later
+func temporary(err error) bool {
+	var serr statusError
+	if errors.As(err, &serr) {
+		return serr.StatusCode == http.StatusTooManyRequests || serr.StatusCode >= 500
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
+
 func (c tsClient) do(ctx context.Context, url string, req *pkcs9.Request, imprint []byte) (*pkcs7.ContentInfoSignedData, error) {
 	var msg *pkcs9.TimeStampReq
 	var httpReq *http.Request
@@ -149,7 +197,7 @@ func (c tsClient) do(ctx context.Context, url string, req *pkcs9.Request, imprin
 	if err != nil {
 		return nil, err
 	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("%s: HTTP %s\n%s", url, resp.Status, body)
+		return nil, statusError{URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Body: body}
 	}
 	if req.Legacy {
 		return pkcs9.ParseLegacyResponse(body)
@@ -0,0 +1,273 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package revocation checks whether X.509 certificates have been revoked,
+// using OCSP or CRLs as named by the certificate
+package revocation
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+const (
+	defaultTTL     = time.Hour
+	defaultTimeout = 30 * time.Second
+	// CRLs for public CAs can be quite large
+	maxResponseSize = 64 << 20
+)
+
+// Checker finds out whether certificates were revoked. OCSP is used if the
+// certificate names a responder, falling back to its CRL distribution points.
+type Checker struct {
+	// HTTP client for fetching responses (default: one with a 30 second timeout)
+	Client *http.Client
+	// Directory to keep responses in between runs. If empty then they are only
+	// kept in memory.
+	CacheDir string
+	// How long to reuse a response (default 1 hour). Responses are not used
+	// past their next update time regardless.
+	TTL time.Duration
+
+	mu     sync.Mutex
+	memory map[string]cached
+}
+
+type cached struct {
+	body    []byte
+	fetched time.Time
+}
+
+// RevokedError is returned when a certificate had been revoked at the time
+// being checked
+type RevokedError struct {
+	Certificate *x509.Certificate
+	RevokedAt   time.Time
+}
+
+func (e RevokedError) Error() string {
+	return fmt.Sprintf("certificate %s was revoked at %s", x509tools.FormatSubject(e.Certificate), e.RevokedAt)
+}
+
+// UnavailableError is returned when none of a certificate's revocation sources
+// could give an answer
+type UnavailableError struct {
+	Certificate *x509.Certificate
+	Err         error
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("revocation status of %s is unknown: %s", x509tools.FormatSubject(e.Certificate), e.Err)
+}
+
+func (e UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Check whether cert, issued by issuer, had been revoked as of the given time.
+// Returns a RevokedError if it was, or an UnavailableError if that can't be
+// determined.
+func (c *Checker) Check(ctx context.Context, cert, issuer *x509.Certificate, at time.Time) error {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	var errs []error
+	for _, url := range cert.OCSPServer {
+		err := c.checkOCSP(ctx, url, cert, issuer, at)
+		if err == nil || errors.As(err, new(RevokedError)) {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("OCSP %s: %w", url, err))
+	}
+	for _, url := range cert.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			// e.g. LDAP
+			continue
+		}
+		err := c.checkCRL(ctx, url, cert, issuer, at)
+		if err == nil || errors.As(err, new(RevokedError)) {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("CRL %s: %w", url, err))
+	}
+	if len(errs) == 0 {
+		errs = append(errs, errors.New("certificate has no OCSP responder or CRL distribution point"))
+	}
+	return UnavailableError{Certificate: cert, Err: errors.Join(errs...)}
+}
+
+func (c *Checker) checkOCSP(ctx context.Context, url string, cert, issuer *x509.Certificate, at time.Time) error {
+	req, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return err
+	}
+	var resp *ocsp.Response
+	for _, refresh := range []bool{false, true} {
+		body, err := c.fetch(ctx, url, req, refresh)
+		if err != nil {
+			return err
+		}
+		resp, err = ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			return err
+		}
+		if resp.NextUpdate.IsZero() || time.Now().Before(resp.NextUpdate) {
+			break
+		}
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		if resp.RevokedAt.After(at) {
+			return nil
+		}
+		return RevokedError{Certificate: cert, RevokedAt: resp.RevokedAt}
+	default:
+		return errors.New("responder does not know the certificate")
+	}
+}
+
+func (c *Checker) checkCRL(ctx context.Context, url string, cert, issuer *x509.Certificate, at time.Time) error {
+	var crl *x509.RevocationList
+	for _, refresh := range []bool{false, true} {
+		body, err := c.fetch(ctx, url, nil, refresh)
+		if err != nil {
+			return err
+		}
+		crl, err = x509.ParseRevocationList(body)
+		if err != nil {
+			return err
+		}
+		if crl.NextUpdate.IsZero() || time.Now().Before(crl.NextUpdate) {
+			break
+		}
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("CRL was not signed by the issuer: %w", err)
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			if entry.RevocationTime.After(at) {
+				return nil
+			}
+			return RevokedError{Certificate: cert, RevokedAt: entry.RevocationTime}
+		}
+	}
+	return nil
+}
+
+// Fetch a URL, or POST to it if there is a request body, reusing a previous
+// response if it's within the TTL and refresh isn't set
+func (c *Checker) fetch(ctx context.Context, url string, request []byte, refresh bool) ([]byte, error) {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	d := sha256.New()
+	d.Write([]byte(url))
+	d.Write([]byte{0})
+	d.Write(request)
+	key := hex.EncodeToString(d.Sum(nil))
+	if !refresh {
+		if body := c.lookup(key, ttl); body != nil {
+			return body, nil
+		}
+	}
+	method := http.MethodGet
+	if request != nil {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	if request != nil {
+		req.Header.Set("Content-Type", "application/ocsp-request")
+	}
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, body)
+	return body, nil
+}
+
+func (c *Checker) lookup(key string, ttl time.Duration) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.memory[key]; ok && time.Since(entry.fetched) < ttl {
+		return entry.body
+	}
+	if c.CacheDir == "" {
+		return nil
+	}
+	fp := filepath.Join(c.CacheDir, key)
+	st, err := os.Stat(fp)
+	if err != nil || time.Since(st.ModTime()) >= ttl {
+		return nil
+	}
+	body, err := os.ReadFile(fp)
+	if err != nil {
+		return nil
+	}
+	return body
+}
+
+func (c *Checker) store(key string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.memory == nil {
+		c.memory = make(map[string]cached)
+	}
+	c.memory[key] = cached{body: body, fetched: time.Now()}
+	if c.CacheDir == "" {
+		return
+	}
+	// the cache is only an optimization, so failing to write it is fine
+	if err := os.MkdirAll(c.CacheDir, 0700); err == nil {
+		_ = os.WriteFile(filepath.Join(c.CacheDir, key), body, 0600)
+	}
+}
@@ -0,0 +1,198 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package revocation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspURL, crlURL string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ocspURL != "" {
+		template.OCSPServer = []string{ocspURL}
+	}
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// serve an OCSP responder and a CRL that both revoke serial 2 as of revokedAt
+func (ca *testCA) serve(t *testing.T, revokedAt time.Time, hits *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ocsp", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		blob, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(blob)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tmpl := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if req.SerialNumber.Int64() == 2 {
+			tmpl.Status = ocsp.Revoked
+			tmpl.RevokedAt = revokedAt
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, tmpl, ca.key)
+		require.NoError(t, err)
+		_, _ = w.Write(resp)
+	})
+	mux.HandleFunc("/crl", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now().Add(-time.Minute),
+			NextUpdate: time.Now().Add(time.Hour),
+			RevokedCertificateEntries: []x509.RevocationListEntry{
+				{SerialNumber: big.NewInt(2), RevocationTime: revokedAt},
+			},
+		}, ca.cert, ca.key)
+		require.NoError(t, err)
+		_, _ = w.Write(crl)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheck(t *testing.T) {
+	ca := newCA(t)
+	revokedAt := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	var hits int32
+	srv := ca.serve(t, revokedAt, &hits)
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name      string
+		ocsp, crl string
+	}{
+		{"OCSP", srv.URL + "/ocsp", ""},
+		{"CRL", "", srv.URL + "/crl"},
+		{"CRLFallback", srv.URL + "/broken", srv.URL + "/crl"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Checker{CacheDir: t.TempDir()}
+			good := ca.issue(t, 3, tc.ocsp, tc.crl)
+			assert.NoError(t, c.Check(ctx, good, ca.cert, time.Time{}))
+
+			revoked := ca.issue(t, 2, tc.ocsp, tc.crl)
+			err := c.Check(ctx, revoked, ca.cert, time.Time{})
+			var rerr RevokedError
+			require.True(t, errors.As(err, &rerr), "expected RevokedError, got %v", err)
+			assert.True(t, rerr.RevokedAt.Equal(revokedAt))
+			// signatures made before the revocation are still good
+			assert.NoError(t, c.Check(ctx, revoked, ca.cert, revokedAt.Add(-time.Minute)))
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	ca := newCA(t)
+	var hits int32
+	srv := ca.serve(t, time.Now(), &hits)
+	ctx := context.Background()
+	dir := t.TempDir()
+	cert := ca.issue(t, 3, srv.URL+"/ocsp", "")
+	c := &Checker{CacheDir: dir}
+	require.NoError(t, c.Check(ctx, cert, ca.cert, time.Time{}))
+	require.NoError(t, c.Check(ctx, cert, ca.cert, time.Time{}))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&hits))
+	// a new checker reuses the response on disk
+	c = &Checker{CacheDir: dir}
+	require.NoError(t, c.Check(ctx, cert, ca.cert, time.Time{}))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&hits))
+	// unless it has outlived the TTL
+	c = &Checker{CacheDir: dir, TTL: time.Nanosecond}
+	require.NoError(t, c.Check(ctx, cert, ca.cert, time.Time{}))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&hits))
+}
+
+func TestUnavailable(t *testing.T) {
+	ca := newCA(t)
+	var hits int32
+	srv := ca.serve(t, time.Now(), &hits)
+	c := &Checker{}
+	ctx := context.Background()
+	var uerr UnavailableError
+	err := c.Check(ctx, ca.issue(t, 3, srv.URL+"/broken", ""), ca.cert, time.Time{})
+	assert.True(t, errors.As(err, &uerr), "expected UnavailableError, got %v", err)
+	err = c.Check(ctx, ca.issue(t, 3, "", ""), ca.cert, time.Time{})
+	assert.True(t, errors.As(err, &uerr), "expected UnavailableError, got %v", err)
+	// a CRL signed by someone else is not trusted
+	other := newCA(t)
+	err = c.Check(ctx, ca.issue(t, 2, "", srv.URL+"/crl"), other.cert, time.Time{})
+	assert.True(t, errors.As(err, &uerr), "expected UnavailableError, got %v", err)
+}
@@ -32,6 +32,9 @@ import (
 
 const blockMapSize = 64 * 1024
 
+// Hashes lists the digest algorithms that can be used in an appx block map
+var Hashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
 var hashAlgs = map[crypto.Hash]string{
 	crypto.SHA256: "http://www.w3.org/2001/04/xmlenc#sha256",
 	crypto.SHA384: "http://www.w3.org/2001/04/xmldsig-more#sha384",
@@ -21,11 +21,13 @@ import (
 	"context"
 	"crypto/x509"
 	"errors"
+	"fmt"
 
 	"github.com/sassoftware/relic/v8/lib/authenticode"
 	"github.com/sassoftware/relic/v8/lib/binpatch"
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 )
 
 var (
@@ -75,7 +77,34 @@ func (i *AppxDigest) addZipEntry(name string, contents []byte) error {
 	return i.blockMap.AddFile(f, i.axpc, nil)
 }
 
+// PublisherMismatchError is returned when signing a package whose manifest
+// names a different publisher than the signing certificate
+type PublisherMismatchError struct {
+	Manifest, Certificate string
+}
+
+func (e PublisherMismatchError) Error() string {
+	return fmt.Sprintf("manifest publisher does not match the signing certificate subject:\nmanifest:    %s\ncertificate: %s", e.Manifest, e.Certificate)
+}
+
+func (i *AppxDigest) checkPublisher(publisher string, leaf *x509.Certificate) error {
+	subj := x509tools.FormatPkixName(leaf.RawSubject, x509tools.NameStyleMsOsco)
+	if publisher != subj {
+		return PublisherMismatchError{Manifest: publisher, Certificate: subj}
+	}
+	return nil
+}
+
 func (i *AppxDigest) writeManifest(leaf *x509.Certificate) error {
+	if i.manifest != nil && !i.RewritePublisher {
+		if err := i.checkPublisher(i.manifest.Identity.Publisher, leaf); err != nil {
+			return err
+		}
+	} else if i.bundle != nil && !i.RewritePublisher {
+		if err := i.checkPublisher(i.bundle.Identity.Publisher, leaf); err != nil {
+			return err
+		}
+	}
 	if i.manifest != nil {
 		i.manifest.SetPublisher(leaf)
 		manifest, err := i.manifest.Marshal()
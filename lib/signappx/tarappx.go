@@ -32,7 +32,11 @@ import (
 )
 
 type AppxDigest struct {
-	Hash             crypto.Hash
+	Hash crypto.Hash
+	// Replace the manifest's publisher with the signing certificate's subject
+	// instead of requiring them to match
+	RewritePublisher bool
+
 	blockMap         blockMap
 	manifest         *appxPackage
 	bundle           *bundleManifest
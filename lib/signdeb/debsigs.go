@@ -0,0 +1,213 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signdeb
+
+// debsigs-style signatures, as checked by debsig-verify. The _gpg<role>
+// member holds a detached PGP signature over the contents of debian-binary,
+// control.tar* and data.tar* concatenated in archive order.
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/blakesmith/ar"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/lib/readercounter"
+)
+
+const debianBinary = "debian-binary"
+
+// Return the position of a member in the order dpkg requires, or -1 if it is
+// not covered by a debsigs signature
+func debsigsOrder(name string) int {
+	switch {
+	case name == debianBinary:
+		return 0
+	case strings.HasPrefix(name, "control.tar"):
+		return 1
+	case strings.HasPrefix(name, "data.tar"):
+		return 2
+	}
+	return -1
+}
+
+// SignDebsigs signs a .deb the way debsigs does, with a detached signature
+// over the package members stored in a _gpg<role> member at the end of the
+// archive. Any existing signature for the same role is replaced.
+func SignDebsigs(r io.Reader, signer *openpgp.Entity, opts crypto.SignerOpts, role string) (*DebSignature, error) {
+	counter := readercounter.New(r)
+	now := time.Now().UTC()
+	reader := ar.NewReader(counter)
+	filename := "_gpg" + role
+	// feed the members to the signer as they are read
+	sigr, sigw := io.Pipe()
+	signed := new(bytes.Buffer)
+	sigerr := make(chan error, 1)
+	go func() {
+		config := &packet.Config{
+			DefaultHash: opts.HashFunc(),
+			Time:        func() time.Time { return now },
+		}
+		err := openpgp.DetachSign(signed, signer, sigr, config)
+		_, _ = io.Copy(io.Discard, sigr)
+		sigerr <- err
+	}()
+	fail := func(err error) (*DebSignature, error) {
+		_ = sigw.CloseWithError(err)
+		<-sigerr
+		return nil, err
+	}
+	var patchOffset, patchLength int64
+	var info *PackageInfo
+	next := 0
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+		name := path.Clean(hdr.Name)
+		if name == filename {
+			// mark the old signature for removal
+			patchOffset = counter.N - 60
+			patchLength = int64(60 + ((hdr.Size+1)/2)*2)
+			continue
+		}
+		order := debsigsOrder(name)
+		if order < 0 {
+			continue
+		} else if order != next {
+			return fail(fmt.Errorf("deb member %s is out of order; dpkg expects debian-binary, control.tar, data.tar", name))
+		}
+		next++
+		dest := io.Writer(sigw)
+		var infoch chan *PackageInfo
+		var errch chan error
+		var cr *io.PipeReader
+		var cw *io.PipeWriter
+		if order == 1 {
+			// parse the control tarball as it's signed
+			cr, cw = io.Pipe()
+			dest = io.MultiWriter(sigw, cw)
+			infoch = make(chan *PackageInfo, 1)
+			errch = make(chan error, 1)
+			go func() {
+				info, err := parseControl(cr, name[11:])
+				_, _ = io.Copy(io.Discard, cr)
+				infoch <- info
+				errch <- err
+			}()
+		}
+		_, err = io.Copy(dest, reader)
+		if cw != nil {
+			cw.Close()
+			info = <-infoch
+			if err2 := <-errch; err == nil {
+				err = err2
+			}
+		}
+		if err != nil {
+			return fail(err)
+		}
+	}
+	if next != 3 {
+		return fail(errors.New("deb must contain debian-binary, control.tar and data.tar"))
+	}
+	sigw.Close()
+	if err := <-sigerr; err != nil {
+		return nil, err
+	}
+	pbuf := new(bytes.Buffer)
+	writer := ar.NewWriter(pbuf)
+	hdr := &ar.Header{
+		Name:    filename,
+		Size:    int64(signed.Len()),
+		ModTime: now,
+		Mode:    0100644,
+	}
+	if err := writer.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(signed.Bytes()); err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	if patchOffset != 0 {
+		patch.Add(patchOffset, patchLength, nil)
+	}
+	// debsigs signatures always go last, after data.tar
+	patch.Add(counter.N, 0, pbuf.Bytes())
+	return &DebSignature{*info, now, patch}, nil
+}
+
+// isDebsigs returns true if a _gpg member holds a detached signature instead of
+// a dpkg-sig cleartext signature
+func isDebsigs(sig []byte) bool {
+	return !bytes.HasPrefix(sig, []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+}
+
+// verifyDebsigs checks a detached signature against the package members. The
+// archive is read again because the signature comes after the members.
+func verifyDebsigs(r io.ReadSeeker, sig []byte, keyring openpgp.EntityList) (*pgptools.PgpSignature, error) {
+	sigr := io.Reader(bytes.NewReader(sig))
+	if bytes.HasPrefix(sig, []byte("-----BEGIN PGP")) {
+		block, err := armor.Decode(sigr)
+		if err != nil {
+			return nil, err
+		}
+		sigr = block.Body
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		reader := ar.NewReader(r)
+		for {
+			hdr, err := reader.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+			if debsigsOrder(path.Clean(hdr.Name)) < 0 {
+				continue
+			}
+			if _, err := io.Copy(pw, reader); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	info, err := pgptools.VerifyDetached(sigr, pr, keyring)
+	_ = pr.Close()
+	return info, err
+}
@@ -34,7 +34,8 @@ import (
 
 // Extract and verify signatures from a Debian package. A keyring of known PGP
 // certificates must be provided to validate the signatures; if the needed key
-// is missing then an ErrNoKey value is returned.
+// is missing then an ErrNoKey value is returned. Both dpkg-sig and debsigs
+// signatures are understood; the latter need r to be seekable.
 func Verify(r io.Reader, keyring openpgp.EntityList, skipDigest bool) (map[string]*pgptools.PgpSignature, error) {
 	reader := ar.NewReader(r)
 	digests := make(map[string]string)
@@ -63,6 +64,18 @@ func Verify(r io.Reader, keyring openpgp.EntityList, skipDigest bool) (map[strin
 	}
 	ret := make(map[string]*pgptools.PgpSignature, len(sigs))
 	for role, sig := range sigs {
+		if isDebsigs(sig) {
+			seeker, ok := r.(io.ReadSeeker)
+			if !ok {
+				return nil, errors.New("verifying a debsigs signature requires a seekable file")
+			}
+			info, err := verifyDebsigs(seeker, sig, keyring)
+			if err != nil {
+				return nil, fmt.Errorf("_gpg%s: %w", role, err)
+			}
+			ret[role] = info
+			continue
+		}
 		var body bytes.Buffer
 		info, err := pgptools.VerifyClearSign(bytes.NewReader(sig), &body, keyring)
 		if err != nil {
@@ -0,0 +1,162 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Create and verify Helm chart provenance files. A provenance file is a
+// cleartext PGP signature over the chart's metadata and the SHA-256 digest of
+// the packaged chart.
+//
+// https://helm.sh/docs/topics/provenance/
+package signhelm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+)
+
+// YAML uses "---" to start a document, which isn't allowed in a cleartext
+// signature, so Helm separates the two parts with the document end marker
+const blockSeparator = "\n...\n"
+
+type sumCollection struct {
+	Files map[string]string `yaml:"files"`
+}
+
+// MessageBlock reads a packaged chart and returns the provenance message for
+// it. name is the base file name of the chart archive.
+func MessageBlock(r io.Reader, name string) ([]byte, error) {
+	d := sha256.New()
+	metadata, err := readChartYaml(io.TeeReader(r, d))
+	if err != nil {
+		return nil, err
+	}
+	// digest the remainder of the archive
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	// Helm emits the metadata with sorted keys, so round-trip it through a map
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(metadata, &fields); err != nil {
+		return nil, fmt.Errorf("parsing Chart.yaml: %w", err)
+	} else if fields["name"] == nil || fields["version"] == nil {
+		return nil, errors.New("Chart.yaml must have a name and version")
+	}
+	block, err := marshalYaml(fields)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := marshalYaml(sumCollection{Files: map[string]string{
+		path.Base(name): "sha256:" + hex.EncodeToString(d.Sum(nil)),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	block = append(block, blockSeparator...)
+	return append(block, sums...), nil
+}
+
+func marshalYaml(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign a packaged chart and return the contents of its provenance file
+func Sign(r io.Reader, name string, signer *openpgp.Entity, config *packet.Config) ([]byte, error) {
+	message, err := MessageBlock(r, name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := pgptools.ClearSign(&buf, signer, bytes.NewReader(message), config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify a provenance file against the packaged chart it describes. A keyring
+// of known PGP certificates must be provided to validate the signature; if the
+// needed key is missing then an ErrNoKey value is returned.
+func Verify(chart io.Reader, name string, prov io.Reader, keyring openpgp.EntityList) (*pgptools.PgpSignature, error) {
+	var message bytes.Buffer
+	sig, err := pgptools.VerifyClearSign(prov, &message, keyring)
+	if err != nil {
+		return sig, err
+	}
+	// the signed text is canonicalized to CRLF line endings
+	text := strings.ReplaceAll(message.String(), "\r\n", "\n")
+	i := strings.Index(text, blockSeparator)
+	if i < 0 {
+		return nil, errors.New("malformed provenance file: missing checksums")
+	}
+	var sums sumCollection
+	if err := yaml.Unmarshal([]byte(text[i+len(blockSeparator):]), &sums); err != nil {
+		return nil, fmt.Errorf("malformed provenance file: %w", err)
+	}
+	expected := sums.Files[path.Base(name)]
+	if expected == "" {
+		return nil, fmt.Errorf("provenance file has no checksum for %s", path.Base(name))
+	}
+	d := sha256.New()
+	if _, err := io.Copy(d, chart); err != nil {
+		return nil, err
+	}
+	if calculated := "sha256:" + hex.EncodeToString(d.Sum(nil)); calculated != expected {
+		return nil, fmt.Errorf("chart digest mismatch: %s != %s", calculated, expected)
+	}
+	return sig, nil
+}
+
+// find the top-level Chart.yaml in a packaged chart, e.g. mychart/Chart.yaml
+func readChartYaml(r io.Reader) ([]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading chart: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("chart archive has no Chart.yaml")
+		} else if err != nil {
+			return nil, fmt.Errorf("reading chart: %w", err)
+		}
+		parts := strings.Split(strings.TrimPrefix(hdr.Name, "./"), "/")
+		if len(parts) == 2 && parts[1] == "Chart.yaml" && hdr.Typeflag == tar.TypeReg {
+			return io.ReadAll(tr)
+		}
+	}
+}
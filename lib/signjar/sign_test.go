@@ -0,0 +1,122 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signjar
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/zipslicer"
+)
+
+func makeMultiReleaseJar(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := []struct{ name, contents string }{
+		{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\r\nMulti-Release: true\r\n\r\n"},
+		{"com/example/Foo.class", "base class"},
+		{"META-INF/versions/9/com/example/Foo.class", "java 9 class"},
+		{"META-INF/versions/11/module-info.class", "java 11 module"},
+	}
+	for _, file := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func makeSigningCert(t *testing.T) *certloader.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jar signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certloader.Certificate{
+		Leaf:         cert,
+		Certificates: []*x509.Certificate{cert},
+		PrivateKey:   key,
+	}
+}
+
+func TestSignMultiRelease(t *testing.T) {
+	orig := makeMultiReleaseJar(t)
+	fp := filepath.Join(t.TempDir(), "mr.jar")
+	require.NoError(t, os.WriteFile(fp, orig, 0644))
+	f, err := os.Open(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	var tarball bytes.Buffer
+	require.NoError(t, zipslicer.ZipToTar(f, &tarball))
+	digest, err := DigestJarStream(&tarball, crypto.SHA256)
+	require.NoError(t, err)
+	patch, _, err := digest.Sign(context.Background(), makeSigningCert(t), "RELIC", false, false, false)
+	require.NoError(t, err)
+	signed, err := patch.ApplyBytes(orig)
+	require.NoError(t, err)
+
+	// every per-version class is in the manifest
+	manifest, err := ParseManifest(digest.Manifest)
+	require.NoError(t, err)
+	assert.Equal(t, "true", manifest.Main.Get("Multi-Release"))
+	for _, name := range []string{
+		"com/example/Foo.class",
+		"META-INF/versions/9/com/example/Foo.class",
+		"META-INF/versions/11/module-info.class",
+	} {
+		if assert.Contains(t, manifest.Files, name) {
+			assert.NotEmpty(t, manifest.Files[name].Get("SHA-256-Digest"), name)
+		}
+	}
+	inz, err := zip.NewReader(bytes.NewReader(signed), int64(len(signed)))
+	require.NoError(t, err)
+	sigs, err := Verify(inz, false)
+	require.NoError(t, err)
+	assert.Len(t, sigs, 1)
+
+	// tampering with a versioned class breaks verification
+	tampered := bytes.Replace(signed, []byte("java 9 class"), []byte("java 9 CLASS"), 1)
+	inz, err = zip.NewReader(bytes.NewReader(tampered), int64(len(tampered)))
+	require.NoError(t, err)
+	_, err = Verify(inz, false)
+	assert.ErrorContains(t, err, "META-INF/versions/9/com/example/Foo.class")
+}
@@ -148,6 +148,16 @@ func verifyManifest(inz *zip.Reader, manifest []byte) error {
 			return err
 		}
 	}
+	// everything that would be signed must be in the manifest, including
+	// per-version classes under META-INF/versions/ in multi-release JARs
+	for _, fh := range inz.File {
+		if strings.HasSuffix(fh.Name, "/") || !keepFile(fh.Name) {
+			continue
+		}
+		if parsed.Files[fh.Name] == nil {
+			return fmt.Errorf("file %s is in JAR but not covered by the manifest", fh.Name)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,299 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package signjws makes and checks JSON Web Signatures (RFC 7515) in the
+// compact serialization, such as signed JWTs.
+package signjws
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+// Hashes lists the digest algorithms that have a JWS algorithm for RSA keys.
+// ECDSA keys always use the digest fixed by their curve.
+var Hashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+var b64 = base64.RawURLEncoding
+
+var algorithms = map[string]bool{
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+	"EdDSA": true,
+}
+
+// Algorithm picks the JWS "alg" for a key and digest, and returns the signer
+// options to sign with. RSA keys that sign with PSS padding use PS256 and
+// friends.
+func Algorithm(signer crypto.Signer, hash crypto.Hash) (string, crypto.SignerOpts, error) {
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		prefix := "RS"
+		var opts crypto.SignerOpts = hash
+		if pss, ok := signer.(x509tools.PSSSigner); ok {
+			prefix = "PS"
+			opts = pss.SignerOpts(hash)
+		}
+		switch hash {
+		case crypto.SHA256:
+			return prefix + "256", opts, nil
+		case crypto.SHA384:
+			return prefix + "384", opts, nil
+		case crypto.SHA512:
+			return prefix + "512", opts, nil
+		}
+		return "", nil, fmt.Errorf("digest %s is not supported for JWS RSA signatures", hash)
+	case *ecdsa.PublicKey:
+		alg, hash, err := ecdsaAlgorithm(pub)
+		return alg, hash, err
+	case ed25519.PublicKey:
+		return "EdDSA", crypto.Hash(0), nil
+	}
+	return "", nil, x509tools.UnsupportedKeyError{Key: signer.Public()}
+}
+
+func ecdsaAlgorithm(pub *ecdsa.PublicKey) (string, crypto.Hash, error) {
+	switch pub.Curve {
+	case elliptic.P256():
+		return "ES256", crypto.SHA256, nil
+	case elliptic.P384():
+		return "ES384", crypto.SHA384, nil
+	case elliptic.P521():
+		return "ES512", crypto.SHA512, nil
+	}
+	return "", 0, fmt.Errorf("ECDSA curve %s is not supported for JWS", pub.Curve.Params().Name)
+}
+
+// Sign payload and return the compact serialization. The protected header
+// includes header, with "alg" set to suit the key. If detached is true then
+// the payload is left out of the result and must be supplied separately to
+// verify it.
+func Sign(signer crypto.Signer, hash crypto.Hash, header map[string]interface{}, payload []byte, detached bool) (string, error) {
+	alg, opts, err := Algorithm(signer, hash)
+	if err != nil {
+		return "", err
+	}
+	protected := make(map[string]interface{}, len(header)+1)
+	for k, v := range header {
+		protected[k] = v
+	}
+	protected["alg"] = alg
+	headerJSON, err := json.Marshal(protected)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(headerJSON) + "." + b64.EncodeToString(payload)
+	sig, err := signInput(signer, opts, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	if detached {
+		head, _, _ := strings.Cut(signingInput, ".")
+		signingInput = head + "."
+	}
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+func signInput(signer crypto.Signer, opts crypto.SignerOpts, input []byte) ([]byte, error) {
+	hash := opts.HashFunc()
+	digest := input
+	if hash != 0 {
+		d := hash.New()
+		d.Write(input)
+		digest = d.Sum(nil)
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if pub, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		// JWS wants fixed-size R and S concatenated, not ASN.1
+		esig, err := x509tools.UnmarshalEcdsaSignature(sig)
+		if err != nil {
+			return nil, err
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		esig.R.FillBytes(sig[:size])
+		esig.S.FillBytes(sig[size:])
+	}
+	return sig, nil
+}
+
+// Signature is a parsed compact JWS
+type Signature struct {
+	Header    map[string]interface{}
+	Algorithm string
+	// Payload is nil if the signature is detached
+	Payload   []byte
+	Signature []byte
+
+	rawHeader string
+}
+
+// Parse a JWS in compact serialization
+func Parse(compact []byte) (*Signature, error) {
+	parts := strings.Split(string(bytes.TrimSpace(compact)), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid JWS: expected 3 parts")
+	}
+	headerJSON, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %w", err)
+	}
+	s := &Signature{rawHeader: parts[0]}
+	if err := json.Unmarshal(headerJSON, &s.Header); err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %w", err)
+	}
+	s.Algorithm, _ = s.Header["alg"].(string)
+	if s.Algorithm == "" {
+		return nil, errors.New("invalid JWS header: alg is missing")
+	} else if !algorithms[s.Algorithm] {
+		return nil, fmt.Errorf("unsupported JWS algorithm %q", s.Algorithm)
+	}
+	if crit, ok := s.Header["crit"]; ok {
+		return nil, fmt.Errorf("unsupported critical JWS header parameters %v", crit)
+	}
+	if parts[1] != "" {
+		s.Payload, err = b64.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWS payload: %w", err)
+		}
+	}
+	s.Signature, err = b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS signature: %w", err)
+	}
+	return s, nil
+}
+
+// KeyID returns the "kid" header, if any
+func (s *Signature) KeyID() string {
+	kid, _ := s.Header["kid"].(string)
+	return kid
+}
+
+// Certificates returns the chain from the "x5c" header, if any, leaf first
+func (s *Signature) Certificates() ([]*x509.Certificate, error) {
+	raw, ok := s.Header["x5c"]
+	if !ok {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, errors.New("invalid JWS x5c header")
+	}
+	certs := make([]*x509.Certificate, len(list))
+	for i, item := range list {
+		str, _ := item.(string)
+		der, err := base64.StdEncoding.DecodeString(str)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWS x5c header: %w", err)
+		}
+		certs[i], err = x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWS x5c header: %w", err)
+		}
+	}
+	return certs, nil
+}
+
+// Hash returns the digest algorithm named by the "alg" header
+func (s *Signature) Hash() crypto.Hash {
+	switch s.Algorithm[len(s.Algorithm)-3:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return 0
+}
+
+// Verify the signature with a public key. For a detached signature the
+// payload must be given, otherwise it must be nil or match the embedded one.
+func (s *Signature) Verify(pub crypto.PublicKey, payload []byte) error {
+	if payload == nil {
+		if s.Payload == nil {
+			return errors.New("JWS payload is detached")
+		}
+		payload = s.Payload
+	} else if s.Payload != nil && !bytes.Equal(payload, s.Payload) {
+		return errors.New("JWS payload does not match")
+	}
+	input := []byte(s.rawHeader + "." + b64.EncodeToString(payload))
+	hash := s.Hash()
+	var digest []byte
+	if hash != 0 {
+		d := hash.New()
+		d.Write(input)
+		digest = d.Sum(nil)
+	}
+	var ok bool
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch s.Algorithm[:2] {
+		case "RS":
+			ok = rsa.VerifyPKCS1v15(key, hash, digest, s.Signature) == nil
+		case "PS":
+			ok = rsa.VerifyPSS(key, hash, digest, s.Signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		default:
+			return s.wrongKey(key)
+		}
+	case *ecdsa.PublicKey:
+		if alg, _, err := ecdsaAlgorithm(key); err != nil || alg != s.Algorithm {
+			return s.wrongKey(key)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(s.Signature) != 2*size {
+			return errors.New("JWS ECDSA signature is the wrong size")
+		}
+		r := new(big.Int).SetBytes(s.Signature[:size])
+		ss := new(big.Int).SetBytes(s.Signature[size:])
+		ok = ecdsa.Verify(key, digest, r, ss)
+	case ed25519.PublicKey:
+		if s.Algorithm != "EdDSA" {
+			return s.wrongKey(key)
+		}
+		ok = ed25519.Verify(key, input, s.Signature)
+	default:
+		return x509tools.UnsupportedKeyError{Key: pub}
+	}
+	if !ok {
+		return errors.New("JWS signature is invalid")
+	}
+	return nil
+}
+
+func (s *Signature) wrongKey(pub crypto.PublicKey) error {
+	return fmt.Errorf("JWS algorithm %s does not match a %s key", s.Algorithm, x509tools.GetPublicKeyAlgorithm(pub))
+}
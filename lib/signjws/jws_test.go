@@ -0,0 +1,142 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signjws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	payload := []byte(`{"sub":"svc","aud":"api"}`)
+	for _, tc := range []struct {
+		alg    string
+		signer crypto.Signer
+		hash   crypto.Hash
+	}{
+		{"RS256", rsaKey, crypto.SHA256},
+		{"RS512", rsaKey, crypto.SHA512},
+		{"PS256", x509tools.PSSSigner{Signer: rsaKey}, crypto.SHA256},
+		{"PS384", x509tools.PSSSigner{Signer: rsaKey}, crypto.SHA384},
+		{"ES256", p256, crypto.SHA256},
+		// the curve decides the digest
+		{"ES384", p384, crypto.SHA256},
+		{"ES512", p521, crypto.SHA256},
+		{"EdDSA", edKey, crypto.SHA256},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			compact, err := Sign(tc.signer, tc.hash, map[string]interface{}{"typ": "JWT", "kid": "01:02"}, payload, false)
+			require.NoError(t, err)
+			sig, err := Parse([]byte(compact + "\n"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.alg, sig.Algorithm)
+			assert.Equal(t, "01:02", sig.KeyID())
+			assert.Equal(t, "JWT", sig.Header["typ"])
+			assert.Equal(t, payload, sig.Payload)
+			require.NoError(t, sig.Verify(tc.signer.Public(), nil))
+			require.NoError(t, sig.Verify(tc.signer.Public(), payload))
+			assert.Error(t, sig.Verify(tc.signer.Public(), []byte(`{}`)))
+			// interoperates with go-jose
+			jsig, err := jose.ParseSigned(compact)
+			require.NoError(t, err)
+			verified, err := jsig.Verify(tc.signer.Public())
+			require.NoError(t, err)
+			assert.Equal(t, payload, verified)
+
+			detached, err := Sign(tc.signer, tc.hash, nil, payload, true)
+			require.NoError(t, err)
+			parts := strings.Split(detached, ".")
+			require.Len(t, parts, 3)
+			assert.Empty(t, parts[1])
+			sig, err = Parse([]byte(detached))
+			require.NoError(t, err)
+			assert.Nil(t, sig.Payload)
+			assert.Error(t, sig.Verify(tc.signer.Public(), nil))
+			require.NoError(t, sig.Verify(tc.signer.Public(), payload))
+			assert.Error(t, sig.Verify(tc.signer.Public(), []byte(`{"sub":"root"}`)))
+			jsig, err = jose.ParseDetached(detached, payload)
+			require.NoError(t, err)
+			_, err = jsig.Verify(tc.signer.Public())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	compact, err := Sign(p256, crypto.SHA256, nil, []byte("{}"), false)
+	require.NoError(t, err)
+	sig, err := Parse([]byte(compact))
+	require.NoError(t, err)
+	assert.ErrorContains(t, sig.Verify(p384.Public(), nil), "does not match")
+	assert.ErrorContains(t, sig.Verify(rsaKey.Public(), nil), "does not match")
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	assert.ErrorContains(t, sig.Verify(other.Public(), nil), "invalid")
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, compact := range []string{
+		"",
+		"a.b",
+		"!!.e30.",
+		// {"alg":"none"}
+		"eyJhbGciOiJub25lIn0.e30.",
+		// {"typ":"JWT"}
+		"eyJ0eXAiOiJKV1QifQ.e30.",
+		// {"alg":"ES256","crit":["exp"]}
+		"eyJhbGciOiJFUzI1NiIsImNyaXQiOlsiZXhwIl19.e30.",
+	} {
+		_, err := Parse([]byte(compact))
+		assert.Error(t, err, compact)
+	}
+	_, _, err := Algorithm(mustRSA(t), crypto.SHA1)
+	assert.Error(t, err)
+}
+
+func mustRSA(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
@@ -0,0 +1,80 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signkmod
+
+import (
+	"crypto"
+	"io"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+)
+
+type ModuleDigest struct {
+	Hash crypto.Hash
+	Sum  []byte
+	// Size of the module without any existing signature
+	ModuleSize int64
+	// Size of the existing signature trailer, if any
+	OldSigSize int64
+}
+
+// Digest a kernel module, ignoring any signature already appended to it
+func Digest(r io.Reader, hash crypto.Hash) (*ModuleDigest, error) {
+	blob, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	module, _, err := Split(blob)
+	if err != nil {
+		return nil, err
+	}
+	d := hash.New()
+	d.Write(module)
+	return &ModuleDigest{
+		Hash:       hash,
+		Sum:        d.Sum(nil),
+		ModuleSize: int64(len(module)),
+		OldSigSize: int64(len(blob) - len(module)),
+	}, nil
+}
+
+// Sign the module digest and return a patch that replaces any existing
+// signature with the new one.
+//
+// The signature is made the same way as the kernel's scripts/sign-file: a
+// detached signature over the raw module with no authenticated attributes and
+// no certificates, identifying the signer by issuer and serial number.
+func (md *ModuleDigest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error) {
+	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), md.Hash)
+	if err := sig.SetDetachedContent(pkcs7.OidData, md.Sum); err != nil {
+		return nil, err
+	}
+	psd, err := sig.Sign()
+	if err != nil {
+		return nil, err
+	}
+	psd.Content.Certificates = nil
+	blob, err := psd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(md.ModuleSize, md.OldSigSize, makeTrailer(blob))
+	return patch, nil
+}
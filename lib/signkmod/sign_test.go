@@ -0,0 +1,107 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signkmod
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+func makeSigningCert(t *testing.T) *certloader.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "module signing key"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certloader.Certificate{
+		Leaf:         cert,
+		Certificates: []*x509.Certificate{cert},
+		PrivateKey:   key,
+	}
+}
+
+func signModule(t *testing.T, module []byte, cert *certloader.Certificate) []byte {
+	digest, err := Digest(bytes.NewReader(module), crypto.SHA256)
+	require.NoError(t, err)
+	patch, err := digest.Sign(cert)
+	require.NoError(t, err)
+	signed, err := patch.ApplyBytes(module)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestSignModule(t *testing.T) {
+	cert := makeSigningCert(t)
+	orig := []byte("\x7fELF not really a kernel module")
+	signed := signModule(t, orig, cert)
+	require.True(t, bytes.HasSuffix(signed, []byte(Magic)))
+	module, sig, err := Split(signed)
+	require.NoError(t, err)
+	assert.Equal(t, orig, module)
+	// the module_signature struct is all zeroes except for the type and length
+	trailer := signed[len(orig)+len(sig) : len(signed)-len(Magic)]
+	assert.Equal(t, []byte{0, 0, idTypePKCS7, 0, 0, 0, 0, 0}, trailer[:8])
+	psd, err := pkcs7.Unmarshal(sig)
+	require.NoError(t, err)
+	assert.Empty(t, psd.Content.Certificates)
+	assert.Empty(t, psd.Content.SignerInfos[0].AuthenticatedAttributes)
+
+	certs := []*x509.Certificate{cert.Leaf}
+	msig, err := Verify(bytes.NewReader(signed), int64(len(signed)), certs, false)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.SHA256, msig.Hash)
+	assert.Equal(t, cert.Leaf, msig.Certificate)
+
+	// the signer can't be found without the certificate
+	_, err = Verify(bytes.NewReader(signed), int64(len(signed)), nil, false)
+	assert.True(t, errors.As(err, &pkcs7.MissingCertificateError{}))
+
+	// signing again replaces the signature
+	resigned := signModule(t, signed, cert)
+	assert.Len(t, resigned, len(signed))
+	_, err = Verify(bytes.NewReader(resigned), int64(len(resigned)), certs, false)
+	require.NoError(t, err)
+
+	tampered := bytes.Replace(signed, []byte("kernel"), []byte("Kernel"), 1)
+	_, err = Verify(bytes.NewReader(tampered), int64(len(tampered)), certs, false)
+	assert.Error(t, err)
+
+	_, err = Verify(bytes.NewReader(orig), int64(len(orig)), certs, false)
+	assert.True(t, errors.As(err, &sigerrors.NotSignedError{}))
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package signkmod signs Linux kernel modules with the PKCS#7 trailer that the
+// kernel's module loader checks. The same trailer is used by GRUB for appended
+// signatures on its core image.
+package signkmod
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic marks the end of a signed module
+const Magic = "~Module signature appended~\n"
+
+// Hashes lists the digest algorithms the kernel accepts for module signatures
+var Hashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// Identifier type for PKCS#7 from include/linux/module_signature.h
+const idTypePKCS7 = 2
+
+// moduleSignature precedes the magic and gives the size of the signature
+// blob before it. For PKCS#7 signatures every field except SigLen is zero.
+type moduleSignature struct {
+	Algo      uint8
+	Hash      uint8
+	IDType    uint8
+	SignerLen uint8
+	KeyIDLen  uint8
+	Pad       [3]byte
+	SigLen    uint32
+}
+
+const trailerSize = 12 + len(Magic)
+
+// Split a possibly-signed module into its contents and the DER PKCS#7
+// signature. If the module is not signed then sig is nil.
+func Split(blob []byte) (module, sig []byte, err error) {
+	if len(blob) < trailerSize {
+		return blob, nil, nil
+	}
+	end := int64(len(blob) - trailerSize)
+	sigLen, err := parseTrailer(blob[end:], end)
+	if err != nil || sigLen < 0 {
+		return blob, nil, err
+	}
+	return blob[:end-sigLen], blob[end-sigLen : end], nil
+}
+
+// readSignature reads the trailer from the end of a module and returns the
+// size of the unsigned module and the DER PKCS#7 signature
+func readSignature(r io.ReaderAt, size int64) (int64, []byte, error) {
+	if size < int64(trailerSize) {
+		return size, nil, nil
+	}
+	end := size - int64(trailerSize)
+	trailer := make([]byte, trailerSize)
+	if _, err := r.ReadAt(trailer, end); err != nil {
+		return 0, nil, err
+	}
+	sigLen, err := parseTrailer(trailer, end)
+	if err != nil || sigLen < 0 {
+		return size, nil, err
+	}
+	sig := make([]byte, sigLen)
+	if _, err := r.ReadAt(sig, end-sigLen); err != nil {
+		return 0, nil, err
+	}
+	return end - sigLen, sig, nil
+}
+
+// parseTrailer returns the length of the signature blob preceding the
+// trailer, or -1 if the magic is not present. avail is the number of bytes
+// before the trailer.
+func parseTrailer(trailer []byte, avail int64) (int64, error) {
+	if !bytes.HasSuffix(trailer, []byte(Magic)) {
+		return -1, nil
+	}
+	var ms moduleSignature
+	if err := binary.Read(bytes.NewReader(trailer), binary.BigEndian, &ms); err != nil {
+		return 0, err
+	}
+	if ms.IDType != idTypePKCS7 {
+		return 0, fmt.Errorf("unsupported module signature type %d", ms.IDType)
+	}
+	if int64(ms.SigLen) > avail {
+		return 0, errors.New("module signature is truncated")
+	}
+	return int64(ms.SigLen), nil
+}
+
+// Build the trailer appended to a module for the given DER PKCS#7 signature
+func makeTrailer(sig []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(sig)
+	_ = binary.Write(&buf, binary.BigEndian, moduleSignature{
+		IDType: idTypePKCS7,
+		SigLen: uint32(len(sig)),
+	})
+	buf.WriteString(Magic)
+	return buf.Bytes()
+}
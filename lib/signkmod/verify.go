@@ -0,0 +1,92 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signkmod
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+type ModuleSignature struct {
+	pkcs7.Signature
+	Hash crypto.Hash
+}
+
+// Verify the signature appended to a kernel module. Module signatures do not
+// carry certificates, so the signer is looked up in certs by issuer and serial
+// number.
+func Verify(r io.ReaderAt, size int64, certs []*x509.Certificate, skipDigests bool) (*ModuleSignature, error) {
+	moduleSize, blob, err := readSignature(r, size)
+	if err != nil {
+		return nil, err
+	} else if blob == nil {
+		return nil, sigerrors.NotSignedError{Type: "kernel module"}
+	}
+	psd, err := pkcs7.Unmarshal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module signature: %w", err)
+	}
+	if !psd.Content.ContentInfo.ContentType.Equal(pkcs7.OidData) {
+		return nil, errors.New("invalid module signature: unexpected content type")
+	} else if len(psd.Content.SignerInfos) != 1 {
+		return nil, errors.New("invalid module signature: expected exactly one signer")
+	}
+	si := &psd.Content.SignerInfos[0]
+	if len(si.AuthenticatedAttributes) != 0 {
+		// the kernel rejects these
+		return nil, errors.New("invalid module signature: authenticated attributes are not allowed")
+	}
+	hash, err := x509tools.PkixDigestToHashE(si.DigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	embedded, err := psd.Content.Certificates.Parse()
+	if err != nil {
+		return nil, err
+	}
+	certs = append(embedded, certs...)
+	if _, err := si.FindCertificate(certs); err != nil {
+		return nil, err
+	}
+	var digest []byte
+	if !skipDigests {
+		d := hash.New()
+		if _, err := io.Copy(d, io.NewSectionReader(r, 0, moduleSize)); err != nil {
+			return nil, err
+		}
+		digest = d.Sum(nil)
+	}
+	cert, err := si.VerifyDigest(digest, certs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module signature: %w", err)
+	}
+	return &ModuleSignature{
+		Signature: pkcs7.Signature{
+			SignerInfo:    si,
+			Certificate:   cert,
+			Intermediates: embedded,
+		},
+		Hash: hash,
+	}, nil
+}
@@ -0,0 +1,390 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+// The package content hash covers the zip exactly as it would be without the
+// signature entry: every byte before the central directory except the
+// signature's local entry, then the remaining central directory records and
+// the end records, with offsets and counts adjusted as if the signature had
+// never been added. Because the signature is always appended after the last
+// entry, this is the same as the hash of the unsigned package.
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/zipslicer"
+)
+
+const (
+	fileHeaderSignature      = 0x04034b50
+	directoryHeaderSignature = 0x02014b50
+	directoryEndSignature    = 0x06054b50
+	directory64EndSignature  = 0x06064b50
+	dataDescriptorSignature  = 0x08074b50
+	fileHeaderLen            = 30
+	directoryHeaderLen       = 46
+	directoryEndLen          = 22
+	directory64LocLen        = 20
+	zip64ExtraID             = 0x0001
+
+	uint32Max = 0xffffffff
+	uint16Max = 0xffff
+)
+
+type PackageDigest struct {
+	Hash crypto.Hash
+	// Sum is the package content hash
+	Sum []byte
+	// Signature holds the contents of the existing signature entry, if any
+	Signature []byte
+
+	size      int64
+	dirLoc    int64
+	sigOffset int64
+	sigSize   int64
+	records   []byte
+	end       []byte
+}
+
+// DigestPackageTar calculates the content hash of a package that was
+// transformed into a tarzip
+func DigestPackageTar(r io.Reader, hash crypto.Hash) (*PackageDigest, error) {
+	tr := tar.NewReader(r)
+	var cd []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("invalid tarzip")
+		} else if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+		if hdr.Name == zipslicer.TarMemberCD {
+			cd, err = io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading tar: %w", err)
+			}
+		} else if hdr.Name == zipslicer.TarMemberZip {
+			return digestPackage(tr, hdr.Size, cd, hash)
+		}
+	}
+}
+
+// DigestPackage calculates the content hash of a package file
+func DigestPackage(r io.ReaderAt, size int64, hash crypto.Hash) (*PackageDigest, error) {
+	cd, err := readDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return digestPackage(io.NewSectionReader(r, 0, size), size, cd, hash)
+}
+
+func readDirectory(r io.ReaderAt, size int64) ([]byte, error) {
+	loc, err := zipslicer.FindDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+	cd := make([]byte, size-loc)
+	if _, err := r.ReadAt(cd, loc); err != nil {
+		return nil, err
+	}
+	return cd, nil
+}
+
+// Find the signature entry in the central directory, if there is one
+func findSignature(dir *zipslicer.Directory) (*zipslicer.File, error) {
+	var sig *zipslicer.File
+	for _, f := range dir.File {
+		if f.Name == SignatureName {
+			if sig != nil {
+				return nil, errors.New("package contains multiple signature entries")
+			}
+			sig = f
+		}
+	}
+	return sig, nil
+}
+
+func digestPackage(r io.Reader, size int64, cd []byte, hash crypto.Hash) (*PackageDigest, error) {
+	dir, err := zipslicer.ReadWithDirectory(nil, size, cd)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := findSignature(dir)
+	if err != nil {
+		return nil, err
+	}
+	pd := &PackageDigest{
+		Hash:   hash,
+		size:   size,
+		dirLoc: dir.DirLoc,
+	}
+	d := hash.New()
+	var pos int64
+	var sigRecord int
+	if sig != nil {
+		if _, err := io.CopyN(d, r, int64(sig.Offset)); err != nil {
+			return nil, err
+		}
+		pd.Signature, pd.sigSize, err = readLocalEntry(r, sig)
+		if err != nil {
+			return nil, err
+		}
+		pd.sigOffset = int64(sig.Offset)
+		pos = pd.sigOffset + pd.sigSize
+	}
+	if pos > pd.dirLoc {
+		return nil, errors.New("signature entry overlaps the central directory")
+	}
+	if _, err := io.CopyN(d, r, pd.dirLoc-pos); err != nil {
+		return nil, err
+	}
+	var records bytes.Buffer
+	var recordsLen int
+	for _, f := range dir.File {
+		raw, err := f.GetDirectoryHeader()
+		if err != nil {
+			return nil, err
+		}
+		recordsLen += len(raw)
+		if f == sig {
+			sigRecord = len(raw)
+			continue
+		}
+		raw = append([]byte(nil), raw...)
+		if sig != nil && f.Offset > sig.Offset {
+			if err := setRecordOffset(raw, f.Offset-uint64(pd.sigSize)); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+		records.Write(raw)
+	}
+	pd.records = records.Bytes()
+	pd.end = append([]byte(nil), cd[recordsLen:]...)
+	if sig != nil {
+		if err := adjustEnd(pd.end, -1, -int64(sigRecord), -pd.sigSize); err != nil {
+			return nil, err
+		}
+	}
+	d.Write(pd.records)
+	d.Write(pd.end)
+	pd.Sum = d.Sum(nil)
+	return pd, nil
+}
+
+// Read the local header and contents of the signature entry from a stream
+// positioned at the start of it, returning the contents and the total size of
+// the entry
+func readLocalEntry(r io.Reader, f *zipslicer.File) ([]byte, int64, error) {
+	if f.Method != zip.Store {
+		return nil, 0, errors.New("package signature entry must not be compressed")
+	}
+	var lfh [fileHeaderLen]byte
+	if _, err := io.ReadFull(r, lfh[:]); err != nil {
+		return nil, 0, err
+	}
+	if binary.LittleEndian.Uint32(lfh[:]) != fileHeaderSignature {
+		return nil, 0, errors.New("local file header not found")
+	}
+	flags := binary.LittleEndian.Uint16(lfh[6:])
+	nameLen := int64(binary.LittleEndian.Uint16(lfh[26:]))
+	extraLen := int64(binary.LittleEndian.Uint16(lfh[28:]))
+	if _, err := io.CopyN(io.Discard, r, nameLen+extraLen); err != nil {
+		return nil, 0, err
+	}
+	size := fileHeaderLen + nameLen + extraLen + int64(f.CompressedSize)
+	if f.CompressedSize > 1<<30 {
+		return nil, 0, errors.New("package signature entry is too big")
+	}
+	contents := make([]byte, f.CompressedSize)
+	if _, err := io.ReadFull(r, contents); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(contents) != f.CRC32 {
+		return nil, 0, zip.ErrChecksum
+	}
+	if flags&0x8 != 0 {
+		// data descriptor, 32-bit unless the central directory needed ZIP64
+		var desc [24]byte
+		n := 16
+		if f.CompressedSize >= uint32Max || f.Offset >= uint32Max {
+			n = 24
+		}
+		if _, err := io.ReadFull(r, desc[:n]); err != nil {
+			return nil, 0, err
+		}
+		if binary.LittleEndian.Uint32(desc[:]) != dataDescriptorSignature {
+			return nil, 0, errors.New("data descriptor signature is missing")
+		}
+		size += int64(n)
+	}
+	return contents, size, nil
+}
+
+// Change the local header offset of a central directory record, either in the
+// fixed part or in its ZIP64 extra field
+func setRecordOffset(raw []byte, offset uint64) error {
+	if binary.LittleEndian.Uint32(raw[42:]) != uint32Max {
+		if offset >= uint32Max {
+			return errors.New("offset does not fit in the directory record")
+		}
+		binary.LittleEndian.PutUint32(raw[42:], uint32(offset))
+		return nil
+	}
+	nameLen := int(binary.LittleEndian.Uint16(raw[28:]))
+	extraLen := int(binary.LittleEndian.Uint16(raw[30:]))
+	extra := raw[directoryHeaderLen+nameLen : directoryHeaderLen+nameLen+extraLen]
+	// fields are only present in the ZIP64 extra if they overflowed
+	var pos int
+	if binary.LittleEndian.Uint32(raw[24:]) == uint32Max {
+		pos += 8
+	}
+	if binary.LittleEndian.Uint32(raw[20:]) == uint32Max {
+		pos += 8
+	}
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra)-4 {
+			break
+		}
+		if tag == zip64ExtraID {
+			if size < pos+8 {
+				break
+			}
+			binary.LittleEndian.PutUint64(extra[4+pos:], offset)
+			return nil
+		}
+		extra = extra[4+size:]
+	}
+	return errors.New("missing ZIP64 header")
+}
+
+// Adjust the entry count, directory size and directory offset in the end
+// records by the given amounts
+func adjustEnd(end []byte, count int, cdSize, localSize int64) error {
+	if len(end) >= 12 && binary.LittleEndian.Uint32(end) == directory64EndSignature {
+		recLen := 12 + int(binary.LittleEndian.Uint64(end[4:]))
+		if recLen < 56 || len(end) < recLen+directory64LocLen+directoryEndLen {
+			return errors.New("invalid ZIP64 end of central directory")
+		}
+		for _, pos := range []int{24, 32} {
+			binary.LittleEndian.PutUint64(end[pos:], uint64(int64(binary.LittleEndian.Uint64(end[pos:]))+int64(count)))
+		}
+		binary.LittleEndian.PutUint64(end[40:], uint64(int64(binary.LittleEndian.Uint64(end[40:]))+cdSize))
+		binary.LittleEndian.PutUint64(end[48:], uint64(int64(binary.LittleEndian.Uint64(end[48:]))+localSize))
+		loc := end[recLen:]
+		binary.LittleEndian.PutUint64(loc[8:], uint64(int64(binary.LittleEndian.Uint64(loc[8:]))+localSize+cdSize))
+		end = end[recLen+directory64LocLen:]
+	}
+	if len(end) < directoryEndLen || binary.LittleEndian.Uint32(end) != directoryEndSignature {
+		return errors.New("invalid end of central directory")
+	}
+	tooBig := errors.New("package is too large to sign without a ZIP64 end of central directory")
+	// values that overflowed into the ZIP64 record are left alone
+	for _, pos := range []int{8, 10} {
+		if v := binary.LittleEndian.Uint16(end[pos:]); v != uint16Max {
+			n := int(v) + count
+			if n < 0 || n >= uint16Max {
+				return tooBig
+			}
+			binary.LittleEndian.PutUint16(end[pos:], uint16(n))
+		}
+	}
+	for _, f := range []struct {
+		pos   int
+		delta int64
+	}{{12, cdSize}, {16, localSize}} {
+		if v := binary.LittleEndian.Uint32(end[f.pos:]); v != uint32Max {
+			n := int64(v) + f.delta
+			if n < 0 || n >= uint32Max {
+				return tooBig
+			}
+			binary.LittleEndian.PutUint32(end[f.pos:], uint32(n))
+		}
+	}
+	return nil
+}
+
+// Build a patch that removes the old signature, if any, and adds a new one
+// after the last entry
+func (pd *PackageDigest) makePatch(sig []byte, mtime time.Time) (*binpatch.PatchSet, error) {
+	var zh zip.FileHeader
+	// need the side effect of this conversion
+	zh.SetModTime(mtime) //nolint:staticcheck
+	offset := uint64(pd.dirLoc - pd.sigSize)
+	crc := crc32.ChecksumIEEE(sig)
+	var local bytes.Buffer
+	lfh := make([]byte, fileHeaderLen)
+	binary.LittleEndian.PutUint32(lfh, fileHeaderSignature)
+	binary.LittleEndian.PutUint16(lfh[4:], 20)
+	binary.LittleEndian.PutUint16(lfh[10:], zh.ModifiedTime)
+	binary.LittleEndian.PutUint16(lfh[12:], zh.ModifiedDate)
+	binary.LittleEndian.PutUint32(lfh[14:], crc)
+	binary.LittleEndian.PutUint32(lfh[18:], uint32(len(sig)))
+	binary.LittleEndian.PutUint32(lfh[22:], uint32(len(sig)))
+	binary.LittleEndian.PutUint16(lfh[26:], uint16(len(SignatureName)))
+	local.Write(lfh)
+	local.WriteString(SignatureName)
+	local.Write(sig)
+
+	var extra []byte
+	recOffset := uint32(offset)
+	version := uint16(20)
+	if offset >= uint32Max {
+		extra = make([]byte, 12)
+		binary.LittleEndian.PutUint16(extra, zip64ExtraID)
+		binary.LittleEndian.PutUint16(extra[2:], 8)
+		binary.LittleEndian.PutUint64(extra[4:], offset)
+		recOffset = uint32Max
+		version = 45
+	}
+	rec := make([]byte, directoryHeaderLen)
+	binary.LittleEndian.PutUint32(rec, directoryHeaderSignature)
+	binary.LittleEndian.PutUint16(rec[4:], version)
+	binary.LittleEndian.PutUint16(rec[6:], version)
+	copy(rec[12:], lfh[10:26])
+	binary.LittleEndian.PutUint16(rec[28:], uint16(len(SignatureName)))
+	binary.LittleEndian.PutUint16(rec[30:], uint16(len(extra)))
+	binary.LittleEndian.PutUint32(rec[42:], recOffset)
+	rec = append(rec, SignatureName...)
+	rec = append(rec, extra...)
+
+	end := append([]byte(nil), pd.end...)
+	if err := adjustEnd(end, 1, int64(len(rec)), int64(local.Len())); err != nil {
+		return nil, err
+	}
+	tail := local
+	tail.Write(pd.records)
+	tail.Write(rec)
+	tail.Write(end)
+	patch := binpatch.New()
+	if pd.Signature != nil {
+		patch.Add(pd.sigOffset, pd.sigSize, nil)
+	}
+	patch.Add(pd.dirLoc, pd.size-pd.dirLoc, tail.Bytes())
+	return patch, nil
+}
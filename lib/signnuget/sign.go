@@ -0,0 +1,137 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+// Sign the package content hash with an author signature and return a patch
+// that stores it in the package
+func (pd *PackageDigest) Sign(ctx context.Context, cert *certloader.Certificate, signingTime time.Time) (*binpatch.PatchSet, *pkcs9.TimestampedSignature, error) {
+	content, err := signatureContent(pd.Hash, pd.Sum)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig := pkcs7.NewBuilder(cert.Signer(), cert.Chain(), pd.Hash)
+	if err := sig.SetContentData(content); err != nil {
+		return nil, nil, err
+	}
+	if err := sig.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, signingTime.UTC().Truncate(time.Second)); err != nil {
+		return nil, nil, err
+	}
+	commitment := CommitmentTypeIndication{OidProofOfOrigin}
+	if err := sig.AddAuthenticatedAttribute(OidCommitmentTypeIndication, commitment); err != nil {
+		return nil, nil, err
+	}
+	if err := sig.AddAuthenticatedAttribute(OidSigningCertificateV2, signingCertificate(cert.Leaf)); err != nil {
+		return nil, nil, err
+	}
+	psd, err := sig.Sign()
+	if err != nil {
+		return nil, nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(ctx, psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch, err := pd.makePatch(ts.Raw, signingTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patch, ts, nil
+}
+
+// Serialize the signed content, a small key-value document naming the hash
+// of the package
+func signatureContent(hash crypto.Hash, sum []byte) ([]byte, error) {
+	oid, ok := x509tools.HashOids[hash]
+	if !ok || !allowedHash(hash) {
+		return nil, fmt.Errorf("digest %s is not allowed for NuGet packages", x509tools.HashNames[hash])
+	}
+	var b bytes.Buffer
+	b.WriteString("Version:1\r\n\r\n")
+	fmt.Fprintf(&b, "%s-Hash:%s\r\n\r\n", oid, base64.StdEncoding.EncodeToString(sum))
+	return b.Bytes(), nil
+}
+
+// Parse the signed content and return the package hash from it
+func parseContent(content []byte) (crypto.Hash, []byte, error) {
+	lines := bytes.Split(content, []byte("\r\n"))
+	if len(lines) == 0 || string(lines[0]) != "Version:1" {
+		return 0, nil, errors.New("unsupported signature content version")
+	}
+	for _, line := range lines[1:] {
+		i := bytes.Index(line, []byte("-Hash:"))
+		if i < 0 {
+			continue
+		}
+		name := string(line[:i])
+		for _, hash := range Hashes {
+			if x509tools.HashOids[hash].String() == name {
+				sum, err := base64.StdEncoding.DecodeString(string(line[i+6:]))
+				if err != nil {
+					return 0, nil, fmt.Errorf("invalid package hash: %w", err)
+				}
+				return hash, sum, nil
+			}
+		}
+		return 0, nil, fmt.Errorf("unsupported package hash algorithm %s", name)
+	}
+	return 0, nil, errors.New("signature content has no package hash")
+}
+
+func allowedHash(hash crypto.Hash) bool {
+	for _, h := range Hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// Build a signing-certificate-v2 attribute identifying the leaf certificate
+func signingCertificate(leaf *x509.Certificate) SigningCertificateV2 {
+	certHash := sha256.Sum256(leaf.Raw)
+	return SigningCertificateV2{Certs: []ESSCertIDv2{{
+		CertHash: certHash[:],
+		IssuerSerial: IssuerSerial{
+			Issuer: []asn1.RawValue{{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        4,
+				IsCompound: true,
+				Bytes:      leaf.RawIssuer,
+			}},
+			SerialNumber: leaf.SerialNumber,
+		},
+	}}}
+}
@@ -0,0 +1,144 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/zipslicer"
+)
+
+func makePackage(t *testing.T, extraFiles int) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := []struct{ name, contents string }{
+		{"[Content_Types].xml", "<Types/>"},
+		{"Example.nuspec", "<package><metadata><id>Example</id></metadata></package>"},
+		{"lib/net6.0/Example.dll", "not really a dll"},
+	}
+	for i := 0; i < extraFiles; i++ {
+		files = append(files, struct{ name, contents string }{fmt.Sprintf("content/%d.txt", i), ""})
+	}
+	for _, file := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(file.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func makeSigningCert(t *testing.T) *certloader.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nuget signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certloader.Certificate{
+		Leaf:         cert,
+		Certificates: []*x509.Certificate{cert},
+		PrivateKey:   key,
+	}
+}
+
+func signPackage(t *testing.T, pkg []byte, cert *certloader.Certificate) []byte {
+	fp := filepath.Join(t.TempDir(), "pkg.nupkg")
+	require.NoError(t, os.WriteFile(fp, pkg, 0644))
+	f, err := os.Open(fp)
+	require.NoError(t, err)
+	defer f.Close()
+	var tarball bytes.Buffer
+	require.NoError(t, zipslicer.ZipToTar(f, &tarball))
+	digest, err := DigestPackageTar(&tarball, crypto.SHA256)
+	require.NoError(t, err)
+	patch, _, err := digest.Sign(context.Background(), cert, time.Now())
+	require.NoError(t, err)
+	signed, err := patch.ApplyBytes(pkg)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestSignPackage(t *testing.T) {
+	cert := makeSigningCert(t)
+	for _, tc := range []struct {
+		name       string
+		extraFiles int
+	}{
+		{"small", 0},
+		{"zip64", 70000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := makePackage(t, tc.extraFiles)
+			signed := signPackage(t, orig, cert)
+			// other entries are untouched and the signature is stored last
+			inz, err := zip.NewReader(bytes.NewReader(signed), int64(len(signed)))
+			require.NoError(t, err)
+			require.Len(t, inz.File, tc.extraFiles+4)
+			last := inz.File[len(inz.File)-1]
+			assert.Equal(t, SignatureName, last.Name)
+			assert.Equal(t, zip.Store, last.Method)
+			sig, err := Verify(bytes.NewReader(signed), int64(len(signed)), false)
+			require.NoError(t, err)
+			assert.Equal(t, "author", sig.Type)
+			assert.Equal(t, crypto.SHA256, sig.Hash)
+			// the content hash is that of the unsigned package
+			pd, err := DigestPackage(bytes.NewReader(signed), int64(len(signed)), crypto.SHA256)
+			require.NoError(t, err)
+			d := crypto.SHA256.New()
+			d.Write(orig)
+			assert.Equal(t, d.Sum(nil), pd.Sum)
+
+			// signing again replaces the signature
+			resigned := signPackage(t, signed, cert)
+			inz, err = zip.NewReader(bytes.NewReader(resigned), int64(len(resigned)))
+			require.NoError(t, err)
+			assert.Len(t, inz.File, tc.extraFiles+4)
+			_, err = Verify(bytes.NewReader(resigned), int64(len(resigned)), false)
+			require.NoError(t, err)
+
+			tampered := bytes.Replace(signed, []byte("not really a dll"), []byte("not really a DLL"), 1)
+			_, err = Verify(bytes.NewReader(tampered), int64(len(tampered)), false)
+			assert.ErrorContains(t, err, "digest mismatch")
+		})
+	}
+}
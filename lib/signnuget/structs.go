@@ -0,0 +1,62 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+)
+
+// SignatureName is the zip entry holding the package signature
+const SignatureName = ".signature.p7s"
+
+// Hashes lists the digest algorithms allowed by the NuGet signing spec
+var Hashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+var (
+	OidCommitmentTypeIndication = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 16}
+	OidSigningCertificateV2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	// author signatures
+	OidProofOfOrigin = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 1}
+	// repository signatures
+	OidProofOfReceipt = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 6, 2}
+)
+
+type CommitmentTypeIndication struct {
+	CommitmentTypeID asn1.ObjectIdentifier
+}
+
+// SigningCertificateV2 from RFC 5035
+type SigningCertificateV2 struct {
+	Certs []ESSCertIDv2
+}
+
+type ESSCertIDv2 struct {
+	// omitted when it is the default of SHA-256
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  IssuerSerial `asn1:"optional"`
+}
+
+type IssuerSerial struct {
+	// GeneralNames holding a single directoryName
+	Issuer       []asn1.RawValue
+	SerialNumber *big.Int
+}
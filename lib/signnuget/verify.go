@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signnuget
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/lib/zipslicer"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+type PackageSignature struct {
+	pkcs9.TimestampedSignature
+	Hash crypto.Hash
+	// Type is "author" or "repository"
+	Type string
+}
+
+// Verify the signature embedded in a NuGet package
+func Verify(r io.ReaderAt, size int64, skipDigests bool) (*PackageSignature, error) {
+	cd, err := readDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := zipslicer.ReadWithDirectory(nil, size, cd)
+	if err != nil {
+		return nil, err
+	}
+	sigFile, err := findSignature(dir)
+	if err != nil {
+		return nil, err
+	} else if sigFile == nil {
+		return nil, sigerrors.NotSignedError{Type: "NuGet package"}
+	}
+	blob, _, err := readLocalEntry(io.NewSectionReader(r, int64(sigFile.Offset), size-int64(sigFile.Offset)), sigFile)
+	if err != nil {
+		return nil, err
+	}
+	psd, err := pkcs7.Unmarshal(blob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if !psd.Content.ContentInfo.ContentType.Equal(pkcs7.OidData) {
+		return nil, errors.New("invalid signature: unexpected content type")
+	}
+	content, err := psd.Content.ContentInfo.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	} else if content == nil {
+		return nil, errors.New("invalid signature: content is missing")
+	}
+	pksig, err := psd.Content.Verify(nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if err := checkSigningCertificate(pksig); err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.VerifyOptionalTimestamp(pksig)
+	if err != nil {
+		return nil, err
+	}
+	hash, expected, err := parseContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if !skipDigests {
+		pd, err := DigestPackage(r, size, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(pd.Sum, expected) {
+			return nil, fmt.Errorf("digest mismatch: calculated %x != found %x", pd.Sum, expected)
+		}
+	}
+	sigType := "unknown"
+	var commitment CommitmentTypeIndication
+	if err := pksig.SignerInfo.AuthenticatedAttributes.GetOne(OidCommitmentTypeIndication, &commitment); err == nil {
+		switch {
+		case commitment.CommitmentTypeID.Equal(OidProofOfOrigin):
+			sigType = "author"
+		case commitment.CommitmentTypeID.Equal(OidProofOfReceipt):
+			sigType = "repository"
+		}
+	}
+	return &PackageSignature{
+		TimestampedSignature: ts,
+		Hash:                 hash,
+		Type:                 sigType,
+	}, nil
+}
+
+// The signing-certificate-v2 attribute is required and must name the
+// certificate that made the signature
+func checkSigningCertificate(pksig pkcs7.Signature) error {
+	var scv2 SigningCertificateV2
+	if err := pksig.SignerInfo.AuthenticatedAttributes.GetOne(OidSigningCertificateV2, &scv2); err != nil {
+		return fmt.Errorf("invalid signature: signing-certificate-v2: %w", err)
+	} else if len(scv2.Certs) == 0 {
+		return errors.New("invalid signature: signing-certificate-v2 is empty")
+	}
+	certID := scv2.Certs[0]
+	hash := crypto.SHA256
+	if len(certID.HashAlgorithm.Algorithm) != 0 {
+		var err error
+		hash, err = x509tools.PkixDigestToHashE(certID.HashAlgorithm)
+		if err != nil {
+			return err
+		}
+	}
+	d := hash.New()
+	d.Write(pksig.Certificate.Raw)
+	if !hmac.Equal(d.Sum(nil), certID.CertHash) {
+		return errors.New("invalid signature: signing-certificate-v2 does not match the signer")
+	}
+	return nil
+}
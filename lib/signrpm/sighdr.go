@@ -0,0 +1,209 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signrpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Signature header tags. Those above 1000 are stored without the offset that
+// go-rpmutils adds to tell them apart from main header tags.
+const (
+	tagHeaderSignatures = 62
+	tagDSA              = 267
+	tagRSA              = 268
+	tagSHA256           = 273
+	tagPGP              = 1002
+	tagGPG              = 1005
+	tagReservedSpace    = 1008
+
+	typeInt16  = 3
+	typeInt32  = 4
+	typeInt64  = 5
+	typeString = 6
+	typeBin    = 7
+)
+
+var headerMagic = [4]byte{0x8e, 0xad, 0xe8, 0x01}
+
+var typeSizes = map[int32]int{0: 0, 1: 1, 2: 1, typeInt16: 2, typeInt32: 4, typeInt64: 8, typeBin: 1}
+
+type headerIntro struct {
+	Magic    [4]byte
+	Reserved [4]byte
+	Entries  uint32
+	Size     uint32
+}
+
+type headerTag struct {
+	Tag, DataType, Offset, Count int32
+}
+
+type entry struct {
+	dataType int32
+	count    int32
+	contents []byte
+}
+
+// sigHeader is the signature header of an RPM, which unlike the main header
+// can be rewritten without invalidating anything else in the package
+type sigHeader struct {
+	entries map[int32]entry
+}
+
+func parseSigHeader(blob []byte) (*sigHeader, error) {
+	r := bytes.NewReader(blob)
+	var intro headerIntro
+	if err := binary.Read(r, binary.BigEndian, &intro); err != nil {
+		return nil, fmt.Errorf("reading signature header: %w", err)
+	} else if intro.Magic != headerMagic {
+		return nil, errors.New("bad magic for signature header")
+	}
+	index := make([]headerTag, intro.Entries)
+	if err := binary.Read(r, binary.BigEndian, index); err != nil {
+		return nil, fmt.Errorf("reading signature header: %w", err)
+	}
+	data := blob[len(blob)-r.Len():]
+	if int(intro.Size) > len(data) {
+		return nil, errors.New("signature header is truncated")
+	}
+	data = data[:intro.Size]
+	hdr := &sigHeader{entries: make(map[int32]entry, len(index))}
+	for _, tag := range index {
+		if tag.Tag == tagHeaderSignatures {
+			// the region is recreated when writing
+			continue
+		}
+		if tag.Offset < 0 || int(tag.Offset) > len(data) {
+			return nil, fmt.Errorf("tag %d is out of bounds", tag.Tag)
+		}
+		end := int(tag.Offset)
+		if size, ok := typeSizes[tag.DataType]; ok {
+			end += size * int(tag.Count)
+		} else {
+			// string types are null-terminated
+			for i := 0; i < int(tag.Count); i++ {
+				next := bytes.IndexByte(data[end:], 0)
+				if next < 0 {
+					return nil, fmt.Errorf("tag %d is truncated", tag.Tag)
+				}
+				end += next + 1
+			}
+		}
+		if end > len(data) {
+			return nil, fmt.Errorf("tag %d is truncated", tag.Tag)
+		}
+		hdr.entries[tag.Tag] = entry{
+			dataType: tag.DataType,
+			count:    tag.Count,
+			contents: data[tag.Offset:end],
+		}
+	}
+	return hdr, nil
+}
+
+func (hdr *sigHeader) setBytes(tag int32, value []byte) {
+	hdr.entries[tag] = entry{dataType: typeBin, count: int32(len(value)), contents: value}
+}
+
+func (hdr *sigHeader) setString(tag int32, value string) {
+	hdr.entries[tag] = entry{dataType: typeString, count: 1, contents: append([]byte(value), 0)}
+}
+
+// Serialize the header. If size is nonzero then a reserved space tag pads the
+// result out to that size, so that the rest of the file doesn't move.
+func (hdr *sigHeader) marshal(size int) ([]byte, error) {
+	delete(hdr.entries, tagReservedSpace)
+	blob := hdr.marshalRegion()
+	if size == 0 {
+		return blob, nil
+	}
+	// a reserved space tag costs an index entry on top of its contents
+	if len(blob)+16 > size {
+		return nil, fmt.Errorf("signature header grew from %d to %d bytes and no longer fits", size, len(blob))
+	}
+	hdr.setBytes(tagReservedSpace, make([]byte, size-len(blob)-16))
+	blob = hdr.marshalRegion()
+	if len(blob) != size {
+		return nil, fmt.Errorf("signature header is %d bytes, expected %d", len(blob), size)
+	}
+	return blob, nil
+}
+
+func (hdr *sigHeader) marshalRegion() []byte {
+	tags := make([]int, 0, len(hdr.entries))
+	for tag := range hdr.entries {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+	var index, data bytes.Buffer
+	for _, tag := range tags {
+		writeTag(&index, &data, int32(tag), hdr.entries[int32(tag)])
+	}
+	// The region's trailer is stored last in the data and its offset points
+	// back to the start of the index entries that it covers, which is all of
+	// them.
+	var trailer bytes.Buffer
+	_ = binary.Write(&trailer, binary.BigEndian, headerTag{
+		Tag:      tagHeaderSignatures,
+		DataType: typeBin,
+		Offset:   int32(-16 * (1 + len(tags))),
+		Count:    16,
+	})
+	var region bytes.Buffer
+	writeTag(&region, &data, tagHeaderSignatures, entry{dataType: typeBin, count: 16, contents: trailer.Bytes()})
+	var out bytes.Buffer
+	_ = binary.Write(&out, binary.BigEndian, headerIntro{
+		Magic:   headerMagic,
+		Entries: uint32(len(tags) + 1),
+		Size:    uint32(data.Len()),
+	})
+	out.Write(region.Bytes())
+	out.Write(index.Bytes())
+	out.Write(data.Bytes())
+	// the signature header is padded so that the main header is aligned
+	if n := out.Len() % 8; n != 0 {
+		out.Write(make([]byte, 8-n))
+	}
+	return out.Bytes()
+}
+
+func writeTag(index, data *bytes.Buffer, tag int32, e entry) {
+	var align int
+	switch e.dataType {
+	case typeInt16:
+		align = 2
+	case typeInt32:
+		align = 4
+	case typeInt64:
+		align = 8
+	}
+	if align != 0 && data.Len()%align != 0 {
+		data.Write(make([]byte, align-data.Len()%align))
+	}
+	_ = binary.Write(index, binary.BigEndian, headerTag{
+		Tag:      tag,
+		DataType: e.dataType,
+		Offset:   int32(data.Len()),
+		Count:    e.count,
+	})
+	data.Write(e.contents)
+}
@@ -0,0 +1,104 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signrpm
+
+// Sign RPM packages with a header-only signature, as rpm 4.14 and later
+// prefer, optionally with the legacy header+payload signature alongside
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	rpmutils "github.com/sassoftware/go-rpmutils"
+
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+)
+
+// leadSize is the size of the obsolete lead that precedes the signature header
+const leadSize = 96
+
+type SignOptions struct {
+	Hash         crypto.Hash
+	CreationTime time.Time
+	// Also write the signature over the header and payload, for distros whose
+	// rpm predates header-only signatures
+	Legacy bool
+}
+
+// Sign the RPM read from r. Returns the parsed headers and a patch that
+// replaces the signature header of the original file.
+func Sign(r io.Reader, key *packet.PrivateKey, opts SignOptions) (*rpmutils.RpmHeader, *binpatch.PatchSet, error) {
+	// capture the lead and both headers while rpmutils parses them
+	var head bytes.Buffer
+	parsed, err := rpmutils.ReadHeader(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, nil, err
+	}
+	rng := parsed.GetRange()
+	if rng.Start <= leadSize || rng.End != head.Len() {
+		return nil, nil, errors.New("unexpected RPM header layout")
+	}
+	// this also checks the header and payload digests against the original
+	// signature header
+	signed, err := rpmutils.SignRpmStream(io.MultiReader(bytes.NewReader(head.Bytes()), r), key, &rpmutils.SignatureOptions{
+		Hash:         opts.Hash,
+		CreationTime: opts.CreationTime,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	headerSig, err := signed.GetBytes(rpmutils.SIG_RSA)
+	if err != nil {
+		return nil, nil, err
+	}
+	payloadSig, err := signed.GetBytes(rpmutils.SIG_PGP)
+	if err != nil {
+		return nil, nil, err
+	}
+	blob := head.Bytes()
+	sigh, err := parseSigHeader(blob[leadSize:rng.Start])
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, tag := range []int32{tagDSA, tagRSA, tagPGP, tagGPG} {
+		delete(sigh.entries, tag)
+	}
+	// rpm picks the tag according to the key algorithm
+	var headerTag, payloadTag int32 = tagDSA, tagGPG
+	if key.PubKeyAlgo == packet.PubKeyAlgoRSA || key.PubKeyAlgo == packet.PubKeyAlgoRSASignOnly {
+		headerTag, payloadTag = tagRSA, tagPGP
+	}
+	sigh.setBytes(headerTag, headerSig)
+	if opts.Legacy {
+		sigh.setBytes(payloadTag, payloadSig)
+	}
+	genHeader := sha256.Sum256(blob[rng.Start:rng.End])
+	sigh.setString(tagSHA256, hex.EncodeToString(genHeader[:]))
+	newSig, err := sigh.marshal(rng.Start - leadSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	patch := binpatch.New()
+	patch.Add(0, int64(rng.Start), append(blob[:leadSize:leadSize], newSig...))
+	return signed, patch, nil
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signrpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	rpmutils "github.com/sassoftware/go-rpmutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPackage = "../../functest/packages/rocky-basesystem-11-13.el9.noarch.rpm"
+
+func TestSign(t *testing.T) {
+	orig, err := os.ReadFile(testPackage)
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		name      string
+		config    *packet.Config
+		legacy    bool
+		headerTag int32
+	}{
+		{"rsa", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}, false, tagRSA},
+		{"rsa-legacy", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048}, true, tagRSA},
+		{"ecdsa", &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.CurveNistP256}, false, tagDSA},
+		{"ecdsa-legacy", &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.CurveNistP256}, true, tagDSA},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entity, err := openpgp.NewEntity("rpm signer", "", "", tc.config)
+			require.NoError(t, err)
+			_, patch, err := Sign(bytes.NewReader(orig), entity.PrivateKey, SignOptions{
+				Hash:         crypto.SHA256,
+				CreationTime: time.Now(),
+				Legacy:       tc.legacy,
+			})
+			require.NoError(t, err)
+			signed, err := patch.ApplyBytes(orig)
+			require.NoError(t, err)
+			// only the signature header changes, and it keeps its size
+			require.Len(t, signed, len(orig))
+			parsed, err := rpmutils.ReadHeader(bytes.NewReader(orig))
+			require.NoError(t, err)
+			rng := parsed.GetRange()
+			assert.Equal(t, orig[:leadSize], signed[:leadSize])
+			assert.Equal(t, orig[rng.Start:], signed[rng.Start:])
+
+			sigh, err := parseSigHeader(signed[leadSize:rng.Start])
+			require.NoError(t, err)
+			genHeader := sha256.Sum256(signed[rng.Start:rng.End])
+			assert.Equal(t, hex.EncodeToString(genHeader[:])+"\x00", string(sigh.entries[tagSHA256].contents))
+			assert.Contains(t, sigh.entries, tc.headerTag)
+			var payloadTags int
+			for _, tag := range []int32{tagPGP, tagGPG} {
+				if _, ok := sigh.entries[tag]; ok {
+					payloadTags++
+				}
+			}
+			if tc.legacy {
+				assert.Equal(t, 1, payloadTags)
+			} else {
+				assert.Equal(t, 0, payloadTags)
+			}
+
+			_, sigs, err := rpmutils.Verify(bytes.NewReader(signed), openpgp.EntityList{entity})
+			require.NoError(t, err)
+			require.Len(t, sigs, payloadTags+1)
+			for _, sig := range sigs {
+				assert.Equal(t, entity.PrimaryKey.KeyId, sig.KeyId)
+				assert.NotNil(t, sig.Signer)
+			}
+			assert.True(t, sigs[0].HeaderOnly || sigs[len(sigs)-1].HeaderOnly)
+
+			tampered := bytes.Clone(signed)
+			tampered[rng.Start+200] ^= 1
+			_, _, err = rpmutils.Verify(bytes.NewReader(tampered), openpgp.EntityList{entity})
+			assert.Error(t, err)
+		})
+	}
+}
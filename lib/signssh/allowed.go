@@ -0,0 +1,278 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signssh
+
+// Allowed signers files as described in the ALLOWED SIGNERS section of
+// ssh-keygen(1)
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AllowedSigner is one entry from an allowed signers file
+type AllowedSigner struct {
+	// Principals is a list of patterns matching the signer's identity
+	Principals []string
+	// CertAuthority means that Key is a CA trusted to certify signers
+	CertAuthority bool
+	// Namespaces, if not empty, is a list of patterns limiting which
+	// signature namespaces are accepted
+	Namespaces  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	Key         ssh.PublicKey
+}
+
+// ReadAllowedSigners parses an allowed signers file
+func ReadAllowedSigners(path string) ([]*AllowedSigner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	signers, err := ParseAllowedSigners(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signers, nil
+}
+
+// ParseAllowedSigners parses the contents of an allowed signers file
+func ParseAllowedSigners(r io.Reader) ([]*AllowedSigner, error) {
+	var signers []*AllowedSigner
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		signer, err := parseAllowedSigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		signers = append(signers, signer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+func parseAllowedSigner(line string) (*AllowedSigner, error) {
+	var principals, rest string
+	if line[0] == '"' {
+		end := strings.IndexByte(line[1:], '"')
+		if end < 0 {
+			return nil, errors.New("unterminated quote in principals")
+		}
+		principals, rest = line[1:end+1], line[end+2:]
+	} else {
+		var ok bool
+		principals, rest, ok = strings.Cut(line, " ")
+		if !ok {
+			return nil, errors.New("missing public key")
+		}
+	}
+	if principals == "" {
+		return nil, errors.New("missing principals")
+	}
+	key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(rest)))
+	if err != nil {
+		return nil, err
+	}
+	signer := &AllowedSigner{
+		Principals: strings.Split(principals, ","),
+		Key:        key,
+	}
+	for _, option := range options {
+		name, value, _ := strings.Cut(option, "=")
+		value = strings.Trim(value, `"`)
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			signer.CertAuthority = true
+		case "namespaces":
+			signer.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			signer.ValidAfter, err = parseAllowedTime(value)
+		case "valid-before":
+			signer.ValidBefore, err = parseAllowedTime(value)
+		default:
+			err = fmt.Errorf("unknown option %q", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signer, nil
+}
+
+// parseAllowedTime parses YYYYMMDD[HHMM[SS]] in local time, or UTC if
+// followed by a Z
+func parseAllowedTime(s string) (time.Time, error) {
+	loc := time.Local
+	if v, ok := strings.CutSuffix(s, "Z"); ok {
+		s = v
+		loc = time.UTC
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(layout) == len(s) {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// FindSigner returns the first allowed signer that accepts the signature at
+// the given time, and the principal it was accepted for. If principal is empty
+// then any principal named by the entry or by the signer's certificate is
+// accepted.
+func (s *Signature) FindSigner(signers []*AllowedSigner, principal string, now time.Time) (*AllowedSigner, string, error) {
+	for _, signer := range signers {
+		if len(signer.Namespaces) != 0 && !matchList(signer.Namespaces, s.Namespace) {
+			continue
+		}
+		if !signer.ValidAfter.IsZero() && now.Before(signer.ValidAfter) {
+			continue
+		}
+		if !signer.ValidBefore.IsZero() && !now.Before(signer.ValidBefore) {
+			continue
+		}
+		if found, ok := signer.accepts(s.PublicKey, principal, now); ok {
+			return signer, found, nil
+		}
+	}
+	return nil, "", errors.New("signer is not in the allowed signers list")
+}
+
+// FindAuthority returns the first cert-authority entry that trusts the CA
+// which signed the certificate, for at least one of its principals. A
+// certificate without principals is valid for any name, so it is only trusted
+// by an entry whose patterns match anything. The certificate's signature and
+// validity period are not checked.
+func FindAuthority(signers []*AllowedSigner, cert *ssh.Certificate, now time.Time) (*AllowedSigner, error) {
+	for _, signer := range signers {
+		if !signer.CertAuthority || !bytes.Equal(cert.SignatureKey.Marshal(), signer.Key.Marshal()) {
+			continue
+		}
+		if !signer.ValidAfter.IsZero() && now.Before(signer.ValidAfter) {
+			continue
+		}
+		if !signer.ValidBefore.IsZero() && !now.Before(signer.ValidBefore) {
+			continue
+		}
+		principals := cert.ValidPrincipals
+		if len(principals) == 0 {
+			// a literal * only matches the pattern *
+			principals = []string{"*"}
+		}
+		for _, p := range principals {
+			if matchList(signer.Principals, p) {
+				return signer, nil
+			}
+		}
+	}
+	return nil, errors.New("certificate authority is not in the allowed signers list")
+}
+
+func (signer *AllowedSigner) accepts(pub ssh.PublicKey, principal string, now time.Time) (string, bool) {
+	cert, isCert := pub.(*ssh.Certificate)
+	if !signer.CertAuthority {
+		if isCert || !bytes.Equal(pub.Marshal(), signer.Key.Marshal()) {
+			return "", false
+		}
+		if principal == "" {
+			return strings.Join(signer.Principals, ","), true
+		}
+		return principal, matchList(signer.Principals, principal)
+	}
+	if !isCert || cert.CertType != ssh.UserCert || !bytes.Equal(cert.SignatureKey.Marshal(), signer.Key.Marshal()) {
+		return "", false
+	}
+	unix := uint64(now.Unix())
+	if unix < cert.ValidAfter || unix >= cert.ValidBefore {
+		return "", false
+	}
+	if VerifyCertificate(cert) != nil {
+		return "", false
+	}
+	for _, p := range cert.ValidPrincipals {
+		if (principal == "" || p == principal) && matchList(signer.Principals, p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// matchList matches a value against a list of patterns, any of which may be
+// negated with a leading !. A negated match rejects the value outright.
+func matchList(patterns []string, value string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchPattern(negated, value) {
+				return false
+			}
+		} else if matchPattern(pattern, value) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchPattern matches a value against a pattern where * matches any
+// sequence of characters and ? matches any one character
+func matchPattern(pattern, value string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			pattern = pattern[1:]
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(value); i++ {
+				if matchPattern(pattern, value[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if value == "" {
+				return false
+			}
+		default:
+			if value == "" || value[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		value = value[1:]
+	}
+	return value == ""
+}
@@ -0,0 +1,229 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultExtensions are the extensions ssh-keygen grants to user
+// certificates when none are specified
+var DefaultExtensions = []string{
+	"permit-X11-forwarding",
+	"permit-agent-forwarding",
+	"permit-port-forwarding",
+	"permit-pty",
+	"permit-user-rc",
+}
+
+// CertificateOptions describe the certificate to issue
+type CertificateOptions struct {
+	// Host issues a host certificate instead of a user certificate
+	Host       bool
+	KeyID      string
+	Serial     uint64
+	Principals []string
+	// ValidAfter and ValidBefore bound the validity period. A zero value
+	// leaves that end unbounded.
+	ValidAfter      time.Time
+	ValidBefore     time.Time
+	CriticalOptions map[string]string
+	Extensions      map[string]string
+}
+
+// SignCertificate issues a certificate for pub signed by the CA key
+func SignCertificate(pub ssh.PublicKey, ca ssh.Signer, opts CertificateOptions) (*ssh.Certificate, error) {
+	if _, ok := pub.(*ssh.Certificate); ok {
+		return nil, errors.New("the key to be certified is already a certificate")
+	}
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          opts.Serial,
+		CertType:        ssh.UserCert,
+		KeyId:           opts.KeyID,
+		ValidPrincipals: opts.Principals,
+		ValidAfter:      0,
+		ValidBefore:     ssh.CertTimeInfinity,
+		Permissions: ssh.Permissions{
+			CriticalOptions: opts.CriticalOptions,
+			Extensions:      opts.Extensions,
+		},
+	}
+	if opts.Host {
+		cert.CertType = ssh.HostCert
+		if len(opts.Extensions) != 0 {
+			return nil, errors.New("host certificates do not have extensions")
+		}
+	}
+	if !opts.ValidAfter.IsZero() {
+		cert.ValidAfter = uint64(opts.ValidAfter.Unix())
+	}
+	if !opts.ValidBefore.IsZero() {
+		cert.ValidBefore = uint64(opts.ValidBefore.Unix())
+	}
+	if cert.ValidBefore <= cert.ValidAfter {
+		return nil, errors.New("certificate validity period is empty")
+	}
+	cert.Nonce = make([]byte, 32)
+	if _, err := rand.Read(cert.Nonce); err != nil {
+		return nil, err
+	}
+	cert.SignatureKey = ca.PublicKey()
+	sig, err := signData(ca, certBytesForSigning(cert))
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = sig
+	return cert, nil
+}
+
+// VerifyCertificate checks the CA signature on a certificate. The validity
+// period and principals are not checked.
+func VerifyCertificate(cert *ssh.Certificate) error {
+	if cert.SignatureKey == nil || cert.Signature == nil {
+		return errors.New("certificate is not signed")
+	}
+	if _, ok := cert.SignatureKey.(*ssh.Certificate); ok {
+		return errors.New("certificate is signed by another certificate")
+	}
+	if err := cert.SignatureKey.Verify(certBytesForSigning(cert), cert.Signature); err != nil {
+		return fmt.Errorf("certificate signature is invalid: %w", err)
+	}
+	return nil
+}
+
+// IsCertificate returns true if blob starts with a certificate in
+// authorized_keys format
+func IsCertificate(blob []byte) bool {
+	keyType, _, ok := bytes.Cut(blob, []byte(" "))
+	return ok && bytes.HasSuffix(keyType, []byte("-cert-v01@openssh.com"))
+}
+
+// certBytesForSigning is the certificate encoding without its trailing
+// signature field
+func certBytesForSigning(cert *ssh.Certificate) []byte {
+	c := *cert
+	c.Signature = nil
+	out := c.Marshal()
+	// drop the empty signature's length prefix
+	return out[:len(out)-4]
+}
+
+// ParseValidity parses a validity interval in the style of ssh-keygen -V,
+// relative to now. The forms accepted are "always", "forever", a relative
+// time like "+52w" or "-1h30m", an absolute time like 20240101 or
+// 20240101123000, or two of these separated by a colon. A single relative or
+// absolute time gives the end of the period, which then starts at now.
+func ParseValidity(s string, now time.Time) (after, before time.Time, err error) {
+	if s == "" || s == "forever" || s == "always" {
+		return time.Time{}, time.Time{}, nil
+	}
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		before, err = parseValidityTime(from, now, true)
+		return now, before, err
+	}
+	after, err = parseValidityTime(from, now, false)
+	if err != nil {
+		return
+	}
+	before, err = parseValidityTime(to, now, true)
+	return
+}
+
+func parseValidityTime(s string, now time.Time, end bool) (time.Time, error) {
+	switch s {
+	case "always":
+		if end {
+			return time.Time{}, fmt.Errorf("invalid validity end %q", s)
+		}
+		return time.Time{}, nil
+	case "forever":
+		if !end {
+			return time.Time{}, fmt.Errorf("invalid validity start %q", s)
+		}
+		return time.Time{}, nil
+	}
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		d, err := parseInterval(s[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if s[0] == '-' {
+			d = -d
+		}
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(layout) == len(s) {
+			if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid validity time %q", s)
+}
+
+// parseInterval parses a sequence of numbers with optional s, m, h, d, or w
+// suffixes, as in sshd_config
+func parseInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, errors.New("empty time interval")
+	}
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid time interval %q", s)
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time interval %q", s)
+		}
+		unit := time.Second
+		if i < len(s) {
+			switch s[i] {
+			case 's', 'S':
+			case 'm', 'M':
+				unit = time.Minute
+			case 'h', 'H':
+				unit = time.Hour
+			case 'd', 'D':
+				unit = 24 * time.Hour
+			case 'w', 'W':
+				unit = 7 * 24 * time.Hour
+			default:
+				return 0, fmt.Errorf("invalid time interval unit %q", s[i])
+			}
+			i++
+		}
+		total += time.Duration(n) * unit
+		s = s[i:]
+	}
+	return total, nil
+}
@@ -0,0 +1,58 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package signssh issues OpenSSH certificates and makes SSHSIG signatures
+// (as produced by "ssh-keygen -Y sign") using a key held by a relic token.
+package signssh
+
+import (
+	"crypto"
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NewSigner wraps a token key as an SSH signer. RSA keys sign with
+// rsa-sha2-256 or rsa-sha2-512 depending on hash, other key types always use
+// the digest fixed by their algorithm.
+func NewSigner(key crypto.Signer, hash crypto.Hash) (ssh.Signer, error) {
+	signer, err := ssh.NewSignerFromSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	if signer.PublicKey().Type() != ssh.KeyAlgoRSA {
+		return signer, nil
+	}
+	var algorithm string
+	switch hash {
+	case crypto.SHA256:
+		algorithm = ssh.KeyAlgoRSASHA256
+	case crypto.SHA512:
+		algorithm = ssh.KeyAlgoRSASHA512
+	default:
+		return nil, fmt.Errorf("digest %s is not supported for SSH RSA signatures", hash)
+	}
+	return ssh.NewSignerWithAlgorithms(signer.(ssh.AlgorithmSigner), []string{algorithm})
+}
+
+// signData signs with the preferred algorithm of signers returned by NewSigner
+func signData(signer ssh.Signer, data []byte) (*ssh.Signature, error) {
+	if ms, ok := signer.(ssh.MultiAlgorithmSigner); ok {
+		return ms.SignWithAlgorithm(rand.Reader, data, ms.Algorithms()[0])
+	}
+	return signer.Sign(rand.Reader, data)
+}
@@ -0,0 +1,209 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signssh
+
+// SSH signature format from PROTOCOL.sshsig in the OpenSSH source
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sigMagic      = "SSHSIG"
+	sigVersion    = 1
+	sigPEMType    = "SSH SIGNATURE"
+	sigLineLength = 70
+)
+
+// Signature is a parsed SSHSIG signature
+type Signature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	Signature     *ssh.Signature
+}
+
+type sigBlob struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type signedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// Hashes lists the digest algorithms allowed for SSH signatures
+var Hashes = []crypto.Hash{crypto.SHA256, crypto.SHA512}
+
+var hashNames = map[crypto.Hash]string{
+	crypto.SHA256: "sha256",
+	crypto.SHA512: "sha512",
+}
+
+// Sign the message read from r. The namespace keeps signatures made for one
+// purpose from being accepted for another, ssh-keygen uses "file" by default.
+func Sign(r io.Reader, signer ssh.Signer, hash crypto.Hash, namespace string) (*Signature, error) {
+	if namespace == "" {
+		return nil, errors.New("a namespace is required for SSH signatures")
+	}
+	hashName, ok := hashNames[hash]
+	if !ok {
+		return nil, fmt.Errorf("digest %s is not supported for SSH signatures", hash)
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return nil, err
+	}
+	sig, err := signData(signer, toSign(namespace, hashName, d.Sum(nil)))
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		PublicKey:     signer.PublicKey(),
+		Namespace:     namespace,
+		HashAlgorithm: hashName,
+		Signature:     sig,
+	}, nil
+}
+
+func toSign(namespace, hashName string, sum []byte) []byte {
+	msg := signedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashName,
+		Hash:          sum,
+	}
+	copy(msg.Magic[:], sigMagic)
+	return ssh.Marshal(msg)
+}
+
+// Marshal the signature in its binary form
+func (s *Signature) Marshal() []byte {
+	blob := sigBlob{
+		Version:       sigVersion,
+		PublicKey:     s.PublicKey.Marshal(),
+		Namespace:     s.Namespace,
+		HashAlgorithm: s.HashAlgorithm,
+		Signature:     ssh.Marshal(s.Signature),
+	}
+	copy(blob.Magic[:], sigMagic)
+	return ssh.Marshal(blob)
+}
+
+// Armor returns the signature in the PEM-like form written by ssh-keygen
+func (s *Signature) Armor() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("-----BEGIN " + sigPEMType + "-----\n")
+	enc := base64.StdEncoding.EncodeToString(s.Marshal())
+	for len(enc) > sigLineLength {
+		buf.WriteString(enc[:sigLineLength])
+		buf.WriteByte('\n')
+		enc = enc[sigLineLength:]
+	}
+	buf.WriteString(enc)
+	buf.WriteString("\n-----END " + sigPEMType + "-----\n")
+	return buf.Bytes()
+}
+
+// IsSignature returns true if blob looks like an armored or binary SSH
+// signature
+func IsSignature(blob []byte) bool {
+	return bytes.HasPrefix(blob, []byte("-----BEGIN "+sigPEMType+"-----")) ||
+		bytes.HasPrefix(blob, []byte(sigMagic))
+}
+
+// Parse an armored or binary SSH signature
+func Parse(blob []byte) (*Signature, error) {
+	if block, _ := pem.Decode(blob); block != nil {
+		if block.Type != sigPEMType {
+			return nil, fmt.Errorf("expected %s but found %s", sigPEMType, block.Type)
+		}
+		blob = block.Bytes
+	}
+	var raw sigBlob
+	if err := ssh.Unmarshal(blob, &raw); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if string(raw.Magic[:]) != sigMagic {
+		return nil, errors.New("invalid SSH signature: bad magic")
+	} else if raw.Version != sigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", raw.Version)
+	}
+	pub, err := ssh.ParsePublicKey(raw.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(raw.Signature, sig); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	return &Signature{
+		PublicKey:     pub,
+		Namespace:     raw.Namespace,
+		HashAlgorithm: raw.HashAlgorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// Hash returns the digest algorithm used to hash the message
+func (s *Signature) Hash() (crypto.Hash, error) {
+	for hash, name := range hashNames {
+		if name == s.HashAlgorithm {
+			return hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported SSH signature hash %q", s.HashAlgorithm)
+}
+
+// Verify the signature over the message read from r. If the signing key is a
+// certificate then the certificate's own key must have made the signature.
+func (s *Signature) Verify(r io.Reader, namespace string) error {
+	if namespace != "" && s.Namespace != namespace {
+		return fmt.Errorf("signature namespace %q does not match expected %q", s.Namespace, namespace)
+	}
+	hash, err := s.Hash()
+	if err != nil {
+		return err
+	}
+	if s.PublicKey.Type() == ssh.KeyAlgoRSA && s.Signature.Format == ssh.KeyAlgoRSA {
+		return errors.New("SSH signatures with SHA-1 RSA are not allowed")
+	}
+	d := hash.New()
+	if _, err := io.Copy(d, r); err != nil {
+		return err
+	}
+	if err := s.PublicKey.Verify(toSign(s.Namespace, s.HashAlgorithm, d.Sum(nil)), s.Signature); err != nil {
+		return fmt.Errorf("SSH signature is invalid: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package signssh
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// made with ssh-keygen -Y sign -n file
+const (
+	keygenPub = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIO11zImcsIAKARmR6BDbQdDQtgvkynItKAXbgbDS+ExF test"
+	keygenSig = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAg7XXMiZywgAoBGZHoENtB0NC2C+
+TKci0oBduBsNL4TEUAAAAEZmlsZQAAAAAAAAAGc2hhNTEyAAAAUwAAAAtzc2gtZWQyNTUx
+OQAAAEDcxPpb+IaSf0cqJRvCDUl1XtfQwe6Nd9mput/f1byt3NPU/faraQoNJY+ZDbKrDb
+H8Stsowiv3BNM+g9B5tH8M
+-----END SSH SIGNATURE-----
+`
+)
+
+func newTestSigner(t *testing.T, hash crypto.Hash) ssh.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := NewSigner(key, hash)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestSignCertificate(t *testing.T) {
+	ca := newTestSigner(t, crypto.SHA256)
+	user := newTestSigner(t, crypto.SHA256)
+	now := time.Unix(1700000000, 0)
+	cert, err := SignCertificate(user.PublicKey(), ca, CertificateOptions{
+		KeyID:       "alice@example.com",
+		Serial:      42,
+		Principals:  []string{"alice"},
+		ValidAfter:  now,
+		ValidBefore: now.Add(time.Hour),
+		Extensions:  map[string]string{"permit-pty": ""},
+	})
+	require.NoError(t, err)
+	require.NoError(t, VerifyCertificate(cert))
+	// round trip through the authorized_keys encoding
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey(ssh.MarshalAuthorizedKey(cert))
+	require.NoError(t, err)
+	pcert := parsed.(*ssh.Certificate)
+	require.NoError(t, VerifyCertificate(pcert))
+	assert.Equal(t, uint32(ssh.UserCert), pcert.CertType)
+	assert.Equal(t, "alice@example.com", pcert.KeyId)
+	assert.Equal(t, uint64(42), pcert.Serial)
+	// the stock checker accepts it too
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool { return bytes.Equal(auth.Marshal(), ca.PublicKey().Marshal()) },
+		Clock:           func() time.Time { return now.Add(time.Minute) },
+	}
+	require.NoError(t, checker.CheckCert("alice", pcert))
+	assert.Error(t, checker.CheckCert("bob", pcert))
+
+	pcert.KeyId = "mallory@example.com"
+	assert.Error(t, VerifyCertificate(pcert))
+
+	_, err = SignCertificate(cert, ca, CertificateOptions{})
+	assert.Error(t, err)
+	_, err = SignCertificate(user.PublicKey(), ca, CertificateOptions{Host: true, Extensions: map[string]string{"permit-pty": ""}})
+	assert.Error(t, err)
+	_, err = SignCertificate(user.PublicKey(), ca, CertificateOptions{ValidAfter: now, ValidBefore: now})
+	assert.Error(t, err)
+}
+
+func TestSignCertificateRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	user := newTestSigner(t, crypto.SHA256)
+	for hash, format := range map[crypto.Hash]string{
+		crypto.SHA256: ssh.KeyAlgoRSASHA256,
+		crypto.SHA512: ssh.KeyAlgoRSASHA512,
+	} {
+		ca, err := NewSigner(key, hash)
+		require.NoError(t, err)
+		cert, err := SignCertificate(user.PublicKey(), ca, CertificateOptions{Host: true, Principals: []string{"host.example.com"}})
+		require.NoError(t, err)
+		assert.Equal(t, format, cert.Signature.Format)
+		assert.Equal(t, uint32(ssh.HostCert), cert.CertType)
+		require.NoError(t, VerifyCertificate(cert))
+	}
+	_, err = NewSigner(key, crypto.SHA384)
+	assert.Error(t, err)
+}
+
+func TestSSHSig(t *testing.T) {
+	signer := newTestSigner(t, crypto.SHA512)
+	sig, err := Sign(strings.NewReader("hello\n"), signer, crypto.SHA512, "file")
+	require.NoError(t, err)
+	armored := sig.Armor()
+	assert.True(t, IsSignature(armored))
+	for _, line := range strings.Split(string(armored), "\n") {
+		assert.LessOrEqual(t, len(line), 70)
+	}
+	parsed, err := Parse(armored)
+	require.NoError(t, err)
+	require.NoError(t, parsed.Verify(strings.NewReader("hello\n"), "file"))
+	assert.Error(t, parsed.Verify(strings.NewReader("hello"), "file"))
+	assert.ErrorContains(t, parsed.Verify(strings.NewReader("hello\n"), "git"), "namespace")
+	// binary form
+	parsed, err = Parse(sig.Marshal())
+	require.NoError(t, err)
+	require.NoError(t, parsed.Verify(strings.NewReader("hello\n"), ""))
+
+	_, err = Sign(strings.NewReader("hello\n"), signer, crypto.SHA384, "file")
+	assert.Error(t, err)
+	_, err = Sign(strings.NewReader("hello\n"), signer, crypto.SHA512, "")
+	assert.Error(t, err)
+}
+
+func TestSSHSigKeygen(t *testing.T) {
+	sig, err := Parse([]byte(keygenSig))
+	require.NoError(t, err)
+	assert.Equal(t, "file", sig.Namespace)
+	assert.Equal(t, "sha512", sig.HashAlgorithm)
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keygenPub))
+	require.NoError(t, err)
+	assert.Equal(t, pub.Marshal(), sig.PublicKey.Marshal())
+	require.NoError(t, sig.Verify(strings.NewReader("hello\n"), "file"))
+	assert.Error(t, sig.Verify(strings.NewReader("goodbye\n"), "file"))
+}
+
+func TestAllowedSigners(t *testing.T) {
+	userSigner := newTestSigner(t, crypto.SHA256)
+	caSigner := newTestSigner(t, crypto.SHA256)
+	userKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(userSigner.PublicKey())))
+	caKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caSigner.PublicKey())))
+	allowed, err := ParseAllowedSigners(strings.NewReader(`
+# comment
+alice@example.com,!bob@example.com namespaces="file,git" ` + userKey + ` alice
+"*@example.com" cert-authority,valid-before="20300101Z" ` + caKey + `
+keygen@example.com ` + keygenPub + `
+`))
+	require.NoError(t, err)
+	require.Len(t, allowed, 3)
+	assert.Equal(t, []string{"file", "git"}, allowed[0].Namespaces)
+	assert.True(t, allowed[1].CertAuthority)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), allowed[1].ValidBefore)
+	now := time.Now()
+
+	sig, err := Sign(strings.NewReader("data"), userSigner, crypto.SHA256, "file")
+	require.NoError(t, err)
+	found, principal, err := sig.FindSigner(allowed, "", now)
+	require.NoError(t, err)
+	assert.Equal(t, allowed[0], found)
+	assert.Equal(t, "alice@example.com,!bob@example.com", principal)
+	_, principal, err = sig.FindSigner(allowed, "alice@example.com", now)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", principal)
+	_, _, err = sig.FindSigner(allowed, "bob@example.com", now)
+	assert.Error(t, err)
+	// namespace restriction
+	sig, err = Sign(strings.NewReader("data"), userSigner, crypto.SHA256, "email")
+	require.NoError(t, err)
+	_, _, err = sig.FindSigner(allowed, "", now)
+	assert.Error(t, err)
+
+	// a key certified by the CA
+	certified := newTestSigner(t, crypto.SHA256)
+	cert, err := SignCertificate(certified.PublicKey(), caSigner, CertificateOptions{
+		Principals:  []string{"carol", "carol@example.com"},
+		ValidAfter:  now.Add(-time.Minute),
+		ValidBefore: now.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	certSigner, err := ssh.NewCertSigner(cert, certified)
+	require.NoError(t, err)
+	sig, err = Sign(strings.NewReader("data"), certSigner, crypto.SHA256, "file")
+	require.NoError(t, err)
+	require.NoError(t, sig.Verify(strings.NewReader("data"), "file"))
+	found, principal, err = sig.FindSigner(allowed, "", now)
+	require.NoError(t, err)
+	assert.Equal(t, allowed[1], found)
+	assert.Equal(t, "carol@example.com", principal)
+	_, _, err = sig.FindSigner(allowed, "carol", now)
+	assert.Error(t, err)
+	_, _, err = sig.FindSigner(allowed, "", now.Add(2*time.Hour))
+	assert.Error(t, err)
+
+	_, err = ParseAllowedSigners(strings.NewReader("alice@example.com bogus=1 " + userKey))
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ParseAllowedSigners(strings.NewReader("alice@example.com"))
+	assert.Error(t, err)
+}
+
+func TestMatchList(t *testing.T) {
+	assert.True(t, matchList([]string{"*.example.com"}, "host.example.com"))
+	assert.True(t, matchList([]string{"host?"}, "host1"))
+	assert.False(t, matchList([]string{"host?"}, "host12"))
+	assert.False(t, matchList([]string{"*", "!root"}, "root"))
+	assert.True(t, matchList([]string{"*", "!root"}, "alice"))
+	assert.False(t, matchList([]string{"!root"}, "alice"))
+}
+
+func TestParseValidity(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		spec          string
+		after, before time.Time
+	}{
+		{"forever", time.Time{}, time.Time{}},
+		{"+52w", now, now.Add(52 * 7 * 24 * time.Hour)},
+		{"+1h30m", now, now.Add(90 * time.Minute)},
+		{"-1d:+1d", now.Add(-24 * time.Hour), now.Add(24 * time.Hour)},
+		{"20240101:20250101123000", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{"always:+3600", time.Time{}, now.Add(time.Hour)},
+		{"-5m:forever", now.Add(-5 * time.Minute), time.Time{}},
+	} {
+		after, before, err := ParseValidity(tc.spec, now)
+		require.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.after, after, tc.spec)
+		assert.Equal(t, tc.before, before, tc.spec)
+	}
+	for _, spec := range []string{"+", "+1y", "2024", "forever:always", "tomorrow"} {
+		_, _, err := ParseValidity(spec, now)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestIsCertificate(t *testing.T) {
+	assert.True(t, IsCertificate([]byte("ssh-ed25519-cert-v01@openssh.com AAAA")))
+	assert.False(t, IsCertificate([]byte(keygenPub)))
+	assert.False(t, IsCertificate([]byte(keygenSig)))
+}
+
+func TestFindAuthority(t *testing.T) {
+	caSigner := newTestSigner(t, crypto.SHA256)
+	caKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(caSigner.PublicKey())))
+	allowed, err := ParseAllowedSigners(strings.NewReader("*.example.com cert-authority " + caKey + "\n* " + caKey + "\n"))
+	require.NoError(t, err)
+	host := newTestSigner(t, crypto.SHA256)
+	now := time.Now()
+	for _, tc := range []struct {
+		principals []string
+		ok         bool
+	}{
+		{[]string{"web.example.com"}, true},
+		{[]string{"web.example.org", "db.example.com"}, true},
+		{[]string{"web.example.org"}, false},
+		{nil, false},
+	} {
+		cert, err := SignCertificate(host.PublicKey(), caSigner, CertificateOptions{Host: true, Principals: tc.principals})
+		require.NoError(t, err)
+		found, err := FindAuthority(allowed, cert, now)
+		if tc.ok {
+			require.NoError(t, err, tc.principals)
+			assert.Equal(t, allowed[0], found)
+		} else {
+			assert.Error(t, err, tc.principals)
+		}
+	}
+	// an entry trusting any name accepts a certificate without principals
+	allowed[0].Principals = []string{"*"}
+	cert, err := SignCertificate(host.PublicKey(), caSigner, CertificateOptions{Host: true})
+	require.NoError(t, err)
+	_, err = FindAuthority(allowed, cert, now)
+	assert.NoError(t, err)
+}
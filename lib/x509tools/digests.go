@@ -22,6 +22,8 @@ import (
 	"encoding/asn1"
 	"strings"
 	"sync"
+
+	_ "golang.org/x/crypto/sha3" // register SHA-3 with crypto.Hash
 )
 
 var (
@@ -33,24 +35,34 @@ var (
 	OidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
 	OidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
 	OidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	// RFC 8702
+	OidDigestSHA3_256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 8}
+	OidDigestSHA3_384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 9}
+	OidDigestSHA3_512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 10}
 )
 
 var HashOids = map[crypto.Hash]asn1.ObjectIdentifier{
-	crypto.MD5:    OidDigestMD5,
-	crypto.SHA1:   OidDigestSHA1,
-	crypto.SHA224: OidDigestSHA224,
-	crypto.SHA256: OidDigestSHA256,
-	crypto.SHA384: OidDigestSHA384,
-	crypto.SHA512: OidDigestSHA512,
+	crypto.MD5:      OidDigestMD5,
+	crypto.SHA1:     OidDigestSHA1,
+	crypto.SHA224:   OidDigestSHA224,
+	crypto.SHA256:   OidDigestSHA256,
+	crypto.SHA384:   OidDigestSHA384,
+	crypto.SHA512:   OidDigestSHA512,
+	crypto.SHA3_256: OidDigestSHA3_256,
+	crypto.SHA3_384: OidDigestSHA3_384,
+	crypto.SHA3_512: OidDigestSHA3_512,
 }
 
 var HashNames = map[crypto.Hash]string{
-	crypto.MD5:    "MD5",
-	crypto.SHA1:   "SHA1",
-	crypto.SHA224: "SHA-224",
-	crypto.SHA256: "SHA-256",
-	crypto.SHA384: "SHA-384",
-	crypto.SHA512: "SHA-512",
+	crypto.MD5:      "MD5",
+	crypto.SHA1:     "SHA1",
+	crypto.SHA224:   "SHA-224",
+	crypto.SHA256:   "SHA-256",
+	crypto.SHA384:   "SHA-384",
+	crypto.SHA512:   "SHA-512",
+	crypto.SHA3_256: "SHA3-256",
+	crypto.SHA3_384: "SHA3-384",
+	crypto.SHA3_512: "SHA3-512",
 }
 
 var (
@@ -0,0 +1,86 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package x509tools
+
+import (
+	"crypto"
+	"crypto/dsa" //nolint:staticcheck // HSM-resident DSA keys still need to be usable
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// UnsupportedKeyError is returned when a signature format has no way to
+// encode signatures made by the given kind of key
+type UnsupportedKeyError struct {
+	Key crypto.PublicKey
+}
+
+func (e UnsupportedKeyError) Error() string {
+	return fmt.Sprintf("%s keys are not supported for this type of signature", KeyAlgorithmName(e.Key))
+}
+
+// KeyAlgorithmName returns a human-readable name for the algorithm of a
+// public or private key. Key types from other packages can provide their own
+// name with an Algorithm() string method.
+func KeyAlgorithmName(key crypto.PublicKey) string {
+	if privkey, ok := key.(crypto.Signer); ok {
+		key = privkey.Public()
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "ECDSA"
+	case ed25519.PublicKey:
+		return "Ed25519"
+	case *dsa.PublicKey:
+		return "DSA"
+	case interface{ Algorithm() string }:
+		return k.Algorithm()
+	default:
+		return fmt.Sprintf("%T", key)
+	}
+}
+
+// Verify a DSA signature, which is encoded the same way as ECDSA ones
+func verifyDSA(pub *dsa.PublicKey, digest, sig []byte) error {
+	dsig, err := UnmarshalEcdsaSignature(sig)
+	if err != nil {
+		return err
+	}
+	// FIPS 186-3 uses the leftmost bits of the digest
+	if n := (pub.Q.BitLen() + 7) / 8; len(digest) > n {
+		digest = digest[:n]
+	}
+	if !dsa.Verify(pub, digest, dsig.R, dsig.S) {
+		return errors.New("DSA verification failed")
+	}
+	return nil
+}
+
+func sameDSAKey(key1 *dsa.PublicKey, pub2 crypto.PublicKey) bool {
+	key2, ok := pub2.(*dsa.PublicKey)
+	return ok && bigEqual(key1.Y, key2.Y) && bigEqual(key1.P, key2.P) && bigEqual(key1.Q, key2.Q) && bigEqual(key1.G, key2.G)
+}
+
+func bigEqual(a, b *big.Int) bool {
+	return a.Cmp(b) == 0
+}
@@ -0,0 +1,49 @@
+package x509tools_test
+
+import (
+	"crypto"
+	"crypto/dsa" //nolint:staticcheck
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDSA(t *testing.T) {
+	t.Parallel()
+	var priv dsa.PrivateKey
+	require.NoError(t, dsa.GenerateParameters(&priv.Parameters, rand.Reader, dsa.L1024N160))
+	require.NoError(t, dsa.GenerateKey(&priv, rand.Reader))
+	pub := &priv.PublicKey
+
+	digestAlg, sigAlg, err := x509tools.PkixAlgorithms(pub, crypto.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, x509tools.OidPublicKeyDSA, sigAlg.Algorithm)
+	assert.Empty(t, sigAlg.Parameters.FullBytes)
+
+	// the digest is longer than the subgroup order so only the leftmost bits are signed
+	digest := sha256.Sum256([]byte("hello"))
+	r, s, err := dsa.Sign(rand.Reader, &priv, digest[:20])
+	require.NoError(t, err)
+	sig := x509tools.EcdsaSignature{R: r, S: s}.Marshal()
+	assert.NoError(t, x509tools.PkixVerify(pub, digestAlg, sigAlg, digest[:], sig))
+	assert.NoError(t, x509tools.Verify(pub, crypto.SHA256, digest[:], sig))
+	digest[0] ^= 1
+	assert.Error(t, x509tools.PkixVerify(pub, digestAlg, sigAlg, digest[:], sig))
+
+	assert.True(t, x509tools.SameKey(pub, &priv.PublicKey))
+	other := priv.PublicKey
+	other.Y = new(big.Int).Add(other.Y, big.NewInt(1))
+	assert.False(t, x509tools.SameKey(pub, &other))
+}
+
+func TestUnsupportedKey(t *testing.T) {
+	t.Parallel()
+	_, _, err := x509tools.PkixAlgorithms(ed25519.PublicKey{}, crypto.SHA256)
+	assert.EqualError(t, err, "Ed25519 keys are not supported for this type of signature")
+}
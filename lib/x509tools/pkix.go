@@ -18,6 +18,7 @@ package x509tools
 
 import (
 	"crypto"
+	"crypto/dsa" //nolint:staticcheck
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
@@ -46,6 +47,14 @@ var (
 	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
 	oidISOSignatureSHA1WithRSA  = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 29}
 
+	// NIST CSOR
+	oidSignatureSHA3_256WithRSA   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 14}
+	oidSignatureSHA3_384WithRSA   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 15}
+	oidSignatureSHA3_512WithRSA   = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 16}
+	oidSignatureECDSAWithSHA3_256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 10}
+	oidSignatureECDSAWithSHA3_384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 11}
+	oidSignatureECDSAWithSHA3_512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 12}
+
 	// RFC 4055
 	OidMGF1            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
 	OidSignatureRSAPSS = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
@@ -83,6 +92,12 @@ var sigAlgInfos = []sigAlgInfo{
 	{oidSignatureECDSAWithSHA256, x509.ECDSA, crypto.SHA256},
 	{oidSignatureECDSAWithSHA384, x509.ECDSA, crypto.SHA384},
 	{oidSignatureECDSAWithSHA512, x509.ECDSA, crypto.SHA512},
+	{oidSignatureSHA3_256WithRSA, x509.RSA, crypto.SHA3_256},
+	{oidSignatureSHA3_384WithRSA, x509.RSA, crypto.SHA3_384},
+	{oidSignatureSHA3_512WithRSA, x509.RSA, crypto.SHA3_512},
+	{oidSignatureECDSAWithSHA3_256, x509.ECDSA, crypto.SHA3_256},
+	{oidSignatureECDSAWithSHA3_384, x509.ECDSA, crypto.SHA3_384},
+	{oidSignatureECDSAWithSHA3_512, x509.ECDSA, crypto.SHA3_512},
 }
 
 // Given a public key and signer options, return the appropriate X.509 digest and signature algorithms
@@ -114,8 +129,12 @@ func PkixAlgorithms(pub crypto.PublicKey, opts crypto.SignerOpts) (digestAlg, si
 		sigAlg.Algorithm = OidPublicKeyRSA
 	case *ecdsa.PublicKey:
 		sigAlg.Algorithm = OidPublicKeyECDSA
+	case *dsa.PublicKey:
+		// RFC 3370: parameters must be absent
+		sigAlg.Algorithm = OidPublicKeyDSA
+		return
 	default:
-		err = errors.New("unsupported public key algorithm")
+		err = UnsupportedKeyError{Key: pub}
 		return
 	}
 	sigAlg.Parameters = asn1.NullRawValue
@@ -126,7 +145,12 @@ func PkixAlgorithms(pub crypto.PublicKey, opts crypto.SignerOpts) (digestAlg, si
 func PkixDigestAlgorithm(hash crypto.Hash) (alg pkix.AlgorithmIdentifier, ok bool) {
 	if oid, ok2 := HashOids[hash]; ok2 {
 		alg.Algorithm = oid
-		alg.Parameters = asn1.NullRawValue
+		switch hash {
+		case crypto.SHA3_256, crypto.SHA3_384, crypto.SHA3_512:
+			// RFC 8702: parameters must be absent
+		default:
+			alg.Parameters = asn1.NullRawValue
+		}
 		ok = true
 	}
 	return
@@ -199,6 +223,12 @@ func PkixVerify(pub crypto.PublicKey, digestAlg, sigAlg pkix.AlgorithmIdentifier
 			return errors.New("ECDSA verification failed")
 		}
 		return nil
+	case x509.DSA:
+		key, ok := pub.(*dsa.PublicKey)
+		if !ok {
+			return errors.New("incorrect key type for signature")
+		}
+		return verifyDSA(key, digest, sig)
 	default:
 		return errors.New("unsupported public key algorithm")
 	}
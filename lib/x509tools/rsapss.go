@@ -24,6 +24,21 @@ import (
 	"errors"
 )
 
+// PSSSigner wraps a RSA private key to indicate that signatures made with it
+// should use PSS padding when the format allows it
+type PSSSigner struct {
+	crypto.Signer
+}
+
+// SignerOpts converts a bare digest into RSA-PSS options with a salt the same
+// length as the digest
+func (PSSSigner) SignerOpts(opts crypto.SignerOpts) crypto.SignerOpts {
+	if hash, ok := opts.(crypto.Hash); ok {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	return opts
+}
+
 // pssParameters reflects the parameters in an AlgorithmIdentifier that
 // specifies RSA PSS. See https://tools.ietf.org/html/rfc3447#appendix-A.2.3
 type pssParameters struct {
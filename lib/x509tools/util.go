@@ -18,7 +18,9 @@ package x509tools
 
 import (
 	"crypto"
+	"crypto/dsa" //nolint:staticcheck
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -27,8 +29,10 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
+	"strings"
 )
 
 // Make a random 12 byte big.Int
@@ -58,6 +62,8 @@ func X509SignatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
 			return x509.ECDSAWithSHA512
 		}
 		return x509.ECDSAWithSHA256
+	case ed25519.PublicKey:
+		return x509.PureEd25519
 	default:
 		return x509.UnknownSignatureAlgorithm
 	}
@@ -85,6 +91,15 @@ func SubjectKeyID(pub crypto.PublicKey) ([]byte, error) {
 	return digest[:], nil
 }
 
+// FormatKeyID formats a token key ID (CKA_ID) as colon-separated hex bytes
+func FormatKeyID(keyID []byte) string {
+	chunks := make([]string, len(keyID))
+	for i, j := range keyID {
+		chunks[i] = fmt.Sprintf("%02x", j)
+	}
+	return strings.Join(chunks, ":")
+}
+
 // Test whether two public or private keys have the same public key
 func SameKey(pub1, pub2 interface{}) bool {
 	if privkey, ok := pub1.(crypto.Signer); ok {
@@ -100,12 +115,18 @@ func SameKey(pub1, pub2 interface{}) bool {
 	case *ecdsa.PublicKey:
 		key2, ok := pub2.(*ecdsa.PublicKey)
 		return ok && key1.X.Cmp(key2.X) == 0 && key1.Y.Cmp(key2.Y) == 0
+	case ed25519.PublicKey:
+		return key1.Equal(pub2)
+	case *dsa.PublicKey:
+		return sameDSAKey(key1, pub2)
+	case interface{ Equal(crypto.PublicKey) bool }:
+		return key1.Equal(pub2)
 	default:
 		return false
 	}
 }
 
-// Verify an RSA or ECDSA signature
+// Verify an RSA, ECDSA or DSA signature
 func Verify(pub interface{}, hash crypto.Hash, hashed []byte, sig []byte) error {
 	switch pubk := pub.(type) {
 	case *rsa.PublicKey:
@@ -119,8 +140,10 @@ func Verify(pub interface{}, hash crypto.Hash, hashed []byte, sig []byte) error
 			return errors.New("ECDSA verification failed")
 		}
 		return nil
+	case *dsa.PublicKey:
+		return verifyDSA(pubk, hashed, sig)
 	}
-	return errors.New("unsupported public key algorithm")
+	return UnsupportedKeyError{Key: pub}
 }
 
 // Determine the type of a public or private key
@@ -133,6 +156,8 @@ func GetPublicKeyAlgorithm(key interface{}) x509.PublicKeyAlgorithm {
 		return x509.RSA
 	case *ecdsa.PublicKey:
 		return x509.ECDSA
+	case *dsa.PublicKey:
+		return x509.DSA
 	default:
 		return x509.UnknownPublicKeyAlgorithm
 	}
@@ -23,5 +23,10 @@ func TestSignatureAlgorithm(t *testing.T) {
 	assert.Equal(t, x509.ECDSAWithSHA384, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P384()}))
 	assert.Equal(t, x509.ECDSAWithSHA512, x509tools.X509SignatureAlgorithm(&ecdsa.PublicKey{Curve: elliptic.P521()}))
 
-	assert.Equal(t, x509.UnknownSignatureAlgorithm, x509tools.X509SignatureAlgorithm(ed25519.PublicKey{}))
+	assert.Equal(t, x509.PureEd25519, x509tools.X509SignatureAlgorithm(ed25519.PublicKey{}))
+}
+
+func TestFormatKeyID(t *testing.T) {
+	assert.Equal(t, "01:ab:ff", x509tools.FormatKeyID([]byte{0x01, 0xab, 0xff}))
+	assert.Equal(t, "", x509tools.FormatKeyID(nil))
 }
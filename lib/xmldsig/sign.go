@@ -204,7 +204,7 @@ func hashAlgs(hash crypto.Hash, pubKey crypto.PublicKey, opts SignOptions) (stri
 	case *ecdsa.PublicKey:
 		pubName = "ecdsa"
 	default:
-		return "", "", errors.New("unsupported key type")
+		return "", "", x509tools.UnsupportedKeyError{Key: pubKey}
 	}
 	var hashAlg, sigAlg string
 	if opts.MsCompatHashNames {
@@ -35,6 +35,9 @@ const (
 // the best thing about namespaces is there are so many to choose from
 var nsPrefixes = []string{NsXMLDsig, NsXMLDsigMore, NsXMLEnc}
 
+// Hashes lists the digest algorithms that can be used in XML signatures
+var Hashes = []crypto.Hash{crypto.SHA1, crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
 var hashNames = map[crypto.Hash]string{
 	crypto.SHA1:   "sha1",
 	crypto.SHA224: "sha224",
@@ -115,7 +115,11 @@ func (f *File) readDataDesc() error {
 	if desc.Signature != dataDescriptorSignature {
 		return errors.New("data descriptor signature is missing")
 	}
-	if f.UncompressedSize >= uint32Max || desc.UncompressedSize != uint32(f.UncompressedSize) || desc.CompressedSize != uint32(f.CompressedSize) {
+	// Empty entries written by older versions of this package had a 64-bit
+	// descriptor that reads the same as a 32-bit one, but those always
+	// declared version 4.5.
+	ambiguous := f.CompressedSize == 0 && f.UncompressedSize == 0 && f.ReaderVersion >= zip45
+	if f.UncompressedSize >= uint32Max || desc.UncompressedSize != uint32(f.UncompressedSize) || desc.CompressedSize != uint32(f.CompressedSize) || ambiguous {
 		// 64-bit
 		if _, err := f.r.ReadAt(f.ddb[dataDescriptorLen:], pos+dataDescriptorLen); err != nil {
 			return err
@@ -169,7 +173,7 @@ func (f *File) GetDirectoryHeader() ([]byte, error) {
 		}
 		b := bytes.NewBuffer(make([]byte, 0, zip64ExtraLen+4+len(f.Extra)))
 		_ = binary.Write(b, binary.LittleEndian, extra)
-		b.Write(f.Extra)
+		b.Write(stripZip64Extra(f.Extra))
 		f.Extra = b.Bytes()
 		hdr.ExtraLen = uint16(b.Len())
 		hdr.ReaderVersion = zip45
@@ -182,6 +186,24 @@ func (f *File) GetDirectoryHeader() ([]byte, error) {
 	return b.Bytes(), nil
 }
 
+// Remove the ZIP64 field from an extra block so that it can be regenerated
+// without duplicating it
+func stripZip64Extra(extra []byte) []byte {
+	var out []byte
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra[:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if size > len(extra)-4 {
+			break
+		}
+		if tag != zip64ExtraID {
+			out = append(out, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	return append(out, extra...)
+}
+
 func (f *File) GetLocalHeader() ([]byte, error) {
 	if err := f.readLocalHeader(); err != nil {
 		return nil, err
@@ -249,9 +271,12 @@ func (d *Directory) NewFile(name string, extra, contents []byte, w io.Writer, mt
 		lfhExtra: extra,
 		compd:    fb.Bytes(),
 	}
+	desc64 := uint64(fb.Len()) >= uint32Max || uint64(len(contents)) >= uint32Max
 	if useDesc {
 		f.Flags = 0x8
-		f.ReaderVersion = zip45
+		if desc64 {
+			f.ReaderVersion = zip45
+		}
 	}
 	f.lfh = zipLocalHeader{
 		Signature:     fileHeaderSignature,
@@ -281,14 +306,22 @@ func (d *Directory) NewFile(name string, extra, contents []byte, w io.Writer, mt
 		return nil, err
 	}
 	if useDesc {
-		desc := zipDataDesc64{
-			Signature:        dataDescriptorSignature,
-			CRC32:            sum,
-			CompressedSize:   uint64(fb.Len()),
-			UncompressedSize: uint64(len(contents)),
-		}
 		ddb := bytes.NewBuffer(make([]byte, 0, dataDescriptor64Len))
-		_ = binary.Write(ddb, binary.LittleEndian, desc)
+		if desc64 {
+			_ = binary.Write(ddb, binary.LittleEndian, zipDataDesc64{
+				Signature:        dataDescriptorSignature,
+				CRC32:            sum,
+				CompressedSize:   uint64(fb.Len()),
+				UncompressedSize: uint64(len(contents)),
+			})
+		} else {
+			_ = binary.Write(ddb, binary.LittleEndian, zipDataDesc{
+				Signature:        dataDescriptorSignature,
+				CRC32:            sum,
+				CompressedSize:   uint32(fb.Len()),
+				UncompressedSize: uint32(len(contents)),
+			})
+		}
 		f.ddb = ddb.Bytes()
 		if _, err := buf.Write(f.ddb); err != nil {
 			return nil, err
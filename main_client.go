@@ -25,28 +25,11 @@ import (
 	"github.com/sassoftware/relic/v8/cmdline/shared"
 	"github.com/sassoftware/relic/v8/config"
 
+	_ "github.com/sassoftware/relic/v8/cmdline/configcmd"
 	_ "github.com/sassoftware/relic/v8/cmdline/remotecmd"
 	_ "github.com/sassoftware/relic/v8/cmdline/verify"
 
-	_ "github.com/sassoftware/relic/v8/signers/apk"
-	_ "github.com/sassoftware/relic/v8/signers/appmanifest"
-	_ "github.com/sassoftware/relic/v8/signers/appx"
-	_ "github.com/sassoftware/relic/v8/signers/cab"
-	_ "github.com/sassoftware/relic/v8/signers/cat"
-	_ "github.com/sassoftware/relic/v8/signers/cosign"
-	_ "github.com/sassoftware/relic/v8/signers/deb"
-	_ "github.com/sassoftware/relic/v8/signers/dmg"
-	_ "github.com/sassoftware/relic/v8/signers/jar"
-	_ "github.com/sassoftware/relic/v8/signers/macho"
-	_ "github.com/sassoftware/relic/v8/signers/msi"
-	_ "github.com/sassoftware/relic/v8/signers/pecoff"
-	_ "github.com/sassoftware/relic/v8/signers/pgp"
-	_ "github.com/sassoftware/relic/v8/signers/pkcs"
-	_ "github.com/sassoftware/relic/v8/signers/ps"
-	_ "github.com/sassoftware/relic/v8/signers/rpm"
-	_ "github.com/sassoftware/relic/v8/signers/vsix"
-	_ "github.com/sassoftware/relic/v8/signers/xap"
-	_ "github.com/sassoftware/relic/v8/signers/xar"
+	_ "github.com/sassoftware/relic/v8/signers/all"
 )
 
 var (
@@ -0,0 +1,89 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rs/zerolog/hlog"
+
+	"github.com/sassoftware/relic/v8/internal/authmodel"
+	"github.com/sassoftware/relic/v8/internal/signinit"
+	"github.com/sassoftware/relic/v8/internal/zhttp"
+	"github.com/sassoftware/relic/v8/lib/audit"
+)
+
+func (s *Server) openAuditSink() error {
+	aconf := s.Config.Server.Audit
+	if aconf == nil {
+		return nil
+	}
+	sink, err := audit.NewSink(aconf)
+	if err != nil {
+		return err
+	}
+	if aconf.SigningKey != "" {
+		keyConf, err := s.Config.GetKey(aconf.SigningKey)
+		if err != nil {
+			sink.Close()
+			return err
+		}
+		cert, _, err := signinit.InitKey(context.Background(), s.tokens[keyConf.Token], aconf.SigningKey)
+		if err != nil {
+			sink.Close()
+			return err
+		}
+		sink = audit.SignedSink(sink, cert.Signer())
+	}
+	s.auditSink = sink
+	return nil
+}
+
+// Send an audit record to the legacy AMQP and file destinations as well as
+// the configured sink
+func (s *Server) publishAudit(info *audit.Info) error {
+	if err := signinit.PublishAudit(info); err != nil {
+		return err
+	}
+	if s.auditSink != nil {
+		return s.auditSink.Send(info.Event())
+	}
+	return nil
+}
+
+// Record a sign request that didn't produce a signature. Errors are logged
+// since the request is failing regardless.
+func (s *Server) auditFailure(request *http.Request, info *audit.Info, err error) {
+	info.Attributes["sig.error"] = err.Error()
+	if err := s.publishAudit(info); err != nil {
+		hlog.FromRequest(request).Err(err).Msg("failed to audit failed request")
+	}
+}
+
+// Record a sign request that was refused because the client lacks a role for
+// the key
+func (s *Server) auditDenied(request *http.Request, userInfo authmodel.UserInfo, keyName, sigType, filename string) {
+	info := audit.New(keyName, sigType, 0)
+	info.Attributes["sig.denied"] = true
+	info.Attributes["client.ip"] = zhttp.StripPort(request.RemoteAddr)
+	info.Attributes["client.filename"] = filename
+	userInfo.AuditContext(info)
+	if err := s.publishAudit(info); err != nil {
+		hlog.FromRequest(request).Err(err).Msg("failed to audit denied request")
+	}
+}
@@ -29,8 +29,8 @@ import (
 
 	"golang.org/x/net/http2"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/internal/activation"
@@ -41,9 +41,12 @@ import (
 )
 
 type Daemon struct {
+	config     *config.Config
 	server     *server.Server
 	httpServer *http.Server
+	grpcServer *grpc.Server
 	listeners  []net.Listener
+	grpc       net.Listener
 	metrics    net.Listener
 	addrs      []string
 	eg         errgroup.Group
@@ -112,6 +115,14 @@ func New(config *config.Config, test bool) (*Daemon, error) {
 			return nil, err
 		}
 	}
+	var grpcServer *grpc.Server
+	if config.Server.ListenGRPC != "" {
+		tconf, err := makeTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		grpcServer = srv.GRPCServer(tconf)
+	}
 	if test {
 		srv.Close()
 		return nil, nil
@@ -150,13 +161,26 @@ func New(config *config.Config, test bool) (*Daemon, error) {
 		if err != nil {
 			return nil, err
 		}
+		index++
+	}
+	// open gRPC listener. TLS is done by the gRPC server.
+	var grpcListener net.Listener
+	if grpcServer != nil {
+		grpcListener, err = activation.GetListener(index, "tcp", config.Server.ListenGRPC)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, "grpc://"+grpcListener.Addr().String())
 		// index++
 	}
 	return &Daemon{
+		config:     config,
 		server:     srv,
 		httpServer: httpServer,
+		grpcServer: grpcServer,
 		listeners:  listeners,
 		metrics:    metricsListener,
+		grpc:       grpcListener,
 		addrs:      addrs,
 	}, nil
 }
@@ -173,10 +197,15 @@ func (d *Daemon) Serve() error {
 			return err
 		})
 	}
+	if d.grpc != nil {
+		d.eg.Go(func() error {
+			return d.grpcServer.Serve(d.grpc)
+		})
+	}
 	log.Info().Strs("urls", d.addrs).Msg("listening for requests")
 	if d.metrics != nil {
 		srv := &http.Server{
-			Handler:      promhttp.Handler(),
+			Handler:      d.server.Metrics.Handler(),
 			ReadTimeout:  10 * time.Second,
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  65 * time.Second,
@@ -196,9 +225,39 @@ func (d *Daemon) Close() error {
 	// calls to return immediately and we need something to keep blocking until
 	// all ongoing requests are done and Shutdown() returns
 	d.eg.Go(func() error {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		d.server.StartDraining()
+		if delay := time.Duration(d.config.Server.DrainDelay) * time.Second; delay > 0 {
+			log.Info().Dur("delay", delay).Msg("waiting for load balancers to notice draining")
+			time.Sleep(delay)
+		}
+		timeout := time.Duration(d.config.Server.ShutdownTimeout) * time.Second
+		if n := d.server.InFlight(); n > 0 {
+			log.Info().Int("requests", n).Dur("timeout", timeout).Msg("waiting for in-flight requests to finish")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
+		var grpcDone chan struct{}
+		if d.grpcServer != nil {
+			grpcDone = make(chan struct{})
+			go func() {
+				d.grpcServer.GracefulStop()
+				close(grpcDone)
+			}()
+		}
 		err := d.httpServer.Shutdown(ctx)
+		if grpcDone != nil {
+			select {
+			case <-grpcDone:
+			case <-ctx.Done():
+				// cancel the remaining calls, which also ends GracefulStop
+				d.grpcServer.Stop()
+				<-grpcDone
+				err = ctx.Err()
+			}
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			d.server.LogAbandoned()
+		}
 		err2 := d.server.Close()
 		if err == nil {
 			err = err2
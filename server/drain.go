@@ -0,0 +1,115 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sassoftware/relic/v8/internal/zhttp"
+)
+
+type inflightRequest struct {
+	start  time.Time
+	method string
+	path   string
+	key    string
+	client string
+}
+
+// requestTracker remembers which requests are in progress so the ones cut off
+// by a shutdown can be reported
+type requestTracker struct {
+	draining atomic.Bool
+
+	mu       sync.Mutex
+	nextID   uint64
+	inflight map[uint64]inflightRequest
+}
+
+func (t *requestTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		done := t.track(inflightRequest{
+			start:  time.Now(),
+			method: req.Method,
+			path:   req.URL.Path,
+			key:    req.URL.Query().Get("key"),
+			client: zhttp.StripPort(req.RemoteAddr),
+		})
+		defer done()
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// track records a request as in progress until the returned function is called
+func (t *requestTracker) track(info inflightRequest) func() {
+	t.mu.Lock()
+	if t.inflight == nil {
+		t.inflight = make(map[uint64]inflightRequest)
+	}
+	id := t.nextID
+	t.nextID++
+	t.inflight[id] = info
+	t.mu.Unlock()
+	return func() {
+		t.mu.Lock()
+		delete(t.inflight, id)
+		t.mu.Unlock()
+	}
+}
+
+// StartDraining makes the health check fail with "draining" so load balancers
+// stop sending new requests
+func (s *Server) StartDraining() {
+	if !s.requests.draining.Swap(true) {
+		log.Info().Msg("draining: health check now reports unavailable")
+	}
+}
+
+// Draining returns true once a shutdown has started
+func (s *Server) Draining() bool {
+	return s.requests.draining.Load()
+}
+
+// InFlight returns the number of requests currently being served
+func (s *Server) InFlight() int {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return len(s.requests.inflight)
+}
+
+// LogAbandoned logs each request that is still running, for use when the
+// shutdown timeout has elapsed
+func (s *Server) LogAbandoned() {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	for _, info := range s.requests.inflight {
+		ev := log.Error().
+			Str("method", info.method).
+			Str("path", info.path).
+			Str("client", info.client).
+			Dur("elapsed", time.Since(info.start))
+		if info.key != "" {
+			ev.Str("key", info.key)
+		}
+		ev.Msg("abandoned in-flight request at shutdown")
+	}
+}
@@ -0,0 +1,426 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sassoftware/relic/v8/internal/authmodel"
+	"github.com/sassoftware/relic/v8/internal/httperror"
+	"github.com/sassoftware/relic/v8/internal/zhttp"
+	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/server/grpcapi"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+// size of the chunks that signatures are returned in
+const grpcChunkSize = 256 * 1024
+
+// GRPCServer returns a gRPC server offering the same services as Handler.
+// Callers are authenticated by the same Authenticator, which is handed a
+// request made up from the TLS connection and call metadata.
+func (s *Server) GRPCServer(tconf *tls.Config) *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tconf)),
+		grpc.ChainUnaryInterceptor(s.grpcUnary),
+		grpc.ChainStreamInterceptor(s.grpcStream),
+	)
+	grpcapi.RegisterRelicServer(srv, &grpcService{s: s})
+	return srv
+}
+
+type grpcService struct {
+	grpcapi.UnimplementedRelicServer
+	s *Server
+}
+
+type grpcRequestKey struct{}
+
+func (s *Server) grpcUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, done, err := s.grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	done(err)
+	return resp, err
+}
+
+func (s *Server) grpcStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done, err := s.grpcAuthenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(srv, contextStream{ServerStream: stream, ctx: ctx})
+	done(err)
+	return err
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// Build a HTTP request describing a call so that the authenticator, audit
+// and logging used by the HTTP API can be applied to it, and authenticate
+// it. Ping is allowed without authentication, like /health. The returned
+// function logs the outcome and must be called when the call is finished.
+func (s *Server) grpcAuthenticate(ctx context.Context, method string) (context.Context, func(error), error) {
+	start := time.Now()
+	req := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: method},
+		Header:     make(http.Header),
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			req.TLS = &tlsInfo.State
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for name, values := range md {
+			for _, value := range values {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+	logger := log.Logger.With().
+		Str("method", method).
+		Str("ip", zhttp.StripPort(req.RemoteAddr)).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	req = req.WithContext(ctx)
+	if method != grpcapi.Relic_Ping_FullMethodName {
+		info, err := s.auth.Authenticate(req)
+		if err != nil {
+			logger.Info().Err(err).Msg("gRPC authentication failed")
+			return nil, nil, grpcError(err, codes.Unauthenticated)
+		} else if info == nil {
+			panic("authenticator returned nil without an error")
+		}
+		ctx = authmodel.WithUserInfo(ctx, info)
+	}
+	req = req.WithContext(ctx)
+	ctx = context.WithValue(ctx, grpcRequestKey{}, req)
+	untrack := s.requests.track(inflightRequest{
+		start:  start,
+		method: "gRPC",
+		path:   method,
+		client: zhttp.StripPort(req.RemoteAddr),
+	})
+	done := func(err error) {
+		untrack()
+		if method == grpcapi.Relic_Ping_FullMethodName && err == nil {
+			return
+		}
+		logger.Info().
+			Str("code", status.Code(err).String()).
+			Dur("dur", time.Since(start)).
+			Msg("gRPC request")
+	}
+	return ctx, done, nil
+}
+
+// Get the request made by grpcAuthenticate
+func grpcRequest(ctx context.Context) *http.Request {
+	req, ok := ctx.Value(grpcRequestKey{}).(*http.Request)
+	if !ok {
+		panic("request missing from gRPC context")
+	}
+	return req
+}
+
+// Convert a handler error to a gRPC status, using the HTTP status of API
+// problems to choose the code
+func grpcError(err error, fallback codes.Code) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var problem httperror.Problem
+	var problemPtr *httperror.Problem
+	if h := errToProblem(err); h != nil {
+		problem, _ = h.(httperror.Problem)
+	} else if errors.As(err, &problemPtr) {
+		problem = *problemPtr
+	} else if !errors.As(err, &problem) {
+		return status.Error(fallback, err.Error())
+	}
+	msg := problem.Detail
+	if msg == "" {
+		msg = problem.Title
+	}
+	var code codes.Code
+	switch problem.Status {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusTooManyRequests:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	default:
+		code = fallback
+	}
+	return status.Error(code, msg)
+}
+
+func (g *grpcService) Ping(ctx context.Context, req *grpcapi.PingRequest) (*grpcapi.PingResponse, error) {
+	if g.s.Draining() {
+		return &grpcapi.PingResponse{Status: "draining"}, nil
+	} else if !g.s.Healthy(grpcRequest(ctx)) {
+		return nil, status.Error(codes.Unavailable, "health check failed")
+	}
+	return &grpcapi.PingResponse{Status: "OK"}, nil
+}
+
+func (g *grpcService) ListKeys(ctx context.Context, req *grpcapi.ListKeysRequest) (*grpcapi.ListKeysResponse, error) {
+	userInfo := authmodel.RequestInfo(grpcRequest(ctx))
+	keys := []string{}
+	for key, keyConf := range g.s.Config.Keys {
+		if !keyConf.Hide && g.s.keyAllowed(userInfo, keyConf) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return &grpcapi.ListKeysResponse{Keys: keys}, nil
+}
+
+func (g *grpcService) Sign(stream grpcapi.Relic_SignServer) error {
+	request := grpcRequest(stream.Context())
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "missing header")
+	} else if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "first message must be a header")
+	} else if header.Key == "" {
+		return grpcError(httperror.MissingParameterError("key"), codes.InvalidArgument)
+	} else if header.Filename == "" {
+		return grpcError(httperror.MissingParameterError("filename"), codes.InvalidArgument)
+	}
+	query := make(url.Values, len(header.Params))
+	for name, value := range header.Params {
+		query.Set(name, value)
+	}
+	p := signParams{
+		keyName:    header.Key,
+		filename:   header.Filename,
+		sigType:    header.SigType,
+		digest:     header.Digest,
+		digestOnly: header.DigestOnly,
+		query:      query,
+	}
+	body := &chunkReader{recv: func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		} else if msg.GetHeader() != nil {
+			return nil, status.Error(codes.InvalidArgument, "header sent twice")
+		}
+		return msg.GetChunk(), nil
+	}}
+	blob, mimeType, err := g.s.signPackage(request, p, body)
+	if err != nil {
+		return grpcError(err, codes.Internal)
+	}
+	resp := &grpcapi.SignResponse{ContentType: mimeType}
+	for {
+		n := len(blob)
+		if n > grpcChunkSize {
+			n = grpcChunkSize
+		}
+		resp.Chunk = blob[:n]
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		blob = blob[n:]
+		if len(blob) == 0 {
+			return nil
+		}
+		resp = new(grpcapi.SignResponse)
+	}
+}
+
+func (g *grpcService) Verify(stream grpcapi.Relic_VerifyServer) error {
+	request := grpcRequest(stream.Context())
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "missing header")
+	} else if err != nil {
+		return err
+	}
+	header := first.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "first message must be a header")
+	}
+	// most formats need to seek
+	f, err := os.CreateTemp("", "relic-verify-")
+	if err != nil {
+		return grpcError(err, codes.Internal)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	body := &chunkReader{recv: func() ([]byte, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		} else if msg.GetHeader() != nil {
+			return nil, status.Error(codes.InvalidArgument, "header sent twice")
+		}
+		return msg.GetChunk(), nil
+	}}
+	if _, err := io.Copy(f, body); err != nil {
+		return grpcError(err, codes.Internal)
+	}
+	sigs, err := verifyFile(f, signers.VerifyOpts{
+		FileName:  header.Filename,
+		NoDigests: header.NoDigests,
+		NoChain:   true,
+	})
+	if err != nil {
+		hlog.FromRequest(request).Info().Err(err).Str("filename", header.Filename).Msg("verify failed")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := new(grpcapi.VerifyResponse)
+	for _, sig := range sigs {
+		resp.Signatures = append(resp.Signatures, grpcSignature(sig))
+	}
+	return stream.SendAndClose(resp)
+}
+
+// Detect the type of a file and check the signatures in it, without building
+// certificate chains
+func verifyFile(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	fileType, compression := magic.DetectCompressed(f)
+	opts.Compression = compression
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	mod := signers.ByMagic(fileType)
+	if mod == nil && opts.FileName != "" {
+		mod = signers.ByFileName(opts.FileName)
+		if mod != nil && mod.VerifyStream == nil {
+			opts.Compression = magic.CompressedNone
+		}
+	}
+	if mod == nil {
+		return nil, errors.New("unknown filetype")
+	} else if mod.VerifyStream != nil {
+		r, err := magic.Decompress(f, opts.Compression)
+		if err != nil {
+			return nil, err
+		}
+		return mod.VerifyStream(r, opts)
+	} else if mod.Verify != nil {
+		if opts.Compression != magic.CompressedNone {
+			return nil, errors.New("cannot verify compressed file")
+		}
+		return mod.Verify(f, opts)
+	}
+	return nil, fmt.Errorf("%s signatures cannot be verified", mod.Name)
+}
+
+func grpcSignature(sig *signers.Signature) *grpcapi.Signature {
+	ret := &grpcapi.Signature{
+		Package: sig.Package,
+		SigInfo: sig.SigInfo,
+		Signer:  sig.SignerName(),
+	}
+	if sig.Hash != 0 {
+		ret.Digest = sig.Hash.String()
+	}
+	if !sig.CreationTime.IsZero() {
+		ret.SigningTime = timestamppb.New(sig.CreationTime)
+	}
+	if xs := sig.X509Signature; xs != nil {
+		ret.Certificates = append(ret.Certificates, xs.Certificate.Raw)
+		for _, cert := range xs.Intermediates {
+			// the signer is usually included as well
+			if !cert.Equal(xs.Certificate) {
+				ret.Certificates = append(ret.Certificates, cert.Raw)
+			}
+		}
+		if cs := xs.CounterSignature; cs != nil {
+			ret.Timestamp = timestamppb.New(cs.SigningTime)
+			ret.Timestamper = x509tools.FormatSubject(cs.Certificate)
+		}
+	} else if sig.SignerPgp != nil {
+		ret.PgpFingerprint = sig.SignerPgp.PrimaryKey.Fingerprint
+	}
+	return ret
+}
+
+// chunkReader reads the chunks of a client stream until the client closes it
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *chunkReader) Read(d []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk
+	}
+	n := copy(d, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
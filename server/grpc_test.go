@@ -0,0 +1,61 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sassoftware/relic/v8/internal/httperror"
+)
+
+func TestGRPCError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{httperror.MissingParameterError("key"), codes.InvalidArgument},
+		{httperror.KeyForbiddenError("key"), codes.PermissionDenied},
+		{httperror.ErrCertificateNotRecognized, codes.Unauthenticated},
+		{status.Error(codes.Canceled, "gone"), codes.Canceled},
+		{errors.New("token failed"), codes.Internal},
+	} {
+		assert.Equal(t, tc.code, status.Code(grpcError(tc.err, codes.Internal)), "%s", tc.err)
+	}
+	assert.NoError(t, grpcError(nil, codes.Internal))
+}
+
+func TestChunkReader(t *testing.T) {
+	chunks := [][]byte{[]byte("hello "), nil, []byte("world")}
+	r := &chunkReader{recv: func() ([]byte, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return chunk, nil
+	}}
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+	resultDenied  = "denied"
+
+	rejectQueueFull = "queue_full"
+	rejectTimeout   = "timeout"
+)
+
+// Metrics holds the collectors for signing requests served by the server.
+// Token, session pool and timestamper metrics are registered by their own
+// packages on the default registry.
+type Metrics struct {
+	SignRequests *prometheus.CounterVec
+	SignLatency  *prometheus.HistogramVec
+	// QueueDepth and QueueRejections describe sign requests held back by the
+	// MaxRequests and MaxClientRequests limits
+	QueueDepth      prometheus.Gauge
+	QueueRejections *prometheus.CounterVec
+
+	handler http.Handler
+}
+
+// NewMetrics registers the server's collectors with reg and serves everything
+// in gatherer from Handler(). Registering on a registry that already has them
+// reuses the existing collectors.
+func NewMetrics(reg prometheus.Registerer, gatherer prometheus.Gatherer) (*Metrics, error) {
+	requests := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sign_requests",
+			Help: "Signing requests by key and result",
+		},
+		[]string{"key", "result"},
+	)
+	latency := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "sign_request_seconds",
+			Help:    "A histogram of latencies for successful signing requests",
+			Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		},
+		[]string{"key", "sigtype"},
+	)
+	depth := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "sign_queue_depth",
+			Help: "Signing requests waiting for their turn",
+		},
+	)
+	rejections := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sign_queue_rejections",
+			Help: "Signing requests refused because the queue was full or they waited too long",
+		},
+		[]string{"reason"},
+	)
+	if err := register(reg, &requests); err != nil {
+		return nil, err
+	}
+	if err := register(reg, &latency); err != nil {
+		return nil, err
+	}
+	if err := register(reg, &depth); err != nil {
+		return nil, err
+	}
+	if err := register(reg, &rejections); err != nil {
+		return nil, err
+	}
+	return &Metrics{
+		SignRequests:    requests,
+		SignLatency:     latency,
+		QueueDepth:      depth,
+		QueueRejections: rejections,
+		handler:         promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}),
+	}, nil
+}
+
+func register[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	err := reg.Register(*c)
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		if existing, ok := already.ExistingCollector.(T); ok {
+			*c = existing
+			return nil
+		}
+	}
+	return err
+}
+
+// Handler serves the gathered metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return m.handler
+}
+
+func (m *Metrics) observeSign(keyName, sigType, result string, start time.Time) {
+	m.SignRequests.WithLabelValues(keyName, result).Inc()
+	if result == resultSuccess {
+		m.SignLatency.WithLabelValues(keyName, sigType).Observe(time.Since(start).Seconds())
+	}
+}
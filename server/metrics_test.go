@@ -0,0 +1,63 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewMetrics(reg, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	m.observeSign("mykey", "rpm", resultSuccess, start)
+	m.observeSign("mykey", "rpm", resultSuccess, start)
+	m.observeSign("mykey", "rpm", resultDenied, start)
+	if v := testutil.ToFloat64(m.SignRequests.WithLabelValues("mykey", resultSuccess)); v != 2 {
+		t.Errorf("expected 2 successful requests, got %v", v)
+	}
+	if v := testutil.ToFloat64(m.SignRequests.WithLabelValues("mykey", resultDenied)); v != 1 {
+		t.Errorf("expected 1 denied request, got %v", v)
+	}
+	if n := testutil.CollectAndCount(m.SignLatency); n != 1 {
+		t.Errorf("expected latency only for successful requests, got %d series", n)
+	}
+	// registering again reuses the same collectors
+	m2, err := NewMetrics(reg, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2.observeSign("mykey", "rpm", resultFailure, start)
+	if v := testutil.ToFloat64(m.SignRequests.WithLabelValues("mykey", resultFailure)); v != 1 {
+		t.Errorf("expected 1 failed request, got %v", v)
+	}
+	// scrape
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `sign_requests{key="mykey",result="success"} 2`) {
+		t.Errorf("metric missing from scrape:\n%s", body)
+	}
+}
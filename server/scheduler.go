@@ -0,0 +1,223 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/internal/httperror"
+)
+
+// clients that are refused are asked to wait this long before trying again
+const queueRetryAfter = 5 * time.Second
+
+// scheduler bounds how many sign requests run at once, both overall and for
+// each client. Requests over either limit wait in a queue that is served
+// round-robin across clients, so a client submitting a burst of requests
+// can't hold up everyone else.
+type scheduler struct {
+	maxActive int
+	perClient int
+	maxQueue  int
+	timeout   time.Duration
+	metrics   *Metrics
+
+	mu      sync.Mutex
+	active  int
+	queued  int
+	clients map[string]*clientQueue
+	// clients with requests waiting, in the order they will be served
+	order []string
+}
+
+type clientQueue struct {
+	active  int
+	waiting []chan struct{}
+}
+
+// newScheduler returns a scheduler for the configured limits, or nil if
+// requests are not limited
+func newScheduler(conf *config.ServerConfig, metrics *Metrics) *scheduler {
+	if conf == nil || (conf.MaxRequests <= 0 && conf.MaxClientRequests <= 0) {
+		return nil
+	}
+	return &scheduler{
+		maxActive: conf.MaxRequests,
+		perClient: conf.MaxClientRequests,
+		maxQueue:  conf.MaxQueuedRequests,
+		timeout:   time.Duration(conf.QueueTimeout) * time.Second,
+		metrics:   metrics,
+		clients:   make(map[string]*clientQueue),
+	}
+}
+
+// acquire waits until the client may run another request. The returned
+// function must be called when the request is finished. A nil scheduler
+// doesn't limit anything.
+func (s *scheduler) acquire(ctx context.Context, client string) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	release := func() { s.release(client) }
+	s.mu.Lock()
+	cq := s.clients[client]
+	if cq == nil {
+		cq = new(clientQueue)
+		s.clients[client] = cq
+	}
+	if s.runnable(cq) {
+		// any requests already waiting are held back by their own client's
+		// limit, so this one doesn't jump the queue
+		cq.active++
+		s.active++
+		s.mu.Unlock()
+		return release, nil
+	}
+	if s.maxQueue > 0 && s.queued >= s.maxQueue {
+		s.forget(client, cq)
+		s.mu.Unlock()
+		s.reject(rejectQueueFull)
+		return nil, httperror.TooManyRequestsError("The server is busy and its queue is full", queueRetryAfter)
+	}
+	ready := make(chan struct{})
+	cq.waiting = append(cq.waiting, ready)
+	if len(cq.waiting) == 1 {
+		s.order = append(s.order, client)
+	}
+	s.queued++
+	s.setDepth()
+	s.mu.Unlock()
+
+	var expired <-chan time.Time
+	if s.timeout > 0 {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return release, nil
+	case <-expired:
+		err = httperror.TooManyRequestsError("The server is busy and the request timed out waiting for its turn", queueRetryAfter)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.mu.Lock()
+	if !s.dequeue(client, cq, ready) {
+		// granted while giving up, so take it rather than drop it
+		s.mu.Unlock()
+		return release, nil
+	}
+	s.mu.Unlock()
+	if ctx.Err() == nil {
+		s.reject(rejectTimeout)
+	}
+	return nil, err
+}
+
+// runnable reports whether a request for the client could start now
+func (s *scheduler) runnable(cq *clientQueue) bool {
+	return (s.maxActive <= 0 || s.active < s.maxActive) &&
+		(s.perClient <= 0 || cq.active < s.perClient)
+}
+
+// release finishes a request and starts the next ones in line
+func (s *scheduler) release(client string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cq := s.clients[client]
+	cq.active--
+	s.active--
+	s.dispatch()
+	s.forget(client, cq)
+}
+
+// dispatch starts waiting requests, taking one from each client in turn,
+// until the overall limit is reached or no waiting client is under its own
+// limit
+func (s *scheduler) dispatch() {
+	for i := 0; i < len(s.order); {
+		if s.maxActive > 0 && s.active >= s.maxActive {
+			break
+		}
+		client := s.order[i]
+		cq := s.clients[client]
+		if !s.runnable(cq) {
+			i++
+			continue
+		}
+		ready := cq.waiting[0]
+		cq.waiting = cq.waiting[1:]
+		cq.active++
+		s.active++
+		s.queued--
+		close(ready)
+		// move to the back of the line
+		s.order = append(s.order[:i], s.order[i+1:]...)
+		if len(cq.waiting) != 0 {
+			s.order = append(s.order, client)
+		}
+	}
+	s.setDepth()
+}
+
+// dequeue removes a request that gave up waiting. It returns false if the
+// request was already started.
+func (s *scheduler) dequeue(client string, cq *clientQueue, ready chan struct{}) bool {
+	for i, ch := range cq.waiting {
+		if ch != ready {
+			continue
+		}
+		cq.waiting = append(cq.waiting[:i], cq.waiting[i+1:]...)
+		s.queued--
+		if len(cq.waiting) == 0 {
+			for j, name := range s.order {
+				if name == client {
+					s.order = append(s.order[:j], s.order[j+1:]...)
+					break
+				}
+			}
+		}
+		s.setDepth()
+		s.forget(client, cq)
+		return true
+	}
+	return false
+}
+
+// forget drops the state for a client that has nothing running or waiting
+func (s *scheduler) forget(client string, cq *clientQueue) {
+	if cq.active == 0 && len(cq.waiting) == 0 {
+		delete(s.clients, client)
+	}
+}
+
+func (s *scheduler) setDepth() {
+	if s.metrics != nil {
+		s.metrics.QueueDepth.Set(float64(s.queued))
+	}
+}
+
+func (s *scheduler) reject(reason string) {
+	if s.metrics != nil {
+		s.metrics.QueueRejections.WithLabelValues(reason).Inc()
+	}
+}
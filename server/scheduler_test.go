@@ -0,0 +1,191 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/internal/httperror"
+)
+
+func testScheduler(t *testing.T, conf config.ServerConfig) *scheduler {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	m, err := NewMetrics(reg, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newScheduler(&conf, m)
+	if s == nil {
+		t.Fatal("expected a scheduler")
+	}
+	return s
+}
+
+// start a request in the background and return a channel that receives its
+// release function once it gets a turn
+func acquireAsync(t *testing.T, s *scheduler, client string) <-chan func() {
+	t.Helper()
+	ch := make(chan func(), 1)
+	go func() {
+		release, err := s.acquire(context.Background(), client)
+		if err != nil {
+			t.Error(err)
+			close(ch)
+			return
+		}
+		ch <- release
+	}()
+	return ch
+}
+
+func waitQueued(t *testing.T, s *scheduler, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		queued := s.queued
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d queued requests", n)
+}
+
+func TestSchedulerUnlimited(t *testing.T) {
+	if s := newScheduler(&config.ServerConfig{QueueTimeout: 60}, nil); s != nil {
+		t.Error("expected no scheduler without limits")
+	}
+	var s *scheduler
+	release, err := s.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestSchedulerFairness(t *testing.T) {
+	s := testScheduler(t, config.ServerConfig{MaxRequests: 1, QueueTimeout: 60})
+	first, err := s.acquire(context.Background(), "busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the busy client queues up several requests before the quiet one arrives
+	busy1 := acquireAsync(t, s, "busy")
+	waitQueued(t, s, 1)
+	busy2 := acquireAsync(t, s, "busy")
+	waitQueued(t, s, 2)
+	quiet := acquireAsync(t, s, "quiet")
+	waitQueued(t, s, 3)
+	if v := testutil.ToFloat64(s.metrics.QueueDepth); v != 3 {
+		t.Errorf("expected queue depth 3, got %v", v)
+	}
+	first()
+	release := <-busy1
+	release()
+	// the quiet client goes next instead of waiting behind the whole burst
+	select {
+	case release = <-quiet:
+	case <-busy2:
+		t.Fatal("busy client was served twice in a row")
+	}
+	release()
+	(<-busy2)()
+	if v := testutil.ToFloat64(s.metrics.QueueDepth); v != 0 {
+		t.Errorf("expected empty queue, got %v", v)
+	}
+	if len(s.clients) != 0 || len(s.order) != 0 || s.active != 0 {
+		t.Errorf("scheduler state not cleaned up: %+v", s)
+	}
+}
+
+func TestSchedulerPerClient(t *testing.T) {
+	s := testScheduler(t, config.ServerConfig{MaxRequests: 3, MaxClientRequests: 1, QueueTimeout: 60})
+	a1, err := s.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2 := acquireAsync(t, s, "a")
+	waitQueued(t, s, 1)
+	// another client still gets in right away
+	b1, err := s.acquire(context.Background(), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1()
+	a1()
+	(<-a2)()
+}
+
+func TestSchedulerRejects(t *testing.T) {
+	s := testScheduler(t, config.ServerConfig{MaxRequests: 1, MaxQueuedRequests: 1, QueueTimeout: 1})
+	s.timeout = 50 * time.Millisecond
+	release, err := s.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.acquire(context.Background(), "b")
+		errCh <- err
+	}()
+	waitQueued(t, s, 1)
+	// queue is full
+	_, err = s.acquire(context.Background(), "c")
+	checkTooMany(t, err)
+	// the waiting request times out
+	checkTooMany(t, <-errCh)
+	if v := testutil.ToFloat64(s.metrics.QueueRejections.WithLabelValues(rejectQueueFull)); v != 1 {
+		t.Errorf("expected 1 queue_full rejection, got %v", v)
+	}
+	if v := testutil.ToFloat64(s.metrics.QueueRejections.WithLabelValues(rejectTimeout)); v != 1 {
+		t.Errorf("expected 1 timeout rejection, got %v", v)
+	}
+	// a canceled request is not counted as a rejection
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.acquire(ctx, "d"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+	if v := testutil.ToFloat64(s.metrics.QueueRejections.WithLabelValues(rejectTimeout)); v != 1 {
+		t.Errorf("expected 1 timeout rejection, got %v", v)
+	}
+	if s.queued != 0 || len(s.order) != 0 {
+		t.Errorf("abandoned requests left in queue: %+v", s)
+	}
+}
+
+func checkTooMany(t *testing.T, err error) {
+	t.Helper()
+	var problem httperror.Problem
+	if !errors.As(err, &problem) || problem.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 problem, got %v", err)
+	}
+	if problem.RetryAfter == 0 {
+		t.Error("expected Retry-After to be set")
+	}
+}
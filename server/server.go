@@ -22,10 +22,13 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
 	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/internal/authmodel"
 	"github.com/sassoftware/relic/v8/internal/realip"
 	"github.com/sassoftware/relic/v8/internal/zhttp"
+	"github.com/sassoftware/relic/v8/lib/audit"
 	"github.com/sassoftware/relic/v8/lib/compresshttp"
 	"github.com/sassoftware/relic/v8/token"
 	"github.com/sassoftware/relic/v8/token/open"
@@ -40,16 +43,24 @@ type Server struct {
 	tokens  map[string]token.Token
 	auth    authmodel.Authenticator
 	realIP  func(http.Handler) http.Handler
+	Metrics *Metrics
+
+	queue     *scheduler
+	auditSink audit.Sink
+	requests  requestTracker
+	healthz   healthzCache
 }
 
 func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 	r.Use(s.realIP)
+	r.Use(s.requests.middleware)
 	r.Use(zhttp.LoggingMiddleware())
 	r.Use(zhttp.RecoveryMiddleware)
 	r.Use(compresshttp.Middleware)
 	// unauthenticated methods
 	r.Get("/health", s.serveHealth)
+	r.Get("/healthz", s.serveHealthz)
 	r.Get("/directory", handleFunc(s.serveDirectory))
 	// authenticated methods
 	a := r.With(authmodel.Middleware(s.auth))
@@ -57,6 +68,7 @@ func (s *Server) Handler() http.Handler {
 	a.Get("/list_keys", handleFunc(s.serveListKeys))
 	a.Get("/keys/{key}", handleFunc(s.serveGetKey))
 	a.Post("/sign", handleFunc(s.serveSign))
+	a.Handle("/metrics", s.Metrics.Handler())
 	return r
 }
 
@@ -65,13 +77,31 @@ func (s *Server) Close() error {
 		close(s.closeCh)
 		s.closeCh = nil
 	}
+	if s.auditSink != nil {
+		if err := s.auditSink.Close(); err != nil {
+			log.Err(err).Msg("failed to flush audit sink")
+		}
+		s.auditSink = nil
+	}
 	for _, t := range s.tokens {
 		t.Close()
 	}
 	return nil
 }
 
+// New creates a server whose metrics are registered on the default Prometheus
+// registry
 func New(config *config.Config) (*Server, error) {
+	metrics, err := NewMetrics(prometheus.DefaultRegisterer, prometheus.DefaultGatherer)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMetrics(config, metrics)
+}
+
+// NewWithMetrics creates a server that records signing metrics into the given
+// collectors
+func NewWithMetrics(config *config.Config, metrics *Metrics) (*Server, error) {
 	closed := make(chan bool)
 	auth, err := authmodel.New(config)
 	if err != nil {
@@ -87,6 +117,8 @@ func New(config *config.Config) (*Server, error) {
 		closeCh: closed,
 		auth:    auth,
 		realIP:  realIP,
+		Metrics: metrics,
+		queue:   newScheduler(config.Server, metrics),
 		tokens:  make(map[string]token.Token),
 	}
 	if err := s.openTokens(); err != nil {
@@ -95,12 +127,25 @@ func New(config *config.Config) (*Server, error) {
 		}
 		return nil, err
 	}
+	if err := s.openAuditSink(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("configuring audit sink: %w", err)
+	}
 	if err := s.startHealthCheck(); err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// keyAllowed checks whether the client can use a key. The audit signing key is
+// never available to clients, even if it has no roles.
+func (s *Server) keyAllowed(userInfo authmodel.UserInfo, keyConf *config.KeyConfig) bool {
+	if aconf := s.Config.Server.Audit; aconf != nil && aconf.SigningKey == keyConf.Name() {
+		return false
+	}
+	return userInfo.Allowed(keyConf)
+}
+
 // Open each token used by any key. pkcs11 tokens get a worker, while other
 // types are used in-process via a cache.
 func (s *Server) openTokens() error {
@@ -37,13 +37,14 @@ import (
 type keyInfo struct {
 	X509Certificate string
 	PGPCertificate  string
+	Hash            string `json:",omitempty"`
 }
 
 func (s *Server) serveGetKey(rw http.ResponseWriter, req *http.Request) error {
 	userInfo := authmodel.RequestInfo(req)
 	keyName := chi.URLParam(req, "key")
 	keyConf, err := s.Config.GetKey(keyName)
-	if err == nil && userInfo.Allowed(keyConf) {
+	if err == nil && s.keyAllowed(userInfo, keyConf) {
 		info, err := s.getKeyInfo(req.Context(), keyConf)
 		if err != nil {
 			return err
@@ -62,7 +63,7 @@ func (s *Server) getKeyInfo(ctx context.Context, keyConf *config.KeyConfig) (key
 	if err != nil {
 		return keyInfo{}, err
 	}
-	var info keyInfo
+	info := keyInfo{Hash: keyConf.Hash}
 	if cert.PgpKey != nil {
 		info.PGPCertificate, err = marshalPGPCert(cert.PgpKey)
 		if err != nil {
@@ -123,7 +123,7 @@ func (s *Server) pingOne(tok token.Token) bool {
 }
 
 func (s *Server) Healthy(request *http.Request) bool {
-	if s.Config.Server.Disabled {
+	if s.Config.Server.Disabled || s.Draining() {
 		return false
 	}
 	healthMu.Lock()
@@ -139,7 +139,9 @@ func (s *Server) Healthy(request *http.Request) bool {
 
 func (s *Server) serveHealth(rw http.ResponseWriter, request *http.Request) {
 	zhttp.DontLog(request)
-	if s.Healthy(request) {
+	if s.Draining() {
+		http.Error(rw, "draining", http.StatusServiceUnavailable)
+	} else if s.Healthy(request) {
 		_, _ = rw.Write([]byte("OK\r\n"))
 	} else {
 		http.Error(rw, "health check failed", http.StatusServiceUnavailable)
@@ -0,0 +1,131 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/sassoftware/relic/v8/internal/zhttp"
+)
+
+type healthzResult struct {
+	Status  string                  `json:"status"`
+	Checked time.Time               `json:"checked"`
+	Tokens  map[string]healthzToken `json:"tokens"`
+}
+
+type healthzToken struct {
+	OK      bool    `json:"ok"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// healthzCache keeps the last result so that frequent probes don't turn into
+// a ping per probe against the HSM. Holding the mutex while pinging also makes
+// concurrent probes share one round of pings.
+type healthzCache struct {
+	mu   sync.Mutex
+	last *healthzResult
+}
+
+// pingAll pings every token concurrently, giving each one the configured
+// timeout
+func (s *Server) pingAll() *healthzResult {
+	timeout := time.Second * time.Duration(s.Config.Server.HealthzTimeout)
+	result := &healthzResult{
+		Status:  "OK",
+		Checked: time.Now(),
+		Tokens:  make(map[string]healthzToken, len(s.tokens)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, tok := range s.tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			start := time.Now()
+			errch := make(chan error, 1)
+			go func() { errch <- tok.Ping(ctx) }()
+			var err error
+			select {
+			case err = <-errch:
+			case <-ctx.Done():
+				// don't let a wedged token hold up the response
+				err = ctx.Err()
+			}
+			status := healthzToken{OK: err == nil, Seconds: time.Since(start).Seconds()}
+			if err != nil {
+				status.Error = err.Error()
+			}
+			mu.Lock()
+			result.Tokens[name] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	var failed []string
+	for name, status := range result.Tokens {
+		if !status.OK {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		result.Status = "ERROR"
+		log.Error().Strs("tokens", failed).Msg("healthz: token ping failed")
+	}
+	return result
+}
+
+func (s *Server) serveHealthz(rw http.ResponseWriter, request *http.Request) {
+	zhttp.DontLog(request)
+	s.healthz.mu.Lock()
+	result := s.healthz.last
+	maxAge := time.Second * time.Duration(s.Config.Server.HealthzCacheSeconds)
+	if result == nil || time.Since(result.Checked) > maxAge {
+		result = s.pingAll()
+		s.healthz.last = result
+	}
+	s.healthz.mu.Unlock()
+	code := http.StatusOK
+	if s.Draining() {
+		copied := *result
+		copied.Status = "DRAINING"
+		result = &copied
+	}
+	if result.Status != "OK" {
+		code = http.StatusServiceUnavailable
+	}
+	blob, err := json.Marshal(result)
+	if err != nil {
+		zhttp.WriteUnhandledError(rw, request, err, "")
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	_, _ = rw.Write(blob)
+}
@@ -27,16 +27,7 @@ func (s *Server) serveListKeys(rw http.ResponseWriter, req *http.Request) error
 	userInfo := authmodel.RequestInfo(req)
 	keys := []string{}
 	for key, keyConf := range s.Config.Keys {
-		if keyConf.Hide {
-			continue
-		}
-		if keyConf.Alias != "" {
-			keyConf = s.Config.Keys[keyConf.Alias]
-			if keyConf == nil {
-				continue
-			}
-		}
-		if !keyConf.Hide && userInfo.Allowed(keyConf) {
+		if !keyConf.Hide && s.keyAllowed(userInfo, keyConf) {
 			keys = append(keys, key)
 		}
 	}
@@ -19,7 +19,11 @@ package server
 import (
 	"crypto"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/hlog"
 	"github.com/sassoftware/relic/v8/internal/authmodel"
@@ -33,72 +37,135 @@ import (
 
 const defaultHash = crypto.SHA256
 
+// signParams are the options of a sign request, from the query string of a
+// HTTP request or the header of a gRPC stream
+type signParams struct {
+	keyName    string
+	filename   string
+	sigType    string
+	digest     string
+	digestOnly bool
+	// signer-specific flags
+	query url.Values
+}
+
 func (s *Server) serveSign(rw http.ResponseWriter, request *http.Request) error {
 	// parse parameters
 	query := request.URL.Query()
-	keyName := query.Get("key")
-	if keyName == "" {
+	p := signParams{
+		keyName:  query.Get("key"),
+		filename: query.Get("filename"),
+		sigType:  query.Get("sigtype"),
+		digest:   query.Get("digest"),
+		query:    query,
+	}
+	if p.keyName == "" {
 		return httperror.MissingParameterError("key")
 	}
-	filename := query.Get("filename")
-	if filename == "" {
+	if p.filename == "" {
 		return httperror.MissingParameterError("filename")
 	}
-	sigType := query.Get("sigtype")
+	p.digestOnly, _ = strconv.ParseBool(query.Get("digestonly"))
+	blob, mimeType, err := s.signPackage(request, p, request.Body)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", mimeType)
+	_, err = rw.Write(blob)
+	return err
+}
+
+// signPackage authorizes and performs a sign request for the user
+// authenticated on the request, and returns the signature or binary patch and
+// its MIME type
+func (s *Server) signPackage(request *http.Request, p signParams, body io.Reader) ([]byte, string, error) {
+	start := time.Now()
+	keyName, filename, sigType := p.keyName, p.filename, p.sigType
 	// authorize key
 	userInfo := authmodel.RequestInfo(request)
 	keyConf, err := s.Config.GetKey(keyName)
 	if err != nil {
 		hlog.FromRequest(request).Err(err).Str("key", keyName).Msg("key not found")
-		return httperror.ErrForbidden
-	} else if !userInfo.Allowed(keyConf) {
+		return nil, "", httperror.KeyForbiddenError(keyName)
+	} else if !s.keyAllowed(userInfo, keyConf) {
 		hlog.FromRequest(request).Error().Str("key", keyName).Msg("access to key denied")
-		return httperror.ErrForbidden
+		s.auditDenied(request, userInfo, keyConf.Name(), sigType, filename)
+		s.Metrics.observeSign(keyConf.Name(), sigType, resultDenied, start)
+		return nil, "", httperror.KeyForbiddenError(keyName)
 	}
 	// configure signer
 	mod := signers.ByName(sigType)
 	if mod == nil {
 		hlog.FromRequest(request).Error().Str("sigtype", sigType).Msg("signature type not found")
-		return httperror.ErrUnknownSignatureType
+		return nil, "", httperror.ErrUnknownSignatureType
+	}
+	sign := mod.Sign
+	if p.digestOnly {
+		if mod.SignDigest == nil {
+			return nil, "", httperror.BadParameterError(fmt.Errorf("signature type %s can't be signed from a digest", mod.Name))
+		}
+		sign = mod.SignDigest
+	} else if sign == nil {
+		return nil, "", httperror.BadParameterError(fmt.Errorf("can't sign files of type: %s", mod.Name))
 	}
 	hash := defaultHash
-	if digest := request.URL.Query().Get("digest"); digest != "" {
+	digest := p.digest
+	if digest == "" {
+		digest = keyConf.Hash
+	}
+	if digest != "" {
 		hash = x509tools.HashByName(digest)
 		if hash == 0 {
 			hlog.FromRequest(request).Error().Str("digest", digest).Msg("digest type not found")
-			return httperror.ErrUnknownDigest
+			return nil, "", httperror.ErrUnknownDigest
 		}
 	}
+	if err := mod.CheckHash(hash); err != nil {
+		hlog.FromRequest(request).Err(err).Str("sigtype", sigType).Msg("digest not supported by signer")
+		return nil, "", httperror.UnsupportedDigestError(err)
+	}
 	// parse flags for signer
-	flags, err := mod.FlagsFromQuery(query)
+	flags, err := mod.FlagsFromQuery(p.query)
 	if err != nil {
 		hlog.FromRequest(request).Err(err).Str("sigtype", sigType).
 			Msg("failed to parse signer arguments")
-		return httperror.BadParameterError(err)
+		return nil, "", httperror.BadParameterError(err)
+	}
+	// wait for a turn if the server is busy
+	release, err := s.queue.acquire(request.Context(), userInfo.Identity())
+	if err != nil {
+		hlog.FromRequest(request).Err(err).Str("key", keyConf.Name()).Msg("sign request not queued")
+		return nil, "", err
 	}
+	defer release()
 	// get key from token and initialize signer context
 	tok := s.tokens[keyConf.Token]
 	if tok == nil {
-		return fmt.Errorf("missing token \"%s\" for key \"%s\"", keyConf.Token, keyName)
+		return nil, "", fmt.Errorf("missing token \"%s\" for key \"%s\"", keyConf.Token, keyName)
 	}
 	cert, opts, err := signinit.Init(request.Context(), mod, tok, keyName, hash, flags)
 	if err != nil {
-		return err
+		s.Metrics.observeSign(keyConf.Name(), mod.Name, resultFailure, start)
+		return nil, "", err
 	}
+	opts.Path = filename
 	opts.Audit.Attributes["client.ip"] = zhttp.StripPort(request.RemoteAddr)
 	opts.Audit.Attributes["client.filename"] = filename
 	userInfo.AuditContext(opts.Audit)
 	// sign the request stream and output a binpatch or signature blob
-	counter := readercounter.New(request.Body)
-	blob, err := mod.Sign(counter, cert, *opts)
+	counter := readercounter.New(body)
+	blob, err := sign(counter, cert, *opts)
 	if err != nil {
-		return err
+		s.auditFailure(request, opts.Audit, err)
+		s.Metrics.observeSign(keyConf.Name(), mod.Name, resultFailure, start)
+		return nil, "", err
 	}
 	opts.Audit.Attributes["perf.size.in"] = counter.N
 	opts.Audit.Attributes["perf.size.patch"] = len(blob)
-	if err := signinit.PublishAudit(opts.Audit); err != nil {
-		return err
+	if err := s.publishAudit(opts.Audit); err != nil {
+		return nil, "", err
 	}
+	s.Metrics.observeSign(keyConf.Name(), mod.Name, resultSuccess, start)
 	ev := hlog.FromRequest(request).Info().
 		Str("key", keyConf.Name()).
 		Str("filename", filename)
@@ -106,7 +173,5 @@ func (s *Server) serveSign(rw http.ResponseWriter, request *http.Request) error
 		ev.Dict("package", mod.FormatLog(opts.Audit))
 	}
 	ev.Msg("signed package")
-	rw.Header().Set("Content-Type", opts.Audit.GetMimeType())
-	_, err = rw.Write(blob)
-	return err
+	return blob, opts.Audit.GetMimeType(), nil
 }
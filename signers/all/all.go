@@ -0,0 +1,49 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package all registers every signer module that ships with relic. Programs
+// that embed relic and add their own formats can import it alongside their
+// own modules.
+package all
+
+import (
+	_ "github.com/sassoftware/relic/v8/signers/apk"
+	_ "github.com/sassoftware/relic/v8/signers/appmanifest"
+	_ "github.com/sassoftware/relic/v8/signers/appx"
+	_ "github.com/sassoftware/relic/v8/signers/cab"
+	_ "github.com/sassoftware/relic/v8/signers/cat"
+	_ "github.com/sassoftware/relic/v8/signers/cms"
+	_ "github.com/sassoftware/relic/v8/signers/cosign"
+	_ "github.com/sassoftware/relic/v8/signers/deb"
+	_ "github.com/sassoftware/relic/v8/signers/dmg"
+	_ "github.com/sassoftware/relic/v8/signers/helm"
+	_ "github.com/sassoftware/relic/v8/signers/jar"
+	_ "github.com/sassoftware/relic/v8/signers/jws"
+	_ "github.com/sassoftware/relic/v8/signers/kmod"
+	_ "github.com/sassoftware/relic/v8/signers/macho"
+	_ "github.com/sassoftware/relic/v8/signers/msi"
+	_ "github.com/sassoftware/relic/v8/signers/nuget"
+	_ "github.com/sassoftware/relic/v8/signers/ostree"
+	_ "github.com/sassoftware/relic/v8/signers/pecoff"
+	_ "github.com/sassoftware/relic/v8/signers/pgp"
+	_ "github.com/sassoftware/relic/v8/signers/pkcs"
+	_ "github.com/sassoftware/relic/v8/signers/ps"
+	_ "github.com/sassoftware/relic/v8/signers/rpm"
+	_ "github.com/sassoftware/relic/v8/signers/ssh"
+	_ "github.com/sassoftware/relic/v8/signers/vsix"
+	_ "github.com/sassoftware/relic/v8/signers/xap"
+	_ "github.com/sassoftware/relic/v8/signers/xar"
+)
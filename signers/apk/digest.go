@@ -68,7 +68,9 @@ func digestApkStream(r io.Reader, hash crypto.Hash) (*Digest, error) {
 	}, nil
 }
 
-func (d *Digest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error) {
+// Sign the digest, producing a v2 signature block and optionally a v3 block
+// with the certificate lineage from cert
+func (d *Digest) Sign(cert *certloader.Certificate, v3 bool) (*binpatch.PatchSet, error) {
 	// select a signature type
 	alg := x509tools.GetPublicKeyAlgorithm(cert.Leaf.PublicKey)
 	var st sigType
@@ -82,35 +84,78 @@ func (d *Digest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error)
 	if st.id == 0 {
 		return nil, errors.New("unsupported public key algorithm")
 	}
-	// build signed data
+	digests := []apkDigest{apkDigest{ID: st.id, Value: d.value}}
+	var certs [][]byte
+	for _, cert := range cert.Chain() {
+		certs = append(certs, cert.Raw)
+	}
+	// build v2 signer
 	sd := apkSignedData{
-		Digests: []apkDigest{apkDigest{ID: st.id, Value: d.value}},
+		Digests:      digests,
+		Certificates: certs,
 	}
-	for _, cert := range cert.Chain() {
-		sd.Certificates = append(sd.Certificates, cert.Raw)
+	if v3 {
+		// tell v3-aware verifiers to reject the APK if the v3 block goes missing
+		var value [4]byte
+		binary.LittleEndian.PutUint32(value[:], 3)
+		sd.Attributes = []apkAttribute{apkAttribute{ID: attrStrippingProtection, Value: value[:]}}
 	}
 	signedData, err := marshal(sd)
 	if err != nil {
 		return nil, err
 	}
-	// sign
-	digest := st.hash.New()
-	digest.Write(signedData.Bytes())
-	sigv, err := cert.Signer().Sign(rand.Reader, digest.Sum(nil), st.hash)
+	sigv, err := signData(cert, st, signedData)
 	if err != nil {
 		return nil, err
 	}
-	// build signer block
-	signerList := []apkSigner{apkSigner{
+	sblob, err := marshal([]apkSigner{apkSigner{
 		SignedData: signedData,
 		Signatures: []apkSignature{apkSignature{ID: st.id, Value: sigv}},
 		PublicKey:  cert.Leaf.RawSubjectPublicKeyInfo,
-	}}
-	sblob, err := marshal(signerList)
+	}})
 	if err != nil {
 		return nil, err
 	}
-	block := makeSigBlock(sblob)
+	parts := []sigBlockPart{{sigApkV2, sblob}}
+	if v3 {
+		// build v3 signer
+		sd3 := apkV3SignedData{
+			Digests:      digests,
+			Certificates: certs,
+			MinSDK:       v3MinSDK,
+			MaxSDK:       v3MaxSDK,
+		}
+		if len(cert.ApkLineage) != 0 {
+			lineage, lcerts, err := parseLineage(cert.ApkLineage)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(lcerts[len(lcerts)-1].Raw, cert.Leaf.Raw) {
+				return nil, errors.New("APK lineage does not end with the signing certificate")
+			}
+			sd3.Attributes = []apkAttribute{apkAttribute{ID: attrProofOfRotation, Value: lineage}}
+		}
+		signedData, err := marshal(sd3)
+		if err != nil {
+			return nil, err
+		}
+		sigv, err := signData(cert, st, signedData)
+		if err != nil {
+			return nil, err
+		}
+		sblob, err := marshal([]apkV3Signer{apkV3Signer{
+			SignedData: signedData,
+			MinSDK:     v3MinSDK,
+			MaxSDK:     v3MaxSDK,
+			Signatures: []apkSignature{apkSignature{ID: st.id, Value: sigv}},
+			PublicKey:  cert.Leaf.RawSubjectPublicKeyInfo,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, sigBlockPart{sigApkV3, sblob})
+	}
+	block := makeSigBlock(parts)
 	// patch
 	patchset := binpatch.New()
 	origDirLoc := d.inz.DirLoc
@@ -124,18 +169,37 @@ func (d *Digest) Sign(cert *certloader.Certificate) (*binpatch.PatchSet, error)
 	return patchset, nil
 }
 
-func makeSigBlock(sblob []byte) []byte {
-	block := make([]byte, 8+12+len(sblob)+24)
+func signData(cert *certloader.Certificate, st sigType, signedData apkRaw) ([]byte, error) {
+	digest := st.hash.New()
+	digest.Write(signedData.Bytes())
+	return cert.Signer().Sign(rand.Reader, digest.Sum(nil), st.hash)
+}
+
+type sigBlockPart struct {
+	id   uint32
+	blob []byte
+}
+
+func makeSigBlock(parts []sigBlockPart) []byte {
+	size := 0
+	for _, part := range parts {
+		size += 8 + 4 + len(part.blob)
+	}
+	block := make([]byte, 8+size+24)
 	// length prefix on signing block, includes the magic suffix but not itself
-	binary.LittleEndian.PutUint64(block, uint64(8+4+len(sblob)+8+16))
-	// length prefix on the inner block
-	binary.LittleEndian.PutUint64(block[8:], uint64(4+len(sblob)))
-	// block type
-	binary.LittleEndian.PutUint32(block[8+8:], sigApkV2)
-	// the block itself
-	copy(block[8+8+4:], sblob)
+	binary.LittleEndian.PutUint64(block, uint64(size+8+16))
+	pos := 8
+	for _, part := range parts {
+		// length prefix on the inner block
+		binary.LittleEndian.PutUint64(block[pos:], uint64(4+len(part.blob)))
+		// block type
+		binary.LittleEndian.PutUint32(block[pos+8:], part.id)
+		// the block itself
+		copy(block[pos+8+4:], part.blob)
+		pos += 8 + 4 + len(part.blob)
+	}
 	// magic suffix
-	suffix := block[8+8+4+len(sblob):]
+	suffix := block[pos:]
 	copy(suffix, block[:8])    // length again
 	copy(suffix[8:], sigMagic) // magic
 	return block
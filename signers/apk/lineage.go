@@ -0,0 +1,94 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// implement the proof-of-rotation lineage of APK Signature Scheme v3
+// https://source.android.com/security/apksigning/v3#proof-of-rotation
+
+const (
+	// lineage files written by "apksigner rotate" have an extra header
+	lineageFileMagic   = 0x3eff39d1
+	lineageFileVersion = 1
+	lineageVersion     = 1
+)
+
+// parseLineage decodes a signing certificate lineage, either from a file
+// produced by "apksigner rotate" or from a proof-of-rotation attribute. Each
+// level's signature by the level before it is checked. It returns the
+// attribute encoding of the lineage and its certificates from oldest to
+// newest.
+func parseLineage(blob []byte) (apkTail, []*x509.Certificate, error) {
+	if len(blob) >= 8 && binary.LittleEndian.Uint32(blob) == lineageFileMagic {
+		if v := binary.LittleEndian.Uint32(blob[4:]); v != lineageFileVersion {
+			return nil, nil, fmt.Errorf("unsupported lineage file version %d", v)
+		}
+		blob = blob[8:]
+	}
+	if len(blob) < 4 {
+		return nil, nil, errTruncated
+	}
+	if v := binary.LittleEndian.Uint32(blob); v != lineageVersion {
+		return nil, nil, fmt.Errorf("unsupported lineage version %d", v)
+	}
+	var nodes []lineageNode
+	rest := blob[4:]
+	for len(rest) > 0 {
+		var node lineageNode
+		var err error
+		rest, err = unmarshalR(rest, reflect.ValueOf(&node).Elem())
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing lineage: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, nil, errors.New("lineage is empty")
+	}
+	certs := make([]*x509.Certificate, len(nodes))
+	for i, node := range nodes {
+		var sd lineageSignedData
+		if err := unmarshal(node.SignedData, &sd); err != nil {
+			return nil, nil, fmt.Errorf("parsing lineage level %d: %w", i+1, err)
+		}
+		cert, err := x509.ParseCertificate(sd.Certificate)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing lineage level %d: %w", i+1, err)
+		}
+		if i > 0 {
+			// the algorithm that signs a level is stored in the level
+			// before it, and repeated in the signed data
+			parentAlg := nodes[i-1].SigAlgID
+			if sd.SigAlgID != parentAlg {
+				return nil, nil, fmt.Errorf("lineage level %d: signature algorithm mismatch", i+1)
+			}
+			sig := apkSignature{ID: parentAlg, Value: node.Signature}
+			if _, err := sig.VerifySignature(certs[i-1].PublicKey, node.SignedData.Bytes()); err != nil {
+				return nil, nil, fmt.Errorf("lineage level %d: %w", i+1, err)
+			}
+		}
+		certs[i] = cert
+	}
+	return apkTail(blob), certs, nil
+}
@@ -0,0 +1,213 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/zipslicer"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+const sigECDSASHA256 = 0x0201
+
+func makeCert(t *testing.T, name string) *certloader.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &certloader.Certificate{
+		Leaf:         cert,
+		Certificates: []*x509.Certificate{cert},
+		PrivateKey:   key,
+	}
+}
+
+// makeLineage encodes a lineage in which each certificate is signed by the one
+// before it, like "apksigner rotate" does. The algorithm that signs a level is
+// recorded in the level before it and repeated in the signed data.
+func makeLineage(t *testing.T, certs ...*certloader.Certificate) []byte {
+	var blob [4]byte
+	binary.LittleEndian.PutUint32(blob[:], lineageVersion)
+	lineage := blob[:]
+	for i, cert := range certs {
+		var parentAlg uint32
+		if i > 0 {
+			parentAlg = sigECDSASHA256
+		}
+		signedData, err := marshal(lineageSignedData{Certificate: cert.Leaf.Raw, SigAlgID: parentAlg})
+		require.NoError(t, err)
+		node := lineageNode{SignedData: signedData}
+		if i < len(certs)-1 {
+			node.SigAlgID = sigECDSASHA256
+		}
+		if i > 0 {
+			digest := sha256.Sum256(signedData.Bytes())
+			node.Signature, err = certs[i-1].Signer().Sign(rand.Reader, digest[:], crypto.SHA256)
+			require.NoError(t, err)
+		}
+		raw, err := marshal(node)
+		require.NoError(t, err)
+		lineage = append(lineage, raw...)
+	}
+	return lineage
+}
+
+// signApk signs a small APK and returns the path to the result
+func signApk(t *testing.T, cert *certloader.Certificate) (string, error) {
+	dir := t.TempDir()
+	unsigned := filepath.Join(dir, "unsigned.apk")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("AndroidManifest.xml")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("<manifest/>"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(unsigned, buf.Bytes(), 0644))
+	// the signer works on the tar form of the zip
+	f, err := os.Open(unsigned)
+	require.NoError(t, err)
+	defer f.Close()
+	var tarzip bytes.Buffer
+	require.NoError(t, zipslicer.ZipToTar(f, &tarzip))
+	digest, err := digestApkStream(&tarzip, crypto.SHA256)
+	require.NoError(t, err)
+	patch, err := digest.Sign(cert, true)
+	if err != nil {
+		return "", err
+	}
+	signed, err := patch.ApplyBytes(buf.Bytes())
+	require.NoError(t, err)
+	signedPath := filepath.Join(dir, "signed.apk")
+	require.NoError(t, os.WriteFile(signedPath, signed, 0644))
+	return signedPath, nil
+}
+
+func verifyApk(t *testing.T, path string) []*signers.Signature {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	sigs, err := verify(f, signers.VerifyOpts{})
+	require.NoError(t, err)
+	return sigs
+}
+
+func TestSignV3(t *testing.T) {
+	cert := makeCert(t, "signer")
+	signed, err := signApk(t, cert)
+	require.NoError(t, err)
+	sigs := verifyApk(t, signed)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, "v2", sigs[0].SigInfo)
+	assert.Equal(t, "v3", sigs[1].SigInfo)
+	assert.Equal(t, cert.Leaf.Raw, sigs[1].X509Signature.Certificate.Raw)
+}
+
+func TestSignV3Lineage(t *testing.T) {
+	oldCert := makeCert(t, "old signer")
+	newCert := makeCert(t, "new signer")
+	newCert.ApkLineage = makeLineage(t, oldCert, newCert)
+	signed, err := signApk(t, newCert)
+	require.NoError(t, err)
+	sigs := verifyApk(t, signed)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, "v3 (rotated, 2 certificates)", sigs[1].SigInfo)
+	assert.Equal(t, newCert.Leaf.Raw, sigs[1].X509Signature.Certificate.Raw)
+	// re-parsing the embedded lineage gives back both certificates in order
+	_, lcerts, err := parseLineage(newCert.ApkLineage)
+	require.NoError(t, err)
+	require.Len(t, lcerts, 2)
+	assert.Equal(t, oldCert.Leaf.Raw, lcerts[0].Raw)
+	assert.Equal(t, newCert.Leaf.Raw, lcerts[1].Raw)
+}
+
+func TestSignV3LineageWrongLeaf(t *testing.T) {
+	oldCert := makeCert(t, "old signer")
+	newCert := makeCert(t, "new signer")
+	// the lineage stops at the old certificate, so the new one isn't in it
+	newCert.ApkLineage = makeLineage(t, oldCert)
+	_, err := signApk(t, newCert)
+	assert.ErrorContains(t, err, "does not end with the signing certificate")
+}
+
+func TestParseLineageBadSignature(t *testing.T) {
+	oldCert := makeCert(t, "old signer")
+	newCert := makeCert(t, "new signer")
+	lineage := makeLineage(t, oldCert, newCert)
+	// the second level's signature is last
+	lineage[len(lineage)-1] ^= 0xff
+	_, _, err := parseLineage(lineage)
+	assert.ErrorContains(t, err, "lineage level 2")
+}
+
+// testdata/rsa-to-ec.lineage is laid out like "apksigner rotate" output by
+// testdata/mklineage.py, rotating from an RSA key to testdata/ec-new.key
+func TestLineageFile(t *testing.T) {
+	blob, err := os.ReadFile("testdata/rsa-to-ec.lineage")
+	require.NoError(t, err)
+	_, lcerts, err := parseLineage(blob)
+	require.NoError(t, err)
+	require.Len(t, lcerts, 2)
+	assert.Equal(t, x509.RSA, lcerts[0].PublicKeyAlgorithm)
+	assert.Equal(t, x509.ECDSA, lcerts[1].PublicKeyAlgorithm)
+
+	pemBlob, err := os.ReadFile("testdata/ec-new.key")
+	require.NoError(t, err)
+	block, _ := pem.Decode(pemBlob)
+	require.NotNil(t, block)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	require.NoError(t, err)
+	cert := &certloader.Certificate{
+		Leaf:         lcerts[1],
+		Certificates: lcerts[1:],
+		PrivateKey:   key.(crypto.Signer),
+		ApkLineage:   blob,
+	}
+	signed, err := signApk(t, cert)
+	require.NoError(t, err)
+	sigs := verifyApk(t, signed)
+	require.Len(t, sigs, 2)
+	assert.Equal(t, "v3 (rotated, 2 certificates)", sigs[1].SigInfo)
+}
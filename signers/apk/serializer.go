@@ -36,9 +36,13 @@ func (r apkRaw) Bytes() []byte {
 	return []byte(r[4:])
 }
 
+// apkTail holds the remainder of the enclosing structure, without a length prefix
+type apkTail []byte
+
 var (
 	bytesType  = reflect.TypeOf([]byte(nil))
 	rawType    = reflect.TypeOf(apkRaw(nil))
+	tailType   = reflect.TypeOf(apkTail(nil))
 	uint32Type = reflect.TypeOf(uint32(0))
 )
 
@@ -68,13 +72,16 @@ func unmarshalR(blob []byte, v reflect.Value /*, path string*/) ([]byte, error)
 		//fmt.Printf("%s = 0x%x\n", path, i)
 		v.SetUint(uint64(i))
 		return blob[4:], nil
+	case v.Type() == tailType:
+		v.SetBytes(blob)
+		return nil, nil
 	}
 	// read uint32 length prefix
 	if len(blob) < 4 {
 		return nil, io.ErrUnexpectedEOF
 	}
 	size := int(binary.LittleEndian.Uint32(blob))
-	if 4+len(blob) < size {
+	if size < 0 || len(blob)-4 < size {
 		return nil, io.ErrUnexpectedEOF
 	}
 	remainder := blob[4+size:]
@@ -165,6 +172,9 @@ func (m *marshaller) marshal(v reflect.Value) error {
 	case v.Type() == uint32Type:
 		binary.LittleEndian.PutUint32(m.grow(4), uint32(v.Uint()))
 		return nil
+	case v.Type() == tailType:
+		m.write(v.Bytes())
+		return nil
 	}
 	// prefixed types
 	start := m.pos
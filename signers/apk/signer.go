@@ -17,6 +17,7 @@
 package apk
 
 import (
+	"crypto"
 	"errors"
 	"io"
 
@@ -32,6 +33,7 @@ var ApkSigner = &signers.Signer{
 	Name:      "apk",
 	Magic:     magic.FileTypeAPK,
 	CertTypes: signers.CertTypeX509,
+	Hashes:    []crypto.Hash{crypto.SHA256, crypto.SHA512},
 	Transform: zipbased.Transform,
 	Sign:      sign,
 	Verify:    verify,
@@ -40,6 +42,16 @@ var ApkSigner = &signers.Signer{
 const (
 	sigMagic = "APK Sig Block 42"
 	sigApkV2 = 0x7109871a
+	sigApkV3 = 0xf05368c0
+
+	// v2 attribute naming the newer schemes that must not be stripped
+	attrStrippingProtection = 0xbeeff00d
+	// v3 attribute holding the signing certificate lineage
+	attrProofOfRotation = 0x3ba06f8c
+
+	// v3 is understood starting with Android 9
+	v3MinSDK = 28
+	v3MaxSDK = 0x7fffffff
 )
 
 var (
@@ -48,6 +60,7 @@ var (
 )
 
 func init() {
+	ApkSigner.Flags().Bool("apk-v3", false, "(APK) Add an APK Signature Scheme v3 block alongside v2")
 	signers.Register(ApkSigner)
 }
 
@@ -56,7 +69,9 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if err != nil {
 		return nil, err
 	}
-	patchset, err := digest.Sign(cert)
+	// a configured lineage only makes sense in a v3 signature
+	v3 := opts.Flags.GetBool("apk-v3") || len(cert.ApkLineage) != 0
+	patchset, err := digest.Sign(cert, v3)
 	if err != nil {
 		return nil, err
 	}
@@ -35,16 +35,78 @@ type apkSignedData struct {
 }
 
 type apkAttribute struct {
+	ID    uint32
+	Value apkTail
+}
+
+type apkSignature struct {
 	ID    uint32
 	Value []byte
 }
 
-type apkSignature apkAttribute
-type apkDigest apkAttribute
+type apkDigest apkSignature
+
+// APK Signature Scheme v3 adds a supported SDK range to the v2 structures
+// https://source.android.com/security/apksigning/v3#format
+type apkV3Signer struct {
+	SignedData apkRaw
+	MinSDK     uint32
+	MaxSDK     uint32
+	Signatures []apkSignature
+	PublicKey  []byte
+}
+
+type apkV3SignedData struct {
+	Digests      []apkDigest
+	Certificates [][]byte
+	MinSDK       uint32
+	MaxSDK       uint32
+	Attributes   []apkAttribute
+}
+
+// one level of a v3 proof-of-rotation lineage, signed by the previous level
+type lineageNode struct {
+	SignedData apkRaw
+	Flags      uint32
+	SigAlgID   uint32 // algorithm this level uses to sign the next, 0 for the newest
+	Signature  []byte // signature of SignedData by the previous level
+}
+
+type lineageSignedData struct {
+	Certificate []byte
+	SigAlgID    uint32 // algorithm the previous level signed with, 0 for the oldest
+}
 
 func (sd *apkSignedData) ParseCertificates() (certs []*x509.Certificate, err error) {
-	certs = make([]*x509.Certificate, len(sd.Certificates))
-	for i, der := range sd.Certificates {
+	return parseCertificates(sd.Certificates)
+}
+
+// Attribute returns the value of the additional attribute with the given ID
+func (sd *apkSignedData) Attribute(id uint32) []byte {
+	return findAttribute(sd.Attributes, id)
+}
+
+func (sd *apkV3SignedData) ParseCertificates() (certs []*x509.Certificate, err error) {
+	return parseCertificates(sd.Certificates)
+}
+
+// Attribute returns the value of the additional attribute with the given ID
+func (sd *apkV3SignedData) Attribute(id uint32) []byte {
+	return findAttribute(sd.Attributes, id)
+}
+
+func findAttribute(attrs []apkAttribute, id uint32) []byte {
+	for _, attr := range attrs {
+		if attr.ID == id {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+func parseCertificates(ders [][]byte) (certs []*x509.Certificate, err error) {
+	certs = make([]*x509.Certificate, len(ders))
+	for i, der := range ders {
 		certs[i], err = x509.ParseCertificate(der)
 		if err != nil {
 			return nil, err
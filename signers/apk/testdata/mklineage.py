@@ -0,0 +1,47 @@
+#!/usr/bin/env python3
+#
+# Writes rsa-to-ec.lineage, a lineage rotating from an RSA-2048 signer to an
+# EC P-256 signer, laid out byte-for-byte the way apksig's
+# SigningCertificateLineage.writeToFile encodes "apksigner rotate" output.
+# Only openssl is used for the keys and signature, so the result does not
+# depend on relic's own encoder.
+
+import struct
+import subprocess
+
+MAGIC = 0x3eff39d1
+RSA_PKCS1_SHA256 = 0x0103
+# installed data, shared UID, permission and auth capabilities (apksig's default)
+FLAGS = 0x17
+
+
+def run(*args):
+    return subprocess.run(args, check=True, capture_output=True).stdout
+
+
+def u32(v):
+    return struct.pack('<I', v)
+
+
+def lp(b):
+    return u32(len(b)) + b
+
+
+def cert(key, cn):
+    return run('openssl', 'req', '-x509', '-new', '-key', key, '-subj', '/CN=' + cn,
+               '-days', '36500', '-sha256', '-outform', 'DER')
+
+
+run('openssl', 'genpkey', '-algorithm', 'RSA', '-pkeyopt', 'rsa_keygen_bits:2048', '-out', 'rsa-old.key')
+run('openssl', 'genpkey', '-algorithm', 'EC', '-pkeyopt', 'ec_paramgen_curve:P-256', '-out', 'ec-new.key')
+old = cert('rsa-old.key', 'old signer')
+new = cert('ec-new.key', 'new signer')
+
+# the oldest level names the algorithm it signs the next level with
+node1 = lp(lp(old) + u32(0)) + u32(FLAGS) + u32(RSA_PKCS1_SHA256) + lp(b'')
+signed = lp(new) + u32(RSA_PKCS1_SHA256)
+sig = subprocess.run(['openssl', 'dgst', '-sha256', '-sign', 'rsa-old.key'],
+                     input=signed, check=True, capture_output=True).stdout
+node2 = lp(lp(signed) + u32(FLAGS) + u32(0) + lp(sig))
+with open('rsa-to-ec.lineage', 'wb') as f:
+    f.write(u32(MAGIC) + u32(1) + u32(1) + lp(node1) + node2)
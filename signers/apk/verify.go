@@ -41,12 +41,13 @@ import (
 )
 
 func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
-	// verify v2
+	// verify v2 and v3
 	inz, block, err := getSigBlock(f)
 	if err != nil {
 		return nil, err
 	}
 	var allSigs []*signers.Signature
+	var v3present, wantV3 bool
 	for len(block) > 0 {
 		if len(block) < 12 {
 			return nil, errTruncated
@@ -59,33 +60,56 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 		partType := binary.LittleEndian.Uint32(block)
 		partBlob := block[4:partSize]
 		block = block[partSize:]
-		if partType != sigApkV2 {
-			continue
-		}
-		var signerList []apkSigner
-		if err := unmarshal(partBlob, &signerList); err != nil {
-			return nil, fmt.Errorf("parsing signature block: %w", err)
-		} else if len(signerList) == 0 {
-			return nil, errors.New("empty APK signing block")
-		}
-		for i, signer := range signerList {
-			sig, err := signer.Verify(nil)
-			if err != nil {
-				return nil, fmt.Errorf("APK signature #%d: %w", i+1, err)
+		switch partType {
+		case sigApkV2:
+			var signerList []apkSigner
+			if err := unmarshal(partBlob, &signerList); err != nil {
+				return nil, fmt.Errorf("parsing signature block: %w", err)
+			} else if len(signerList) == 0 {
+				return nil, errors.New("empty APK signing block")
+			}
+			for i, signer := range signerList {
+				sig, stripped, err := signer.Verify(inz)
+				if err != nil {
+					return nil, fmt.Errorf("APK signature #%d: %w", i+1, err)
+				}
+				wantV3 = wantV3 || stripped
+				allSigs = append(allSigs, sig)
+			}
+		case sigApkV3:
+			var signerList []apkV3Signer
+			if err := unmarshal(partBlob, &signerList); err != nil {
+				return nil, fmt.Errorf("parsing v3 signature block: %w", err)
+			} else if len(signerList) == 0 {
+				return nil, errors.New("empty APK v3 signing block")
+			}
+			for i, signer := range signerList {
+				sig, err := signer.Verify(inz)
+				if err != nil {
+					return nil, fmt.Errorf("APK v3 signature #%d: %w", i+1, err)
+				}
+				allSigs = append(allSigs, sig)
 			}
-			allSigs = append(allSigs, sig)
+			v3present = true
 		}
 	}
+	if wantV3 && !v3present {
+		return nil, errors.New("V2 signature requires a V3 signature but none exists")
+	}
 	v2present := len(allSigs) != 0
 	// verify v1
 	inzr, err := zip.NewReader(f, inz.Size)
 	if err != nil {
 		return nil, err
 	}
-	jarSigs, err := signjar.Verify(inzr, false)
-	if err != nil {
-		if _, ok := err.(sigerrors.NotSignedError); !ok {
-			return nil, err
+	var jarSigs []*signjar.JarSignature
+	if hasManifest(inzr) || !v2present {
+		// APKs for newer Android versions may have only a v2 or v3 signature
+		jarSigs, err = signjar.Verify(inzr, false)
+		if err != nil {
+			if _, ok := err.(sigerrors.NotSignedError); !ok {
+				return nil, err
+			}
 		}
 	}
 	for _, jarSig := range jarSigs {
@@ -105,6 +129,15 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	return allSigs, nil
 }
 
+func hasManifest(inzr *zip.Reader) bool {
+	for _, f := range inzr.File {
+		if strings.EqualFold(f.Name, "META-INF/MANIFEST.MF") {
+			return true
+		}
+	}
+	return false
+}
+
 func getSigBlock(f *os.File) (*zipslicer.Directory, []byte, error) {
 	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
@@ -144,68 +177,135 @@ func getSigBlock(f *os.File) (*zipslicer.Directory, []byte, error) {
 	return inz, blob[8 : len(blob)-24], nil
 }
 
-func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error) {
-	if len(s.Signatures) == 0 {
-		return nil, errors.New("no signatures in APK signer block")
+// Verify a v2 signer. The second return value is true if the signer requires
+// a v3 signature to also be present.
+func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, bool, error) {
+	bestHash, err := verifySignatures(s.Signatures, s.PublicKey, s.SignedData)
+	if err != nil {
+		return nil, false, err
+	}
+	var signedData apkSignedData
+	if err := unmarshal(s.SignedData, &signedData); err != nil {
+		return nil, false, err
 	}
-	// check signatures over SignedData
-	publicKey, err := x509.ParsePKIXPublicKey(s.PublicKey)
+	if err := checkDigests(signedData.Digests, inz); err != nil {
+		return nil, false, err
+	}
+	certs, err := signedData.ParseCertificates()
+	if err != nil {
+		return nil, false, err
+	}
+	sig, err := makeSignature("v2", bestHash, s.PublicKey, certs)
+	if err != nil {
+		return nil, false, err
+	}
+	var stripped bool
+	if value := signedData.Attribute(attrStrippingProtection); len(value) == 4 {
+		stripped = binary.LittleEndian.Uint32(value) == 3
+	}
+	return sig, stripped, nil
+}
+
+// Verify a v3 signer, including its proof-of-rotation lineage if present
+func (s *apkV3Signer) Verify(inz *zipslicer.Directory) (*signers.Signature, error) {
+	bestHash, err := verifySignatures(s.Signatures, s.PublicKey, s.SignedData)
 	if err != nil {
 		return nil, err
 	}
-	var bestHash crypto.Hash
-	for _, sig := range s.Signatures {
-		hash, err := sig.VerifySignature(publicKey, s.SignedData.Bytes())
+	var signedData apkV3SignedData
+	if err := unmarshal(s.SignedData, &signedData); err != nil {
+		return nil, err
+	}
+	if signedData.MinSDK != s.MinSDK || signedData.MaxSDK != s.MaxSDK {
+		return nil, errors.New("SDK versions in signed data do not match signer")
+	}
+	if err := checkDigests(signedData.Digests, inz); err != nil {
+		return nil, err
+	}
+	certs, err := signedData.ParseCertificates()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := makeSignature("v3", bestHash, s.PublicKey, certs)
+	if err != nil {
+		return nil, err
+	}
+	if lineage := signedData.Attribute(attrProofOfRotation); lineage != nil {
+		_, lcerts, err := parseLineage(lineage)
 		if err != nil {
 			return nil, err
 		}
+		if !bytes.Equal(lcerts[len(lcerts)-1].Raw, sig.X509Signature.Certificate.Raw) {
+			return nil, errors.New("lineage does not end with the signing certificate")
+		}
+		sig.SigInfo = fmt.Sprintf("v3 (rotated, %d certificates)", len(lcerts))
+	}
+	return sig, nil
+}
+
+// check signatures over SignedData, returning the strongest hash used
+func verifySignatures(sigs []apkSignature, spki []byte, signedData apkRaw) (crypto.Hash, error) {
+	if len(sigs) == 0 {
+		return 0, errors.New("no signatures in APK signer block")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return 0, err
+	}
+	var bestHash crypto.Hash
+	for _, sig := range sigs {
+		hash, err := sig.VerifySignature(publicKey, signedData.Bytes())
+		if err != nil {
+			return 0, err
+		}
 		// check them all but only need to report one per signature
 		if hash > bestHash {
 			bestHash = hash
 		}
 	}
-	// check digests
-	var signedData apkSignedData
-	if err := unmarshal(s.SignedData, &signedData); err != nil {
-		return nil, err
+	return bestHash, nil
+}
+
+// check digests of the APK contents
+func checkDigests(signedDigests []apkDigest, inz *zipslicer.Directory) error {
+	if len(signedDigests) == 0 {
+		return errors.New("no digests in APK signed data block")
 	}
-	if len(signedData.Digests) == 0 {
-		return nil, errors.New("no digests in APK signed data block")
+	if inz == nil {
+		return nil
 	}
-	if inz != nil {
-		hashes := make([]crypto.Hash, len(signedData.Digests))
-		for i, digest := range signedData.Digests {
-			st, err := sigTypeByID(digest.ID)
-			if err != nil {
-				return nil, err
-			}
-			hashes[i] = st.hash
-		}
-		hasher := newMerkleHasher(hashes)
-		for _, f := range inz.File {
-			if _, err := f.Dump(hasher); err != nil {
-				return nil, err
-			}
-		}
-		digests, err := hasher.Finish(inz, false)
+	hashes := make([]crypto.Hash, len(signedDigests))
+	for i, digest := range signedDigests {
+		st, err := sigTypeByID(digest.ID)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		for i, digest := range signedData.Digests {
-			if !hmac.Equal(digest.Value, digests[i]) {
-				return nil, fmt.Errorf("digest mismatch for algorithm 0x%04x", digest.ID)
-			}
+		hashes[i] = st.hash
+	}
+	hasher := newMerkleHasher(hashes)
+	for _, f := range inz.File {
+		if _, err := f.Dump(hasher); err != nil {
+			return err
 		}
 	}
-	// identify which certificate is the leaf
-	certs, err := signedData.ParseCertificates()
+	digests, err := hasher.Finish(inz, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	for i, digest := range signedDigests {
+		if !hmac.Equal(digest.Value, digests[i]) {
+			return fmt.Errorf("digest mismatch for algorithm 0x%04x", digest.ID)
+		}
+	}
+	return nil
+}
+
+// identify which certificate is the leaf
+func makeSignature(sigInfo string, hash crypto.Hash, spki []byte, certs []*x509.Certificate) (*signers.Signature, error) {
 	var leaf *x509.Certificate
 	var intermediates []*x509.Certificate
 	for _, cert := range certs {
-		if bytes.Equal(cert.RawSubjectPublicKeyInfo, s.PublicKey) {
+		if bytes.Equal(cert.RawSubjectPublicKeyInfo, spki) {
 			leaf = cert
 		} else {
 			intermediates = append(intermediates, cert)
@@ -215,8 +315,8 @@ func (s *apkSigner) Verify(inz *zipslicer.Directory) (*signers.Signature, error)
 		return nil, errors.New("public key does not match any certificate")
 	}
 	return &signers.Signature{
-		SigInfo: "v2",
-		Hash:    bestHash,
+		SigInfo: sigInfo,
+		Hash:    hash,
 		X509Signature: &pkcs9.TimestampedSignature{
 			Signature: pkcs7.Signature{
 				Certificate:   leaf,
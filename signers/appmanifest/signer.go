@@ -21,6 +21,7 @@ package appmanifest
 // other Microsoft signatures, does not use an Authenticode PKCS#7 structure.
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -31,6 +32,7 @@ import (
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/xmldsig"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
@@ -38,6 +40,8 @@ var AppSigner = &signers.Signer{
 	Name:         "appmanifest",
 	Magic:        magic.FileTypeAppManifest,
 	CertTypes:    signers.CertTypeX509,
+	ExtKeyUsage:  x509.ExtKeyUsageCodeSigning,
+	Hashes:       xmldsig.Hashes,
 	FormatLog:    formatLog,
 	Sign:         sign,
 	VerifyStream: verify,
@@ -19,6 +19,8 @@ package appx
 // Sign Windows Universal (UWP) .appx and .appxbundle
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -32,15 +34,18 @@ import (
 )
 
 var AppxSigner = &signers.Signer{
-	Name:      "appx",
-	Magic:     magic.FileTypeAPPX,
-	CertTypes: signers.CertTypeX509,
-	Transform: zipbased.Transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "appx",
+	Magic:       magic.FileTypeAPPX,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      signappx.Hashes,
+	Transform:   zipbased.Transform,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
+	AppxSigner.Flags().Bool("rewrite-publisher", false, "(APPX) Replace the publisher in the manifest with the signing certificate's subject instead of requiring them to match")
 	pecoff.AddOpusFlags(AppxSigner)
 	signers.Register(AppxSigner)
 }
@@ -50,8 +55,11 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if err != nil {
 		return nil, err
 	}
+	digest.RewritePublisher = opts.Flags.GetBool("rewrite-publisher")
 	patch, priSig, _, err := digest.Sign(opts.Context(), cert, pecoff.OpusFlags(opts))
-	if err != nil {
+	if e := new(signappx.PublisherMismatchError); errors.As(err, e) {
+		return nil, fmt.Errorf("%w\nuse a certificate for the publisher or pass --rewrite-publisher", err)
+	} else if err != nil {
 		return nil, err
 	}
 	opts.Audit.SetCounterSignature(priSig.CounterSignature)
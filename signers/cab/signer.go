@@ -19,6 +19,7 @@ package cab
 // Sign Microsoft cabinet files
 
 import (
+	"crypto/x509"
 	"io"
 	"os"
 
@@ -31,11 +32,13 @@ import (
 )
 
 var CabSigner = &signers.Signer{
-	Name:      "cab",
-	Magic:     magic.FileTypeCAB,
-	CertTypes: signers.CertTypeX509,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "cab",
+	Magic:       magic.FileTypeCAB,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
@@ -0,0 +1,97 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cat
+
+// Implementation for the "relic make-catalog" command, which builds an
+// unsigned security catalog to be signed afterwards like any other catalog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sassoftware/relic/v8/cmdline/shared"
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/authenticode"
+)
+
+var MakeCatalogCmd = &cobra.Command{
+	Use:   "make-catalog -o FILE.cat [flags] [file or directory...]",
+	Short: "Build a security catalog listing the given files",
+	Long: `Build a security catalog listing the digest of each of the given files.
+Directories are searched recursively. PE images are listed by their Authenticode
+digest and other files by the digest of their full contents.
+
+The catalog is written unsigned. Sign it afterwards with "relic sign" or
+"relic remote sign".`,
+	RunE: makeCatalogCmd,
+}
+
+var argCatOutput string
+
+func init() {
+	shared.RootCmd.AddCommand(MakeCatalogCmd)
+	MakeCatalogCmd.Flags().StringVarP(&argCatOutput, "output", "o", "", "Output file")
+	shared.AddDigestFlag(MakeCatalogCmd)
+}
+
+func makeCatalogCmd(cmd *cobra.Command, args []string) error {
+	if argCatOutput == "" || len(args) == 0 {
+		return errors.New("--output and at least one input are required")
+	}
+	hash, err := shared.GetDigest()
+	if err != nil {
+		return err
+	}
+	cat := authenticode.NewCatalog(hash)
+	for _, arg := range args {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if err := addMember(cat, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return shared.Fail(err)
+		}
+	}
+	blob, err := cat.MarshalUnsigned()
+	if err != nil {
+		return shared.Fail(err)
+	}
+	return shared.Fail(atomicfile.WriteFile(argCatOutput, blob))
+}
+
+func addMember(cat *authenticode.Catalog, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	indirect, err := authenticode.DigestCatalogMember(f, cat.Hash)
+	if err != nil {
+		return err
+	}
+	return cat.AddMember(filepath.Base(path), indirect)
+}
@@ -19,9 +19,13 @@ package cat
 // Sign Microsoft security catalog files
 
 import (
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/sassoftware/relic/v8/lib/authenticode"
 	"github.com/sassoftware/relic/v8/lib/certloader"
@@ -33,11 +37,13 @@ import (
 )
 
 var CatSigner = &signers.Signer{
-	Name:      "cat",
-	Magic:     magic.FileTypeCAT,
-	CertTypes: signers.CertTypeX509,
-	Sign:      sign,
-	Verify:    pkcs.Verify,
+	Name:        "cat",
+	Magic:       magic.FileTypeCAT,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
@@ -70,3 +76,52 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	}
 	return opts.SetPkcs7(ts)
 }
+
+// verify the catalog signature and, if --content is given, that the file is
+// listed in the catalog
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	content := opts.Content
+	opts.Content = ""
+	sigs, err := pkcs.Verify(f, opts)
+	if err != nil || content == "" {
+		return sigs, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	blob, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	psd, err := pkcs7.Unmarshal(blob)
+	if err != nil {
+		return nil, err
+	}
+	ctl, err := authenticode.ParseCatalog(psd)
+	if err != nil {
+		return nil, err
+	}
+	member, err := findMember(ctl, content)
+	if err != nil {
+		return nil, err
+	} else if member == nil {
+		return nil, fmt.Errorf("%s is not listed in the catalog", content)
+	}
+	info := fmt.Sprintf("[member:%s]", filepath.Base(content))
+	if member.Name != "" {
+		info = fmt.Sprintf("[member:%q]", member.Name)
+	}
+	for _, sig := range sigs {
+		sig.SigInfo += info
+	}
+	return sigs, nil
+}
+
+func findMember(ctl *authenticode.CertTrustList, path string) (*authenticode.CatalogMember, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ctl.FindMember(f)
+}
@@ -0,0 +1,120 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cms
+
+// Create detached PKCS#7/CMS signatures over arbitrary files. The resulting
+// .p7s is verified by the pkcs7 module.
+
+import (
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/pkcs"
+)
+
+var CmsSigner = &signers.Signer{
+	Name:         "generic-cms",
+	Aliases:      []string{"cms"},
+	CertTypes:    signers.CertTypeX509,
+	StreamOutput: true,
+	Transform:    transform,
+	Sign:         sign,
+}
+
+func init() {
+	CmsSigner.Flags().Bool("cms-signing-time", false, "(CMS) Include the signing time as an authenticated attribute")
+	CmsSigner.Flags().Bool("cms-chain", false, "(CMS) Include the full certificate chain instead of just the signing certificate")
+	signers.Register(CmsSigner)
+}
+
+type cmsTransformer struct {
+	f *os.File
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &cmsTransformer{f}, nil
+}
+
+func (t *cmsTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Apply writes the signature to the output file, or alongside the input if no
+// output was specified
+func (t *cmsTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += pkcs.DetachedSuffix
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	blob, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	certs := []*x509.Certificate{cert.Leaf}
+	if opts.Flags.GetBool("cms-chain") || cert.IncludeChain {
+		certs = cert.Chain()
+	}
+	sig := pkcs7.NewBuilder(cert.Signer(), certs, opts.Hash)
+	if err := sig.SetContentData(blob); err != nil {
+		return nil, err
+	}
+	if opts.Flags.GetBool("cms-signing-time") {
+		if err := sig.AddAuthenticatedAttribute(pkcs7.OidAttributeSigningTime, opts.Time.UTC().Truncate(time.Second)); err != nil {
+			return nil, err
+		}
+	}
+	psd, err := sig.Sign()
+	if err != nil {
+		return nil, err
+	}
+	ts, err := pkcs9.TimestampAndMarshal(opts.Context(), psd, cert.Timestamper, false)
+	if err != nil {
+		return nil, err
+	}
+	// content was embedded for the self-check, now take it back out
+	if _, err := psd.Detach(); err != nil {
+		return nil, err
+	}
+	ts.Raw, err = psd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return opts.SetPkcs7(ts)
+}
@@ -0,0 +1,102 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	oci "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/sassoftware/relic/v8/lib/ociregistry"
+)
+
+// SignatureTag returns the tag where cosign looks for the signatures of an
+// image, such as sha256-<hex>.sig
+func SignatureTag(d digest.Digest) string {
+	return d.Algorithm().String() + "-" + d.Encoded() + ".sig"
+}
+
+// PushSignature stores a signature made by this signer in the image's
+// repository under the tag returned by SignatureTag, which is where cosign
+// verify looks for it. Signatures already stored under the tag are kept.
+func PushSignature(ctx context.Context, client *ociregistry.Client, image ociregistry.Reference, artifact []byte) (ociregistry.Reference, error) {
+	var signed oci.Manifest
+	if err := json.Unmarshal(artifact, &signed); err != nil {
+		return ociregistry.Reference{}, fmt.Errorf("parsing signature: %w", err)
+	}
+	if signed.ArtifactType != cosignArtifactType || signed.Subject == nil || len(signed.Layers) != 1 || signed.Layers[0].Data == nil {
+		return ociregistry.Reference{}, errors.New("parsing signature: not a cosign signature")
+	}
+	layer := signed.Layers[0]
+	payload := layer.Data
+	layer.Data = nil
+	sigRef := image.WithTag(SignatureTag(signed.Subject.Digest))
+	// add to the existing signatures, if any
+	var layers []oci.Descriptor
+	if _, blob, err := client.GetManifest(ctx, sigRef); err == nil {
+		var existing oci.Manifest
+		if err := json.Unmarshal(blob, &existing); err != nil {
+			return sigRef, fmt.Errorf("parsing existing signatures in %s: %w", sigRef, err)
+		}
+		layers = existing.Layers
+	} else if !ociregistry.IsNotFound(err) {
+		return sigRef, err
+	}
+	for _, other := range layers {
+		if other.Digest == layer.Digest && other.Annotations[signatureAnnotationKey] == layer.Annotations[signatureAnnotationKey] {
+			return sigRef, nil
+		}
+	}
+	layers = append(layers, layer)
+	uploaded, err := client.PutBlob(ctx, image, layer.MediaType, payload)
+	if err != nil {
+		return sigRef, err
+	} else if uploaded.Digest != layer.Digest {
+		return sigRef, fmt.Errorf("signature payload digest %s can't be stored in a registry, use SHA-256", layer.Digest.Algorithm())
+	}
+	// the config is a minimal image config listing the signature layers
+	imageConfig := oci.Image{
+		RootFS: oci.RootFS{Type: "layers"},
+	}
+	for _, l := range layers {
+		imageConfig.RootFS.DiffIDs = append(imageConfig.RootFS.DiffIDs, l.Digest)
+	}
+	configBlob, err := json.Marshal(imageConfig)
+	if err != nil {
+		return sigRef, err
+	}
+	configDesc, err := client.PutBlob(ctx, image, oci.MediaTypeImageConfig, configBlob)
+	if err != nil {
+		return sigRef, err
+	}
+	manifest, err := json.Marshal(oci.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: oci.MediaTypeImageManifest,
+		Config:    configDesc,
+		Layers:    layers,
+	})
+	if err != nil {
+		return sigRef, err
+	}
+	_, err = client.PutManifest(ctx, sigRef, oci.MediaTypeImageManifest, manifest)
+	return sigRef, err
+}
@@ -1,6 +1,7 @@
 package cosign
 
 import (
+	"crypto"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -18,9 +19,11 @@ import (
 )
 
 var signer = &signers.Signer{
-	Name:      "cosign",
-	CertTypes: signers.CertTypeX509,
-	Sign:      sign,
+	Name:         "cosign",
+	CertTypes:    signers.CertTypeX509,
+	StreamOutput: true,
+	Hashes:       []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512},
+	Sign:         sign,
 }
 
 func init() {
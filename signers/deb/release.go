@@ -0,0 +1,198 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package deb
+
+// Sign the Release file of an apt repository, producing both the detached
+// Release.gpg and the cleartext-signed InRelease alongside it
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+var ReleaseSigner = &signers.Signer{
+	Name:      "apt-release",
+	Aliases:   []string{"release"},
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testReleasePath,
+	Transform: releaseTransform,
+	Sign:      releaseSign,
+	Verify:    releaseVerify,
+}
+
+// Release files are a few KB even for large repositories
+const maxReleaseSize = 10 * 1000 * 1000
+
+var sigHeader = []byte("-----BEGIN PGP SIGNATURE-----")
+
+func init() {
+	signers.Register(ReleaseSigner)
+}
+
+func testReleasePath(fp string) bool {
+	return filepath.Base(fp) == "Release"
+}
+
+type releaseTransformer struct {
+	f       *os.File
+	release []byte
+}
+
+func releaseTransform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	release, err := io.ReadAll(io.LimitReader(f, maxReleaseSize))
+	if err != nil {
+		return nil, err
+	} else if len(release) == maxReleaseSize {
+		return nil, errors.New("release file is too big")
+	}
+	return &releaseTransformer{f: f, release: release}, nil
+}
+
+func (t *releaseTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.release), nil
+}
+
+// Apply writes InRelease and Release.gpg next to dest, and dest itself if it
+// isn't the file that was signed
+func (t *releaseTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	blob, err := io.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	// the clearsign signature comes first, then the detached one
+	i := bytes.LastIndex(blob, sigHeader)
+	if i <= 0 {
+		return errors.New("expected two signatures from the server")
+	}
+	clearSig, detachedSig := blob[:i], blob[i:]
+	if dest != t.f.Name() {
+		if err := writeReleaseFile(dest, t.release); err != nil {
+			return err
+		}
+	}
+	var inRelease bytes.Buffer
+	if err := pgptools.MergeClearSign(&inRelease, clearSig, bytes.NewReader(t.release)); err != nil {
+		return err
+	}
+	dir := filepath.Dir(dest)
+	if err := writeReleaseFile(filepath.Join(dir, "InRelease"), inRelease.Bytes()); err != nil {
+		return err
+	}
+	t.f.Close()
+	return writeReleaseFile(dest+".gpg", detachedSig)
+}
+
+func writeReleaseFile(dest string, contents []byte) error {
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := outfile.Write(contents); err != nil {
+		return err
+	}
+	return outfile.Commit()
+}
+
+func releaseSign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	release, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := pgptools.DetachClearSign(&buf, cert.PgpKey, bytes.NewReader(release), config); err != nil {
+		return nil, err
+	}
+	if err := openpgp.ArmoredDetachSign(&buf, cert.PgpKey, bytes.NewReader(release), config); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// releaseVerify checks whichever of Release.gpg and InRelease are present
+// next to the Release file
+func releaseVerify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	release, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*signers.Signature
+	addSig := func(what string, info *pgptools.PgpSignature) {
+		ret = append(ret, &signers.Signature{
+			SigInfo:      what,
+			CreationTime: info.CreationTime,
+			Hash:         info.Hash,
+			SignerPgp:    info.Key.Entity,
+		})
+	}
+	if detached, err := os.ReadFile(f.Name() + ".gpg"); err == nil {
+		sigr := io.Reader(bytes.NewReader(detached))
+		if bytes.HasPrefix(detached, sigHeader) {
+			block, err := armor.Decode(sigr)
+			if err != nil {
+				return nil, fmt.Errorf("Release.gpg: %w", err)
+			}
+			sigr = block.Body
+		}
+		info, err := pgptools.VerifyDetached(sigr, bytes.NewReader(release), opts.TrustedPgp)
+		if err != nil {
+			return nil, fmt.Errorf("Release.gpg: %w", err)
+		}
+		addSig("Release.gpg", info)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if inRelease, err := os.ReadFile(filepath.Join(filepath.Dir(f.Name()), "InRelease")); err == nil {
+		var body bytes.Buffer
+		info, err := pgptools.VerifyClearSign(bytes.NewReader(inRelease), &body, opts.TrustedPgp)
+		if err != nil {
+			return nil, fmt.Errorf("InRelease: %w", err)
+		}
+		// the signed text has canonical CRLF line endings
+		signedText := bytes.ReplaceAll(body.Bytes(), []byte("\r\n"), []byte("\n"))
+		if !opts.NoDigests && !bytes.Equal(bytes.TrimRight(signedText, "\n"), bytes.TrimRight(release, "\n")) {
+			return nil, errors.New("InRelease: signed contents do not match Release")
+		}
+		addSig("InRelease", info)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "apt Release"}
+	}
+	return ret, nil
+}
@@ -19,6 +19,7 @@ package deb
 // Sign Debian packages
 
 import (
+	"fmt"
 	"io"
 	"os"
 
@@ -31,6 +32,11 @@ import (
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
 
+const (
+	formatDpkgSig = "dpkg-sig"
+	formatDebsigs = "debsigs"
+)
+
 var DebSigner = &signers.Signer{
 	Name:      "deb",
 	Magic:     magic.FileTypeDEB,
@@ -41,7 +47,8 @@ var DebSigner = &signers.Signer{
 }
 
 func init() {
-	DebSigner.Flags().StringP("role", "r", "builder", "(DEB) signing role: builder, origin, maint, archive")
+	DebSigner.Flags().StringP("role", "r", "", "(DEB) signing role: builder, origin, maint, archive (default builder, or origin with --deb-format=debsigs)")
+	DebSigner.Flags().String("deb-format", formatDpkgSig, "(DEB) signature format: dpkg-sig or debsigs")
 	signers.Register(DebSigner)
 }
 
@@ -51,13 +58,31 @@ func formatLog(attrs *audit.Info) *zerolog.Event {
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
 	role := opts.Flags.GetString("role")
-	if role == "" {
-		role = "builder"
+	var sig *signdeb.DebSignature
+	var err error
+	format := opts.Flags.GetString("deb-format")
+	switch format {
+	case "":
+		format = formatDpkgSig
+		fallthrough
+	case formatDpkgSig:
+		if role == "" {
+			role = "builder"
+		}
+		sig, err = signdeb.Sign(r, cert.PgpKey, opts.Hash, role)
+	case formatDebsigs:
+		if role == "" {
+			role = "origin"
+		}
+		sig, err = signdeb.SignDebsigs(r, cert.PgpKey, opts.Hash, role)
+	default:
+		return nil, fmt.Errorf("unknown deb-format %q", format)
 	}
-	sig, err := signdeb.Sign(r, cert.PgpKey, opts.Hash, role)
 	if err != nil {
 		return nil, err
 	}
+	opts.Audit.Attributes["deb.format"] = format
+	opts.Audit.Attributes["deb.role"] = role
 	opts.Audit.Attributes["deb.name"] = sig.Info.Package
 	opts.Audit.Attributes["deb.version"] = sig.Info.Version
 	opts.Audit.Attributes["deb.arch"] = sig.Info.Arch
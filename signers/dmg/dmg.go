@@ -1,23 +1,27 @@
 package dmg
 
 import (
+	"crypto/x509"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/fruit/csblob"
 	"github.com/sassoftware/relic/v8/lib/fruit/dmg"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
 var signer = &signers.Signer{
-	Name:      "dmg",
-	CertTypes: signers.CertTypeX509,
-	TestPath:  testPath,
-	Verify:    verify,
-	Sign:      sign,
-	Transform: transform,
+	Name:        "dmg",
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      csblob.Hashes,
+	TestPath:    testPath,
+	Verify:      verify,
+	Sign:        sign,
+	Transform:   transform,
 }
 
 func init() {
@@ -40,6 +44,7 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	params := &dmg.SignatureParams{
 		HashFunc:        opts.Hash,
 		SigningIdentity: opts.Flags.GetString("bundle-id"),
+		SigningTime:     opts.Time,
 	}
 	if v := args["requirements"]; v != nil {
 		params.Requirements = v
@@ -0,0 +1,114 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package helm
+
+// Sign Helm charts by writing a provenance file alongside the chart archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/signhelm"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+var HelmSigner = &signers.Signer{
+	Name:      "helm",
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+const provSuffix = ".prov"
+
+func init() {
+	signers.Register(HelmSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".tgz")
+}
+
+type helmTransformer struct {
+	f *os.File
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &helmTransformer{f}, nil
+}
+
+func (t *helmTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Apply writes the provenance file next to the chart, which is left untouched
+func (t *helmTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	outfile, err := atomicfile.WriteAny(dest + provSuffix)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	if opts.Path == "" {
+		return nil, errors.New("chart file name is required")
+	}
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	return signhelm.Sign(r, filepath.Base(opts.Path), cert.PgpKey, config)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	prov, err := os.ReadFile(f.Name() + provSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, sigerrors.NotSignedError{Type: "Helm chart"}
+	} else if err != nil {
+		return nil, err
+	}
+	sig, err := signhelm.Verify(f, f.Name(), bytes.NewReader(prov), opts.TrustedPgp)
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		CreationTime: sig.CreationTime,
+		Hash:         sig.Hash,
+		SignerPgp:    sig.Key.Entity,
+	}}, nil
+}
@@ -20,6 +20,9 @@ package jar
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto/x509"
+	"errors"
 	"io"
 	"os"
 
@@ -31,12 +34,13 @@ import (
 )
 
 var JarSigner = &signers.Signer{
-	Name:      "jar",
-	Magic:     magic.FileTypeJAR,
-	CertTypes: signers.CertTypeX509,
-	Transform: zipbased.Transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "jar",
+	Magic:       magic.FileTypeJAR,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Transform:   transform,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
@@ -47,6 +51,19 @@ func init() {
 	signers.Register(JarSigner)
 }
 
+// JMOD files are a zip behind a 4-byte header
+var jmodMagic = []byte{'J', 'M', 1, 0}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	var hdr [4]byte
+	if _, err := f.ReadAt(hdr[:], 0); err == nil && bytes.Equal(hdr[:], jmodMagic) {
+		// jlink rejects JMOD entries outside of its sections, so there is no
+		// place to put META-INF/ signatures that wouldn't break the module
+		return nil, errors.New("JMOD files can't hold JAR signatures; sign the modular JAR before running \"jmod create\"")
+	}
+	return zipbased.Transform(f, opts)
+}
+
 // sign a manifest and return the PKCS#7 blob
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
 	argSectionsOnly := opts.Flags.GetBool("sections-only")
@@ -0,0 +1,200 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package jws
+
+// Sign JSON payloads such as JWT claims as a JSON Web Signature in compact
+// serialization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/signjws"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+const (
+	jwsSuffix = ".jws"
+	// tokens are meant to be small
+	maxPayloadSize = 1 << 20
+)
+
+var JWSSigner = &signers.Signer{
+	Name:         "jws",
+	Aliases:      []string{"jwt"},
+	Hashes:       signjws.Hashes,
+	StreamOutput: true,
+	TestPath:     testPath,
+	Transform:    transform,
+	Sign:         sign,
+	Verify:       verify,
+}
+
+func init() {
+	JWSSigner.Flags().String("jws-header", "", "(JWS) JSON object of extra protected header parameters, such as typ or a kid to use instead of the token key ID")
+	JWSSigner.Flags().Bool("jws-detached", false, "(JWS) Leave the payload out of the signature")
+	JWSSigner.Flags().Bool("jws-x5c", false, "(JWS) Include the certificate chain in the x5c header")
+	signers.Register(JWSSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, jwsSuffix) || strings.HasSuffix(fp, ".jwt")
+}
+
+type jwsTransformer struct {
+	f *os.File
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &jwsTransformer{f}, nil
+}
+
+func (t *jwsTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Apply writes the signature to the output file, or alongside the input if no
+// output was specified
+func (t *jwsTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		dest += jwsSuffix
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	payload, err := io.ReadAll(io.LimitReader(r, maxPayloadSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(payload) > maxPayloadSize {
+		return nil, fmt.Errorf("payload exceeds %d bytes", maxPayloadSize)
+	} else if !json.Valid(payload) {
+		return nil, errors.New("payload is not valid JSON")
+	}
+	header := make(map[string]interface{})
+	if h := opts.Flags.GetString("jws-header"); h != "" {
+		if err := json.Unmarshal([]byte(h), &header); err != nil {
+			return nil, fmt.Errorf("invalid --jws-header: %w", err)
+		}
+	}
+	if _, ok := header["kid"]; !ok {
+		if key, ok := cert.PrivateKey.(interface{ GetID() []byte }); ok && len(key.GetID()) != 0 {
+			header["kid"] = x509tools.FormatKeyID(key.GetID())
+		}
+	}
+	if opts.Flags.GetBool("jws-x5c") {
+		if cert.Leaf == nil {
+			return nil, errors.New("--jws-x5c requires a key with an X.509 certificate")
+		}
+		var chain []string
+		for _, c := range cert.Chain() {
+			chain = append(chain, base64.StdEncoding.EncodeToString(c.Raw))
+		}
+		header["x5c"] = chain
+	}
+	detached := opts.Flags.GetBool("jws-detached")
+	compact, err := signjws.Sign(cert.Signer(), opts.Hash, header, payload, detached)
+	if err != nil {
+		return nil, err
+	}
+	if kid, ok := header["kid"].(string); ok {
+		opts.Audit.Attributes["jws.kid"] = kid
+	}
+	opts.Audit.Attributes["jws.detached"] = detached
+	opts.Audit.SetMimeType("application/jose")
+	return []byte(compact), nil
+}
+
+// verify checks the signature using the key from the x5c header, or else one
+// of the certificates given with --cert. The payload of a detached signature
+// is read from --content, or the signature's filename without its suffix.
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := io.ReadAll(io.LimitReader(f, 4*maxPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signjws.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	if sig.Payload == nil {
+		contentPath := opts.Content
+		if contentPath == "" {
+			contentPath = strings.TrimSuffix(strings.TrimSuffix(opts.FileName, jwsSuffix), ".jwt")
+			if contentPath == opts.FileName {
+				return nil, errors.New("use --content to specify the detached payload")
+			}
+		}
+		payload, err = os.ReadFile(contentPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	chain, err := sig.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	var signerCert *pkcs7.Signature
+	if len(chain) != 0 {
+		if err := sig.Verify(chain[0].PublicKey, payload); err != nil {
+			return nil, err
+		}
+		signerCert = &pkcs7.Signature{Certificate: chain[0], Intermediates: chain[1:]}
+	} else {
+		for _, trusted := range opts.TrustedX509 {
+			if sig.Verify(trusted.PublicKey, payload) == nil {
+				signerCert = &pkcs7.Signature{Certificate: trusted}
+				break
+			}
+		}
+		if signerCert == nil {
+			return nil, errors.New("signature has no x5c header and does not match any certificate; use --cert to specify the signing certificate")
+		}
+	}
+	var info string
+	if kid := sig.KeyID(); kid != "" {
+		info = "kid " + kid + " "
+	}
+	return []*signers.Signature{{
+		SigInfo:       strings.TrimSpace(info + sig.Algorithm),
+		Hash:          sig.Hash(),
+		X509Signature: &pkcs9.TimestampedSignature{Signature: *signerCert},
+	}}, nil
+}
@@ -0,0 +1,85 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kmod
+
+// Sign Linux kernel modules with an appended PKCS#7 signature
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/signkmod"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+var KmodSigner = &signers.Signer{
+	Name:        "kmod",
+	Aliases:     []string{"kernel-module"},
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      signkmod.Hashes,
+	TestPath:    testPath,
+	Sign:        sign,
+	Verify:      verify,
+}
+
+func init() {
+	signers.Register(KmodSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".ko")
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	digest, err := signkmod.Digest(r, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := digest.Sign(cert)
+	if err != nil {
+		return nil, err
+	}
+	if digest.OldSigSize != 0 {
+		opts.Audit.Attributes["kmod.replaced"] = true
+	}
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signkmod.Verify(f, size, opts.TrustedX509, opts.NoDigests)
+	if errors.As(err, &pkcs7.MissingCertificateError{}) {
+		return nil, fmt.Errorf("%w; module signatures do not include certificates, use --cert to specify the signing certificate", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Hash:          sig.Hash,
+		X509Signature: &pkcs9.TimestampedSignature{Signature: sig.Signature},
+	}}, nil
+}
@@ -1,24 +1,31 @@
 package macho
 
 import (
+	"crypto/x509"
 	"debug/macho"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/sassoftware/relic/v8/lib/fruit/csblob"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
-var fatVerifier = &signers.Signer{
-	Name:      "mach-o-fat",
-	Magic:     magic.FileTypeMachOFat,
-	CertTypes: signers.CertTypeX509,
-	Verify:    verifyFatFile,
+var fatSigner = &signers.Signer{
+	Name:        "mach-o-fat",
+	Magic:       magic.FileTypeMachOFat,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      csblob.Hashes,
+	Transform:   transform,
+	Sign:        sign,
+	Verify:      verifyFatFile,
 }
 
 func init() {
-	signers.Register(fatVerifier)
+	addFlags(fatSigner)
+	signers.Register(fatSigner)
 }
 
 func verifyFatFile(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
@@ -2,6 +2,7 @@ package macho
 
 import (
 	"archive/zip"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
@@ -11,15 +12,18 @@ import (
 
 	"howett.net/plist"
 
+	"github.com/sassoftware/relic/v8/lib/fruit/csblob"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
 var ipaVerifier = &signers.Signer{
-	Name:      "ipa",
-	Magic:     magic.FileTypeIPA,
-	CertTypes: signers.CertTypeX509,
-	Verify:    verifyIPA,
+	Name:        "ipa",
+	Magic:       magic.FileTypeIPA,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      csblob.Hashes,
+	Verify:      verifyIPA,
 }
 
 func init() {
@@ -1,6 +1,8 @@
 package macho
 
 import (
+	"bufio"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"os"
@@ -13,24 +15,31 @@ import (
 )
 
 var signer = &signers.Signer{
-	Name:      "mach-o",
-	Magic:     magic.FileTypeMachO,
-	CertTypes: signers.CertTypeX509,
-	Transform: transform,
-	Sign:      sign,
-	Verify:    verifyMachoFile,
+	Name:        "mach-o",
+	Magic:       magic.FileTypeMachO,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      csblob.Hashes,
+	Transform:   transform,
+	Sign:        sign,
+	Verify:      verifyMachoFile,
 }
 
 func init() {
-	signer.Flags().String("bundle-id", "", "(Apple) app bundle ID")
-	signer.Flags().String("info-plist", "", "(Apple) Info.plist file to bind to the signature")
-	signer.Flags().String("entitlements", "", "(Apple) entitlements file to embed")
-	signer.Flags().Bool("hardened-runtime", true, "(Apple) enable hardened runtime")
-	signer.Flags().String("requirements", "", "(Apple) requirements file to embed (binary only)")
-	signer.Flags().String("resources", "", "(Apple) CodeResources file to bind to the signature")
+	addFlags(signer)
 	signers.Register(signer)
 }
 
+// thin and fat binaries take the same flags
+func addFlags(s *signers.Signer) {
+	s.Flags().String("bundle-id", "", "(Apple) app bundle ID")
+	s.Flags().String("info-plist", "", "(Apple) Info.plist file to bind to the signature")
+	s.Flags().String("entitlements", "", "(Apple) entitlements file to embed")
+	s.Flags().Bool("hardened-runtime", true, "(Apple) enable hardened runtime")
+	s.Flags().String("requirements", "", "(Apple) requirements file to embed (binary only)")
+	s.Flags().String("resources", "", "(Apple) CodeResources file to bind to the signature")
+}
+
 var fileArgs = []string{"info-plist", "entitlements", "requirements", "resources"}
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
@@ -41,6 +50,7 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	params := &csblob.SignatureParams{
 		HashFunc:        opts.Hash,
 		SigningIdentity: opts.Flags.GetString("bundle-id"),
+		SigningTime:     opts.Time,
 	}
 	if v := args["info-plist"]; v != nil {
 		params.InfoPlist = v
@@ -57,7 +67,13 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	if opts.Flags.GetBool("hardened-runtime") {
 		params.Flags |= csblob.FlagRuntime
 	}
-	patch, tsig, err := machos.Sign(opts.Context(), exec, cert, params)
+	br := bufio.NewReader(exec)
+	header, _ := br.Peek(4)
+	signFunc := machos.Sign
+	if machos.IsFat(header) {
+		signFunc = machos.SignFat
+	}
+	patch, tsig, err := signFunc(opts.Context(), br, cert, params)
 	if err != nil {
 		return nil, err
 	}
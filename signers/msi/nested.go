@@ -0,0 +1,133 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package msi
+
+// Sign cabinets embedded as streams in an MSI before the MSI itself
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/sassoftware/relic/v8/lib/comdoc"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+var cabMagic = []byte("MSCF")
+
+func signNested(f *os.File, opts signers.SignOpts, signFile signers.NestedSignFunc) (*os.File, error) {
+	if !opts.Flags.GetBool("sign-embedded-cabs") {
+		return nil, nil
+	}
+	cdf, err := comdoc.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	cabs, err := embeddedCabs(cdf)
+	if err != nil || len(cabs) == 0 {
+		return nil, err
+	}
+	// work on a copy so the input isn't touched until the MSI is signed
+	out, err := ioutil.TempFile("", "relic-msi-")
+	if err != nil {
+		return nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		return nil, err
+	}
+	wcdf, err := comdoc.WriteFile(out)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range cabs {
+		blob, err := signCab(cdf, item, signFile)
+		if err != nil {
+			return nil, fmt.Errorf("embedded cabinet %q: %w", item.Name(), err)
+		}
+		if err := wcdf.AddFile(item.Name(), blob); err != nil {
+			return nil, err
+		}
+	}
+	if err := wcdf.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	ok = true
+	return out, nil
+}
+
+// find streams in the root storage that hold a cabinet
+func embeddedCabs(cdf *comdoc.ComDoc) ([]*comdoc.DirEnt, error) {
+	files, err := cdf.ListDir(nil)
+	if err != nil {
+		return nil, err
+	}
+	var cabs []*comdoc.DirEnt
+	for _, item := range files {
+		if item.Type != comdoc.DirStream || item.StreamSize < uint32(len(cabMagic)) {
+			continue
+		}
+		r, err := cdf.ReadStream(item)
+		if err != nil {
+			return nil, err
+		}
+		var head [4]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, err
+		}
+		if bytes.Equal(head[:], cabMagic) {
+			cabs = append(cabs, item)
+		}
+	}
+	return cabs, nil
+}
+
+// extract one cabinet to a temporary file, sign it and return the result
+func signCab(cdf *comdoc.ComDoc, item *comdoc.DirEnt, signFile signers.NestedSignFunc) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "relic-cab-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	r, err := cdf.ReadStream(item)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	if err := signFile(tmp, "cab"); err != nil {
+		return nil, err
+	}
+	// the signer may have replaced the file, so read it back by name
+	return ioutil.ReadFile(tmp.Name())
+}
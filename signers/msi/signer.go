@@ -19,6 +19,8 @@ package msi
 // Sign Microsoft Installer files
 
 import (
+	"crypto/x509"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -28,30 +30,36 @@ import (
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/comdoc"
 	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/signers"
 	"github.com/sassoftware/relic/v8/signers/pecoff"
 )
 
 var MsiSigner = &signers.Signer{
-	Name:      "msi",
-	Aliases:   []string{"msi-tar"},
-	Magic:     magic.FileTypeMSI,
-	CertTypes: signers.CertTypeX509,
-	Transform: transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "msi",
+	Aliases:     []string{"msi-tar"},
+	Magic:       magic.FileTypeMSI,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	Transform:   transform,
+	Sign:        sign,
+	Verify:      verify,
+	SignNested:  signNested,
 }
 
 func init() {
 	MsiSigner.Flags().Bool("no-extended-sig", false, "(MSI) Don't emit a MsiDigitalSignatureEx digest")
+	MsiSigner.Flags().Bool("sign-embedded-cabs", false, "(MSI) Sign cabinets embedded in the MSI before signing the MSI itself")
 	pecoff.AddOpusFlags(MsiSigner)
 	signers.Register(MsiSigner)
 }
 
 type msiTransformer struct {
-	f     *os.File
-	cdf   *comdoc.ComDoc
-	exsig []byte
+	f          *os.File
+	cdf        *comdoc.ComDoc
+	noExtended bool
 }
 
 func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
@@ -59,15 +67,7 @@ func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
 	if err != nil {
 		return nil, err
 	}
-	var exsig []byte
-	noExtended := opts.Flags.GetBool("no-extended-sig")
-	if !noExtended {
-		exsig, err = authenticode.PrehashMSI(cdf, opts.Hash)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return &msiTransformer{f, cdf, exsig}, nil
+	return &msiTransformer{f, cdf, opts.Flags.GetBool("no-extended-sig")}, nil
 }
 
 // transform the MSI to a tar stream for upload
@@ -81,11 +81,29 @@ func (t *msiTransformer) GetReader() (io.Reader, error) {
 
 // apply a signed PKCS#7 blob to an already-open MSI document
 func (t *msiTransformer) Apply(dest, mimeType string, result io.Reader) error {
-	t.cdf.Close()
 	blob, err := ioutil.ReadAll(result)
 	if err != nil {
 		return err
 	}
+	// the server may have picked the digest, so take it from the signature
+	var exsig []byte
+	if !t.noExtended {
+		psd, err := pkcs7.Unmarshal(blob)
+		if err != nil {
+			return err
+		} else if len(psd.Content.SignerInfos) == 0 {
+			return errors.New("signature is missing SignerInfo")
+		}
+		hash, err := x509tools.PkixDigestToHashE(psd.Content.SignerInfos[0].DigestAlgorithm)
+		if err != nil {
+			return err
+		}
+		exsig, err = authenticode.PrehashMSI(t.cdf, hash)
+		if err != nil {
+			return err
+		}
+	}
+	t.cdf.Close()
 	// copy src to dest if needed, otherwise open in-place
 	f, err := atomicfile.WriteInPlace(t.f, dest)
 	if err != nil {
@@ -96,7 +114,7 @@ func (t *msiTransformer) Apply(dest, mimeType string, result io.Reader) error {
 	if err != nil {
 		return err
 	}
-	if err := authenticode.InsertMSISignature(cdf, blob, t.exsig); err != nil {
+	if err := authenticode.InsertMSISignature(cdf, blob, exsig); err != nil {
 		return err
 	}
 	if err := cdf.Close(); err != nil {
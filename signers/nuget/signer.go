@@ -0,0 +1,76 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package nuget
+
+// Sign NuGet packages with an author signature stored in .signature.p7s
+
+import (
+	"crypto/x509"
+	"io"
+	"os"
+
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/signnuget"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/zipbased"
+)
+
+var NugetSigner = &signers.Signer{
+	Name:        "nuget",
+	Aliases:     []string{"nupkg"},
+	Magic:       magic.FileTypeNuGet,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      signnuget.Hashes,
+	Transform:   zipbased.Transform,
+	Sign:        sign,
+	Verify:      verify,
+}
+
+func init() {
+	signers.Register(NugetSigner)
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	digest, err := signnuget.DigestPackageTar(r, opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	patch, ts, err := digest.Sign(opts.Context(), cert, opts.Time)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.SetCounterSignature(ts.CounterSignature)
+	return opts.SetBinPatch(patch)
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signnuget.Verify(f, size, opts.NoDigests)
+	if err != nil {
+		return nil, err
+	}
+	return []*signers.Signature{{
+		Hash:          sig.Hash,
+		X509Signature: &sig.TimestampedSignature,
+		SigInfo:       sig.Type,
+	}}, nil
+}
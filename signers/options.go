@@ -22,6 +22,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net/url"
+	"os"
 	"strconv"
 	"time"
 
@@ -40,6 +41,23 @@ var common *pflag.FlagSet
 func init() {
 	common = pflag.NewFlagSet("common", pflag.ExitOnError)
 	common.Bool("no-timestamp", false, "Do not attach a trusted timestamp even if the selected key configures one")
+	common.Bool("pss", false, "Use RSA-PSS padding for PKCS#7 signatures, even if the selected key doesn't configure it")
+	common.Bool("no-pss", false, "Use PKCS#1 v1.5 padding even if the selected key configures RSA-PSS")
+	common.Bool("timestamp", false, "Attach a trusted timestamp from the timestamp server in the configuration, even if the selected key doesn't configure one")
+	common.String("sign-time", "", "Record this signing time instead of the current time, as Unix seconds or RFC 3339. Defaults to $SOURCE_DATE_EPOCH if set. Trusted timestamps still record the time of the timestamp server.")
+}
+
+// ParseSignTime parses the value of the sign-time option, either a count of
+// seconds since the Unix epoch like SOURCE_DATE_EPOCH or an RFC 3339 time
+func ParseSignTime(value string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signing time %q: expected Unix seconds or RFC 3339", value)
+	}
+	return t.UTC(), nil
 }
 
 type SignOpts struct {
@@ -89,6 +107,8 @@ type VerifyOpts struct {
 	NoChain     bool
 	Content     string
 	Compression magic.CompressionType
+	// AllowedSigners is an SSH allowed signers file to check SSH signers against
+	AllowedSigners string
 }
 
 type FlagValues struct {
@@ -139,6 +159,18 @@ func (s *Signer) FlagsFromCmdline(fs *pflag.FlagSet) (*FlagValues, error) {
 		}
 		return fs.Lookup(name).Value.String()
 	})
+	// the environment of the client is honored here so that it also applies
+	// when signing remotely
+	if _, ok := values.Values["sign-time"]; !ok {
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			values.Values["sign-time"] = epoch
+		}
+	}
+	if v, ok := values.Values["sign-time"]; ok {
+		if _, err := ParseSignTime(v); err != nil {
+			return nil, err
+		}
+	}
 	return values, nil
 }
 
@@ -152,6 +184,19 @@ func (s *Signer) FlagsFromQuery(q url.Values) (*FlagValues, error) {
 	return values, nil
 }
 
+// FlagsFromValues creates a FlagValues for this signer from the options given
+// to another one, keeping only those that this signer also accepts
+func (s *Signer) FlagsFromValues(other *FlagValues) *FlagValues {
+	values := &FlagValues{
+		Defs:   s.flags,
+		Values: make(map[string]string),
+	}
+	values.mergeAll(s.flags, func(name string) string {
+		return other.Values[name]
+	})
+	return values
+}
+
 // ToQuery appends query parameters to a URL for each option in the flag set
 func (values *FlagValues) ToQuery(q url.Values) error {
 	for key, value := range values.Values {
@@ -0,0 +1,149 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ostree
+
+// Sign OSTree (Flatpak) commit objects with detached PGP signatures
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/ostree"
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/signers"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+)
+
+var OstreeSigner = &signers.Signer{
+	Name:      "ostree",
+	Aliases:   []string{"flatpak"},
+	CertTypes: signers.CertTypePgp,
+	TestPath:  testPath,
+	Transform: transform,
+	Sign:      sign,
+	Verify:    verify,
+}
+
+func init() {
+	signers.Register(OstreeSigner)
+}
+
+func testPath(fp string) bool {
+	return strings.HasSuffix(fp, ".commit")
+}
+
+type ostreeTransformer struct {
+	f      *os.File
+	commit []byte
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	commit, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := ostree.CheckCommit(f.Name(), commit); err != nil {
+		return nil, err
+	}
+	return &ostreeTransformer{f: f, commit: commit}, nil
+}
+
+func (t *ostreeTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.commit), nil
+}
+
+// Apply adds the signature to the commit's detached metadata, keeping any
+// signatures that were already there
+func (t *ostreeTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	sig, err := io.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	meta, err := ostree.ReadMetadata(dest)
+	if err != nil {
+		return err
+	}
+	if err := meta.AddSignature(sig); err != nil {
+		return err
+	}
+	outfile, err := atomicfile.WriteAny(ostree.MetadataPath(dest))
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := outfile.Write(meta.Marshal()); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var buf bytes.Buffer
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	if err := openpgp.DetachSign(&buf, cert.PgpKey, r, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	commit, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoDigests {
+		if err := ostree.CheckCommit(f.Name(), commit); err != nil {
+			return nil, err
+		}
+	}
+	meta, err := ostree.ReadMetadata(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := meta.Signatures()
+	if err != nil {
+		return nil, err
+	} else if len(sigs) == 0 {
+		return nil, sigerrors.NotSignedError{Type: "OSTree commit"}
+	}
+	var ret []*signers.Signature
+	for i, sig := range sigs {
+		info, err := pgptools.VerifyDetached(bytes.NewReader(sig), bytes.NewReader(commit), opts.TrustedPgp)
+		if err != nil {
+			return nil, fmt.Errorf("signature #%d: %w", i+1, err)
+		}
+		ret = append(ret, &signers.Signature{
+			CreationTime: info.CreationTime,
+			Hash:         info.Hash,
+			SignerPgp:    info.Key.Entity,
+		})
+	}
+	return ret, nil
+}
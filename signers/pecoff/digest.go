@@ -0,0 +1,163 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package pecoff
+
+// Remote signing of large images by uploading just the digest. The client
+// digests the image, the server signs the imprint and returns a PKCS#7 blob,
+// and the client patches it into the image.
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sassoftware/relic/v8/lib/authenticode"
+	"github.com/sassoftware/relic/v8/lib/binpatch"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pkcs7"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+type digestUpload struct {
+	Hash       string `json:"hash"`
+	Imprint    []byte `json:"imprint"`
+	PageHashes []byte `json:"page_hashes,omitempty"`
+	// the image is checked by UEFI Secure Boot
+	EFI bool `json:"efi,omitempty"`
+	// SHA-1 digest for --dual-sign
+	NestedImprint    []byte `json:"nested_imprint,omitempty"`
+	NestedPageHashes []byte `json:"nested_page_hashes,omitempty"`
+}
+
+type digestTransformer struct {
+	f      *os.File
+	digest *authenticode.PEDigest
+	upload []byte
+	append bool
+}
+
+func digestTransform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	pageHashes := opts.Flags.GetBool("page-hashes")
+	digest, err := authenticode.DigestPE(f, opts.Hash, pageHashes)
+	if err != nil {
+		return nil, err
+	}
+	du := digestUpload{
+		Hash:       x509tools.HashNames[opts.Hash],
+		Imprint:    digest.Imprint,
+		PageHashes: digest.PageHashes,
+		EFI:        digest.IsEFI(),
+	}
+	if opts.Flags.GetBool("dual-sign") {
+		if opts.Hash == crypto.SHA1 {
+			return nil, errors.New("--dual-sign requires a digest other than SHA-1")
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		inner, err := authenticode.DigestPE(f, crypto.SHA1, pageHashes)
+		if err != nil {
+			return nil, err
+		}
+		du.NestedImprint = inner.Imprint
+		du.NestedPageHashes = inner.PageHashes
+	}
+	upload, err := json.Marshal(du)
+	if err != nil {
+		return nil, err
+	}
+	return &digestTransformer{f: f, digest: digest, upload: upload, append: opts.Flags.GetBool("append")}, nil
+}
+
+func (t *digestTransformer) GetReader() (io.Reader, error) {
+	return bytes.NewReader(t.upload), nil
+}
+
+// Apply patches the returned signature into the image that was digested
+func (t *digestTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if mimeType != pkcs7.MimeType {
+		return fmt.Errorf("expected a PKCS#7 signature from the server but got %s", mimeType)
+	}
+	blob, err := io.ReadAll(result)
+	if err != nil {
+		return err
+	}
+	var patch *binpatch.PatchSet
+	if t.append {
+		patch, err = t.digest.MakeAppendPatch(blob)
+	} else {
+		patch, err = t.digest.MakePatch(blob)
+	}
+	if err != nil {
+		return err
+	}
+	return patch.Apply(t.f, dest)
+}
+
+func signDigest(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var upload digestUpload
+	if err := json.NewDecoder(r).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("parsing PE digest: %w", err)
+	}
+	if hash := x509tools.HashByName(upload.Hash); hash != opts.Hash {
+		return nil, fmt.Errorf("PE digest was calculated with %s but %s was requested", upload.Hash, x509tools.HashNames[opts.Hash])
+	} else if len(upload.Imprint) != opts.Hash.Size() {
+		return nil, errors.New("PE digest has the wrong length")
+	}
+	pageHashes := opts.Flags.GetBool("page-hashes")
+	if pageHashes != (len(upload.PageHashes) != 0) {
+		return nil, errors.New("PE digest does not match the page-hashes option")
+	}
+	digest := &authenticode.PEDigest{
+		Imprint:    upload.Imprint,
+		PageHashes: upload.PageHashes,
+		Hash:       opts.Hash,
+	}
+	var inner *authenticode.PEDigest
+	if opts.Flags.GetBool("dual-sign") {
+		if len(upload.NestedImprint) != crypto.SHA1.Size() {
+			return nil, errors.New("PE digest does not match the dual-sign option")
+		} else if pageHashes != (len(upload.NestedPageHashes) != 0) {
+			return nil, errors.New("PE digest does not match the page-hashes option")
+		}
+		inner = &authenticode.PEDigest{
+			Imprint:    upload.NestedImprint,
+			PageHashes: upload.NestedPageHashes,
+			Hash:       crypto.SHA1,
+		}
+	}
+	if upload.EFI {
+		if err := checkEFIKey(cert, opts); err != nil {
+			return nil, err
+		}
+	}
+	ts, err := signImprint(digest, inner, cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["pe-coff.pagehashes"] = pageHashes
+	opts.Audit.Attributes["pe-coff.digestonly"] = true
+	return opts.SetPkcs7(ts)
+}
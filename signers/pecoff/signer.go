@@ -19,28 +19,42 @@ package pecoff
 // Sign Microsoft PE/COFF executables
 
 import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/sassoftware/relic/v8/lib/authenticode"
+	"github.com/sassoftware/relic/v8/lib/binpatch"
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/pkcs9"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/signers"
 )
 
 var PeSigner = &signers.Signer{
-	Name:      "pe-coff",
-	Magic:     magic.FileTypePECOFF,
-	CertTypes: signers.CertTypeX509,
-	Sign:      sign,
-	Fixup:     authenticode.FixPEChecksum,
-	Verify:    verify,
+	Name:        "pe-coff",
+	Magic:       magic.FileTypePECOFF,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	Sign:        sign,
+	Fixup:       authenticode.FixPEChecksum,
+	Verify:      verify,
+
+	DigestTransform: digestTransform,
+	SignDigest:      signDigest,
 }
 
 func init() {
 	PeSigner.Flags().Bool("page-hashes", false, "(PE-COFF) Add page hashes to signature")
+	PeSigner.Flags().Bool("append", false, "(PE-COFF) Add the signature alongside any existing ones instead of replacing them")
+	PeSigner.Flags().Bool("dual-sign", false, "(PE-COFF) Nest a SHA-1 signature inside the main one for older versions of Windows")
 	AddOpusFlags(PeSigner)
 	signers.Register(PeSigner)
 }
@@ -59,11 +73,26 @@ func OpusFlags(opts signers.SignOpts) *authenticode.OpusParams {
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
 	pageHashes := opts.Flags.GetBool("page-hashes")
-	digest, err := authenticode.DigestPE(r, opts.Hash, pageHashes)
+	var digest, inner *authenticode.PEDigest
+	var err error
+	if opts.Flags.GetBool("dual-sign") {
+		digest, inner, err = digestDual(r, opts.Hash, pageHashes)
+	} else {
+		digest, err = authenticode.DigestPE(r, opts.Hash, pageHashes)
+	}
 	if err != nil {
 		return nil, err
 	}
-	patch, ts, err := digest.Sign(opts.Context(), cert, OpusFlags(opts))
+	if digest.IsEFI() {
+		if err := checkEFIKey(cert, opts); err != nil {
+			return nil, err
+		}
+	}
+	ts, err := signImprint(digest, inner, cert, opts)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := makePatch(digest, ts.Raw, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +101,62 @@ func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]b
 	return opts.SetBinPatch(patch)
 }
 
+// Digest the image with both the requested hash and SHA-1. The input is
+// spooled to a temporary file so it can be read twice.
+func digestDual(r io.Reader, hash crypto.Hash, pageHashes bool) (outer, inner *authenticode.PEDigest, err error) {
+	if hash == crypto.SHA1 {
+		return nil, nil, errors.New("--dual-sign requires a digest other than SHA-1")
+	}
+	spool, err := os.CreateTemp("", "relic-pe-")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	outer, err = authenticode.DigestPE(io.TeeReader(r, spool), hash, pageHashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	inner, err = authenticode.DigestPE(spool, crypto.SHA1, pageHashes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return outer, inner, nil
+}
+
+// Sign the imprint and, if there is an inner digest, nest a signature over it
+func signImprint(digest, inner *authenticode.PEDigest, cert *certloader.Certificate, opts signers.SignOpts) (*pkcs9.TimestampedSignature, error) {
+	if inner == nil {
+		return digest.SignImprint(opts.Context(), cert, OpusFlags(opts))
+	}
+	opts.Audit.Attributes["pe-coff.dualsign"] = true
+	return digest.SignImprintNested(opts.Context(), inner, cert, OpusFlags(opts))
+}
+
+// UEFI firmware is only required to support RSA, so refuse to make a
+// signature that Secure Boot can't check
+func checkEFIKey(cert *certloader.Certificate, opts signers.SignOpts) error {
+	if _, ok := cert.Leaf.PublicKey.(*rsa.PublicKey); !ok {
+		return errors.New("EFI images for Secure Boot can only be signed with RSA keys")
+	}
+	opts.Audit.Attributes["pe-coff.efi"] = true
+	return nil
+}
+
+// replace the existing signatures or, with --append, add to them
+func makePatch(digest *authenticode.PEDigest, sig []byte, opts signers.SignOpts) (*binpatch.PatchSet, error) {
+	if opts.Flags.GetBool("append") {
+		opts.Audit.Attributes["pe-coff.append"] = true
+		return digest.MakeAppendPatch(sig)
+	}
+	return digest.MakePatch(sig)
+}
+
 func FormatOpus(info *authenticode.SpcSpOpusInfo) string {
 	if info == nil {
 		return ""
@@ -93,8 +178,16 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	}
 	var ret []*signers.Signature
 	for _, sig := range sigs {
+		info := FormatOpus(sig.OpusInfo)
+		if len(sig.PageHashes) != 0 {
+			count := len(sig.PageHashes) / (4 + sig.PageHashFunc.Size())
+			info += fmt.Sprintf("[page-hashes:%s*%d]", x509tools.HashNames[sig.PageHashFunc], count)
+		}
+		if sig.Nested {
+			info += "[nested]"
+		}
 		ret = append(ret, &signers.Signature{
-			SigInfo:       FormatOpus(sig.OpusInfo),
+			SigInfo:       info,
 			Hash:          sig.ImageHashFunc,
 			X509Signature: &sig.TimestampedSignature,
 		})
@@ -45,6 +45,7 @@ var PgpSigner = &signers.Signer{
 	Magic:        magic.FileTypePGP,
 	CertTypes:    signers.CertTypePgp,
 	AllowStdin:   true,
+	StreamOutput: true,
 	Transform:    transform,
 	Sign:         sign,
 	VerifyStream: verify,
@@ -21,6 +21,7 @@ package pkcs
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/lib/pkcs7"
@@ -37,6 +38,10 @@ var PkcsSigner = &signers.Signer{
 	Verify:    Verify,
 }
 
+// Suffix conventionally used for detached signatures. If the content isn't
+// specified when verifying such a file, it is assumed to be alongside.
+const DetachedSuffix = ".p7s"
+
 func init() {
 	PkcsSigner.Flags().String("content", "", "Specify file containing contents for detached signatures")
 	signers.Register(PkcsSigner)
@@ -51,9 +56,17 @@ func Verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	if err != nil {
 		return nil, err
 	}
+	content := opts.Content
+	if content == "" && strings.HasSuffix(opts.FileName, DetachedSuffix) {
+		if attached, err := psd.Content.ContentInfo.Bytes(); err != nil {
+			return nil, err
+		} else if attached == nil {
+			content = strings.TrimSuffix(opts.FileName, DetachedSuffix)
+		}
+	}
 	var cblob []byte
-	if !opts.NoDigests && opts.Content != "" {
-		cblob, err = ioutil.ReadFile(opts.Content)
+	if !opts.NoDigests && content != "" {
+		cblob, err = ioutil.ReadFile(content)
 		if err != nil {
 			return nil, err
 		}
@@ -19,6 +19,7 @@ package ps
 // Sign Microsoft PowerShell scripts, modules, and other bits that can be signed
 
 import (
+	"crypto/x509"
 	"errors"
 	"io"
 	"os"
@@ -33,12 +34,14 @@ import (
 )
 
 var PsSigner = &signers.Signer{
-	Name:      "ps",
-	CertTypes: signers.CertTypeX509,
-	TestPath:  testPath,
-	Transform: transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "ps",
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	TestPath:    testPath,
+	Transform:   transform,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
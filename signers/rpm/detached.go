@@ -0,0 +1,154 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package rpm
+
+// Detached signatures over the RPM header and payload, stored next to the
+// package in FILE.sig so that the package itself is not modified
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	rpmutils "github.com/sassoftware/go-rpmutils"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+// DetachedSuffix is appended to the package name to get the signature's name
+const DetachedSuffix = ".sig"
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	if !opts.Flags.GetBool("detached") {
+		return signers.DefaultTransform(f), nil
+	}
+	return &detachedTransformer{f}, nil
+}
+
+type detachedTransformer struct {
+	f *os.File
+}
+
+func (t *detachedTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// write the signature next to the package, copying the package too if the
+// output is somewhere else
+func (t *detachedTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest != t.f.Name() {
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		outfile, err := atomicfile.WriteAny(dest)
+		if err != nil {
+			return err
+		}
+		defer outfile.Close()
+		if _, err := io.Copy(outfile, t.f); err != nil {
+			return err
+		}
+		if err := outfile.Commit(); err != nil {
+			return err
+		}
+	}
+	outfile, err := atomicfile.WriteAny(dest + DetachedSuffix)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	return outfile.Commit()
+}
+
+// make a detached signature over the general header and payload, the same
+// range covered by the legacy header+payload signature inside the RPM
+func signDetached(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	var head bytes.Buffer
+	header, err := rpmutils.ReadHeader(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	hrange := header.GetRange()
+	if head.Len() != hrange.End {
+		return nil, errors.New("unexpected RPM header size")
+	}
+	signed := io.MultiReader(bytes.NewReader(head.Bytes()[hrange.Start:]), r)
+	config := &packet.Config{
+		DefaultHash: opts.Hash,
+		Time:        func() time.Time { return opts.Time },
+	}
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, cert.PgpKey, signed, config); err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["rpm.nevra"] = nevra(header)
+	opts.Audit.Attributes["rpm.detached"] = true
+	return buf.Bytes(), nil
+}
+
+// check the detached signature next to the package, if there is one
+func verifyDetached(f *os.File, opts signers.VerifyOpts) (*signers.Signature, error) {
+	sigfile, err := os.Open(f.Name() + DetachedSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer sigfile.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header, err := rpmutils.ReadHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(int64(header.GetRange().Start), io.SeekStart); err != nil {
+		return nil, err
+	}
+	sig, err := pgptools.VerifyDetached(sigfile, f, opts.TrustedPgp)
+	rsig := &signers.Signature{
+		Package: nevra(header),
+		SigInfo: "[detached]",
+	}
+	if keyID, ok := err.(pgptools.ErrNoKey); ok && opts.NoChain {
+		rsig.Signer = fmt.Sprintf("UNKNOWN(%x)", uint64(keyID))
+		return rsig, nil
+	} else if err != nil {
+		if sig != nil {
+			return nil, fmt.Errorf("bad detached signature from %s(%x): %w", pgptools.EntityName(sig.Key.Entity), sig.Key.PublicKey.KeyId, err)
+		}
+		return nil, fmt.Errorf("detached signature: %w", err)
+	}
+	rsig.CreationTime = sig.CreationTime
+	rsig.Hash = sig.Hash
+	rsig.SignerPgp = sig.Key.Entity
+	return rsig, nil
+}
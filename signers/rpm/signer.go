@@ -30,10 +30,10 @@ import (
 	rpmutils "github.com/sassoftware/go-rpmutils"
 
 	"github.com/sassoftware/relic/v8/lib/audit"
-	"github.com/sassoftware/relic/v8/lib/binpatch"
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/lib/pgptools"
+	"github.com/sassoftware/relic/v8/lib/signrpm"
 	"github.com/sassoftware/relic/v8/signers"
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
@@ -43,11 +43,14 @@ var RpmSigner = &signers.Signer{
 	Magic:     magic.FileTypeRPM,
 	CertTypes: signers.CertTypePgp,
 	FormatLog: formatLog,
+	Transform: transform,
 	Sign:      sign,
 	Verify:    verify,
 }
 
 func init() {
+	RpmSigner.Flags().Bool("detached", false, "(RPM) Write a detached signature to FILE"+DetachedSuffix+" instead of modifying the package")
+	RpmSigner.Flags().Bool("rpmv3", false, "(RPM) Also write the legacy header+payload signature for older distros")
 	signers.Register(RpmSigner)
 }
 
@@ -56,20 +59,18 @@ func formatLog(attrs *audit.Info) *zerolog.Event {
 }
 
 func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
-	config := &rpmutils.SignatureOptions{
+	if opts.Flags.GetBool("detached") {
+		return signDetached(r, cert, opts)
+	}
+	config := signrpm.SignOptions{
 		Hash:         opts.Hash,
 		CreationTime: opts.Time.UTC().Round(time.Second),
+		Legacy:       opts.Flags.GetBool("rpmv3"),
 	}
-	header, err := rpmutils.SignRpmStream(r, cert.PgpKey.PrivateKey, config)
-	if err != nil {
-		return nil, err
-	}
-	blob, err := header.DumpSignatureHeader(true)
+	header, patch, err := signrpm.Sign(r, cert.PgpKey.PrivateKey, config)
 	if err != nil {
 		return nil, err
 	}
-	patch := binpatch.New()
-	patch.Add(0, int64(header.OriginalSignatureHeaderSize()), blob)
 	md5, _ := header.GetBytes(rpmutils.SIG_MD5)
 	sha1, _ := header.GetString(rpmutils.SIG_SHA1)
 	opts.Audit.Attributes["rpm.nevra"] = nevra(header)
@@ -84,7 +85,11 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(sigs) == 0 {
+	detached, err := verifyDetached(f, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 && detached == nil {
 		return nil, sigerrors.NotSignedError{Type: "RPM"}
 	}
 	var ret []*signers.Signature
@@ -109,6 +114,9 @@ func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
 		}
 		ret = append(ret, rsig)
 	}
+	if detached != nil {
+		ret = append(ret, detached)
+	}
 	return ret, nil
 }
 
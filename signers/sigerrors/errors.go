@@ -30,12 +30,38 @@ func (KeyNotFoundError) Error() string {
 	return "No object found in token with the specified label"
 }
 
+// TokenNotFoundError is returned when a token name is not defined in the
+// configuration
+type TokenNotFoundError struct {
+	Name string
+}
+
+func (e TokenNotFoundError) Error() string {
+	return "Token \"" + e.Name + "\" not found in configuration"
+}
+
+// KeyNotConfiguredError is returned when a key name is not defined in the
+// configuration. Unlike KeyNotFoundError, the token is never consulted.
+type KeyNotConfiguredError struct {
+	Name string
+}
+
+func (e KeyNotConfiguredError) Error() string {
+	return "Key \"" + e.Name + "\" not found in configuration"
+}
+
 type PinIncorrectError struct{}
 
 func (PinIncorrectError) Error() string {
 	return "The entered PIN was incorrect"
 }
 
+type PinLockedError struct{}
+
+func (PinLockedError) Error() string {
+	return "The PIN is locked due to too many incorrect attempts"
+}
+
 type ErrNoCertificate struct {
 	Type string
 }
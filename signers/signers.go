@@ -18,10 +18,12 @@ package signers
 
 import (
 	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -39,12 +41,27 @@ import (
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
 
+// Signer describes how to sign and verify one package format. See
+// doc/signers.md for how the client and server use each of these functions.
 type Signer struct {
-	Name       string
-	Aliases    []string
-	Magic      magic.FileType
-	CertTypes  CertType
+	// Name used for --sig-type and by the server to pick the module
+	Name    string
+	Aliases []string
+	// Files with this magic are detected as belonging to this signer
+	Magic magic.FileType
+	// Kinds of key that the signer can use
+	CertTypes CertType
+	// Extended key usage that the signing certificate's chain must allow when
+	// verifying whether it is trusted
+	ExtKeyUsage x509.ExtKeyUsage
+	// Whether the input may be read from standard input
 	AllowStdin bool
+	// Whether the result is written to the output in one sequential pass, so
+	// that --output - can send it straight to standard output. Otherwise it
+	// is written to a temporary file first.
+	StreamOutput bool
+	// Digest algorithms supported by this signer, or nil if any may be used
+	Hashes []crypto.Hash
 	// Return true if the given filename is associated with this signer
 	TestPath func(string) bool
 	// Format audit attributes for logfile
@@ -58,12 +75,24 @@ type Signer struct {
 	Transform func(*os.File, SignOpts) (Transformer, error)
 	// Sign a input stream (possibly transformed) and return a mode-specific result blob
 	Sign func(io.Reader, *certloader.Certificate, SignOpts) ([]byte, error)
+	// Digest a file on the client so that only the digest is uploaded for
+	// remote signing, instead of the whole file
+	DigestTransform func(*os.File, SignOpts) (Transformer, error)
+	// Sign a digest produced by DigestTransform and return a mode-specific result blob
+	SignDigest func(io.Reader, *certloader.Certificate, SignOpts) ([]byte, error)
 	// Final step to run on the client after the file is patched
 	Fixup func(*os.File) error
+	// Sign files embedded in this one before the outer signature is made. If
+	// anything was signed, returns a temporary copy of the input holding the
+	// signed results, otherwise returns nil.
+	SignNested func(*os.File, SignOpts, NestedSignFunc) (*os.File, error)
 
 	flags *pflag.FlagSet
 }
 
+// NestedSignFunc signs a file in-place using the named signature type
+type NestedSignFunc func(f *os.File, sigType string) error
+
 type CertType uint
 
 const (
@@ -97,10 +126,31 @@ func (s *Signature) SignerName() string {
 var registered []*Signer
 var flagMap map[string][]string
 
+// Register a signer module so that the sign and verify commands, and the
+// server, can dispatch to it. Modules outside of relic can call this from an
+// init function to add their own formats. Panics if the name, an alias, or the
+// file magic is already claimed by another module.
 func Register(s *Signer) {
+	if s.Name == "" {
+		panic("signers: Register called with an unnamed signer")
+	}
+	for _, name := range append([]string{s.Name}, s.Aliases...) {
+		if other := ByName(name); other != nil {
+			panic(fmt.Sprintf("signers: %s is already registered by %s", name, other.Name))
+		}
+	}
+	if other := ByMagic(s.Magic); other != nil {
+		panic(fmt.Sprintf("signers: file magic of %s is already registered by %s", s.Name, other.Name))
+	}
 	registered = append(registered, s)
 }
 
+// Registered returns all of the signer modules in the order they were
+// registered
+func Registered() []*Signer {
+	return append([]*Signer(nil), registered...)
+}
+
 // Return the signer module with the given name or alias
 func ByName(name string) *Signer {
 	for _, s := range registered {
@@ -159,14 +209,38 @@ func ByFile(name, sigtype string) (*Signer, error) {
 	defer f.Close()
 	fileType, compressionType := magic.DetectCompressed(f)
 	if compressionType != magic.CompressedNone {
+		// some formats are themselves compressed archives, e.g. Helm charts
+		if mod := ByFileName(name); mod != nil {
+			return mod, nil
+		}
 		return nil, errors.New("cannot sign compressed file")
 	}
-	if mod := ByMagic(fileType); mod != nil {
+	if fileType == magic.FileTypeZip {
+		return nil, errors.New("can't tell what kind of package this zip archive is (jar, apk, vsix...); use --sig-type to choose")
+	} else if mod := ByMagic(fileType); mod != nil {
 		return mod, nil
 	} else if mod := ByFileName(name); mod != nil {
 		return mod, nil
 	}
-	return nil, errors.New("unknown filetype")
+	return nil, errors.New("unknown filetype; use --sig-type to choose a signer")
+}
+
+// CheckHash returns an error if the signer can't use the given digest algorithm
+func (s *Signer) CheckHash(hash crypto.Hash) error {
+	if !hash.Available() {
+		return fmt.Errorf("digest %s is not available", hash)
+	}
+	if len(s.Hashes) == 0 {
+		return nil
+	}
+	var names []string
+	for _, h := range s.Hashes {
+		if h == hash {
+			return nil
+		}
+		names = append(names, x509tools.HashNames[h])
+	}
+	return fmt.Errorf("%s signer does not support digest %s, use one of: %s", s.Name, x509tools.HashNames[hash], strings.Join(names, ", "))
 }
 
 // Create a FlagSet for flags associated with this module. These will be added
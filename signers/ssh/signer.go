@@ -0,0 +1,235 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+// Issue OpenSSH certificates for public keys, and sign arbitrary files in the
+// format of "ssh-keygen -Y sign"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/sassoftware/relic/v8/lib/atomicfile"
+	"github.com/sassoftware/relic/v8/lib/audit"
+	"github.com/sassoftware/relic/v8/lib/certloader"
+	"github.com/sassoftware/relic/v8/lib/magic"
+	"github.com/sassoftware/relic/v8/lib/signssh"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+const (
+	sigSuffix  = ".sig"
+	certSuffix = "-cert.pub"
+	// public keys, certificates and armored signatures are all small
+	maxInputSize = 1 << 20
+)
+
+var sshMagic = magic.Register(func(prefix []byte) bool {
+	return signssh.IsSignature(prefix) || signssh.IsCertificate(prefix)
+})
+
+var SSHSigner = &signers.Signer{
+	Name:         "ssh",
+	Aliases:      []string{"sshsig"},
+	Magic:        sshMagic,
+	Hashes:       signssh.Hashes,
+	StreamOutput: true,
+	FormatLog:    formatLog,
+	Transform:    transform,
+	Sign:         sign,
+	Verify:       verify,
+}
+
+func init() {
+	SSHSigner.Flags().String("ssh-namespace", "file", "(SSH) Namespace for file signatures")
+	SSHSigner.Flags().Bool("ssh-cert", false, "(SSH) Issue a certificate for the public key in the input file instead of signing it")
+	SSHSigner.Flags().Bool("ssh-host", false, "(SSH) Issue a host certificate instead of a user certificate")
+	SSHSigner.Flags().String("ssh-key-id", "", "(SSH) Key identity to put in the certificate")
+	SSHSigner.Flags().String("ssh-principals", "", "(SSH) Comma-separated user or host names the certificate is valid for (default any)")
+	SSHSigner.Flags().String("ssh-validity", "", "(SSH) Certificate validity interval, as in ssh-keygen -V (default forever)")
+	SSHSigner.Flags().String("ssh-serial", "", "(SSH) Certificate serial number")
+	SSHSigner.Flags().String("ssh-extensions", "", "(SSH) Comma-separated certificate extensions as name or name=value, or \"none\" (default the permit-* set for user certificates)")
+	SSHSigner.Flags().String("ssh-force-command", "", "(SSH) Force this command to run when the certificate is used")
+	SSHSigner.Flags().String("ssh-source-address", "", "(SSH) Comma-separated CIDR addresses the certificate may be used from")
+	signers.Register(SSHSigner)
+}
+
+func formatLog(attrs *audit.Info) *zerolog.Event {
+	return attrs.AttrsForLog("ssh.")
+}
+
+type sshTransformer struct {
+	f    *os.File
+	cert bool
+}
+
+func transform(f *os.File, opts signers.SignOpts) (signers.Transformer, error) {
+	return &sshTransformer{f: f, cert: opts.Flags.GetBool("ssh-cert")}, nil
+}
+
+func (t *sshTransformer) GetReader() (io.Reader, error) {
+	if _, err := t.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return t.f, nil
+}
+
+// Apply writes the certificate or signature to the output file, or alongside
+// the input if no output was specified in the same places as ssh-keygen
+func (t *sshTransformer) Apply(dest, mimeType string, result io.Reader) error {
+	if dest == t.f.Name() {
+		if t.cert {
+			dest = strings.TrimSuffix(dest, ".pub") + certSuffix
+		} else {
+			dest += sigSuffix
+		}
+	}
+	outfile, err := atomicfile.WriteAny(dest)
+	if err != nil {
+		return err
+	}
+	defer outfile.Close()
+	if _, err := io.Copy(outfile, result); err != nil {
+		return err
+	}
+	t.f.Close()
+	return outfile.Commit()
+}
+
+func sign(r io.Reader, cert *certloader.Certificate, opts signers.SignOpts) ([]byte, error) {
+	signer, err := signssh.NewSigner(cert.Signer(), opts.Hash)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["ssh.ca"] = gossh.FingerprintSHA256(signer.PublicKey())
+	if opts.Flags.GetBool("ssh-cert") {
+		return signCertificate(r, signer, opts)
+	}
+	namespace := opts.Flags.GetString("ssh-namespace")
+	sig, err := signssh.Sign(r, signer, opts.Hash, namespace)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["ssh.namespace"] = namespace
+	return sig.Armor(), nil
+}
+
+func signCertificate(r io.Reader, signer gossh.Signer, opts signers.SignOpts) ([]byte, error) {
+	blob, err := io.ReadAll(io.LimitReader(r, maxInputSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(blob) > maxInputSize {
+		return nil, errors.New("public key file is too large")
+	}
+	pub, comment, _, _, err := gossh.ParseAuthorizedKey(blob)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	certOpts, err := certificateOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	sshCert, err := signssh.SignCertificate(pub, signer, certOpts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Audit.Attributes["ssh.type"] = certTypeName(sshCert.CertType)
+	opts.Audit.Attributes["ssh.keyid"] = sshCert.KeyId
+	opts.Audit.Attributes["ssh.serial"] = strconv.FormatUint(sshCert.Serial, 10)
+	opts.Audit.Attributes["ssh.principals"] = strings.Join(sshCert.ValidPrincipals, ",")
+	opts.Audit.Attributes["ssh.fingerprint"] = gossh.FingerprintSHA256(pub)
+	out := bytes.TrimSuffix(gossh.MarshalAuthorizedKey(sshCert), []byte("\n"))
+	if comment != "" {
+		out = append(out, ' ')
+		out = append(out, comment...)
+	}
+	return append(out, '\n'), nil
+}
+
+// certificateOptions builds the certificate parameters from the module flags
+func certificateOptions(opts signers.SignOpts) (certOpts signssh.CertificateOptions, err error) {
+	certOpts.Host = opts.Flags.GetBool("ssh-host")
+	certOpts.KeyID = opts.Flags.GetString("ssh-key-id")
+	if certOpts.KeyID == "" {
+		return certOpts, errors.New("--ssh-key-id is required for certificates")
+	}
+	certOpts.Principals = splitList(opts.Flags.GetString("ssh-principals"))
+	if serial := opts.Flags.GetString("ssh-serial"); serial != "" {
+		certOpts.Serial, err = strconv.ParseUint(serial, 0, 64)
+		if err != nil {
+			return certOpts, fmt.Errorf("invalid --ssh-serial: %w", err)
+		}
+	}
+	now := opts.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	certOpts.ValidAfter, certOpts.ValidBefore, err = signssh.ParseValidity(opts.Flags.GetString("ssh-validity"), now)
+	if err != nil {
+		return certOpts, fmt.Errorf("invalid --ssh-validity: %w", err)
+	}
+	switch extensions := opts.Flags.GetString("ssh-extensions"); extensions {
+	case "":
+		if !certOpts.Host {
+			certOpts.Extensions = make(map[string]string)
+			for _, name := range signssh.DefaultExtensions {
+				certOpts.Extensions[name] = ""
+			}
+		}
+	case "none":
+	default:
+		certOpts.Extensions = make(map[string]string)
+		for _, ext := range splitList(extensions) {
+			name, value, _ := strings.Cut(ext, "=")
+			certOpts.Extensions[name] = value
+		}
+	}
+	certOpts.CriticalOptions = make(map[string]string)
+	if command := opts.Flags.GetString("ssh-force-command"); command != "" {
+		certOpts.CriticalOptions["force-command"] = command
+	}
+	if addrs := opts.Flags.GetString("ssh-source-address"); addrs != "" {
+		certOpts.CriticalOptions["source-address"] = strings.Join(splitList(addrs), ",")
+	}
+	return certOpts, nil
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func certTypeName(certType uint32) string {
+	if certType == gossh.HostCert {
+		return "host"
+	}
+	return "user"
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/sassoftware/relic/v8/lib/signssh"
+	"github.com/sassoftware/relic/v8/signers"
+)
+
+func verify(f *os.File, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	blob, err := io.ReadAll(io.LimitReader(f, maxInputSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(blob) > maxInputSize {
+		return nil, errors.New("file is too large")
+	}
+	var allowed []*signssh.AllowedSigner
+	if opts.AllowedSigners != "" {
+		allowed, err = signssh.ReadAllowedSigners(opts.AllowedSigners)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if signssh.IsSignature(blob) {
+		return verifySignature(blob, allowed, opts)
+	}
+	return verifyCertificate(blob, allowed)
+}
+
+// verifySignature checks a file signature against the contents named by
+// --content, or else the signature's filename without the .sig suffix
+func verifySignature(blob []byte, allowed []*signssh.AllowedSigner, opts signers.VerifyOpts) ([]*signers.Signature, error) {
+	sig, err := signssh.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := sig.Hash()
+	if err != nil {
+		return nil, err
+	}
+	if !opts.NoDigests {
+		contentPath := opts.Content
+		if contentPath == "" {
+			contentPath = strings.TrimSuffix(opts.FileName, sigSuffix)
+			if contentPath == opts.FileName {
+				return nil, errors.New("use --content to specify the signed file")
+			}
+		}
+		content, err := os.Open(contentPath)
+		if err != nil {
+			return nil, err
+		}
+		defer content.Close()
+		if err := sig.Verify(content, ""); err != nil {
+			return nil, err
+		}
+	}
+	fingerprint := keyFingerprint(sig.PublicKey)
+	signerName := "SSH key " + fingerprint
+	if allowed != nil {
+		_, principal, err := sig.FindSigner(allowed, "", time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", signerName, err)
+		}
+		signerName = fmt.Sprintf("`%s`(%s)", principal, fingerprint)
+	}
+	return []*signers.Signature{{
+		SigInfo: "namespace " + sig.Namespace,
+		Hash:    hash,
+		Signer:  signerName,
+	}}, nil
+}
+
+// verifyCertificate checks the CA signature on a certificate, and that the CA
+// is trusted if an allowed signers file was given
+func verifyCertificate(blob []byte, allowed []*signssh.AllowedSigner) ([]*signers.Signature, error) {
+	pub, _, _, _, err := gossh.ParseAuthorizedKey(blob)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*gossh.Certificate)
+	if !ok {
+		return nil, errors.New("not an SSH certificate")
+	}
+	if err := signssh.VerifyCertificate(cert); err != nil {
+		return nil, err
+	}
+	signerName := "SSH CA " + gossh.FingerprintSHA256(cert.SignatureKey)
+	if allowed != nil {
+		ca, err := signssh.FindAuthority(allowed, cert, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", signerName, err)
+		}
+		signerName = fmt.Sprintf("`%s`(%s)", strings.Join(ca.Principals, ","), gossh.FingerprintSHA256(cert.SignatureKey))
+	}
+	var created time.Time
+	if cert.ValidAfter != 0 {
+		created = time.Unix(int64(cert.ValidAfter), 0)
+	}
+	return []*signers.Signature{{
+		Package:      cert.KeyId,
+		SigInfo:      certTypeName(cert.CertType) + " certificate",
+		CreationTime: created,
+		Signer:       signerName,
+	}}, nil
+}
+
+// keyFingerprint identifies a key the way ssh-keygen does, by the certified
+// key rather than the whole certificate
+func keyFingerprint(pub gossh.PublicKey) string {
+	if cert, ok := pub.(*gossh.Certificate); ok {
+		pub = cert.Key
+	}
+	return gossh.FingerprintSHA256(pub)
+}
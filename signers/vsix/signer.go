@@ -18,6 +18,7 @@ package vsix
 
 import (
 	"archive/zip"
+	"crypto/x509"
 	"errors"
 	"io"
 	"os"
@@ -35,12 +36,14 @@ import (
 )
 
 var Signer = &signers.Signer{
-	Name:      "vsix",
-	Magic:     magic.FileTypeVSIX,
-	CertTypes: signers.CertTypeX509,
-	Transform: zipbased.Transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "vsix",
+	Magic:       magic.FileTypeVSIX,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      xmldsig.Hashes,
+	Transform:   zipbased.Transform,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 type zipFiles map[string]*zip.File
@@ -17,9 +17,11 @@
 package xap
 
 import (
+	"crypto/x509"
 	"io"
 	"os"
 
+	"github.com/sassoftware/relic/v8/lib/authenticode"
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/magic"
 	"github.com/sassoftware/relic/v8/lib/signxap"
@@ -31,12 +33,14 @@ import (
 // Sign Silverlight / legacy Windows Phone apps
 
 var XapSigner = &signers.Signer{
-	Name:      "xap",
-	Magic:     magic.FileTypeXAP,
-	CertTypes: signers.CertTypeX509,
-	Transform: zipbased.Transform,
-	Sign:      sign,
-	Verify:    verify,
+	Name:        "xap",
+	Magic:       magic.FileTypeXAP,
+	CertTypes:   signers.CertTypeX509,
+	ExtKeyUsage: x509.ExtKeyUsageCodeSigning,
+	Hashes:      authenticode.Hashes,
+	Transform:   zipbased.Transform,
+	Sign:        sign,
+	Verify:      verify,
 }
 
 func init() {
@@ -15,6 +15,7 @@ var signer = &signers.Signer{
 	Name:      "xar",
 	Magic:     magic.FileTypeXAR,
 	CertTypes: signers.CertTypeX509,
+	Hashes:    xar.Hashes,
 	Sign:      sign,
 	Verify:    verify,
 }
@@ -18,7 +18,10 @@ import (
 	"github.com/sassoftware/relic/v8/token"
 )
 
-const tokenType = "aws"
+const (
+	tokenType  = "aws"
+	tokenAlias = "awskms"
+)
 
 type awsToken struct {
 	config *config.Config
@@ -34,6 +37,7 @@ type awsKey struct {
 
 func init() {
 	token.Openers[tokenType] = open
+	token.Openers[tokenAlias] = open
 }
 
 func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
@@ -41,7 +45,14 @@ func open(conf *config.Config, tokenName string, pinProvider passprompt.Password
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	var opts []func(*awsconfig.LoadOptions) error
+	if tconf.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(tconf.Region))
+	}
+	if tconf.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(tconf.Profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +69,19 @@ func (t *awsToken) Close() error {
 }
 
 func (t *awsToken) Ping(ctx context.Context) error {
-	// TODO
+	// query info for one of the keys in this token
+	for _, keyConf := range t.config.Keys {
+		if keyConf.Token != t.tconf.Name() || keyConf.Hide || keyConf.ID == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, keyConf.GetTimeout())
+		defer cancel()
+		id := keyConf.ID
+		if _, err := t.cli.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &id}); err != nil {
+			return fmt.Errorf("checking key %q: %w", keyConf.Name(), err)
+		}
+		break
+	}
 	return nil
 }
 
@@ -72,7 +95,7 @@ func (t *awsToken) GetKey(ctx context.Context, keyName string) (token.Key, error
 		return nil, err
 	}
 	if keyConf.ID == "" {
-		return nil, fmt.Errorf("key %q must have \"id\" set to the ID or ARN of the key", keyName)
+		return nil, fmt.Errorf("key %q must have \"id\" set to the ID, ARN, or alias of the key", keyName)
 	}
 	id := keyConf.ID
 	resp, err := t.cli.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: &id})
@@ -99,13 +122,17 @@ func (t *awsToken) ImportCertificate(cert *x509.Certificate, labelBase string) e
 }
 
 func (t *awsToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
-	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+	return nil, fmt.Errorf("%w: create keys using the AWS KMS console or API instead", token.NotImplementedError{Op: "generate-key", Type: tokenType})
 }
 
 func (t *awsToken) ListKeys(opts token.ListOptions) error {
 	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
 }
 
+func (t *awsToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
 func (k *awsKey) Public() crypto.PublicKey {
 	return k.pub
 }
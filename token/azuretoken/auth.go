@@ -9,6 +9,9 @@ import (
 	"github.com/sassoftware/relic/v8/config"
 )
 
+// PIN value that selects managed identity auth
+const managedIdentity = "managed-identity"
+
 var compatVars = map[string]string{
 	"AZURE_BEARER_TOKEN_FILE":    "AZURE_FEDERATED_TOKEN_FILE",
 	"AZURE_CERTIFICATE_PATH":     "AZURE_CLIENT_CERTIFICATE_PATH",
@@ -37,7 +40,21 @@ func newCredential(tconf *config.TokenConfig) (azcore.TokenCredential, error) {
 		}
 		return azidentity.NewAzureCLICredential(opts)
 
+	case *tconf.Pin == managedIdentity:
+		// use managed identity, optionally user-assigned
+		opts := &azidentity.ManagedIdentityCredentialOptions{}
+		if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+			opts.ID = azidentity.ClientID(clientID)
+		}
+		return azidentity.NewManagedIdentityCredential(opts)
+
 	default:
-		return nil, errors.New("azure token pin must be empty or absent - credential files are no longer supported")
+		// PIN is a client secret for the service principal named in the environment
+		tenantID := os.Getenv("AZURE_TENANT_ID")
+		clientID := os.Getenv("AZURE_CLIENT_ID")
+		if tenantID == "" || clientID == "" {
+			return nil, errors.New("azure token pin is a client secret, but AZURE_TENANT_ID and AZURE_CLIENT_ID are not set")
+		}
+		return azidentity.NewClientSecretCredential(tenantID, clientID, *tconf.Pin, nil)
 	}
 }
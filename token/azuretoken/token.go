@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -115,7 +116,7 @@ func (t *kvToken) getKey(ctx context.Context, keyConf *config.KeyConfig, pingOnl
 		// link to a cert version, get the key version and cert contents from it
 		cert, err = t.loadCertificateVersion(ctx, baseURL, words[2], words[3])
 		if err != nil {
-			return nil, fmt.Errorf("key %q: fetching certificate: %w", keyConf.Name(), err)
+			return nil, fmt.Errorf("key %q: fetching certificate: %w", keyConf.Name(), wrapError(err))
 		} else if pingOnly {
 			return nil, nil
 		}
@@ -123,7 +124,7 @@ func (t *kvToken) getKey(ctx context.Context, keyConf *config.KeyConfig, pingOnl
 		// link to a cert, pick the latest version
 		cert, err = t.loadCertificateVersion(ctx, baseURL, words[2], "")
 		if err != nil {
-			return nil, fmt.Errorf("key %q: fetching certificate: %w", keyConf.Name(), err)
+			return nil, fmt.Errorf("key %q: fetching certificate: %w", keyConf.Name(), wrapError(err))
 		} else if pingOnly {
 			return nil, nil
 		}
@@ -136,7 +137,7 @@ func (t *kvToken) getKey(ctx context.Context, keyConf *config.KeyConfig, pingOnl
 	}
 	key, err := keyClient.GetKey(ctx, cert.KeyName, cert.KeyVersion, nil)
 	if err != nil {
-		return nil, fmt.Errorf("key %q: %w", keyConf.Name(), err)
+		return nil, fmt.Errorf("key %q: %w", keyConf.Name(), wrapError(err))
 	} else if pingOnly {
 		return nil, nil
 	}
@@ -179,6 +180,10 @@ func (t *kvToken) ListKeys(opts token.ListOptions) error {
 	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
 }
 
+func (t *kvToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
 func (k *kvKey) Public() crypto.PublicKey {
 	return k.pub
 }
@@ -206,7 +211,7 @@ func (k *kvKey) SignContext(ctx context.Context, digest []byte, opts crypto.Sign
 		Value:     digest,
 	}, nil)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 	sig := resp.Result
 	if _, ok := k.pub.(*ecdsa.PublicKey); ok {
@@ -260,3 +265,28 @@ func (k *kvKey) sigAlgorithm(opts crypto.SignerOpts) (azkeys.SignatureAlgorithm,
 		}
 	}
 }
+
+// throttledError marks a Key Vault response that should be retried later
+type throttledError struct {
+	Err error
+}
+
+func (e throttledError) Error() string   { return e.Err.Error() }
+func (e throttledError) Unwrap() error   { return e.Err }
+func (e throttledError) Temporary() bool { return true }
+
+// mark throttling and service errors from Key Vault as retryable
+func wrapError(err error) error {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	switch respErr.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return throttledError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package azuretoken
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/internal/httperror"
+)
+
+func TestWrapErrorRetryable(t *testing.T) {
+	cases := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusTooManyRequests, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+	}
+	for _, c := range cases {
+		t.Run(http.StatusText(c.status), func(t *testing.T) {
+			respErr := &azcore.ResponseError{StatusCode: c.status}
+			// GetKey adds the key name on top of the marked error
+			err := fmt.Errorf("key %q: %w", "mykey", wrapError(respErr))
+			assert.Equal(t, c.want, httperror.Temporary(err))
+			assert.True(t, errors.As(err, &respErr), "the Key Vault error is still reachable")
+		})
+	}
+	assert.False(t, httperror.Temporary(wrapError(errors.New("not a response"))))
+}
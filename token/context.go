@@ -1,6 +1,10 @@
 package token
 
-import "context"
+import (
+	"context"
+	"crypto"
+	"io"
+)
 
 type ctxKey int
 
@@ -14,3 +18,19 @@ func KeyID(ctx context.Context) []byte {
 	keyID, _ := ctx.Value(ctxKeyID).([]byte)
 	return keyID
 }
+
+// WithContext returns a view of key whose Sign method calls SignContext with
+// ctx, so that code which only knows about crypto.Signer still stops when the
+// operation it is part of is cancelled or runs out of time
+func WithContext(ctx context.Context, key Key) Key {
+	return contextKey{Key: key, ctx: ctx}
+}
+
+type contextKey struct {
+	Key
+	ctx context.Context
+}
+
+func (k contextKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.Key.SignContext(k.ctx, digest, opts)
+}
@@ -0,0 +1,54 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package token
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+// GenerateCSR makes a PKCS#10 certificate signing request for a key and
+// returns it in PEM format. The request is signed by the token.
+func GenerateCSR(key Key, subject pkix.Name) ([]byte, error) {
+	if subject.CommonName == "" {
+		return nil, errors.New("a commonName is required to make a certificate request")
+	}
+	template := &x509.CertificateRequest{
+		Subject:            subject,
+		SignatureAlgorithm: x509tools.X509SignatureAlgorithm(key.Public()),
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// SubjectFromConfig returns the subject configured for a key's certificate requests
+func SubjectFromConfig(keyConf *config.KeyConfig) pkix.Name {
+	name := pkix.Name{CommonName: keyConf.CommonName}
+	if keyConf.Organization != "" {
+		name.Organization = []string{keyConf.Organization}
+	}
+	return name
+}
@@ -19,34 +19,70 @@ package filetoken
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/lib/certloader"
 	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
 	"github.com/sassoftware/relic/v8/token"
 )
 
-const tokenType = "file"
+const (
+	tokenType       = "file"
+	tokenTypePkcs12 = "pkcs12"
+)
 
 func init() {
 	token.Openers[tokenType] = Open
+	token.Openers[tokenTypePkcs12] = OpenPkcs12
 }
 
 type fileToken struct {
 	config    *config.Config
 	tokenConf *config.TokenConfig
 	prompt    passprompt.PasswordGetter
+	pkcs12    bool
 }
 
 type fileKey struct {
 	keyConf *config.KeyConfig
 	signer  crypto.Signer
 	cert    []byte
+	id      []byte
+}
+
+// pinPrompt supplies the PIN from the token configuration as the key file password
+type pinPrompt string
+
+func (p pinPrompt) GetPasswd(prompt string) (string, error) {
+	return string(p), nil
+}
+
+// configuredPin answers only the first password request. The parsers ask again
+// when the password is wrong, which would loop forever on a configured one.
+type configuredPin struct {
+	getter passprompt.PasswordGetter
+	asked  bool
+}
+
+func (p *configuredPin) GetPasswd(prompt string) (string, error) {
+	if p.asked {
+		return "", sigerrors.PinIncorrectError{}
+	}
+	p.asked = true
+	return p.getter.GetPasswd(prompt)
 }
 
 func Open(conf *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
@@ -61,6 +97,28 @@ func Open(conf *config.Config, tokenName string, prompt passprompt.PasswordGette
 	}, nil
 }
 
+// OpenPkcs12 opens a token where every key file is a PKCS#12 (.pfx) bundle of
+// the private key and its certificate chain, as if each key set IsPkcs12
+func OpenPkcs12(conf *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
+	tok, err := Open(conf, tokenName, prompt)
+	if err != nil {
+		return nil, err
+	}
+	tok.(*fileToken).pkcs12 = true
+	return tok, nil
+}
+
+func (tok *fileToken) isPkcs12(keyConf *config.KeyConfig) bool {
+	return tok.pkcs12 || keyConf.IsPkcs12
+}
+
+func (tok *fileToken) typeName() string {
+	if tok.pkcs12 {
+		return tokenTypePkcs12
+	}
+	return tokenType
+}
+
 func (tok *fileToken) Ping(context.Context) error {
 	return nil
 }
@@ -74,7 +132,11 @@ func (tok *fileToken) Config() *config.TokenConfig {
 }
 
 func (tok *fileToken) ListKeys(opts token.ListOptions) error {
-	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
+	return token.NotImplementedError{Op: "list-keys", Type: tok.typeName()}
+}
+
+func (tok *fileToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tok.typeName()}
 }
 
 func (tok *fileToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
@@ -82,28 +144,28 @@ func (tok *fileToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 	if err != nil {
 		return nil, err
 	}
-	if keyConf.KeyFile == "" {
-		return nil, fmt.Errorf("key \"%s\" needs a KeyFile setting", keyName)
-	}
-	blob, err := ioutil.ReadFile(keyConf.KeyFile)
+	keyPath, err := tok.keyPath(keyConf)
 	if err != nil {
 		return nil, err
 	}
-	/* TODO: keyring support
-	loginFunc := func(pin string) (bool, error) {
-	keyringUser := fmt.Sprintf("%s.%s", tok.tokenConf.Name(), keyName)
-	if savedPass != "" {
-		tok.mu.Lock()
-		defer tok.mu.Unlock()
-		if err := token.Login(tok.tokenConf, tok.prompt, loginFunc, keyringUser, ""); err != nil {
-			return nil, err
+	blob, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		return nil, sigerrors.KeyNotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+	prompt := tok.prompt
+	if tok.tokenConf.Pin != nil {
+		if getter, ok := passprompt.ParsePinSource(*tok.tokenConf.Pin); ok {
+			prompt = &configuredPin{getter: getter}
+		} else {
+			prompt = &configuredPin{getter: pinPrompt(*tok.tokenConf.Pin)}
 		}
 	}
-	*/
 	var privateKey crypto.PrivateKey
 	var certBlob []byte
-	if keyConf.IsPkcs12 {
-		cert, err := certloader.ParsePKCS12(blob, tok.prompt)
+	if tok.isPkcs12(keyConf) {
+		cert, err := certloader.ParsePKCS12(blob, prompt)
 		if err != nil {
 			return nil, err
 		}
@@ -113,15 +175,46 @@ func (tok *fileToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 		}
 	} else {
 		var err error
-		privateKey, err = certloader.ParseAnyPrivateKey(blob, tok.prompt)
+		privateKey, err = certloader.ParseAnyPrivateKey(blob, prompt)
 		if err != nil {
 			return nil, err
 		}
 	}
+	return newKey(keyConf, privateKey, certBlob)
+}
+
+// Determine the path to a key's private key file. If the key doesn't set
+// KeyFile then the token's Provider is used as a directory and the key's label
+// as the file name, with a .pfx extension for pkcs12 tokens.
+func (tok *fileToken) keyPath(keyConf *config.KeyConfig) (string, error) {
+	ext := ".key"
+	if tok.pkcs12 {
+		ext = ".pfx"
+	}
+	if keyConf.KeyFile != "" {
+		return keyConf.KeyFile, nil
+	} else if tok.tokenConf.Provider != "" && keyConf.Label != "" {
+		return filepath.Join(tok.tokenConf.Provider, keyConf.Label+ext), nil
+	}
+	return "", fmt.Errorf("key \"%s\" needs a KeyFile setting", keyConf.Name())
+}
+
+func newKey(keyConf *config.KeyConfig, privateKey crypto.PrivateKey, certBlob []byte) (*fileKey, error) {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key \"%s\": unsupported private key type %T", keyConf.Name(), privateKey)
+	}
+	// key ID is the SHA-256 digest of the public key
+	pubDer, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(pubDer)
 	return &fileKey{
 		keyConf: keyConf,
-		signer:  privateKey.(crypto.Signer),
+		signer:  signer,
 		cert:    certBlob,
+		id:      id[:],
 	}, nil
 }
 
@@ -146,20 +239,80 @@ func (key *fileKey) Certificate() []byte {
 }
 
 func (key *fileKey) GetID() []byte {
-	return nil
+	return key.id
 }
 
+// Export returns the private key that was read from the file
+func (key *fileKey) Export() (crypto.PrivateKey, error) {
+	return key.signer, nil
+}
+
+// Import a private key by writing it as a PKCS#8 PEM file at the key's path
 func (tok *fileToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
-	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if tok.isPkcs12(keyConf) {
+		return nil, token.NotImplementedError{Op: "import-pkcs12", Type: tok.typeName()}
+	}
+	keyPath, err := tok.keyPath(keyConf)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newKey(keyConf, privKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	pk8, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, sigerrors.ErrExist
+	} else if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: pk8}); err != nil {
+		f.Close()
+		os.Remove(keyPath)
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(keyPath)
+		return nil, err
+	}
+	keyConf.KeyFile = keyPath
+	return key, nil
 }
 
 func (tok *fileToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
-	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+	return token.NotImplementedError{Op: "import-certificate", Type: tok.typeName()}
 }
 
+// Generate a RSA, ECDSA or Ed25519 key and write it to the key's path
 func (tok *fileToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
-	// TODO - probably useful
-	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+	var privKey crypto.PrivateKey
+	var err error
+	switch keyType {
+	case token.KeyTypeRsa:
+		privKey, err = rsa.GenerateKey(rand.Reader, int(bits))
+	case token.KeyTypeEcdsa:
+		var curve *x509tools.CurveDefinition
+		curve, err = x509tools.CurveByBits(bits)
+		if err == nil {
+			privKey, err = ecdsa.GenerateKey(curve.Curve, rand.Reader)
+		}
+	case token.KeyTypeEd25519:
+		_, privKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tok.Import(keyName, privKey)
 }
 
 func (key *fileKey) ImportCertificate(cert *x509.Certificate) error {
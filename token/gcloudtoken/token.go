@@ -19,7 +19,10 @@ import (
 	"github.com/sassoftware/relic/v8/token"
 )
 
-const tokenType = "gcloud"
+const (
+	tokenType  = "gcloud"
+	tokenAlias = "gcpkms"
+)
 
 type gcloudToken struct {
 	config *config.Config
@@ -37,6 +40,7 @@ type gcloudKey struct {
 
 func init() {
 	token.Openers[tokenType] = open
+	token.Openers[tokenAlias] = open
 }
 
 func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
@@ -64,7 +68,18 @@ func (t *gcloudToken) Close() error {
 }
 
 func (t *gcloudToken) Ping(ctx context.Context) error {
-	// TODO
+	// query info for one of the keys in this token
+	for _, keyConf := range t.config.Keys {
+		if keyConf.Token != t.tconf.Name() || keyConf.Hide || keyConf.ID == "" {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, keyConf.GetTimeout())
+		defer cancel()
+		if _, err := t.cli.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{Name: keyConf.ID}); err != nil {
+			return fmt.Errorf("checking key %q: %w", keyConf.Name(), err)
+		}
+		break
+	}
 	return nil
 }
 
@@ -78,7 +93,7 @@ func (t *gcloudToken) GetKey(ctx context.Context, keyName string) (token.Key, er
 		return nil, err
 	}
 	if keyConf.ID == "" {
-		return nil, fmt.Errorf("key %q must have \"id\" set to the fully-quaified resource name of a Cloud KMS key version", keyName)
+		return nil, fmt.Errorf("key %q must have \"id\" set to the fully-qualified resource name of a Cloud KMS key version", keyName)
 	}
 	resp, err := t.cli.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: keyConf.ID})
 	if err != nil {
@@ -123,6 +138,10 @@ func (t *gcloudToken) ListKeys(opts token.ListOptions) error {
 	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
 }
 
+func (t *gcloudToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
 func (k *gcloudKey) Public() crypto.PublicKey {
 	return k.pub
 }
@@ -137,6 +156,11 @@ func (k *gcloudKey) SignContext(ctx context.Context, digest []byte, opts crypto.
 			Key: k.kconf.Name(),
 			Err: fmt.Errorf("tried to use digest %s but key requires digest %s", opts.HashFunc(), k.hash),
 		}
+	} else if len(digest) != k.hash.Size() {
+		return nil, token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("digest is %d bytes but %s requires %d", len(digest), k.hash, k.hash.Size()),
+		}
 	}
 	if _, ok := opts.(*rsa.PSSOptions); ok && !k.pss {
 		return nil, token.KeyUsageError{
@@ -28,7 +28,15 @@ import (
 
 func Login(tokenConf *config.TokenConfig, pinProvider passprompt.PasswordGetter, loginFunc passprompt.LoginFunc, keyringUser, initialPrompt string) error {
 	if tokenConf.Pin != nil {
-		ok, err := loginFunc(*tokenConf.Pin)
+		pin := *tokenConf.Pin
+		if getter, ok := passprompt.ParsePinSource(pin); ok {
+			var err error
+			pin, err = getter.GetPasswd("")
+			if err != nil {
+				return err
+			}
+		}
+		ok, err := loginFunc(pin)
 		if err != nil {
 			return err
 		} else if !ok {
@@ -50,7 +58,7 @@ func Login(tokenConf *config.TokenConfig, pinProvider passprompt.PasswordGetter,
 		if pinProvider == nil {
 			msg := "PIN required but none was provided"
 			if tokenConf.UseKeyring {
-				msg += "; use 'relic ping' to save password in keyring"
+				msg += "; use 'relic token ping' to save password in keyring"
 			}
 			return errors.New(msg)
 		}
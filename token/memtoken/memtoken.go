@@ -0,0 +1,269 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package memtoken implements a token that holds software keys in memory. It
+// is intended for tests and nothing is ever persisted.
+package memtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+const tokenType = "memory"
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+type Token struct {
+	config    *config.Config
+	tokenConf *config.TokenConfig
+
+	mu    sync.Mutex
+	keys  map[string]*Key
+	certs []*x509.Certificate
+}
+
+type Key struct {
+	keyConf *config.KeyConfig
+	signer  crypto.Signer
+	id      []byte
+
+	mu   sync.Mutex
+	cert []byte
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tokenConf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		config:    conf,
+		tokenConf: tokenConf,
+		keys:      make(map[string]*Key),
+	}, nil
+}
+
+// New creates a standalone token seeded with the given keys, which are named
+// "key0", "key1", etc. in the token's own configuration
+func New(keys ...crypto.Signer) *Token {
+	conf := new(config.Config)
+	tokenConf := conf.NewToken(tokenType)
+	tokenConf.Type = tokenType
+	tok := &Token{
+		config:    conf,
+		tokenConf: tokenConf,
+		keys:      make(map[string]*Key),
+	}
+	for i, signer := range keys {
+		keyName := fmt.Sprintf("key%d", i)
+		keyConf := conf.NewKey(keyName)
+		keyConf.Token = tokenType
+		keyConf.Label = keyName
+		if _, err := tok.Import(keyName, signer); err != nil {
+			panic(err)
+		}
+	}
+	return tok
+}
+
+// Configuration that keys of a standalone token were added to
+func (tok *Token) AppConfig() *config.Config {
+	return tok.config
+}
+
+func (tok *Token) Close() error {
+	return nil
+}
+
+func (tok *Token) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (tok *Token) Config() *config.TokenConfig {
+	return tok.tokenConf
+}
+
+// keys are stored by label, or by name if they don't have one
+func keyLabel(keyConf *config.KeyConfig) string {
+	if keyConf.Label != "" {
+		return keyConf.Label
+	}
+	return keyConf.Name()
+}
+
+func (tok *Token) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	key := tok.keys[keyLabel(keyConf)]
+	if key == nil {
+		return nil, sigerrors.KeyNotFoundError{}
+	}
+	return key, nil
+}
+
+func (tok *Token) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privKey)
+	}
+	// key ID is the SHA-256 digest of the public key
+	pubDer, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	id := sha256.Sum256(pubDer)
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	label := keyLabel(keyConf)
+	if tok.keys[label] != nil {
+		return nil, sigerrors.ErrExist
+	}
+	key := &Key{
+		keyConf: keyConf,
+		signer:  signer,
+		id:      id[:],
+	}
+	tok.keys[label] = key
+	return key, nil
+}
+
+func (tok *Token) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	for _, existing := range tok.certs {
+		if existing.Equal(cert) {
+			return sigerrors.ErrExist
+		}
+	}
+	tok.certs = append(tok.certs, cert)
+	return nil
+}
+
+func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	var privKey crypto.PrivateKey
+	var err error
+	switch keyType {
+	case token.KeyTypeRsa:
+		privKey, err = rsa.GenerateKey(rand.Reader, int(bits))
+	case token.KeyTypeEcdsa:
+		var curve *x509tools.CurveDefinition
+		curve, err = x509tools.CurveByBits(bits)
+		if err == nil {
+			privKey, err = ecdsa.GenerateKey(curve.Curve, rand.Reader)
+		}
+	case token.KeyTypeEd25519:
+		_, privKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tok.Import(keyName, privKey)
+}
+
+func (tok *Token) ListKeys(opts token.ListOptions) error {
+	infos, err := tok.EnumerateKeys()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if opts.Label != "" && info.Label != opts.Label {
+			continue
+		}
+		fmt.Fprintf(opts.Output, "%s:\n type:    %s\n bits:    %d\n id:      %x\n", info.Label, info.Type, info.Bits, info.ID)
+	}
+	return nil
+}
+
+func (tok *Token) EnumerateKeys() ([]token.KeyInfo, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	infos := make([]token.KeyInfo, 0, len(tok.keys))
+	for label, key := range tok.keys {
+		info := token.KeyInfo{Label: label, ID: key.id}
+		info.SetPublic(key.Public())
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Label < infos[j].Label })
+	return infos, nil
+}
+
+func (key *Key) Public() crypto.PublicKey {
+	return key.signer.Public()
+}
+
+func (key *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return key.signer.Sign(rand, digest, opts)
+}
+
+func (key *Key) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return key.signer.Sign(rand.Reader, digest, opts)
+}
+
+func (key *Key) Config() *config.KeyConfig {
+	return key.keyConf
+}
+
+func (key *Key) Certificate() []byte {
+	key.mu.Lock()
+	defer key.mu.Unlock()
+	return key.cert
+}
+
+func (key *Key) GetID() []byte {
+	return key.id
+}
+
+func (key *Key) ImportCertificate(cert *x509.Certificate) error {
+	if !x509tools.SameKey(key.Public(), cert.PublicKey) {
+		return fmt.Errorf("key %q: certificate does not match key", key.keyConf.Name())
+	}
+	key.mu.Lock()
+	defer key.mu.Unlock()
+	if key.cert != nil {
+		return sigerrors.ErrExist
+	}
+	key.cert = cert.Raw
+	return nil
+}
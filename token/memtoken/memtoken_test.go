@@ -0,0 +1,72 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package memtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+func TestSeededKey(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := New(priv)
+	key, err := tok.GetKey(context.Background(), "key0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := key.SignContext(context.Background(), digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&priv.PublicKey, digest[:], sig) {
+		t.Error("signature did not verify")
+	}
+	if _, err := tok.Import("key0", priv); err != sigerrors.ErrExist {
+		t.Errorf("expected ErrExist importing a duplicate key, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tok := New()
+	keyConf := tok.AppConfig().NewKey("gen")
+	keyConf.Token = tokenType
+	if _, err := tok.GetKey(context.Background(), "gen"); !errors.As(err, new(sigerrors.KeyNotFoundError)) {
+		t.Fatalf("expected KeyNotFoundError before generating, got %v", err)
+	}
+	if _, err := tok.Generate("gen", token.KeyTypeEd25519, 0); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := tok.EnumerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(infos) != 1 || infos[0].Type != "ed25519" {
+		t.Errorf("unexpected key list: %+v", infos)
+	}
+}
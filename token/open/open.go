@@ -30,7 +30,10 @@ import (
 	_ "github.com/sassoftware/relic/v8/token/azuretoken"
 	_ "github.com/sassoftware/relic/v8/token/filetoken"
 	_ "github.com/sassoftware/relic/v8/token/gcloudtoken"
+	_ "github.com/sassoftware/relic/v8/token/memtoken"
 	_ "github.com/sassoftware/relic/v8/token/scdtoken"
+	_ "github.com/sassoftware/relic/v8/token/tpmtoken"
+	_ "github.com/sassoftware/relic/v8/token/vaulttoken"
 )
 
 func Token(cfg *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
@@ -41,11 +44,7 @@ func Token(cfg *config.Config, tokenName string, prompt passprompt.PasswordGette
 	if ofunc := token.Openers[tcfg.Type]; ofunc != nil {
 		return ofunc(cfg, tokenName, prompt)
 	}
-	var msg string
-	if tcfg.Type == "pkcs11" {
-		msg = " -- built without pkcs11 support"
-	}
-	return nil, fmt.Errorf("unknown token type %s%s", tcfg.Type, msg)
+	return nil, fmt.Errorf("unknown token type %s%s", tcfg.Type, missingSupport(tcfg.Type))
 }
 
 func Key(cfg *config.Config, keyName string, prompt passprompt.PasswordGetter) (token.Key, error) {
@@ -72,9 +71,45 @@ func List(tokenType, provider string, w io.Writer) error {
 	if token.Openers[tokenType] != nil {
 		return fmt.Errorf("list operation not supported for token type %s", tokenType)
 	}
-	var msg string
-	if tokenType == "pkcs11" {
-		msg = " -- built without pkcs11 support"
+	return fmt.Errorf("unknown token type %s%s", tokenType, missingSupport(tokenType))
+}
+
+func SetPIN(cfg *config.Config, tokenName string, so bool, oldPin, newPin string) error {
+	tcfg, err := cfg.GetToken(tokenName)
+	if err != nil {
+		return err
+	}
+	if setFunc := token.PINSetters[tcfg.Type]; setFunc != nil {
+		return setFunc(tcfg, so, oldPin, newPin)
+	}
+	if token.Openers[tcfg.Type] != nil {
+		return fmt.Errorf("changing the PIN is not supported for token type %s", tcfg.Type)
+	}
+	return fmt.Errorf("unknown token type %s%s", tcfg.Type, missingSupport(tcfg.Type))
+}
+
+// ResetPIN logs in to a token as the security officer and sets a new user PIN
+func ResetPIN(cfg *config.Config, tokenName string, soPin, newPin string) error {
+	tcfg, err := cfg.GetToken(tokenName)
+	if err != nil {
+		return err
+	}
+	if resetFunc := token.PINResetters[tcfg.Type]; resetFunc != nil {
+		return resetFunc(tcfg, soPin, newPin)
+	}
+	if token.Openers[tcfg.Type] != nil {
+		return fmt.Errorf("resetting the PIN is not supported for token type %s", tcfg.Type)
+	}
+	return fmt.Errorf("unknown token type %s%s", tcfg.Type, missingSupport(tcfg.Type))
+}
+
+// Explain why a known token type is not available in this build
+func missingSupport(tokenType string) string {
+	switch tokenType {
+	case "pkcs11":
+		return " -- built without pkcs11 support"
+	case "yubikey":
+		return " -- built without yubikey support"
 	}
-	return fmt.Errorf("unknown token type %s%s", tokenType, msg)
+	return ""
 }
@@ -0,0 +1,101 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto"
+	"crypto/x509"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+// keyCache remembers the public half of keys and their certificate chains so
+// that looking up the same key repeatedly doesn't go back to the token, which
+// is slow on network HSMs. Keys are cached by the label and ID in their
+// configuration, since several keys on a token may share a CKA_ID, while
+// certificate chains are shared by CKA_ID. Object handles remain
+// valid as long as the token is open, so the cache is cleared on Close and
+// whenever objects are added to the token.
+type keyCache struct {
+	mu     sync.Mutex
+	keys   map[string]*cachedKey
+	chains map[string][]*x509.Certificate
+}
+
+type cachedKey struct {
+	id         []byte
+	label      string
+	keyType    uint
+	pub        pkcs11.ObjectHandle
+	priv       pkcs11.ObjectHandle
+	pubParsed  crypto.PublicKey
+	alwaysAuth bool
+}
+
+func keySelector(keyConf *config.KeyConfig) string {
+	return keyConf.Label + "\x00" + keyConf.ID
+}
+
+func (c *keyCache) getKey(keyConf *config.KeyConfig) *cachedKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.keys[keySelector(keyConf)]
+}
+
+func (c *keyCache) putKey(keyConf *config.KeyConfig, entry *cachedKey) {
+	if len(entry.id) == 0 {
+		// can't tell keys without a CKA_ID apart
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]*cachedKey)
+	}
+	c.keys[keySelector(keyConf)] = entry
+}
+
+func (c *keyCache) getChain(id []byte) []*x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	chain := c.chains[string(id)]
+	if chain == nil {
+		return nil
+	}
+	// callers may modify the returned slice
+	return append([]*x509.Certificate(nil), chain...)
+}
+
+func (c *keyCache) putChain(id []byte, chain []*x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.chains == nil {
+		c.chains = make(map[string][]*x509.Certificate)
+	}
+	c.chains[string(id)] = append([]*x509.Certificate(nil), chain...)
+}
+
+// reset discards everything, for when the token is closed or modified
+func (c *keyCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = nil
+	c.chains = nil
+}
@@ -0,0 +1,95 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto/x509"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func TestKeyCache(t *testing.T) {
+	var c keyCache
+	byLabel := &config.KeyConfig{Label: "signer"}
+	byID := &config.KeyConfig{ID: "0102"}
+	entry := &cachedKey{id: []byte{1, 2}, label: "signer", priv: 5, pub: 6}
+	assert.Nil(t, c.getKey(byLabel))
+	c.putKey(byLabel, entry)
+	c.putKey(byID, entry)
+	assert.Same(t, entry, c.getKey(byLabel))
+	assert.Same(t, entry, c.getKey(byID))
+	assert.Nil(t, c.getKey(&config.KeyConfig{Label: "other"}))
+
+	// keys without an ID are not cached
+	c.putKey(&config.KeyConfig{Label: "noid"}, &cachedKey{label: "noid"})
+	assert.Nil(t, c.getKey(&config.KeyConfig{Label: "noid"}))
+
+	chain := []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("root")}}
+	c.putChain(entry.id, chain)
+	got := c.getChain(entry.id)
+	assert.Equal(t, chain, got)
+	got[0] = nil
+	assert.Equal(t, chain, c.getChain(entry.id), "cached chain must not be shared with callers")
+
+	c.reset()
+	assert.Nil(t, c.getKey(byLabel))
+	assert.Nil(t, c.getChain(entry.id))
+}
+
+func TestKeyCacheSharedID(t *testing.T) {
+	// vendor tools often give every key the same CKA_ID
+	var c keyCache
+	confA := &config.KeyConfig{Label: "a", ID: "01"}
+	confB := &config.KeyConfig{Label: "b", ID: "01"}
+	entryA := &cachedKey{id: []byte{1}, label: "a", priv: 5, pub: 6}
+	entryB := &cachedKey{id: []byte{1}, label: "b", priv: 7, pub: 8}
+	c.putKey(confA, entryA)
+	c.putKey(confB, entryB)
+	assert.Same(t, entryA, c.getKey(confA))
+	assert.Same(t, entryB, c.getKey(confB))
+
+	// the certificate chain is still shared by CKA_ID
+	chain := []*x509.Certificate{{Raw: []byte("leaf")}}
+	c.putChain(entryA.id, chain)
+	assert.Equal(t, chain, c.getChain(entryB.id))
+}
+
+func TestKeyCacheConcurrent(t *testing.T) {
+	var c keyCache
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keyConf := &config.KeyConfig{ID: string(rune('a' + i))}
+			for j := 0; j < 100; j++ {
+				c.putKey(keyConf, &cachedKey{id: []byte(keyConf.ID)})
+				c.getKey(keyConf)
+				c.putChain([]byte(keyConf.ID), nil)
+				c.getChain([]byte(keyConf.ID))
+				if j%10 == 0 {
+					c.reset()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -17,6 +17,7 @@
 package p11token
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"crypto/x509"
 	"errors"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/miekg/pkcs11"
 
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
 )
 
@@ -58,6 +60,7 @@ func (tk *Token) ImportCertificate(cert *x509.Certificate, labelBase string) err
 		pkcs11.NewAttribute(pkcs11.CKA_VALUE, cert.Raw),
 	}
 	attrs = append(attrs, newCertAttrs...)
+	tk.cache.reset()
 	_, err := tk.ctx.CreateObject(tk.sh, attrs)
 	return err
 }
@@ -78,6 +81,9 @@ func (tk *Token) certExists(label string) error {
 }
 
 func (key *Key) ImportCertificate(cert *x509.Certificate) error {
+	if !x509tools.SameKey(key.Public(), cert.PublicKey) {
+		return errors.New("certificate does not match key")
+	}
 	keyID, handle, err := key.findCertificate()
 	if err != nil {
 		return err
@@ -98,10 +104,74 @@ func (key *Key) ImportCertificate(cert *x509.Certificate) error {
 	attrs = append(attrs, newCertAttrs...)
 	key.token.mutex.Lock()
 	defer key.token.mutex.Unlock()
+	key.token.cache.reset()
 	_, err = key.token.ctx.CreateObject(key.token.sh, attrs)
 	return err
 }
 
+// CertificateChain returns the leaf certificate, which shares the key's CKA_ID,
+// followed by whichever issuers were imported into the token alongside it.
+// Issuers are found by matching each certificate's issuer to a subject.
+func (key *Key) CertificateChain() ([]*x509.Certificate, error) {
+	if chain := key.token.cache.getChain(key.id); chain != nil {
+		return chain, nil
+	}
+	_, handle, err := key.findCertificate()
+	if err != nil {
+		return nil, err
+	} else if handle == 0 {
+		return nil, sigerrors.ErrNoCertificate{Type: "x509"}
+	}
+	tk := key.token
+	tk.mutex.Lock()
+	defer tk.mutex.Unlock()
+	leaf, err := x509.ParseCertificate(tk.getAttribute(handle, pkcs11.CKA_VALUE))
+	if err != nil {
+		return nil, fmt.Errorf("parsing leaf certificate: %w", err)
+	}
+	chain := []*x509.Certificate{leaf}
+	for cert := leaf; len(chain) < maxChainLength; {
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			break
+		}
+		issuer, err := tk.findIssuer(cert)
+		if err != nil {
+			return nil, err
+		} else if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		cert = issuer
+	}
+	tk.cache.putChain(key.id, chain)
+	return chain, nil
+}
+
+const maxChainLength = 10
+
+// find a certificate object that issued cert
+func (tk *Token) findIssuer(cert *x509.Certificate) (*x509.Certificate, error) {
+	attrs := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+		pkcs11.NewAttribute(pkcs11.CKA_SUBJECT, cert.RawIssuer),
+	}
+	objects, err := tk.findObject(attrs)
+	if err != nil {
+		return nil, err
+	}
+	for _, handle := range objects {
+		candidate, err := x509.ParseCertificate(tk.getAttribute(handle, pkcs11.CKA_VALUE))
+		if err != nil {
+			continue
+		}
+		// the same subject may have been reissued with a different key
+		if cert.CheckSignatureFrom(candidate) == nil {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
 func (key *Key) findCertificate() (keyID []byte, handle pkcs11.ObjectHandle, err error) {
 	keyID = key.GetID()
 	if len(keyID) == 0 {
@@ -0,0 +1,70 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto"
+	"crypto/dsa" //nolint:staticcheck
+	"errors"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+)
+
+// Convert token DSA public key to *dsa.PublicKey
+func (key *Key) toDsaKey() (crypto.PublicKey, error) {
+	p := key.token.getAttribute(key.pub, pkcs11.CKA_PRIME)
+	q := key.token.getAttribute(key.pub, pkcs11.CKA_SUBPRIME)
+	g := key.token.getAttribute(key.pub, pkcs11.CKA_BASE)
+	y := key.token.getAttribute(key.pub, pkcs11.CKA_VALUE)
+	if len(p) == 0 || len(q) == 0 || len(g) == 0 || len(y) == 0 {
+		return nil, errors.New("unable to retrieve DSA public key")
+	}
+	return &dsa.PublicKey{
+		Parameters: dsa.Parameters{
+			P: new(big.Int).SetBytes(p),
+			Q: new(big.Int).SetBytes(q),
+			G: new(big.Int).SetBytes(g),
+		},
+		Y: new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// Sign a digest using token DSA private key
+func (key *Key) signDSA(sh pkcs11.SessionHandle, digest []byte) ([]byte, error) {
+	// CKM_DSA takes a digest no longer than the subgroup order
+	pub := key.pubParsed.(*dsa.PublicKey)
+	if n := (pub.Q.BitLen() + 7) / 8; len(digest) > n {
+		digest = digest[:n]
+	}
+	mech := pkcs11.NewMechanism(pkcs11.CKM_DSA, nil)
+	if err := key.signInit(sh, mech); err != nil {
+		return nil, err
+	}
+	sig, err := key.token.ctx.Sign(sh, digest)
+	if err != nil {
+		return nil, err
+	}
+	// r || s, same as ECDSA
+	parsed, err := x509tools.UnpackEcdsaSignature(sig)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Marshal(), nil
+}
@@ -0,0 +1,78 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/asn1"
+	"errors"
+
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 v3.0 constants not yet provided by the pkcs11 package
+const (
+	CKK_EC_EDWARDS              = 0x40
+	CKM_EC_EDWARDS_KEY_PAIR_GEN = 0x1055
+	CKM_EDDSA                   = 0x1057
+)
+
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// Convert token Ed25519 public key to ed25519.PublicKey
+func (key *Key) toEd25519Key() (crypto.PublicKey, error) {
+	ecpoint := key.token.getAttribute(key.pub, pkcs11.CKA_EC_POINT)
+	if len(ecpoint) == 0 {
+		return nil, errors.New("Unable to retrieve Ed25519 public key")
+	}
+	if len(ecpoint) != ed25519.PublicKeySize {
+		// most tokens wrap the point in an octet string
+		var raw []byte
+		if _, err := asn1.Unmarshal(ecpoint, &raw); err != nil {
+			return nil, err
+		}
+		ecpoint = raw
+	}
+	if len(ecpoint) != ed25519.PublicKeySize {
+		return nil, errors.New("Invalid Ed25519 public key")
+	}
+	return ed25519.PublicKey(ecpoint), nil
+}
+
+// Sign a message using token Ed25519 private key
+func (key *Key) signEd25519(sh pkcs11.SessionHandle, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != 0 {
+		return nil, errors.New("Ed25519 keys can only sign the unhashed message")
+	}
+	mech := pkcs11.NewMechanism(CKM_EDDSA, nil)
+	if err := key.signInit(sh, mech); err != nil {
+		return nil, err
+	}
+	return key.token.ctx.Sign(sh, message)
+}
+
+// Generate Ed25519-specific public attributes to generate an Ed25519 key in the token
+func ed25519GenerateAttrs() ([]*pkcs11.Attribute, *pkcs11.Mechanism, error) {
+	params, err := asn1.Marshal(oidEd25519)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubAttrs := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params)}
+	mech := pkcs11.NewMechanism(CKM_EC_EDWARDS_KEY_PAIR_GEN, nil)
+	return pubAttrs, mech, nil
+}
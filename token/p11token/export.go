@@ -0,0 +1,155 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/sassoftware/relic/v8/token"
+)
+
+// Export reads the private key out of the token so it can be imported
+// elsewhere. Sensitive keys are wrapped under a temporary 3DES key with
+// C_WrapKey and decrypted here, the reverse of importPkcs8. Keys that are
+// neither extractable nor readable can't be exported at all.
+func (key *Key) Export() (crypto.PrivateKey, error) {
+	tok := key.token
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	if !tok.getBool(key.priv, pkcs11.CKA_SENSITIVE, true) {
+		return key.readPrivate()
+	}
+	if !tok.getBool(key.priv, pkcs11.CKA_EXTRACTABLE, false) {
+		return nil, token.KeyNotExtractableError{Key: key.keyConf.Name(), Token: tok.tokenConf.Name()}
+	}
+	pk8, err := key.wrapPkcs8()
+	if err != nil {
+		return nil, fmt.Errorf("wrapping key: %w", err)
+	}
+	return x509.ParsePKCS8PrivateKey(pk8)
+}
+
+// Wrap the private key under a temporary 3DES key and decrypt the result to
+// a PKCS#8 blob
+func (key *Key) wrapPkcs8() (pk8 []byte, err error) {
+	tok := key.token
+	genMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_DES3_KEY_GEN, nil)}
+	wrapKey, err := tok.ctx.GenerateKey(tok.sh, genMech, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, false),
+		pkcs11.NewAttribute(pkcs11.CKA_WRAP, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := tok.ctx.DestroyObject(tok.sh, wrapKey)
+		if err2 != nil && err == nil {
+			err = fmt.Errorf("destroying temporary key: %w", err2)
+		}
+	}()
+	iv := make([]byte, des.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	wrapMech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_DES3_CBC_PAD, iv)}
+	wrapped, err := tok.ctx.WrapKey(tok.sh, wrapMech, wrapKey, key.priv)
+	if err != nil {
+		return nil, err
+	}
+	block, err := des.NewTripleDESCipher(tok.getAttribute(wrapKey, pkcs11.CKA_VALUE))
+	if err != nil {
+		return nil, fmt.Errorf("reading temporary key: %w", err)
+	}
+	if len(wrapped) == 0 || len(wrapped)%des.BlockSize != 0 {
+		return nil, errors.New("wrapped key has an invalid length")
+	}
+	pk8 = make([]byte, len(wrapped))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(pk8, wrapped)
+	pad := int(pk8[len(pk8)-1])
+	if pad == 0 || pad > des.BlockSize {
+		return nil, errors.New("wrapped key has invalid padding")
+	}
+	return pk8[:len(pk8)-pad], nil
+}
+
+// Read the private key from its attributes, for keys that aren't sensitive
+func (key *Key) readPrivate() (crypto.PrivateKey, error) {
+	tok := key.token
+	switch key.keyType {
+	case CKK_RSA:
+		attrs, err := tok.ctx.GetAttributeValue(tok.sh, key.priv, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE_EXPONENT, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIME_1, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIME_2, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		priv := &rsa.PrivateKey{
+			PublicKey: *key.pubParsed.(*rsa.PublicKey),
+			D:         bytesToBig(attrs[0].Value),
+			Primes:    []*big.Int{bytesToBig(attrs[1].Value), bytesToBig(attrs[2].Value)},
+		}
+		if err := priv.Validate(); err != nil {
+			return nil, err
+		}
+		priv.Precompute()
+		return priv, nil
+	case CKK_ECDSA:
+		value := tok.getAttribute(key.priv, pkcs11.CKA_VALUE)
+		if len(value) == 0 {
+			return nil, errors.New("private key: CKA_VALUE is missing")
+		}
+		return &ecdsa.PrivateKey{
+			PublicKey: *key.pubParsed.(*ecdsa.PublicKey),
+			D:         bytesToBig(value),
+		}, nil
+	case CKK_EC_EDWARDS:
+		seed := tok.getAttribute(key.priv, pkcs11.CKA_VALUE)
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("private key: CKA_VALUE is missing or the wrong size")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	default:
+		return nil, errors.New("Unsupported key type")
+	}
+}
+
+// getBool reads a boolean attribute, or returns def if the token doesn't
+// report it
+func (tok *Token) getBool(handle pkcs11.ObjectHandle, attr uint, def bool) bool {
+	v := tok.getAttribute(handle, attr)
+	if len(v) == 0 {
+		return def
+	}
+	return v[0] != 0
+}
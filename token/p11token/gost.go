@@ -0,0 +1,81 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+)
+
+// GostPublicKey is a GOST R 34.10 public key held in a token. Go has no
+// implementation of these algorithms so only signature formats that know
+// about this type can use it.
+type GostPublicKey struct {
+	// DER-encoded OID of the curve parameters (CKA_GOSTR3410_PARAMS)
+	Params []byte
+	// DER-encoded OID of the GOST R 34.11 hash parameters (CKA_GOSTR3411_PARAMS)
+	HashParams []byte
+	// Little-endian X || Y (CKA_VALUE)
+	Value []byte
+}
+
+// Algorithm names the key type in error messages
+func (pub *GostPublicKey) Algorithm() string {
+	if len(pub.Value) == 128 {
+		return "GOST R 34.10-2012 512-bit"
+	}
+	return "GOST R 34.10"
+}
+
+func (pub *GostPublicKey) Equal(other crypto.PublicKey) bool {
+	o, ok := other.(*GostPublicKey)
+	return ok && bytes.Equal(pub.Params, o.Params) && bytes.Equal(pub.Value, o.Value)
+}
+
+// Convert token GOST R 34.10 public key to *GostPublicKey
+func (key *Key) toGostKey() (crypto.PublicKey, error) {
+	if !key.token.hasMechanism(pkcs11.CKM_GOSTR3410) {
+		return nil, errors.New("token does not provide the CKM_GOSTR3410 mechanism needed to sign with GOST keys")
+	}
+	pub := &GostPublicKey{
+		Params:     key.token.getAttribute(key.pub, pkcs11.CKA_GOSTR3410_PARAMS),
+		HashParams: key.token.getAttribute(key.pub, pkcs11.CKA_GOSTR3411_PARAMS),
+		Value:      key.token.getAttribute(key.pub, pkcs11.CKA_VALUE),
+	}
+	if len(pub.Params) == 0 || len(pub.Value) == 0 {
+		return nil, errors.New("unable to retrieve GOST public key")
+	}
+	return pub, nil
+}
+
+// Sign a digest using token GOST R 34.10 private key. The signature is
+// returned as the token encodes it, s || r.
+func (key *Key) signGOST(sh pkcs11.SessionHandle, digest []byte) ([]byte, error) {
+	size := len(key.pubParsed.(*GostPublicKey).Value) / 2
+	if len(digest) != size {
+		return nil, fmt.Errorf("%s keys need a %d-byte digest, not %d", key.pubParsed.(*GostPublicKey).Algorithm(), size, len(digest))
+	}
+	mech := pkcs11.NewMechanism(pkcs11.CKM_GOSTR3410, nil)
+	if err := key.signInit(sh, mech); err != nil {
+		return nil, err
+	}
+	return key.token.ctx.Sign(sh, digest)
+}
@@ -22,13 +22,13 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 
 	"github.com/miekg/pkcs11"
 
+	"github.com/sassoftware/relic/v8/lib/x509tools"
 	"github.com/sassoftware/relic/v8/token"
 )
 
@@ -144,11 +144,12 @@ func (tok *Token) Import(keyName string, privKey crypto.PrivateKey) (token.Key,
 		_ = tok.ctx.DestroyObject(tok.sh, pubHandle)
 		return nil, err
 	}
-	keyConf.ID = hex.EncodeToString(keyID)
+	keyConf.ID = x509tools.FormatKeyID(keyID)
+	tok.cache.reset()
 	return tok.getKey(keyConf, keyName)
 }
 
-// Generate an RSA or ECDSA key in the token
+// Generate an RSA, ECDSA or Ed25519 key in the token
 func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
 	tok.mutex.Lock()
 	defer tok.mutex.Unlock()
@@ -159,6 +160,10 @@ func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (to
 	if keyConf.Label == "" {
 		return nil, errors.New("Key attribute 'label' must be defined in order to create an object")
 	}
+	tmpl, err := newKeyTemplate(tok.tokenConf.KeyAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("token %s: %w", tok.tokenConf.Name(), err)
+	}
 	keyID := makeKeyID()
 	if keyID == nil {
 		return nil, errors.New("failed to make key ID")
@@ -170,29 +175,35 @@ func (tok *Token) Generate(keyName string, keyType token.KeyType, bits uint) (to
 		pubTypeAttrs, mech, err = rsaGenerateAttrs(bits)
 	case token.KeyTypeEcdsa:
 		pubTypeAttrs, mech, err = ecdsaGenerateAttrs(bits)
+	case token.KeyTypeEd25519:
+		pubTypeAttrs, mech, err = ed25519GenerateAttrs()
+		bits = 0
 	default:
-		return nil, errors.New("Unsupported key type")
+		return nil, token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType}
 	}
 	if err != nil {
 		return nil, err
 	}
+	if keyType == token.KeyTypeEd25519 && !tok.hasMechanism(mech.Mechanism) {
+		return nil, token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType}
+	}
 	commonAttrs := []*pkcs11.Attribute{
 		pkcs11.NewAttribute(pkcs11.CKA_ID, keyID),
 		pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyConf.Label),
 	}
-	pubAttrs := attrConcat(commonAttrs, newPublicKeyAttrs, pubTypeAttrs)
-	privAttrs := attrConcat(commonAttrs, newPrivateKeyAttrs)
+	pubAttrs := attrConcat(commonAttrs, tmpl.pub, pubTypeAttrs)
+	privAttrs := attrConcat(commonAttrs, tmpl.priv)
 	if _, _, err := tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs); err != nil {
 		if err2, ok := err.(pkcs11.Error); ok && err2 == pkcs11.CKR_MECHANISM_INVALID && mech.Mechanism == pkcs11.CKM_RSA_X9_31_KEY_PAIR_GEN {
 			mech.Mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
-			if _, _, err := tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+			_, _, err = tok.ctx.GenerateKeyPair(tok.sh, []*pkcs11.Mechanism{mech}, pubAttrs, privAttrs)
+		}
+		if err != nil {
+			return nil, generateError(tok, keyType, bits, err)
 		}
 	}
-	keyConf.ID = hex.EncodeToString(keyID)
+	keyConf.ID = x509tools.FormatKeyID(keyID)
+	tok.cache.reset()
 	return tok.getKey(keyConf, keyName)
 }
 
@@ -203,3 +214,32 @@ func attrConcat(attrSets ...[]*pkcs11.Attribute) []*pkcs11.Attribute {
 	}
 	return ret
 }
+
+// hasMechanism checks whether the token's slot advertises a mechanism
+func (tok *Token) hasMechanism(mech uint) bool {
+	mechs, err := tok.ctx.GetMechanismList(tok.slot)
+	if err != nil {
+		// can't tell, so let the operation itself fail
+		return true
+	}
+	for _, m := range mechs {
+		if m.Mechanism == mech {
+			return true
+		}
+	}
+	return false
+}
+
+// generateError translates errors that mean the token can't create the
+// requested kind of key
+func generateError(tok *Token, keyType token.KeyType, bits uint, err error) error {
+	if rv, ok := err.(pkcs11.Error); ok {
+		switch rv {
+		case pkcs11.CKR_MECHANISM_INVALID, pkcs11.CKR_MECHANISM_PARAM_INVALID,
+			pkcs11.CKR_ATTRIBUTE_VALUE_INVALID, pkcs11.CKR_TEMPLATE_INCONSISTENT,
+			pkcs11.CKR_KEY_SIZE_RANGE, pkcs11.CKR_CURVE_NOT_SUPPORTED:
+			return token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType, Bits: bits}
+		}
+	}
+	return err
+}
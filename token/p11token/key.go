@@ -19,12 +19,12 @@ package p11token
 import (
 	"context"
 	"crypto"
-	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
 
 	"github.com/miekg/pkcs11"
+	"github.com/rs/zerolog/log"
 
 	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/signers/sigerrors"
@@ -40,6 +40,9 @@ type Key struct {
 	pub             pkcs11.ObjectHandle
 	priv            pkcs11.ObjectHandle
 	pubParsed       crypto.PublicKey
+	alwaysAuth      bool
+	id              []byte
+	label           string
 }
 
 func (token *Token) GetKey(ctx context.Context, keyName string) (token.Key, error) {
@@ -53,13 +56,34 @@ func (token *Token) GetKey(ctx context.Context, keyName string) (token.Key, erro
 }
 
 func (token *Token) getKey(keyConf *config.KeyConfig, keyName string) (*Key, error) {
-	var err error
-	key := &Key{
+	entry := token.cache.getKey(keyConf)
+	if entry == nil {
+		var err error
+		entry, err = token.readKey(keyConf)
+		if err != nil {
+			return nil, err
+		}
+		token.cache.putKey(keyConf, entry)
+	}
+	return &Key{
 		token:           token,
 		keyConf:         keyConf,
 		PgpCertificate:  keyConf.PgpCertificate,
 		X509Certificate: keyConf.X509Certificate,
-	}
+		id:              entry.id,
+		label:           entry.label,
+		keyType:         entry.keyType,
+		pub:             entry.pub,
+		priv:            entry.priv,
+		pubParsed:       entry.pubParsed,
+		alwaysAuth:      entry.alwaysAuth,
+	}, nil
+}
+
+// Find a key in the token and read its public half
+func (token *Token) readKey(keyConf *config.KeyConfig) (*cachedKey, error) {
+	var err error
+	key := &Key{token: token, keyConf: keyConf}
 	key.priv, err = token.findKey(keyConf, pkcs11.CKO_PRIVATE_KEY)
 	if err != nil {
 		return nil, err
@@ -76,18 +100,35 @@ func (token *Token) getKey(keyConf *config.KeyConfig, keyName string) (*Key, err
 	if err != nil {
 		return nil, fmt.Errorf("private key: CKA_KEY_TYPE: %w", err)
 	}
+	if v := token.getAttribute(key.priv, pkcs11.CKA_ALWAYS_AUTHENTICATE); len(v) != 0 && v[0] != 0 {
+		key.alwaysAuth = true
+	}
 	switch key.keyType {
 	case CKK_RSA:
 		key.pubParsed, err = key.toRsaKey()
 	case CKK_ECDSA:
 		key.pubParsed, err = key.toEcdsaKey()
+	case CKK_EC_EDWARDS:
+		key.pubParsed, err = key.toEd25519Key()
+	case CKK_DSA:
+		key.pubParsed, err = key.toDsaKey()
+	case CKK_GOSTR3410:
+		key.pubParsed, err = key.toGostKey()
 	default:
 		return nil, errors.New("Unsupported key type")
 	}
 	if err != nil {
 		return nil, err
 	}
-	return key, nil
+	return &cachedKey{
+		id:         token.getAttribute(key.priv, pkcs11.CKA_ID),
+		label:      string(token.getAttribute(key.priv, pkcs11.CKA_LABEL)),
+		keyType:    key.keyType,
+		pub:        key.pub,
+		priv:       key.priv,
+		pubParsed:  key.pubParsed,
+		alwaysAuth: key.alwaysAuth,
+	}, nil
 }
 
 func (token *Token) findKey(keyConf *config.KeyConfig, class uint) (pkcs11.ObjectHandle, error) {
@@ -128,30 +169,110 @@ func (key *Key) Public() crypto.PublicKey {
 }
 
 func (key *Key) getLabel() string {
-	key.token.mutex.Lock()
-	defer key.token.mutex.Unlock()
-	return string(key.token.getAttribute(key.priv, pkcs11.CKA_LABEL))
+	return key.label
 }
 
 func (key *Key) GetID() []byte {
-	key.token.mutex.Lock()
-	defer key.token.mutex.Unlock()
-	return key.token.getAttribute(key.priv, pkcs11.CKA_ID)
+	return key.id
 }
 
 func (key *Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	key.token.mutex.Lock()
-	defer key.token.mutex.Unlock()
-	switch key.keyType {
-	case CKK_RSA:
-		return key.signRSA(digest, opts)
-	case CKK_ECDSA:
-		return key.signECDSA(digest)
-	default:
-		return nil, errors.New("Unsupported key type")
-	}
+	return key.SignContext(context.Background(), digest, opts)
 }
 
+// SignContext signs a digest, giving up if ctx is done first. The PKCS#11 call
+// can't be interrupted, so on timeout it is abandoned to finish, or not, in
+// the background. Its session stays in use until it does.
 func (key *Key) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	return key.Sign(rand.Reader, digest, opts)
+	if ctx.Done() == nil {
+		// can't be cancelled
+		return key.sign(ctx, digest, opts)
+	}
+	type result struct {
+		sig []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		sig, err := key.sign(ctx, digest, opts)
+		done <- result{sig, err}
+	}()
+	select {
+	case r := <-done:
+		return r.sig, r.err
+	case <-ctx.Done():
+		// keep Close from waiting on the abandoned call or closing its session
+		// out from under it
+		tok := key.token
+		tok.abandoned.Add(1)
+		go func() {
+			<-done
+			tok.abandoned.Add(-1)
+		}()
+		log.Warn().
+			Str("token", key.token.tokenConf.Name()).
+			Str("key", key.keyConf.Name()).
+			AnErr("reason", ctx.Err()).
+			Msg("abandoning PKCS#11 sign that did not complete in time")
+		return nil, fmt.Errorf("token %q: sign: %w", key.token.tokenConf.Name(), ctx.Err())
+	}
+}
+
+func (key *Key) sign(ctx context.Context, digest []byte, opts crypto.SignerOpts) (sig []byte, err error) {
+	err = key.token.withSession(ctx, func(sh pkcs11.SessionHandle) error {
+		switch key.keyType {
+		case CKK_RSA:
+			sig, err = key.signRSA(sh, digest, opts)
+		case CKK_ECDSA:
+			sig, err = key.signECDSA(sh, digest)
+		case CKK_EC_EDWARDS:
+			sig, err = key.signEd25519(sh, digest, opts)
+		case CKK_DSA:
+			sig, err = key.signDSA(sh, digest)
+		case CKK_GOSTR3410:
+			sig, err = key.signGOST(sh, digest)
+		default:
+			err = errors.New("Unsupported key type")
+		}
+		return err
+	})
+	return sig, err
+}
+
+// Start a signing operation. Keys with CKA_ALWAYS_AUTHENTICATE set require a
+// context-specific login after every SignInit, so the PIN is requested anew
+// each time.
+func (key *Key) signInit(sh pkcs11.SessionHandle, mech *pkcs11.Mechanism) error {
+	if err := key.token.ctx.SignInit(sh, []*pkcs11.Mechanism{mech}, key.priv); err != nil {
+		return err
+	}
+	if !key.alwaysAuth {
+		return nil
+	}
+	tok := key.token
+	loginFunc := func(pin string) (bool, error) {
+		err := withTimeout(tok.tokenConf, "login", &tok.abandoned, func() error {
+			return tok.ctx.Login(sh, pkcs11.CKU_CONTEXT_SPECIFIC, pin)
+		})
+		if rv, ok := err.(pkcs11.Error); ok {
+			switch rv {
+			case pkcs11.CKR_PIN_INCORRECT:
+				return false, nil
+			case pkcs11.CKR_PIN_LOCKED:
+				return false, sigerrors.PinLockedError{}
+			}
+		}
+		return err == nil, err
+	}
+	if tok.protectedAuth {
+		if ok, err := loginFunc(""); err != nil {
+			return err
+		} else if !ok {
+			return sigerrors.PinIncorrectError{}
+		}
+		return nil
+	}
+	initialPrompt := fmt.Sprintf("PIN for key %s on token %s: ", key.keyConf.Name(), tok.tokenConf.Name())
+	keyringUser := fmt.Sprintf("%s.%08x", tok.tokenConf.Name(), pkcs11.CKU_CONTEXT_SPECIFIC)
+	return token.Login(tok.tokenConf, tok.pinProvider, loginFunc, keyringUser, initialPrompt)
 }
@@ -0,0 +1,103 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"context"
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func TestSignContextAbandoned(t *testing.T) {
+	cfg := new(config.Config)
+	tok := &Token{config: cfg, tokenConf: cfg.NewToken("hsm")}
+	// an unknown key type fails without calling the provider once the sign
+	// is let go
+	key := &Key{token: tok, keyConf: new(config.KeyConfig), keyType: ^uint(0)}
+	// an earlier abandoned call that never returns holds the only session
+	tok.mutex.Lock()
+	tok.abandoned.Add(1)
+	t.Cleanup(tok.mutex.Unlock)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := key.SignContext(ctx, make([]byte, 32), crypto.SHA256)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assertClosesPromptly(t, tok)
+}
+
+func TestSignQueuedBehindHungCall(t *testing.T) {
+	cfg := new(config.Config)
+	tok := &Token{config: cfg, tokenConf: cfg.NewToken("hsm")}
+	// a sign that is still running holds the only session
+	tok.mutex.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := make(chan struct{}, 1)
+	err := tok.withSession(ctx, func(pkcs11.SessionHandle) error {
+		ran <- struct{}{}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// a queued SignContext stops waiting too, so it isn't left abandoned
+	key := &Key{token: tok, keyConf: new(config.KeyConfig), keyType: ^uint(0)}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel2()
+	_, err = key.SignContext(ctx2, make([]byte, 32), crypto.SHA256)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Eventually(t, func() bool { return tok.abandoned.Load() == 0 }, 5*time.Second, time.Millisecond)
+
+	// once the running sign finishes, the expired one must not run
+	tok.mutex.Unlock()
+	time.Sleep(5 * closePollInterval)
+	select {
+	case <-ran:
+		t.Fatal("sign ran after its caller gave up")
+	default:
+	}
+	assertClosesPromptly(t, tok)
+}
+
+func TestCloseWithAbandonedPoolSession(t *testing.T) {
+	cfg := new(config.Config)
+	tok := &Token{config: cfg, tokenConf: cfg.NewToken("hsm")}
+	tok.pool = newSessionPool(tok, 0, 1)
+	// an abandoned sign holds the only pooled session
+	tok.pool.sem <- struct{}{}
+	tok.abandoned.Add(1)
+	assertClosesPromptly(t, tok)
+}
+
+func assertClosesPromptly(t *testing.T, tok *Token) {
+	t.Helper()
+	closed := make(chan error, 1)
+	go func() { closed <- tok.Close() }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited on the abandoned call")
+	}
+}
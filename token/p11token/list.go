@@ -21,10 +21,11 @@ import (
 	"crypto"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"strings"
 
 	"github.com/miekg/pkcs11"
 
@@ -44,10 +45,50 @@ var classNames = map[uint]string{
 	pkcs11.CKO_OTP_KEY:           "otp_key",
 }
 
+// boolean attributes describing what a key may be used for and how it is
+// protected, in the order they are printed
+type boolAttr struct {
+	name string
+	attr uint
+}
+
+var privateKeyAttrs = []boolAttr{
+	{"sign", pkcs11.CKA_SIGN},
+	{"decrypt", pkcs11.CKA_DECRYPT},
+	{"unwrap", pkcs11.CKA_UNWRAP},
+	{"sensitive", pkcs11.CKA_SENSITIVE},
+	{"extractable", pkcs11.CKA_EXTRACTABLE},
+	{"always_authenticate", pkcs11.CKA_ALWAYS_AUTHENTICATE},
+}
+
+var publicKeyAttrs = []boolAttr{
+	{"verify", pkcs11.CKA_VERIFY},
+	{"encrypt", pkcs11.CKA_ENCRYPT},
+	{"wrap", pkcs11.CKA_WRAP},
+}
+
+// an object as emitted by "token contents --json"
+type listedObject struct {
+	Handle     uint            `json:"handle"`
+	Class      string          `json:"class"`
+	ID         string          `json:"id,omitempty"`
+	Label      string          `json:"label,omitempty"`
+	KeyType    string          `json:"key_type,omitempty"`
+	Bits       uint            `json:"bits,omitempty"`
+	Attributes map[string]bool `json:"attributes,omitempty"`
+	Subject    string          `json:"subject,omitempty"`
+	Issuer     string          `json:"issuer,omitempty"`
+	SHA1       string          `json:"sha1,omitempty"`
+	Size       int             `json:"size,omitempty"`
+}
+
 var keyTypes = map[uint]string{
 	pkcs11.CKK_RSA: "rsa",
 	pkcs11.CKK_DSA: "dsa",
 	pkcs11.CKK_EC:  "ec",
+	CKK_EC_EDWARDS: "ed25519",
+
+	pkcs11.CKK_GOSTR3410: "gostr3410",
 }
 
 func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
@@ -66,6 +107,7 @@ func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
 			err = err2
 		}
 	}()
+	listed := []listedObject{}
 	for {
 		objects, _, err := tok.ctx.FindObjects(tok.sh, 1)
 		if err != nil {
@@ -82,6 +124,10 @@ func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
 			if len(filterKeyId) != 0 && !bytes.Equal(filterKeyId, objId) {
 				continue
 			}
+			if opts.JSON {
+				listed = append(listed, tok.describeObject(handle, objId, label))
+				continue
+			}
 			fmt.Fprintf(opts.Output, "handle 0x%08x:\n", handle)
 			rawClass := tok.getAttribute(handle, pkcs11.CKA_CLASS)
 			class, err := getUlong(rawClass)
@@ -91,7 +137,7 @@ func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
 				fmt.Fprintf(opts.Output, " class:   0x%x\n", rawClass)
 			}
 			if len(objId) > 0 {
-				fmt.Fprintf(opts.Output, " id:      %s\n", formatKeyID(objId))
+				fmt.Fprintf(opts.Output, " id:      %s\n", x509tools.FormatKeyID(objId))
 			}
 			if len(label) > 0 {
 				fmt.Fprintf(opts.Output, " label:   %s\n", label)
@@ -99,8 +145,10 @@ func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
 			switch class {
 			case pkcs11.CKO_PUBLIC_KEY:
 				tok.printKey(opts, handle)
+				tok.printAttributes(opts, handle, publicKeyAttrs)
 			case pkcs11.CKO_PRIVATE_KEY:
 				tok.printKey(opts, handle)
+				tok.printAttributes(opts, handle, privateKeyAttrs)
 			case pkcs11.CKO_CERTIFICATE:
 				tok.printCertificate(opts, handle)
 			case pkcs11.CKO_DATA:
@@ -114,9 +162,177 @@ func (tok *Token) ListKeys(opts token.ListOptions) (err error) {
 			fmt.Fprintln(opts.Output)
 		}
 	}
+	if opts.JSON {
+		enc := json.NewEncoder(opts.Output)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
 	return nil
 }
 
+// collect the same information as the text listing into a structure
+func (tok *Token) describeObject(handle pkcs11.ObjectHandle, objId, label []byte) listedObject {
+	obj := listedObject{
+		Handle: uint(handle),
+		Label:  string(label),
+	}
+	if len(objId) > 0 {
+		obj.ID = x509tools.FormatKeyID(objId)
+	}
+	rawClass := tok.getAttribute(handle, pkcs11.CKA_CLASS)
+	class, err := getUlong(rawClass)
+	if name := classNames[class]; name != "" && err == nil {
+		obj.Class = name
+	} else {
+		obj.Class = fmt.Sprintf("0x%x", rawClass)
+	}
+	switch class {
+	case pkcs11.CKO_PUBLIC_KEY:
+		obj.KeyType, obj.Bits = tok.keyTypeAndBits(handle)
+		obj.Attributes = tok.boolAttributes(handle, publicKeyAttrs)
+	case pkcs11.CKO_PRIVATE_KEY:
+		obj.KeyType, obj.Bits = tok.keyTypeAndBits(handle)
+		obj.Attributes = tok.boolAttributes(handle, privateKeyAttrs)
+	case pkcs11.CKO_CERTIFICATE:
+		blob := tok.getAttribute(handle, pkcs11.CKA_VALUE)
+		if cert, err := x509.ParseCertificate(blob); err == nil {
+			d := crypto.SHA1.New()
+			d.Write(blob)
+			obj.Subject = x509tools.FormatSubject(cert)
+			obj.Issuer = x509tools.FormatIssuer(cert)
+			obj.SHA1 = hex.EncodeToString(d.Sum(nil))
+		}
+	case pkcs11.CKO_DATA:
+		obj.Size = len(tok.getAttribute(handle, pkcs11.CKA_VALUE))
+	}
+	return obj
+}
+
+// read boolean attributes, omitting any the token doesn't report
+func (tok *Token) boolAttributes(handle pkcs11.ObjectHandle, attrs []boolAttr) map[string]bool {
+	values := make(map[string]bool, len(attrs))
+	for _, a := range attrs {
+		if value := tok.getAttribute(handle, a.attr); len(value) != 0 {
+			values[a.name] = value[0] != 0
+		}
+	}
+	return values
+}
+
+func (tok *Token) printAttributes(opts token.ListOptions, handle pkcs11.ObjectHandle, attrs []boolAttr) {
+	values := tok.boolAttributes(handle, attrs)
+	if len(values) == 0 {
+		return
+	}
+	fmt.Fprintln(opts.Output, " attributes:")
+	for _, a := range attrs {
+		if value, ok := values[a.name]; ok {
+			fmt.Fprintf(opts.Output, "  %s: %t\n", a.name, value)
+		}
+	}
+}
+
+// EnumerateKeys returns metadata for each private key in the token. If the
+// token doesn't expose private keys then public keys and certificates are
+// returned instead.
+func (tok *Token) EnumerateKeys() ([]token.KeyInfo, error) {
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
+	infos, err := tok.enumerateClass(pkcs11.CKO_PRIVATE_KEY)
+	if err != nil || len(infos) != 0 {
+		return infos, err
+	}
+	for _, class := range []uint{pkcs11.CKO_PUBLIC_KEY, pkcs11.CKO_CERTIFICATE} {
+		more, err := tok.enumerateClass(class)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, more...)
+	}
+	return infos, nil
+}
+
+func (tok *Token) enumerateClass(class uint) ([]token.KeyInfo, error) {
+	handles, err := tok.findAllObjects([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var infos []token.KeyInfo
+	for _, handle := range handles {
+		info := token.KeyInfo{
+			Label: string(tok.getAttribute(handle, pkcs11.CKA_LABEL)),
+			ID:    tok.getAttribute(handle, pkcs11.CKA_ID),
+		}
+		if class != pkcs11.CKO_PRIVATE_KEY {
+			info.Source = classNames[class]
+		}
+		if class == pkcs11.CKO_CERTIFICATE {
+			cert, err := x509.ParseCertificate(tok.getAttribute(handle, pkcs11.CKA_VALUE))
+			if err != nil {
+				continue
+			}
+			info.SetPublic(cert.PublicKey)
+		} else {
+			info.Type, info.Bits = tok.keyTypeAndBits(handle)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// find all objects matching attrs, without the limit imposed by findObject
+func (tok *Token) findAllObjects(attrs []*pkcs11.Attribute) (handles []pkcs11.ObjectHandle, err error) {
+	if err := tok.ctx.FindObjectsInit(tok.sh, attrs); err != nil {
+		return nil, err
+	}
+	defer func() {
+		err2 := tok.ctx.FindObjectsFinal(tok.sh)
+		if err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+	for {
+		objects, _, err := tok.ctx.FindObjects(tok.sh, 100)
+		if err != nil {
+			return nil, err
+		} else if len(objects) == 0 {
+			break
+		}
+		handles = append(handles, objects...)
+	}
+	return handles, nil
+}
+
+func (tok *Token) keyTypeAndBits(handle pkcs11.ObjectHandle) (string, uint) {
+	keyType, err := getUlong(tok.getAttribute(handle, pkcs11.CKA_KEY_TYPE))
+	if err != nil {
+		return "", 0
+	}
+	name := keyTypes[keyType]
+	if name == "" {
+		name = fmt.Sprintf("0x%x", keyType)
+	}
+	switch keyType {
+	case pkcs11.CKK_RSA:
+		if n := tok.getAttribute(handle, pkcs11.CKA_MODULUS); len(n) != 0 {
+			return name, uint(bytesToBig(n).BitLen())
+		}
+	case pkcs11.CKK_EC:
+		if curve, err := x509tools.CurveByDer(tok.getAttribute(handle, pkcs11.CKA_EC_PARAMS)); err == nil {
+			return name, curve.Bits
+		}
+	case CKK_EC_EDWARDS:
+		return name, 256
+	case pkcs11.CKK_DSA:
+		if p := tok.getAttribute(handle, pkcs11.CKA_PRIME); len(p) != 0 {
+			return name, uint(bytesToBig(p).BitLen())
+		}
+	}
+	return name, 0
+}
+
 func (tok *Token) printKey(opts token.ListOptions, handle pkcs11.ObjectHandle) {
 	rawKeyType := tok.getAttribute(handle, pkcs11.CKA_KEY_TYPE)
 	keyType, err := getUlong(rawKeyType)
@@ -136,6 +352,10 @@ func (tok *Token) printKey(opts token.ListOptions, handle pkcs11.ObjectHandle) {
 		if e := tok.getAttribute(handle, pkcs11.CKA_PUBLIC_EXPONENT); len(e) != 0 && opts.Values {
 			fmt.Fprintf(opts.Output, " e:       %s\n", bytesToBig(e))
 		}
+	case pkcs11.CKK_DSA:
+		if p := tok.getAttribute(handle, pkcs11.CKA_PRIME); len(p) != 0 {
+			fmt.Fprintf(opts.Output, " bits:    %d\n", len(p)*8)
+		}
 	case pkcs11.CKK_EC:
 		ecparams := tok.getAttribute(handle, pkcs11.CKA_EC_PARAMS)
 		if len(ecparams) == 0 {
@@ -178,14 +398,6 @@ func (tok *Token) printCertificate(opts token.ListOptions, handle pkcs11.ObjectH
 	}
 }
 
-func formatKeyID(keyID []byte) string {
-	chunks := make([]string, len(keyID))
-	for i, j := range keyID {
-		chunks[i] = fmt.Sprintf("%02x", j)
-	}
-	return strings.Join(chunks, ":")
-}
-
 func dumpData(w io.Writer, d []byte) {
 	encoded := base64.StdEncoding.EncodeToString(d)
 	for len(encoded) > 0 {
@@ -0,0 +1,119 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+// SetPIN changes the user PIN of a token, or the SO PIN if so is true. After
+// the change it logs in again with the new PIN to confirm that it took effect.
+func SetPIN(tokenConf *config.TokenConfig, so bool, oldPin, newPin string) error {
+	if newPin == "" {
+		return errors.New("new PIN must not be empty")
+	}
+	tok, err := openAdminSession(tokenConf)
+	if err != nil {
+		return err
+	}
+	defer tok.Close()
+	ctx, sh := tok.ctx, tok.sh
+	var user uint = pkcs11.CKU_USER
+	if so {
+		user = pkcs11.CKU_SO
+	} else if tokenConf.User != nil {
+		user = *tokenConf.User
+	}
+	if err := tok.login(user, oldPin); err != nil {
+		return err
+	}
+	err = withTimeout(tokenConf, "set PIN", &tok.abandoned, func() error {
+		return ctx.SetPIN(sh, oldPin, newPin)
+	})
+	if rv, ok := err.(pkcs11.Error); ok && (rv == pkcs11.CKR_PIN_LEN_RANGE || rv == pkcs11.CKR_PIN_INVALID) {
+		return fmt.Errorf("new PIN was rejected by the token: %w", err)
+	} else if err != nil {
+		return err
+	}
+	if err := ctx.Logout(sh); err != nil {
+		return err
+	}
+	if err := tok.login(user, newPin); err != nil {
+		return fmt.Errorf("PIN was changed but logging in with the new PIN failed: %w", err)
+	}
+	return ctx.Logout(sh)
+}
+
+// ResetPIN logs in as the security officer and initializes the user PIN,
+// which also clears a user PIN lockout. It then logs in as the user with the
+// new PIN to confirm that it took effect.
+func ResetPIN(tokenConf *config.TokenConfig, soPin, newPin string) error {
+	if newPin == "" {
+		return errors.New("new PIN must not be empty")
+	}
+	tok, err := openAdminSession(tokenConf)
+	if err != nil {
+		return err
+	}
+	defer tok.Close()
+	ctx, sh := tok.ctx, tok.sh
+	if err := tok.login(pkcs11.CKU_SO, soPin); err != nil {
+		return fmt.Errorf("SO login: %w", err)
+	}
+	err = withTimeout(tokenConf, "init PIN", &tok.abandoned, func() error {
+		return ctx.InitPIN(sh, newPin)
+	})
+	if rv, ok := err.(pkcs11.Error); ok && (rv == pkcs11.CKR_PIN_LEN_RANGE || rv == pkcs11.CKR_PIN_INVALID) {
+		return fmt.Errorf("new PIN was rejected by the token: %w", err)
+	} else if err != nil {
+		return err
+	}
+	if err := ctx.Logout(sh); err != nil {
+		return err
+	}
+	if err := tok.login(pkcs11.CKU_USER, newPin); err != nil {
+		return fmt.Errorf("PIN was reset but logging in with the new PIN failed: %w", err)
+	}
+	return ctx.Logout(sh)
+}
+
+// Open a read-write session on the configured slot without logging in
+func openAdminSession(tokenConf *config.TokenConfig) (*Token, error) {
+	ctx, err := openLib(tokenConf, true)
+	if err != nil {
+		return nil, err
+	}
+	tok := &Token{ctx: ctx, tokenConf: tokenConf}
+	slot, _, err := tok.findSlot()
+	if err != nil {
+		tok.Close()
+		return nil, err
+	}
+	sh, err := tok.openSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		tok.Close()
+		return nil, err
+	}
+	tok.sh = sh
+	tok.slot = slot
+	return tok, nil
+}
@@ -0,0 +1,261 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sassoftware/relic/v8/token"
+)
+
+var (
+	metricSessionsInUse = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_sessions_in_use",
+			Help: "Number of pooled PKCS#11 sessions currently signing",
+		},
+		[]string{"token"},
+	)
+	metricSessionsIdle = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_sessions_idle",
+			Help: "Number of pooled PKCS#11 sessions waiting to be used",
+		},
+		[]string{"token"},
+	)
+	metricSessionWaits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "token_session_waits",
+			Help: "Number of times a signing operation waited for a free PKCS#11 session",
+		},
+		[]string{"token"},
+	)
+)
+
+var errPoolClosed = errors.New("token session pool is closed")
+
+// sessionPool hands out additional sessions on the token's slot so that
+// signing operations can run concurrently. The number of sessions is capped so
+// the HSM's session limit isn't exceeded.
+type sessionPool struct {
+	tok  *Token
+	slot uint
+	sem  chan struct{}
+	done chan struct{}
+	// Close may be called more than once
+	closeOnce sync.Once
+	closed    bool
+
+	mu   sync.Mutex
+	idle []pkcs11.SessionHandle
+
+	inUse prometheus.Gauge
+	nIdle prometheus.Gauge
+	waits prometheus.Counter
+}
+
+func newSessionPool(tok *Token, slot uint, size int) *sessionPool {
+	name := tok.tokenConf.Name()
+	return &sessionPool{
+		tok:   tok,
+		slot:  slot,
+		sem:   make(chan struct{}, size),
+		done:  make(chan struct{}),
+		inUse: metricSessionsInUse.WithLabelValues(name),
+		nIdle: metricSessionsIdle.WithLabelValues(name),
+		waits: metricSessionWaits.WithLabelValues(name),
+	}
+}
+
+// get an idle session or open a new one, waiting if the pool is at capacity
+func (p *sessionPool) get(ctx context.Context) (pkcs11.SessionHandle, error) {
+	select {
+	case p.sem <- struct{}{}:
+	default:
+		p.waits.Inc()
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-p.done:
+			return 0, errPoolClosed
+		}
+	}
+	select {
+	case <-p.done:
+		<-p.sem
+		return 0, errPoolClosed
+	default:
+	}
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		sh := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.nIdle.Set(float64(len(p.idle)))
+		p.mu.Unlock()
+		p.inUse.Inc()
+		return sh, nil
+	}
+	p.mu.Unlock()
+	sh, err := p.open()
+	if err != nil {
+		<-p.sem
+		return 0, err
+	}
+	p.inUse.Inc()
+	return sh, nil
+}
+
+// open a new session, logging in again if the token forgot the login state
+func (p *sessionPool) open() (pkcs11.SessionHandle, error) {
+	sh, err := p.tok.openSession(p.slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return 0, err
+	}
+	info, err := p.tok.ctx.GetSessionInfo(sh)
+	if err == nil && info.State != CKS_RO_USER_FUNCTIONS && info.State != CKS_RW_USER_FUNCTIONS {
+		err = p.tok.autoLogIn(p.tok.pinProvider)
+	}
+	if err != nil {
+		_ = p.tok.ctx.CloseSession(sh)
+		return 0, err
+	}
+	return sh, nil
+}
+
+// put a session back into the pool after use
+func (p *sessionPool) put(sh pkcs11.SessionHandle) {
+	p.mu.Lock()
+	p.idle = append(p.idle, sh)
+	p.nIdle.Set(float64(len(p.idle)))
+	p.mu.Unlock()
+	p.inUse.Dec()
+	<-p.sem
+}
+
+// discard a session that is no longer usable
+func (p *sessionPool) discard(sh pkcs11.SessionHandle) {
+	_ = p.tok.ctx.CloseSession(sh)
+	p.inUse.Dec()
+	<-p.sem
+}
+
+// close waits for in-flight operations to finish and then closes all sessions.
+// If an abandoned call still holds a session it gives up without closing
+// anything and returns false.
+func (p *sessionPool) close() bool {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if !p.drain() {
+			return
+		}
+		p.closed = true
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, sh := range p.idle {
+			_ = p.tok.ctx.CloseSession(sh)
+		}
+		p.idle = nil
+		p.nIdle.Set(0)
+	})
+	return p.closed
+}
+
+// wait for every session to be handed back, unless the token has a call that
+// was abandoned and might never return its session
+func (p *sessionPool) drain() bool {
+	tick := time.NewTicker(closePollInterval)
+	defer tick.Stop()
+	for i := 0; i < cap(p.sem); {
+		if p.tok.abandoned.Load() > 0 {
+			return false
+		}
+		select {
+		case p.sem <- struct{}{}:
+			i++
+		case <-tick.C:
+		}
+	}
+	return true
+}
+
+func (p *sessionPool) stats() token.SessionStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return token.SessionStats{InUse: len(p.sem), Idle: len(p.idle)}
+}
+
+// SessionStats reports how many pooled sessions are signing or idle. Tokens
+// without a pool report no sessions.
+func (tok *Token) SessionStats() token.SessionStats {
+	if tok.pool == nil {
+		return token.SessionStats{}
+	}
+	return tok.pool.stats()
+}
+
+// staleSession returns true if the error means the session can't be used anymore
+func staleSession(err error) bool {
+	rv, ok := err.(pkcs11.Error)
+	if !ok {
+		return false
+	}
+	switch rv {
+	case pkcs11.CKR_SESSION_HANDLE_INVALID, pkcs11.CKR_SESSION_CLOSED, pkcs11.CKR_USER_NOT_LOGGED_IN:
+		return true
+	}
+	return false
+}
+
+// withSession runs f with a session suitable for signing. Without a pool, the
+// token's own session is used and operations are serialized.
+func (tok *Token) withSession(ctx context.Context, f func(pkcs11.SessionHandle) error) error {
+	if tok.pool == nil {
+		if err := tok.lockContext(ctx); err != nil {
+			return err
+		}
+		defer tok.mutex.Unlock()
+		return f(tok.sh)
+	}
+	sh, err := tok.pool.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = f(sh)
+	if staleSession(err) {
+		// replace the session and try once more
+		tok.pool.discard(sh)
+		sh, err = tok.pool.get(ctx)
+		if err != nil {
+			return err
+		}
+		err = f(sh)
+		if staleSession(err) {
+			tok.pool.discard(sh)
+			return err
+		}
+	}
+	tok.pool.put(sh)
+	return err
+}
@@ -0,0 +1,33 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func TestPoolCloseTwice(t *testing.T) {
+	cfg := new(config.Config)
+	tok := &Token{config: cfg, tokenConf: cfg.NewToken("hsm")}
+	tok.pool = newSessionPool(tok, 0, 2)
+	assert.NoError(t, tok.Close())
+	assert.NoError(t, tok.Close())
+}
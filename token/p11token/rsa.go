@@ -81,7 +81,7 @@ func (key *Key) newPssMech(opts *rsa.PSSOptions) (*pkcs11.Mechanism, error) {
 }
 
 // Sign a digest using token RSA private key
-func (key *Key) signRSA(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+func (key *Key) signRSA(sh pkcs11.SessionHandle, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
 	var mech *pkcs11.Mechanism
 	if opts == nil || opts.HashFunc() == 0 {
 		return nil, errors.New("signer options are required")
@@ -99,11 +99,10 @@ func (key *Key) signRSA(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
 		}
 		mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
 	}
-	err := key.token.ctx.SignInit(key.token.sh, []*pkcs11.Mechanism{mech}, key.priv)
-	if err != nil {
+	if err := key.signInit(sh, mech); err != nil {
 		return nil, err
 	}
-	return key.token.ctx.Sign(key.token.sh, digest)
+	return key.token.ctx.Sign(sh, digest)
 }
 
 // Generate RSA-specific public and private key attributes from a PrivateKey
@@ -0,0 +1,55 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func TestSelectSlot(t *testing.T) {
+	infos := []pkcs11.TokenInfo{
+		{Label: "alpha", SerialNumber: "1111"},
+		{Label: "alpha", SerialNumber: "2222    "},
+		{Label: "beta", SerialNumber: "3333"},
+	}
+	for _, tc := range []struct {
+		label, serial string
+		want          int
+		err           string
+	}{
+		{label: "beta", want: 2},
+		{serial: "2222", want: 1},
+		// serial wins over label
+		{label: "beta", serial: "1111", want: 0},
+		{label: "alpha", err: `multiple tokens are labeled "alpha"`},
+		{label: "gamma", err: `no token found with label "gamma"`},
+		{serial: "4444", err: `no token found with serial number "4444"`},
+		{err: "Multiple tokens matched"},
+	} {
+		i, err := selectSlot(&config.TokenConfig{Label: tc.label, Serial: tc.serial}, infos)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err)
+		} else if assert.NoError(t, err) {
+			assert.Equal(t, tc.want, i)
+		}
+	}
+}
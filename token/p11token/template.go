@@ -0,0 +1,140 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// Private key attributes that may be set through the keyattributes setting
+var templateAttrs = map[string]uint{
+	"token":               pkcs11.CKA_TOKEN,
+	"private":             pkcs11.CKA_PRIVATE,
+	"sensitive":           pkcs11.CKA_SENSITIVE,
+	"extractable":         pkcs11.CKA_EXTRACTABLE,
+	"sign":                pkcs11.CKA_SIGN,
+	"decrypt":             pkcs11.CKA_DECRYPT,
+	"unwrap":              pkcs11.CKA_UNWRAP,
+	"modifiable":          pkcs11.CKA_MODIFIABLE,
+	"copyable":            pkcs11.CKA_COPYABLE,
+	"destroyable":         pkcs11.CKA_DESTROYABLE,
+	"always_authenticate": pkcs11.CKA_ALWAYS_AUTHENTICATE,
+	"wrap_with_trusted":   pkcs11.CKA_WRAP_WITH_TRUSTED,
+}
+
+// keyTemplate holds the attributes of a key about to be generated
+type keyTemplate struct {
+	pub, priv []*pkcs11.Attribute
+}
+
+// newKeyTemplate applies configured attribute overrides to the default
+// templates for new keys and checks that the result is a usable signing key.
+// Names are those in templateAttrs, or a vendor-defined attribute number in
+// hex. Values are true or false, an integer, or hex:<bytes> for vendor
+// attributes.
+func newKeyTemplate(overrides map[string]string) (*keyTemplate, error) {
+	tmpl := &keyTemplate{
+		pub:  attrConcat(newPublicKeyAttrs),
+		priv: attrConcat(newPrivateKeyAttrs),
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bools := make(map[uint]bool)
+	for _, name := range names {
+		attr, err := parseTemplateAttr(name, overrides[name])
+		if err != nil {
+			return nil, fmt.Errorf("keyattributes: %w", err)
+		}
+		if len(attr.Value) == 1 {
+			bools[attr.Type] = attr.Value[0] != 0
+		}
+		tmpl.priv = setAttr(tmpl.priv, attr)
+		if attr.Type == pkcs11.CKA_TOKEN {
+			// the public half lives alongside the private one
+			tmpl.pub = setAttr(tmpl.pub, attr)
+		}
+	}
+	isFalse := func(attr uint) bool {
+		value, ok := bools[attr]
+		return ok && !value
+	}
+	switch {
+	case isFalse(pkcs11.CKA_SIGN):
+		return nil, errors.New("keyattributes: sign cannot be false for a signing key")
+	case isFalse(pkcs11.CKA_TOKEN):
+		return nil, errors.New("keyattributes: token cannot be false, the key would be lost when the session closes")
+	case bools[pkcs11.CKA_WRAP_WITH_TRUSTED] && !bools[pkcs11.CKA_EXTRACTABLE]:
+		return nil, errors.New("keyattributes: wrap_with_trusted requires extractable to be true")
+	case bools[pkcs11.CKA_EXTRACTABLE] && isFalse(pkcs11.CKA_SENSITIVE) && isFalse(pkcs11.CKA_PRIVATE):
+		return nil, errors.New("keyattributes: a key that is extractable, not sensitive and not private could be read by anyone with access to the token")
+	}
+	return tmpl, nil
+}
+
+func parseTemplateAttr(name, value string) (*pkcs11.Attribute, error) {
+	attrType, known := templateAttrs[strings.ToLower(name)]
+	if !known {
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(name), "0x"), 16, 32)
+		if err != nil || !strings.HasPrefix(strings.ToLower(name), "0x") {
+			return nil, fmt.Errorf("unknown attribute %q", name)
+		} else if n&pkcs11.CKA_VENDOR_DEFINED == 0 {
+			return nil, fmt.Errorf("attribute %s is not vendor-defined and cannot be set", name)
+		}
+		attrType = uint(n)
+	}
+	switch lower := strings.ToLower(value); {
+	case lower == "true" || lower == "false":
+		return pkcs11.NewAttribute(attrType, lower == "true"), nil
+	case known:
+		return nil, fmt.Errorf("%s: expected true or false, not %q", name, value)
+	case strings.HasPrefix(lower, "hex:"):
+		blob, err := hex.DecodeString(value[4:])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return pkcs11.NewAttribute(attrType, blob), nil
+	default:
+		n, err := strconv.ParseUint(value, 0, ulongSize*8)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected true, false, an integer or hex:<bytes>, not %q", name, value)
+		}
+		blob := make([]byte, ulongSize)
+		putUlong(blob, uint(n))
+		return pkcs11.NewAttribute(attrType, blob), nil
+	}
+}
+
+// setAttr replaces an attribute of the same type, or appends it
+func setAttr(attrs []*pkcs11.Attribute, attr *pkcs11.Attribute) []*pkcs11.Attribute {
+	for i, a := range attrs {
+		if a.Type == attr.Type {
+			attrs[i] = attr
+			return attrs
+		}
+	}
+	return append(attrs, attr)
+}
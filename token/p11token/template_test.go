@@ -0,0 +1,74 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findAttr(attrs []*pkcs11.Attribute, attrType uint) []byte {
+	for _, a := range attrs {
+		if a.Type == attrType {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestKeyTemplate(t *testing.T) {
+	tmpl, err := newKeyTemplate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0}, findAttr(tmpl.priv, pkcs11.CKA_EXTRACTABLE))
+	assert.Len(t, tmpl.priv, len(newPrivateKeyAttrs))
+
+	tmpl, err = newKeyTemplate(map[string]string{
+		"extractable":       "true",
+		"wrap_with_trusted": "true",
+		"Token":             "TRUE",
+		"0x80000001":        "hex:0102",
+		"0x80000002":        "7",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1}, findAttr(tmpl.priv, pkcs11.CKA_EXTRACTABLE))
+	assert.Equal(t, []byte{1}, findAttr(tmpl.priv, pkcs11.CKA_WRAP_WITH_TRUSTED))
+	assert.Equal(t, []byte{1, 2}, findAttr(tmpl.priv, 0x80000001))
+	n, err := getUlong(findAttr(tmpl.priv, 0x80000002))
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), n)
+	assert.Equal(t, []byte{1}, findAttr(tmpl.pub, pkcs11.CKA_TOKEN))
+	assert.Nil(t, findAttr(tmpl.pub, pkcs11.CKA_EXTRACTABLE))
+	// the defaults are not modified
+	assert.Equal(t, []byte{0}, findAttr(newPrivateKeyAttrs, pkcs11.CKA_EXTRACTABLE))
+
+	for want, attrs := range map[string]map[string]string{
+		"sign cannot be false":   {"sign": "false"},
+		"token cannot be false":  {"token": "false"},
+		"requires extractable":   {"wrap_with_trusted": "true"},
+		"could be read":          {"extractable": "true", "sensitive": "false", "private": "false"},
+		"unknown attribute":      {"label": "foo"},
+		"not vendor-defined":     {"0x100": "true"},
+		"expected true or false": {"sensitive": "yes"},
+		"expected true, false":   {"0x80000001": "yes"},
+	} {
+		_, err := newKeyTemplate(attrs)
+		assert.ErrorContains(t, err, want)
+	}
+}
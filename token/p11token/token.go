@@ -21,10 +21,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/pkcs11"
+	"github.com/rs/zerolog/log"
 
 	"github.com/sassoftware/relic/v8/config"
 	"github.com/sassoftware/relic/v8/lib/passprompt"
@@ -43,35 +48,58 @@ const (
 	CKA_LABEL         = pkcs11.CKA_LABEL
 	CKA_SERIAL_NUMBER = pkcs11.CKA_SERIAL_NUMBER
 
-	CKK_RSA   = pkcs11.CKK_RSA
-	CKK_ECDSA = pkcs11.CKK_ECDSA
+	CKK_RSA       = pkcs11.CKK_RSA
+	CKK_ECDSA     = pkcs11.CKK_ECDSA
+	CKK_DSA       = pkcs11.CKK_DSA
+	CKK_GOSTR3410 = pkcs11.CKK_GOSTR3410
 )
 
 func init() {
 	token.Openers["pkcs11"] = open
 	token.Listers["pkcs11"] = List
+	token.PINSetters["pkcs11"] = SetPIN
+	token.PINResetters["pkcs11"] = ResetPIN
 }
 
-var providerMap map[string]*pkcs11.Ctx
+// Loaded PKCS#11 modules are shared by all tokens using the same provider
+// library, so that it is only initialized and finalized once
+var providerMap map[string]*loadedModule
 var providerMutex sync.Mutex
 
+type loadedModule struct {
+	ctx  *pkcs11.Ctx
+	refs int
+	// a call into the module timed out and may still be running, so it is
+	// never finalized
+	abandoned bool
+	// C_Initialize timed out, so the module can't be used or initialized again
+	initTimedOut bool
+}
+
 type Token struct {
-	config    *config.Config
-	tokenConf *config.TokenConfig
-	ctx       *pkcs11.Ctx
-	sh        pkcs11.SessionHandle
-	mutex     sync.Mutex
+	config      *config.Config
+	tokenConf   *config.TokenConfig
+	ctx         *pkcs11.Ctx
+	sh          pkcs11.SessionHandle
+	slot        uint
+	mutex       sync.Mutex
+	pinProvider passprompt.PasswordGetter
+	pool        *sessionPool
+	// log in with a PIN pad or similar instead of a PIN
+	protectedAuth bool
+	slotInfo      token.SlotInfo
+	cache         keyCache
+	// calls into the provider that timed out but haven't returned yet
+	abandoned atomic.Int32
+	closed    atomic.Bool
 }
 
 func List(provider string, output io.Writer) error {
-	ctx := pkcs11.New(provider)
-	if ctx == nil {
-		return errors.New("Failed to initialize pkcs11 provider")
-	}
-	defer ctx.Destroy()
-	if err := ctx.Initialize(); err != nil {
+	ctx, err := openLib(&config.TokenConfig{Provider: provider}, false)
+	if err != nil {
 		return err
 	}
+	defer closeLib(provider)
 	slots, err := ctx.GetSlotList(false)
 	if err != nil {
 		return err
@@ -97,28 +125,51 @@ func Open(config *config.Config, tokenName string, pinProvider passprompt.Passwo
 		return nil, err
 	}
 	tok := &Token{
-		ctx:       ctx,
-		config:    config,
-		tokenConf: tokenConf,
+		ctx:         ctx,
+		config:      config,
+		tokenConf:   tokenConf,
+		pinProvider: pinProvider,
 	}
 	runtime.SetFinalizer(tok, (*Token).Close)
-	slot, err := tok.findSlot()
+	slot, info, err := tok.findSlot()
 	if err != nil {
 		tok.Close()
 		return nil, err
 	}
 	mode := uint(pkcs11.CKF_SERIAL_SESSION | pkcs11.CKF_RW_SESSION)
-	sh, err := tok.ctx.OpenSession(slot, mode)
+	sh, err := tok.openSession(slot, mode)
 	if err != nil {
 		tok.Close()
 		return nil, err
 	}
 	tok.sh = sh
+	tok.slot = slot
+	tok.slotInfo = token.SlotInfo{
+		ID:           slot,
+		Label:        info.Label,
+		Serial:       info.SerialNumber,
+		Manufacturer: info.ManufacturerID,
+		Model:        info.Model,
+	}
+	tok.protectedAuth, err = tok.checkProtectedAuth()
+	if err != nil {
+		tok.Close()
+		return nil, err
+	}
 	err = tok.autoLogIn(pinProvider)
 	if err != nil {
 		tok.Close()
 		return nil, err
 	}
+	log.Info().
+		Str("token", tokenConf.Name()).
+		Uint("slot", slot).
+		Str("serial", info.SerialNumber).
+		Str("label", info.Label).
+		Msg("opened PKCS#11 token")
+	if tokenConf.Sessions > 1 {
+		tok.pool = newSessionPool(tok, slot, tokenConf.Sessions)
+	}
 	return tok, nil
 }
 
@@ -134,70 +185,234 @@ func openLib(tokenConf *config.TokenConfig, write bool) (*pkcs11.Ctx, error) {
 	providerMutex.Lock()
 	defer providerMutex.Unlock()
 	if providerMap == nil {
-		providerMap = make(map[string]*pkcs11.Ctx)
+		providerMap = make(map[string]*loadedModule)
 	}
-	ctx, ok := providerMap[tokenConf.Provider]
-	if ok {
-		return ctx, nil
+	if p, ok := providerMap[tokenConf.Provider]; ok {
+		if p.initTimedOut {
+			return nil, fmt.Errorf("token %q: an earlier initialization of %s timed out and may still be running: %w", tokenConf.Name(), tokenConf.Provider, context.DeadlineExceeded)
+		}
+		p.refs++
+		return p.ctx, nil
 	}
-	ctx = pkcs11.New(tokenConf.Provider)
+	ctx := pkcs11.New(tokenConf.Provider)
 	if ctx == nil {
 		return nil, errors.New("Failed to initialize pkcs11 provider")
 	}
-	err := ctx.Initialize()
-	if err != nil {
+	err := withTimeout(tokenConf, "initialize", nil, ctx.Initialize)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// still running, so it can't be destroyed, and calling C_Initialize
+		// again on a module that's stuck in it won't help
+		providerMap[tokenConf.Provider] = &loadedModule{ctx: ctx, initTimedOut: true}
+		return nil, err
+	} else if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED {
+		// something else in the process initialized it, which is fine
+	} else if err != nil {
 		ctx.Destroy()
 		return nil, err
 	}
-	providerMap[tokenConf.Provider] = ctx
+	providerMap[tokenConf.Provider] = &loadedModule{ctx: ctx, refs: 1}
 	return ctx, nil
 }
 
-// Close the token session
+// Release a reference to a provider library, finalizing it when the last
+// token using it is closed
+func closeLib(path string) error {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	p, ok := providerMap[path]
+	if !ok {
+		return nil
+	}
+	p.refs--
+	if p.refs > 0 || p.abandoned {
+		return nil
+	}
+	delete(providerMap, path)
+	err := p.ctx.Finalize()
+	p.ctx.Destroy()
+	return err
+}
+
+// Mark a provider library as having a call into it that may still be
+// running, so it is kept loaded instead of being finalized on last close
+func abandonLib(path string) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	if p, ok := providerMap[path]; ok {
+		p.abandoned = true
+	}
+}
+
+// how often Close checks whether it is waiting on an abandoned call
+const closePollInterval = 10 * time.Millisecond
+
+// Close the token session. If a call into the provider timed out and is still
+// running, Close doesn't wait for it and the sessions and module are left open
+// rather than pulled out from under it.
 func (tok *Token) Close() error {
-	tok.mutex.Lock()
+	if tok.closed.Swap(true) {
+		return nil
+	}
+	tok.cache.reset()
+	if tok.pool != nil && !tok.pool.close() {
+		tok.leak()
+		return nil
+	}
+	if !tok.lockUnlessAbandoned() {
+		tok.leak()
+		return nil
+	}
 	defer tok.mutex.Unlock()
+	if tok.abandoned.Load() > 0 {
+		tok.leak()
+		return nil
+	}
 	var err error
 	if tok.ctx != nil {
-		err = tok.ctx.CloseSession(tok.sh)
+		if tok.sh != 0 {
+			err = tok.ctx.CloseSession(tok.sh)
+		}
 		tok.ctx = nil
 		runtime.SetFinalizer(tok, nil)
+		if err2 := closeLib(tok.tokenConf.Provider); err == nil {
+			err = err2
+		}
 	}
 	return err
 }
 
+// Lock the token, unless it is held by an abandoned call that may never
+// release it
+func (tok *Token) lockUnlessAbandoned() bool {
+	for !tok.mutex.TryLock() {
+		if tok.abandoned.Load() > 0 {
+			return false
+		}
+		time.Sleep(closePollInterval)
+	}
+	return true
+}
+
+// Lock the token for an operation, giving up if ctx is done first so that a
+// call whose caller already gave up doesn't run once the token is free
+func (tok *Token) lockContext(ctx context.Context) error {
+	if ctx.Done() == nil {
+		tok.mutex.Lock()
+		return nil
+	}
+	tick := time.NewTicker(closePollInterval)
+	defer tick.Stop()
+	for !tok.mutex.TryLock() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		tok.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Give up on closing a token that an abandoned call is still using. Its
+// sessions stay open and the module stays loaded.
+func (tok *Token) leak() {
+	runtime.SetFinalizer(tok, nil)
+	log.Warn().
+		Str("token", tok.tokenConf.Name()).
+		Msg("leaving PKCS#11 token open because an abandoned call is still running")
+	if tok.ctx != nil {
+		abandonLib(tok.tokenConf.Provider)
+		_ = closeLib(tok.tokenConf.Provider)
+	}
+}
+
 func (tok *Token) Config() *config.TokenConfig {
 	return tok.tokenConf
 }
 
-func (tok *Token) findSlot() (uint, error) {
-	tokenConf := tok.tokenConf
-	slots, err := tok.ctx.GetSlotList(false)
+// SlotInfo returns the slot and token that the configuration selected
+func (tok *Token) SlotInfo() token.SlotInfo {
+	return tok.slotInfo
+}
+
+func (tok *Token) findSlot() (uint, pkcs11.TokenInfo, error) {
+	var present []uint
+	var infos []pkcs11.TokenInfo
+	err := withTimeout(tok.tokenConf, "list slots", &tok.abandoned, func() error {
+		slots, err := tok.ctx.GetSlotList(false)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			info, err := tok.ctx.GetTokenInfo(slot)
+			if err != nil {
+				if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_TOKEN_NOT_PRESENT {
+					continue
+				}
+				return err
+			}
+			present = append(present, slot)
+			infos = append(infos, info)
+		}
+		return nil
+	})
 	if err != nil {
-		return 0, nil
+		return 0, pkcs11.TokenInfo{}, err
 	}
-	candidates := make([]uint, 0, len(slots))
-	for _, slot := range slots {
-		info, err := tok.ctx.GetTokenInfo(slot)
-		if err != nil {
-			if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_TOKEN_NOT_PRESENT {
-				continue
+	i, err := selectSlot(tok.tokenConf, infos)
+	if err != nil {
+		return 0, pkcs11.TokenInfo{}, err
+	}
+	return present[i], infos[i], nil
+}
+
+// selectSlot picks the token matching the configured serial number, or
+// failing that the label. The serial is unique where labels may not be, so
+// when both are set only the serial is used to choose.
+func selectSlot(tokenConf *config.TokenConfig, infos []pkcs11.TokenInfo) (int, error) {
+	var matched []int
+	if serial := strings.TrimSpace(tokenConf.Serial); serial != "" {
+		for i, info := range infos {
+			if strings.TrimSpace(info.SerialNumber) == serial {
+				matched = append(matched, i)
 			}
-			return 0, err
 		}
-		if tokenConf.Label != "" && tokenConf.Label != info.Label {
-			continue
-		} else if tokenConf.Serial != "" && tokenConf.Serial != info.SerialNumber {
-			continue
+		switch len(matched) {
+		case 0:
+			return 0, fmt.Errorf("no token found with serial number %q", serial)
+		case 1:
+			info := infos[matched[0]]
+			if tokenConf.Label != "" && tokenConf.Label != info.Label {
+				log.Warn().
+					Str("token", tokenConf.Name()).
+					Str("serial", serial).
+					Str("label", info.Label).
+					Msgf("token with the configured serial number is not labeled %q", tokenConf.Label)
+			}
+			return matched[0], nil
+		default:
+			return 0, fmt.Errorf("multiple tokens have serial number %q", serial)
 		}
-		candidates = append(candidates, slot)
 	}
-	if len(candidates) == 0 {
+	for i, info := range infos {
+		if tokenConf.Label == "" || tokenConf.Label == info.Label {
+			matched = append(matched, i)
+		}
+	}
+	switch {
+	case len(matched) == 1:
+		return matched[0], nil
+	case len(matched) == 0 && tokenConf.Label != "":
+		return 0, fmt.Errorf("no token found with label %q", tokenConf.Label)
+	case len(matched) == 0:
 		return 0, errors.New("No token found with the specified attributes")
-	} else if len(candidates) != 1 {
-		return 0, errors.New("Multiple tokens matched the specified attributes")
-	} else {
-		return candidates[0], nil
+	case tokenConf.Label != "":
+		return 0, fmt.Errorf("multiple tokens are labeled %q, set serial to choose one", tokenConf.Label)
+	default:
+		return 0, errors.New("Multiple tokens matched the specified attributes, set label or serial to choose one")
 	}
 }
 
@@ -205,6 +420,10 @@ func (tok *Token) findSlot() (uint, error) {
 func (tok *Token) isLoggedIn() (bool, error) {
 	tok.mutex.Lock()
 	defer tok.mutex.Unlock()
+	return tok.isLoggedInLocked()
+}
+
+func (tok *Token) isLoggedInLocked() (bool, error) {
 	info, err := tok.ctx.GetSessionInfo(tok.sh)
 	if err != nil {
 		return false, err
@@ -225,18 +444,34 @@ func (tok *Token) Ping(ctx context.Context) error {
 func (tok *Token) login(user uint, pin string) error {
 	tok.mutex.Lock()
 	defer tok.mutex.Unlock()
-	err := tok.ctx.Login(tok.sh, user, pin)
+	return tok.loginLocked(user, pin)
+}
+
+func (tok *Token) loginLocked(user uint, pin string) error {
+	err := withTimeout(tok.tokenConf, "login", &tok.abandoned, func() error {
+		return tok.ctx.Login(tok.sh, user, pin)
+	})
 	if err != nil {
-		if rv, ok := err.(pkcs11.Error); ok && rv == pkcs11.CKR_PIN_INCORRECT {
-			return sigerrors.PinIncorrectError{}
+		if rv, ok := err.(pkcs11.Error); ok {
+			switch rv {
+			case pkcs11.CKR_PIN_INCORRECT:
+				return sigerrors.PinIncorrectError{}
+			case pkcs11.CKR_PIN_LOCKED:
+				return sigerrors.PinLockedError{}
+			}
 		}
 	}
 	return err
 }
 
+// Log in if the token isn't already. Pooled sessions can find the login gone
+// at the same time, so the whole check and prompt happens under the token lock
+// to avoid logging in, or asking for the PIN, more than once.
 func (tok *Token) autoLogIn(pinProvider passprompt.PasswordGetter) error {
+	tok.mutex.Lock()
+	defer tok.mutex.Unlock()
 	tokenConf := tok.tokenConf
-	loggedIn, err := tok.isLoggedIn()
+	loggedIn, err := tok.isLoggedInLocked()
 	if err != nil {
 		return err
 	}
@@ -248,7 +483,7 @@ func (tok *Token) autoLogIn(pinProvider passprompt.PasswordGetter) error {
 		user = *tokenConf.User
 	}
 	loginFunc := func(pin string) (bool, error) {
-		if err := tok.login(user, pin); err == nil {
+		if err := tok.loginLocked(user, pin); err == nil {
 			return true, nil
 		} else if _, ok := err.(sigerrors.PinIncorrectError); ok {
 			return false, nil
@@ -256,11 +491,89 @@ func (tok *Token) autoLogIn(pinProvider passprompt.PasswordGetter) error {
 			return false, err
 		}
 	}
+	if tok.protectedAuth {
+		fmt.Fprintf(os.Stderr, "Log in to token %s using its PIN pad or reader\n", tokenConf.Name())
+		if ok, err := loginFunc(""); err != nil {
+			return err
+		} else if !ok {
+			return sigerrors.PinIncorrectError{}
+		}
+		return nil
+	}
 	initialPrompt := fmt.Sprintf("PIN for token %s user %08x: ", tokenConf.Name(), user)
 	keyringUser := fmt.Sprintf("%s.%08x", tokenConf.Name(), user)
 	return token.Login(tokenConf, pinProvider, loginFunc, keyringUser, initialPrompt)
 }
 
+// PinProtected is the PIN setting that selects the token's protected
+// authentication path, such as a PIN pad or biometric reader
+const PinProtected = "protected"
+
+// If the configuration asks for the protected authentication path, check that
+// the token has one
+func (tok *Token) checkProtectedAuth() (bool, error) {
+	if tok.tokenConf.Pin == nil || *tok.tokenConf.Pin != PinProtected {
+		return false, nil
+	}
+	var info pkcs11.TokenInfo
+	err := withTimeout(tok.tokenConf, "get token info", &tok.abandoned, func() (err error) {
+		info, err = tok.ctx.GetTokenInfo(tok.slot)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if info.Flags&pkcs11.CKF_PROTECTED_AUTHENTICATION_PATH == 0 {
+		return false, fmt.Errorf("token %s does not have a protected authentication path", tok.tokenConf.Name())
+	}
+	return true, nil
+}
+
+// Open a session, giving up if the token doesn't respond within OpenTimeout
+func (tok *Token) openSession(slot, mode uint) (pkcs11.SessionHandle, error) {
+	var sh pkcs11.SessionHandle
+	err := withTimeout(tok.tokenConf, "open session", &tok.abandoned, func() (err error) {
+		sh, err = tok.ctx.OpenSession(slot, mode)
+		return err
+	})
+	return sh, err
+}
+
+// Run a blocking PKCS#11 call, giving up if it doesn't complete within the
+// token's OpenTimeout. Calls into the provider can't be cancelled, so on
+// timeout the call is abandoned and left running in the background. If
+// abandoned is not nil, it counts the call until it finally returns.
+func withTimeout(tokenConf *config.TokenConfig, op string, abandoned *atomic.Int32, f func() error) error {
+	if tokenConf.OpenTimeout <= 0 {
+		return f()
+	}
+	timeout := time.Duration(tokenConf.OpenTimeout) * time.Second
+	errch := make(chan error, 1)
+	go func() {
+		errch <- f()
+	}()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-errch:
+		return err
+	case <-t.C:
+		if abandoned != nil {
+			abandoned.Add(1)
+			go func() {
+				<-errch
+				abandoned.Add(-1)
+			}()
+		}
+		log.Warn().
+			Str("token", tokenConf.Name()).
+			Str("op", op).
+			Dur("timeout", timeout).
+			Msg("abandoning PKCS#11 call that did not complete in time")
+		return fmt.Errorf("token %q: %s did not complete within %s: %w", tokenConf.Name(), op, timeout, context.DeadlineExceeded)
+	}
+}
+
 func (tok *Token) getAttribute(handle pkcs11.ObjectHandle, attr uint) []byte {
 	attrs, err := tok.ctx.GetAttributeValue(tok.sh, handle, []*pkcs11.Attribute{pkcs11.NewAttribute(attr, nil)})
 	if err != nil {
@@ -0,0 +1,59 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package p11token
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+func TestWithTimeoutAbandoned(t *testing.T) {
+	tokenConf := &config.TokenConfig{OpenTimeout: 1}
+	release := make(chan struct{})
+	var abandoned atomic.Int32
+	err := withTimeout(tokenConf, "login", &abandoned, func() error {
+		<-release
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualValues(t, 1, abandoned.Load())
+	close(release)
+	assert.Eventually(t, func() bool { return abandoned.Load() == 0 }, 5*time.Second, time.Millisecond)
+}
+
+func TestOpenLibAfterInitTimeout(t *testing.T) {
+	const provider = "/nonexistent/hung-module.so"
+	providerMutex.Lock()
+	if providerMap == nil {
+		providerMap = make(map[string]*loadedModule)
+	}
+	providerMap[provider] = &loadedModule{initTimedOut: true}
+	providerMutex.Unlock()
+	t.Cleanup(func() {
+		providerMutex.Lock()
+		delete(providerMap, provider)
+		providerMutex.Unlock()
+	})
+	_, err := openLib(&config.TokenConfig{Provider: provider}, false)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -26,9 +26,16 @@ import (
 type (
 	OpenFunc func(cfg *config.Config, tokenName string, prompt passprompt.PasswordGetter) (Token, error)
 	ListFunc func(provider string, dest io.Writer) error
+	// SetPINFunc changes the user PIN, or the security officer PIN if so is true
+	SetPINFunc func(tokenConf *config.TokenConfig, so bool, oldPin, newPin string) error
+	// ResetPINFunc logs in as the security officer and replaces the user PIN,
+	// clearing any lockout
+	ResetPINFunc func(tokenConf *config.TokenConfig, soPin, newPin string) error
 )
 
 var (
-	Openers = make(map[string]OpenFunc)
-	Listers = make(map[string]ListFunc)
+	Openers      = make(map[string]OpenFunc)
+	Listers      = make(map[string]ListFunc)
+	PINSetters   = make(map[string]SetPINFunc)
+	PINResetters = make(map[string]ResetPINFunc)
 )
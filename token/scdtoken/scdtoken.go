@@ -209,6 +209,20 @@ func (tok *scdToken) ListKeys(opts token.ListOptions) error {
 	return nil
 }
 
+func (tok *scdToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	infos := make([]token.KeyInfo, 0, len(tok.keyInfos))
+	for _, key := range tok.keyInfos {
+		info := token.KeyInfo{ID: []byte(key.KeyId)}
+		if pub, err := key.Public(); err == nil {
+			info.SetPublic(pub)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 func (tok *scdToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
 	tok.mu.Lock()
 	defer tok.mu.Unlock()
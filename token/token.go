@@ -19,6 +19,9 @@ package token
 import (
 	"context"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/x509"
 	"fmt"
 	"io"
@@ -30,10 +33,24 @@ type KeyType uint
 
 const (
 	// Values match CKK_RSA etc.
-	KeyTypeRsa   KeyType = 0
-	KeyTypeEcdsa KeyType = 3
+	KeyTypeRsa     KeyType = 0
+	KeyTypeEcdsa   KeyType = 3
+	KeyTypeEd25519 KeyType = 0x40
 )
 
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeRsa:
+		return "RSA"
+	case KeyTypeEcdsa:
+		return "ECDSA"
+	case KeyTypeEd25519:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("KeyType(%d)", uint(t))
+	}
+}
+
 type Token interface {
 	io.Closer
 	// Check that the token is still alive
@@ -51,6 +68,8 @@ type Token interface {
 	Generate(keyName string, keyType KeyType, bits uint) (Key, error)
 	// Print key info
 	ListKeys(opts ListOptions) error
+	// Return metadata for each key in the token
+	EnumerateKeys() ([]KeyInfo, error)
 }
 
 type Key interface {
@@ -66,6 +85,45 @@ type Key interface {
 	ImportCertificate(cert *x509.Certificate) error
 }
 
+// SessionCounter is implemented by tokens that keep a pool of sessions for
+// concurrent signing
+type SessionCounter interface {
+	SessionStats() SessionStats
+}
+
+// ChainReader is implemented by keys that can read back the certificate chain
+// stored alongside them in the token
+type ChainReader interface {
+	// Return the leaf certificate followed by any issuers found in the token
+	CertificateChain() ([]*x509.Certificate, error)
+}
+
+// Exporter is implemented by keys that can read their private half out of the
+// token, if the token's policy allows it
+type Exporter interface {
+	// Return the private key, or KeyNotExtractableError
+	Export() (crypto.PrivateKey, error)
+}
+
+// SlotDescriber is implemented by tokens that select one of several slots or
+// devices, to report which one was actually opened
+type SlotDescriber interface {
+	SlotInfo() SlotInfo
+}
+
+type SlotInfo struct {
+	ID           uint
+	Label        string
+	Serial       string
+	Manufacturer string
+	Model        string
+}
+
+type SessionStats struct {
+	InUse int
+	Idle  int
+}
+
 type ListOptions struct {
 	// Destination stream
 	Output io.Writer
@@ -74,6 +132,34 @@ type ListOptions struct {
 	ID    string
 	// Print key and certificate contents
 	Values bool
+	// Emit a JSON array of objects instead of text (pkcs11 only)
+	JSON bool
+}
+
+// Metadata about a key found by enumerating a token
+type KeyInfo struct {
+	Label string
+	ID    []byte
+	// Key algorithm: rsa, ec, etc.
+	Type string
+	Bits uint
+	// Type of object the metadata came from, if not the private key
+	Source string
+}
+
+// SetPublic fills in the key type and size from a public key
+func (i *KeyInfo) SetPublic(pub crypto.PublicKey) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		i.Type = "rsa"
+		i.Bits = uint(k.N.BitLen())
+	case *ecdsa.PublicKey:
+		i.Type = "ec"
+		i.Bits = uint(k.Curve.Params().BitSize)
+	case ed25519.PublicKey:
+		i.Type = "ed25519"
+		i.Bits = 256
+	}
 }
 
 type NotImplementedError struct {
@@ -84,6 +170,31 @@ func (e NotImplementedError) Error() string {
 	return fmt.Sprintf("operation %s not implemented for tokens of type %s", e.Op, e.Type)
 }
 
+// UnsupportedKeyTypeError is returned when a token is not capable of
+// generating the requested type or size of key
+type UnsupportedKeyTypeError struct {
+	Token   string
+	KeyType KeyType
+	Bits    uint
+}
+
+func (e UnsupportedKeyTypeError) Error() string {
+	if e.Bits != 0 {
+		return fmt.Sprintf("token %q does not support generating %d-bit %s keys", e.Token, e.Bits, e.KeyType)
+	}
+	return fmt.Sprintf("token %q does not support generating %s keys", e.Token, e.KeyType)
+}
+
+// KeyNotExtractableError is returned when a key's private half can't be
+// copied out of its token
+type KeyNotExtractableError struct {
+	Key, Token string
+}
+
+func (e KeyNotExtractableError) Error() string {
+	return fmt.Sprintf("cannot export key %q: it is not extractable from token %q", e.Key, e.Token)
+}
+
 type KeyUsageError struct {
 	Key string
 	Err error
@@ -0,0 +1,167 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tpmtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/google/go-tpm/tpm2"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+type tpmKey struct {
+	token   *tpmToken
+	keyConf *config.KeyConfig
+	handle  tpm2.NamedHandle
+	pub     crypto.PublicKey
+}
+
+func (tok *tpmToken) newKey(keyConf *config.KeyConfig, handle tpm2.NamedHandle, pub crypto.PublicKey) *tpmKey {
+	return &tpmKey{
+		token:   tok,
+		keyConf: keyConf,
+		handle:  handle,
+		pub:     pub,
+	}
+}
+
+func (key *tpmKey) Public() crypto.PublicKey {
+	return key.pub
+}
+
+func (key *tpmKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashAlg, err := hashAlgorithm(opts.HashFunc())
+	if err != nil {
+		return nil, err
+	}
+	var scheme tpm2.TPMTSigScheme
+	switch key.pub.(type) {
+	case *rsa.PublicKey:
+		scheme.Scheme = tpm2.TPMAlgRSASSA
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			scheme.Scheme = tpm2.TPMAlgRSAPSS
+		}
+	case *ecdsa.PublicKey:
+		scheme.Scheme = tpm2.TPMAlgECDSA
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+	scheme.Details = tpm2.NewTPMUSigScheme(scheme.Scheme, &tpm2.TPMSSchemeHash{HashAlg: hashAlg})
+	key.token.mu.Lock()
+	defer key.token.mu.Unlock()
+	if key.token.tpm == nil {
+		return nil, errors.New("token is closed")
+	}
+	rsp, err := tpm2.Sign{
+		KeyHandle: tpm2.AuthHandle{
+			Handle: key.handle.Handle,
+			Name:   key.handle.Name,
+			Auth:   tpm2.PasswordAuth(key.token.auth),
+		},
+		Digest:   tpm2.TPM2BDigest{Buffer: digest},
+		InScheme: scheme,
+		Validation: tpm2.TPMTTKHashCheck{
+			Tag:       tpm2.TPMSTHashCheck,
+			Hierarchy: tpm2.TPMRHNull,
+		},
+	}.Execute(key.token.tpm)
+	if errors.Is(err, tpm2.TPMRCAuthFail) || errors.Is(err, tpm2.TPMRCBadAuth) {
+		return nil, sigerrors.PinIncorrectError{}
+	} else if errors.Is(err, tpm2.TPMRCLockout) {
+		return nil, sigerrors.PinLockedError{}
+	} else if err != nil {
+		return nil, err
+	}
+	return unpackSignature(rsp.Signature)
+}
+
+// Convert a TPM signature into the format returned by crypto.Signer
+func unpackSignature(sig tpm2.TPMTSignature) ([]byte, error) {
+	switch sig.SigAlg {
+	case tpm2.TPMAlgRSASSA:
+		rsig, err := sig.Signature.RSASSA()
+		if err != nil {
+			return nil, err
+		}
+		return rsig.Sig.Buffer, nil
+	case tpm2.TPMAlgRSAPSS:
+		rsig, err := sig.Signature.RSAPSS()
+		if err != nil {
+			return nil, err
+		}
+		return rsig.Sig.Buffer, nil
+	case tpm2.TPMAlgECDSA:
+		esig, err := sig.Signature.ECDSA()
+		if err != nil {
+			return nil, err
+		}
+		return x509tools.EcdsaSignature{
+			R: new(big.Int).SetBytes(esig.SignatureR.Buffer),
+			S: new(big.Int).SetBytes(esig.SignatureS.Buffer),
+		}.Marshal(), nil
+	default:
+		return nil, fmt.Errorf("unexpected signature algorithm %v", sig.SigAlg)
+	}
+}
+
+func hashAlgorithm(hash crypto.Hash) (tpm2.TPMIAlgHash, error) {
+	switch hash {
+	case crypto.SHA1:
+		return tpm2.TPMAlgSHA1, nil
+	case crypto.SHA256:
+		return tpm2.TPMAlgSHA256, nil
+	case crypto.SHA384:
+		return tpm2.TPMAlgSHA384, nil
+	case crypto.SHA512:
+		return tpm2.TPMAlgSHA512, nil
+	default:
+		return 0, fmt.Errorf("digest %s is not supported by TPM keys", x509tools.HashNames[hash])
+	}
+}
+
+func (key *tpmKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return key.Sign(rand.Reader, digest, opts)
+}
+
+func (key *tpmKey) Config() *config.KeyConfig {
+	return key.keyConf
+}
+
+func (key *tpmKey) Certificate() []byte {
+	return nil
+}
+
+func (key *tpmKey) GetID() []byte {
+	return key.handle.Name.Buffer
+}
+
+func (key *tpmKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
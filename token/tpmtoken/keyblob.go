@@ -0,0 +1,78 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tpmtoken
+
+import (
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+// Key blobs use the PEM "TSS2 PRIVATE KEY" format, which holds the public and
+// wrapped private parts of a key along with the hierarchy of the primary key it
+// was created under
+const keyBlobType = "TSS2 PRIVATE KEY"
+
+var oidLoadableKey = asn1.ObjectIdentifier{2, 23, 133, 10, 1, 3}
+
+type tssKey struct {
+	Type      asn1.ObjectIdentifier
+	EmptyAuth bool `asn1:"optional,explicit,tag:0"`
+	Parent    int64
+	Public    []byte
+	Private   []byte
+}
+
+func marshalKeyBlob(parent tpm2.TPMHandle, public tpm2.TPM2BPublic, private tpm2.TPM2BPrivate, emptyAuth bool) ([]byte, error) {
+	der, err := asn1.Marshal(tssKey{
+		Type:      oidLoadableKey,
+		EmptyAuth: emptyAuth,
+		Parent:    int64(parent),
+		Public:    tpm2.Marshal(public),
+		Private:   tpm2.Marshal(private),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: keyBlobType, Bytes: der}), nil
+}
+
+func parseKeyBlob(blob []byte) (tpm2.TPMHandle, tpm2.TPM2BPublic, tpm2.TPM2BPrivate, error) {
+	var public tpm2.TPM2BPublic
+	var private tpm2.TPM2BPrivate
+	block, _ := pem.Decode(blob)
+	if block == nil || block.Type != keyBlobType {
+		return 0, public, private, errors.New("not a TPM key blob")
+	}
+	var key tssKey
+	if rest, err := asn1.Unmarshal(block.Bytes, &key); err != nil {
+		return 0, public, private, err
+	} else if len(rest) != 0 || !key.Type.Equal(oidLoadableKey) {
+		return 0, public, private, errors.New("not a TPM key blob")
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPM2BPublic](key.Public)
+	if err != nil {
+		return 0, public, private, err
+	}
+	priv, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](key.Private)
+	if err != nil {
+		return 0, public, private, err
+	}
+	return tpm2.TPMHandle(key.Parent), *pub, *priv, nil
+}
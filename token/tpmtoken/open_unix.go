@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tpmtoken
+
+import "github.com/google/go-tpm/tpm2/transport"
+
+// Open a TPM character device or the Unix socket of a software TPM, or
+// /dev/tpmrm0 by default
+func openTPM(path string) (transport.TPMCloser, error) {
+	if path == "" {
+		return transport.OpenTPM()
+	}
+	return transport.OpenTPM(path)
+}
@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package tpmtoken
+
+import (
+	"errors"
+
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Open the TPM through the TPM Base Services, which is the only way to reach it
+// on Windows
+func openTPM(path string) (transport.TPMCloser, error) {
+	if path != "" {
+		return nil, errors.New("a TPM provider path is not supported on Windows")
+	}
+	return transport.OpenTPM()
+}
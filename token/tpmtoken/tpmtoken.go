@@ -0,0 +1,498 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package tpmtoken signs using keys held by a TPM 2.0 chip. Keys are either
+// persisted in the TPM at a handle given by the key's id, or stored as a
+// wrapped blob in the key's keyfile and loaded under a primary key derived from
+// the configured hierarchy.
+package tpmtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/lib/x509tools"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+const tokenType = "tpm"
+
+// range of handles used for persistent objects
+const (
+	persistentFirst = tpm2.TPMHandle(0x81000000)
+	persistentLast  = tpm2.TPMHandle(0x81ffffff)
+)
+
+func init() {
+	token.Openers[tokenType] = Open
+}
+
+type tpmToken struct {
+	config    *config.Config
+	tokenConf *config.TokenConfig
+	tpm       transport.TPMCloser
+	hierarchy tpm2.TPMHandle
+	auth      []byte
+	// keys loaded from key files, flushed on close
+	loaded map[string]tpm2.NamedHandle
+	mu     sync.Mutex
+}
+
+// Open the TPM device named by the token's provider, or the system default if
+// none is set
+func Open(conf *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	hierarchy, err := parseHierarchy(tconf.Hierarchy)
+	if err != nil {
+		return nil, fmt.Errorf("tokens.%s.hierarchy: %w", tokenName, err)
+	}
+	tpm, err := openTPM(tconf.Provider)
+	if err != nil {
+		return nil, err
+	}
+	tok := &tpmToken{
+		config:    conf,
+		tokenConf: tconf,
+		tpm:       tpm,
+		hierarchy: hierarchy,
+	}
+	// The auth value is only checked by the TPM when a key is used, so
+	// accept whatever is provided
+	loginFunc := func(pin string) (bool, error) {
+		tok.auth = []byte(pin)
+		return true, nil
+	}
+	initialPrompt := fmt.Sprintf("Key auth value for TPM token %s: ", tconf.Name())
+	if err := token.Login(tconf, prompt, loginFunc, tconf.Name(), initialPrompt); err != nil {
+		tpm.Close()
+		return nil, err
+	}
+	return tok, nil
+}
+
+func parseHierarchy(name string) (tpm2.TPMHandle, error) {
+	switch strings.ToLower(name) {
+	case "", "owner":
+		return tpm2.TPMRHOwner, nil
+	case "endorsement":
+		return tpm2.TPMRHEndorsement, nil
+	case "platform":
+		return tpm2.TPMRHPlatform, nil
+	case "null":
+		return tpm2.TPMRHNull, nil
+	default:
+		return 0, fmt.Errorf("unknown hierarchy %q", name)
+	}
+}
+
+// Parse a persistent handle from a key id such as 81000001
+func parseHandle(id string) (tpm2.TPMHandle, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(id), "0x"), 16, 32)
+	handle := tpm2.TPMHandle(v)
+	if err != nil || handle < persistentFirst || handle > persistentLast {
+		return 0, fmt.Errorf("invalid key id %q: expected a persistent handle between %08x and %08x", id, uint32(persistentFirst), uint32(persistentLast))
+	}
+	return handle, nil
+}
+
+func (tok *tpmToken) Ping(ctx context.Context) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	if tok.tpm == nil {
+		return errors.New("token is closed")
+	}
+	_, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapTPMProperties,
+		Property:      uint32(tpm2.TPMPTManufacturer),
+		PropertyCount: 1,
+	}.Execute(tok.tpm)
+	return err
+}
+
+func (tok *tpmToken) Close() error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	if tok.tpm == nil {
+		return nil
+	}
+	for _, handle := range tok.loaded {
+		tok.flush(handle.Handle)
+	}
+	tok.loaded = nil
+	err := tok.tpm.Close()
+	tok.tpm = nil
+	return err
+}
+
+func (tok *tpmToken) flush(handle tpm2.TPMHandle) {
+	_, _ = tpm2.FlushContext{FlushHandle: handle}.Execute(tok.tpm)
+}
+
+func (tok *tpmToken) Config() *config.TokenConfig {
+	return tok.tokenConf
+}
+
+// Create the primary storage key that wrapped keys are loaded under. The TCG
+// reference ECC SRK template is used so the same key is derived every time.
+// The caller must flush it.
+func (tok *tpmToken) createPrimary() (tpm2.NamedHandle, error) {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tok.hierarchy,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(tok.tpm)
+	if err != nil {
+		return tpm2.NamedHandle{}, fmt.Errorf("creating primary key: %w", err)
+	}
+	return tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, nil
+}
+
+// List the handles of persistent objects in the TPM
+func (tok *tpmToken) persistentHandles() ([]tpm2.TPMHandle, error) {
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapHandles,
+		Property:      uint32(persistentFirst),
+		PropertyCount: 256,
+	}.Execute(tok.tpm)
+	if err != nil {
+		return nil, err
+	}
+	handles, err := rsp.CapabilityData.Data.Handles()
+	if err != nil {
+		return nil, err
+	}
+	return handles.Handle, nil
+}
+
+// Read the public area of a persistent object
+func (tok *tpmToken) readPublic(handle tpm2.TPMHandle) (*tpm2.ReadPublicResponse, crypto.PublicKey, error) {
+	rsp, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(tok.tpm)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := publicKey(rsp.OutPublic)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rsp, pub, nil
+}
+
+func publicKey(public tpm2.TPM2BPublic) (crypto.PublicKey, error) {
+	contents, err := public.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return tpm2.Pub(*contents)
+}
+
+func (tok *tpmToken) ListKeys(opts token.ListOptions) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	handles, err := tok.persistentHandles()
+	if err != nil {
+		return err
+	}
+	for _, handle := range handles {
+		id := fmt.Sprintf("%08x", uint32(handle))
+		if opts.ID != "" && !strings.EqualFold(strings.TrimPrefix(opts.ID, "0x"), id) {
+			continue
+		}
+		rsp, pub, err := tok.readPublic(handle)
+		if err != nil {
+			fmt.Fprintf(opts.Output, "handle %s:\n error reading key: %s\n", id, err)
+			continue
+		}
+		contents, _ := rsp.OutPublic.Contents()
+		if contents != nil && !contents.ObjectAttributes.SignEncrypt {
+			// storage and decryption keys
+			continue
+		}
+		var info token.KeyInfo
+		info.SetPublic(pub)
+		fmt.Fprintf(opts.Output, "handle %s:\n type:        %s\n bits:        %d\n", id, info.Type, info.Bits)
+		if opts.Values {
+			switch k := pub.(type) {
+			case *rsa.PublicKey:
+				fmt.Fprintf(opts.Output, " n:           0x%x\n e:           %d\n", k.N, k.E)
+			case *ecdsa.PublicKey:
+				fmt.Fprintf(opts.Output, " x:           %x\n y:           %x\n", k.X, k.Y)
+			}
+		}
+	}
+	return nil
+}
+
+func (tok *tpmToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	handles, err := tok.persistentHandles()
+	if err != nil {
+		return nil, err
+	}
+	var infos []token.KeyInfo
+	for _, handle := range handles {
+		rsp, pub, err := tok.readPublic(handle)
+		if err != nil {
+			return nil, err
+		}
+		if contents, err := rsp.OutPublic.Contents(); err != nil || !contents.ObjectAttributes.SignEncrypt {
+			continue
+		}
+		info := token.KeyInfo{ID: []byte(fmt.Sprintf("%08x", uint32(handle)))}
+		info.SetPublic(pub)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetKey loads a key from the persistent handle in its id, or from the wrapped
+// blob in its keyfile
+func (tok *tpmToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case keyConf.ID != "":
+		handle, err := parseHandle(keyConf.ID)
+		if err != nil {
+			return nil, err
+		}
+		rsp, pub, err := tok.readPublic(handle)
+		if err != nil {
+			if errors.Is(err, tpm2.TPMRCHandle) {
+				return nil, sigerrors.KeyNotFoundError{}
+			}
+			return nil, err
+		}
+		return tok.newKey(keyConf, tpm2.NamedHandle{Handle: handle, Name: rsp.Name}, pub), nil
+	case keyConf.KeyFile != "":
+		return tok.loadFile(keyConf)
+	default:
+		return nil, fmt.Errorf("key %s must set either id to a persistent handle or keyfile to a TPM key blob", keyName)
+	}
+}
+
+// Load a wrapped key from a key file and keep it loaded until the token is
+// closed
+func (tok *tpmToken) loadFile(keyConf *config.KeyConfig) (*tpmKey, error) {
+	blob, err := os.ReadFile(keyConf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	parent, public, private, err := parseKeyBlob(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyConf.KeyFile, err)
+	} else if parent != tok.hierarchy {
+		return nil, fmt.Errorf("%s: key was created under a different hierarchy than token %s uses", keyConf.KeyFile, tok.tokenConf.Name())
+	}
+	pub, err := publicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	handle, ok := tok.loaded[keyConf.KeyFile]
+	if !ok {
+		primary, err := tok.createPrimary()
+		if err != nil {
+			return nil, err
+		}
+		defer tok.flush(primary.Handle)
+		handle, err = tok.load(primary, public, private)
+		if err != nil {
+			return nil, err
+		}
+		if tok.loaded == nil {
+			tok.loaded = make(map[string]tpm2.NamedHandle)
+		}
+		tok.loaded[keyConf.KeyFile] = handle
+	}
+	return tok.newKey(keyConf, handle, pub), nil
+}
+
+func (tok *tpmToken) load(parent tpm2.NamedHandle, public tpm2.TPM2BPublic, private tpm2.TPM2BPrivate) (tpm2.NamedHandle, error) {
+	rsp, err := tpm2.Load{
+		ParentHandle: parent,
+		InPrivate:    private,
+		InPublic:     public,
+	}.Execute(tok.tpm)
+	if err != nil {
+		return tpm2.NamedHandle{}, fmt.Errorf("loading key: %w", err)
+	}
+	return tpm2.NamedHandle{Handle: rsp.ObjectHandle, Name: rsp.Name}, nil
+}
+
+func (tok *tpmToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (tok *tpmToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+// Generate a signing key in the TPM. If the key has an id then the key is
+// persisted at that handle, otherwise the wrapped key is written to its
+// keyfile.
+func (tok *tpmToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	var persist tpm2.TPMHandle
+	if keyConf.ID != "" {
+		persist, err = parseHandle(keyConf.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else if keyConf.KeyFile == "" {
+		return nil, fmt.Errorf("key %s must set either id to a persistent handle or keyfile to write the key blob to", keyName)
+	} else if _, err := os.Stat(keyConf.KeyFile); err == nil {
+		return nil, fmt.Errorf("%s already exists", keyConf.KeyFile)
+	}
+	template, err := keyTemplate(tok.tokenConf.Name(), keyType, bits)
+	if err != nil {
+		return nil, err
+	}
+	primary, err := tok.createPrimary()
+	if err != nil {
+		return nil, err
+	}
+	defer tok.flush(primary.Handle)
+	created, err := tpm2.Create{
+		ParentHandle: primary,
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				UserAuth: tpm2.TPM2BAuth{Buffer: tok.auth},
+			},
+		},
+		InPublic: tpm2.New2B(template),
+	}.Execute(tok.tpm)
+	if err != nil {
+		return nil, fmt.Errorf("creating key: %w", err)
+	}
+	if persist == 0 {
+		blob, err := marshalKeyBlob(tok.hierarchy, created.OutPublic, created.OutPrivate, len(tok.auth) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(keyConf.KeyFile, blob, 0600); err != nil {
+			return nil, err
+		}
+		return tok.loadFile(keyConf)
+	}
+	pub, err := publicKey(created.OutPublic)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := tok.load(primary, created.OutPublic, created.OutPrivate)
+	if err != nil {
+		return nil, err
+	}
+	auth := tpm2.TPMRHOwner
+	if tok.hierarchy == tpm2.TPMRHPlatform {
+		auth = tpm2.TPMRHPlatform
+	}
+	_, err = tpm2.EvictControl{
+		Auth:             auth,
+		ObjectHandle:     handle,
+		PersistentHandle: persist,
+	}.Execute(tok.tpm)
+	// the transient copy is no longer needed
+	tok.flush(handle.Handle)
+	if err != nil {
+		return nil, fmt.Errorf("persisting key at %08x: %w", uint32(persist), err)
+	}
+	return tok.newKey(keyConf, tpm2.NamedHandle{Handle: persist, Name: handle.Name}, pub), nil
+}
+
+// Build the public template for an unrestricted signing key. The signature
+// scheme is left open so it can be chosen for each signature.
+func keyTemplate(tokenName string, keyType token.KeyType, bits uint) (tpm2.TPMTPublic, error) {
+	public := tpm2.TPMTPublic{
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			UserWithAuth:        true,
+			SignEncrypt:         true,
+		},
+	}
+	switch keyType {
+	case token.KeyTypeRsa:
+		if bits == 0 {
+			bits = 2048
+		}
+		if bits != 2048 && bits != 3072 && bits != 4096 {
+			return public, token.UnsupportedKeyTypeError{Token: tokenName, KeyType: keyType, Bits: bits}
+		}
+		public.Type = tpm2.TPMAlgRSA
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgRSA, &tpm2.TPMSRSAParms{
+			Symmetric: tpm2.TPMTSymDefObject{Algorithm: tpm2.TPMAlgNull},
+			Scheme:    tpm2.TPMTRSAScheme{Scheme: tpm2.TPMAlgNull},
+			KeyBits:   tpm2.TPMKeyBits(bits),
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgRSA, &tpm2.TPM2BPublicKeyRSA{})
+	case token.KeyTypeEcdsa:
+		if bits == 0 {
+			bits = 256
+		}
+		curve, err := x509tools.CurveByBits(bits)
+		if err != nil {
+			return public, token.UnsupportedKeyTypeError{Token: tokenName, KeyType: keyType, Bits: bits}
+		}
+		var curveID tpm2.TPMECCCurve
+		switch curve.Bits {
+		case 256:
+			curveID = tpm2.TPMECCNistP256
+		case 384:
+			curveID = tpm2.TPMECCNistP384
+		case 521:
+			curveID = tpm2.TPMECCNistP521
+		}
+		public.Type = tpm2.TPMAlgECC
+		public.Parameters = tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Symmetric: tpm2.TPMTSymDefObject{Algorithm: tpm2.TPMAlgNull},
+			Scheme:    tpm2.TPMTECCScheme{Scheme: tpm2.TPMAlgNull},
+			CurveID:   curveID,
+			KDF:       tpm2.TPMTKDFScheme{Scheme: tpm2.TPMAlgNull},
+		})
+		public.Unique = tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{})
+	default:
+		return public, token.UnsupportedKeyTypeError{Token: tokenName, KeyType: keyType}
+	}
+	return public, nil
+}
@@ -0,0 +1,203 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vaulttoken
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/internal/httperror"
+)
+
+// renew the client token once less than this fraction of its TTL remains
+const renewFraction = 3
+
+type vaultClient struct {
+	addr   string
+	roleID string
+	secret string
+	cli    *http.Client
+
+	mu      sync.Mutex
+	token   string
+	ttl     time.Duration
+	expires time.Time
+	renew   bool
+}
+
+type authResponse struct {
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Data *struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	} `json:"data"`
+}
+
+func newClient(tconf *config.TokenConfig) (*vaultClient, error) {
+	addr := tconf.Provider
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, errors.New("vault token needs \"provider\" set to the address of the Vault server, or VAULT_ADDR set in the environment")
+	}
+	c := &vaultClient{
+		addr:   strings.TrimSuffix(addr, "/"),
+		roleID: tconf.RoleID,
+		cli:    &http.Client{Timeout: defaultTimeout},
+	}
+	switch {
+	case tconf.Pin != nil:
+		c.secret = *tconf.Pin
+	case c.roleID != "":
+		c.secret = os.Getenv("VAULT_SECRET_ID")
+	default:
+		c.secret = os.Getenv("VAULT_TOKEN")
+	}
+	if c.secret == "" {
+		if c.roleID != "" {
+			return nil, errors.New("vault token uses AppRole auth but no secret ID was provided in \"pin\" or VAULT_SECRET_ID")
+		}
+		return nil, errors.New("vault token needs \"pin\" set to a Vault token, or VAULT_TOKEN set in the environment")
+	}
+	return c, nil
+}
+
+// login authenticates with AppRole, or looks up the TTL of a static token
+func (c *vaultClient) login(ctx context.Context) error {
+	var resp authResponse
+	if c.roleID != "" {
+		req := map[string]string{"role_id": c.roleID, "secret_id": c.secret}
+		if err := c.do(ctx, http.MethodPost, "auth/approle/login", "", req, &resp); err != nil {
+			return fmt.Errorf("vault approle login: %w", err)
+		} else if resp.Auth == nil || resp.Auth.ClientToken == "" {
+			return errors.New("vault approle login: no client token in response")
+		}
+		c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		return nil
+	}
+	if err := c.do(ctx, http.MethodGet, "auth/token/lookup-self", c.secret, nil, &resp); err != nil {
+		return fmt.Errorf("vault token lookup: %w", err)
+	} else if resp.Data == nil {
+		return errors.New("vault token lookup: no data in response")
+	}
+	c.setToken(c.secret, resp.Data.TTL, resp.Data.Renewable)
+	return nil
+}
+
+func (c *vaultClient) setToken(token string, ttl int, renewable bool) {
+	c.token = token
+	c.ttl = time.Duration(ttl) * time.Second
+	c.expires = time.Now().Add(c.ttl)
+	c.renew = renewable
+}
+
+// getToken returns a current client token, renewing or logging in again if it
+// is close to expiring so that long-running servers don't lose their session
+func (c *vaultClient) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" {
+		if err := c.login(ctx); err != nil {
+			return "", err
+		}
+	}
+	if c.ttl == 0 || time.Until(c.expires) > c.ttl/renewFraction {
+		// token doesn't expire, or isn't due for renewal yet
+		return c.token, nil
+	}
+	if c.renew {
+		var resp authResponse
+		err := c.do(ctx, http.MethodPost, "auth/token/renew-self", c.token, map[string]string{}, &resp)
+		switch {
+		case err == nil && resp.Auth != nil:
+			c.setToken(c.token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return c.token, nil
+		case c.roleID != "":
+			// log in again below
+		case err != nil:
+			return "", fmt.Errorf("vault token renewal: %w", err)
+		default:
+			return "", errors.New("vault: renew returned no auth")
+		}
+	}
+	if c.roleID == "" {
+		// static token can't be refreshed, use it until it expires
+		return c.token, nil
+	}
+	if err := c.login(ctx); err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+// call makes an authenticated API call
+func (c *vaultClient) call(ctx context.Context, method, path string, req, resp interface{}) error {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, token, req, resp)
+}
+
+func (c *vaultClient) do(ctx context.Context, method, path, token string, req, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		blob, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(blob)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, method, c.addr+"/v1/"+path, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		hreq.Header.Set("X-Vault-Token", token)
+	}
+	hresp, err := c.cli.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode >= 300 {
+		return httperror.FromResponse(hresp)
+	}
+	blob, err := io.ReadAll(hresp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, resp)
+}
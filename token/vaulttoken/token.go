@@ -0,0 +1,287 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vaulttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+const (
+	tokenType      = "vault"
+	defaultMount   = "transit"
+	defaultTimeout = 60 * time.Second
+)
+
+type vaultToken struct {
+	config *config.Config
+	tconf  *config.TokenConfig
+	cli    *vaultClient
+	mount  string
+}
+
+type vaultKey struct {
+	kconf   *config.KeyConfig
+	tok     *vaultToken
+	pub     crypto.PublicKey
+	version int
+}
+
+func init() {
+	token.Openers[tokenType] = open
+}
+
+func open(conf *config.Config, tokenName string, pinProvider passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := newClient(tconf)
+	if err != nil {
+		return nil, err
+	}
+	mount := strings.Trim(tconf.Mount, "/")
+	if mount == "" {
+		mount = defaultMount
+	}
+	return &vaultToken{
+		config: conf,
+		tconf:  tconf,
+		cli:    cli,
+		mount:  mount,
+	}, nil
+}
+
+func (t *vaultToken) Close() error {
+	return nil
+}
+
+func (t *vaultToken) Ping(ctx context.Context) error {
+	_, err := t.cli.getToken(ctx)
+	return err
+}
+
+func (t *vaultToken) Config() *config.TokenConfig {
+	return t.tconf
+}
+
+type keyResponse struct {
+	Data struct {
+		Type          string `json:"type"`
+		LatestVersion int    `json:"latest_version"`
+		Keys          map[string]struct {
+			PublicKey string `json:"public_key"`
+		} `json:"keys"`
+	} `json:"data"`
+}
+
+func (t *vaultToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	keyConf, err := t.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" {
+		return nil, fmt.Errorf("key %q must have \"id\" set to the name of a transit key", keyName)
+	}
+	var resp keyResponse
+	if err := t.cli.call(ctx, http.MethodGet, t.keyPath("keys", keyConf.ID), nil, &resp); err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	version := resp.Data.LatestVersion
+	if wantKeyID := token.KeyID(ctx); len(wantKeyID) != 0 {
+		// reusing a key the client saw before
+		version, err = strconv.Atoi(string(wantKeyID))
+		if err != nil {
+			return nil, errors.New("invalid keyID")
+		}
+	}
+	keyVer, ok := resp.Data.Keys[strconv.Itoa(version)]
+	if !ok {
+		return nil, fmt.Errorf("key %q: version %d not found", keyName, version)
+	}
+	pub, err := parsePublicKey(resp.Data.Type, keyVer.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", keyName, err)
+	}
+	return &vaultKey{
+		kconf:   keyConf,
+		tok:     t,
+		pub:     pub,
+		version: version,
+	}, nil
+}
+
+func (t *vaultToken) keyPath(op, keyName string) string {
+	return t.mount + "/" + op + "/" + url.PathEscape(keyName)
+}
+
+func (t *vaultToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (t *vaultToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (t *vaultToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "generate-key", Type: tokenType}
+}
+
+func (t *vaultToken) ListKeys(opts token.ListOptions) error {
+	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
+func (t *vaultToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
+func (k *vaultKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+func (k *vaultKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	return k.SignContext(context.Background(), digest, opts)
+}
+
+type signResponse struct {
+	Data struct {
+		Signature string `json:"signature"`
+	} `json:"data"`
+}
+
+func (k *vaultKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
+	req := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(digest),
+		"key_version":          k.version,
+		"marshaling_algorithm": "asn1",
+	}
+	if _, ok := k.pub.(ed25519.PublicKey); !ok {
+		hashAlg, err := k.hashAlgorithm(opts.HashFunc())
+		if err != nil {
+			return nil, err
+		}
+		req["prehashed"] = true
+		req["hash_algorithm"] = hashAlg
+	}
+	if _, ok := k.pub.(*rsa.PublicKey); ok {
+		if pss, ok := opts.(*rsa.PSSOptions); ok {
+			req["signature_algorithm"] = "pss"
+			switch pss.SaltLength {
+			case rsa.PSSSaltLengthAuto:
+				req["salt_length"] = "auto"
+			case rsa.PSSSaltLengthEqualsHash:
+				req["salt_length"] = "hash"
+			default:
+				req["salt_length"] = pss.SaltLength
+			}
+		} else {
+			req["signature_algorithm"] = "pkcs1v15"
+		}
+	}
+	var resp signResponse
+	if err := k.tok.cli.call(ctx, http.MethodPost, k.tok.keyPath("sign", k.kconf.ID), req, &resp); err != nil {
+		return nil, err
+	}
+	// signature is formatted as vault:v<version>:<base64>
+	words := strings.Split(resp.Data.Signature, ":")
+	if len(words) != 3 || words[0] != "vault" {
+		return nil, errors.New("unexpected signature format in vault response")
+	}
+	return base64.StdEncoding.DecodeString(words[2])
+}
+
+func (k *vaultKey) Config() *config.KeyConfig {
+	return k.kconf
+}
+
+func (k *vaultKey) Certificate() []byte {
+	return nil
+}
+
+func (k *vaultKey) GetID() []byte {
+	// encode the exact key version so that callers via a worker token get a
+	// consistent signing key from GetKey() to Sign()
+	return []byte(strconv.Itoa(k.version))
+}
+
+func (k *vaultKey) ImportCertificate(cert *x509.Certificate) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+func (k *vaultKey) hashAlgorithm(hash crypto.Hash) (string, error) {
+	switch hash {
+	case crypto.SHA1:
+		return "sha1", nil
+	case crypto.SHA224:
+		return "sha2-224", nil
+	case crypto.SHA256:
+		return "sha2-256", nil
+	case crypto.SHA384:
+		return "sha2-384", nil
+	case crypto.SHA512:
+		return "sha2-512", nil
+	default:
+		return "", token.KeyUsageError{
+			Key: k.kconf.Name(),
+			Err: fmt.Errorf("unsupported digest algorithm %s", hash),
+		}
+	}
+}
+
+func parsePublicKey(keyType, encoded string) (crypto.PublicKey, error) {
+	if keyType == "ed25519" {
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		} else if len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("parsing public key: invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("key type %q has no public key", keyType)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
@@ -0,0 +1,226 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vaulttoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+const (
+	testRoleID   = "test-role"
+	testSecretID = "test-secret"
+	testToken    = "s.clienttoken"
+)
+
+// fakeVault implements the parts of the Vault API used by the token: AppRole
+// login and a transit key with two versions
+type fakeVault struct {
+	t      *testing.T
+	keys   map[int]*ecdsa.PrivateKey
+	logins atomic.Int32
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{t: t, keys: make(map[int]*ecdsa.PrivateKey)}
+	for _, version := range []int{1, 2} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		v.keys[version] = key
+	}
+	srv := httptest.NewServer(v)
+	t.Cleanup(srv.Close)
+	return v, srv
+}
+
+func (v *fakeVault) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var reqBody map[string]interface{}
+	if req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.URL.Path == "/v1/auth/approle/login" {
+		if reqBody["role_id"] != testRoleID || reqBody["secret_id"] != testSecretID {
+			http.Error(rw, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		v.logins.Add(1)
+		v.reply(rw, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token":   testToken,
+			"lease_duration": 3600,
+			"renewable":      true,
+		}})
+		return
+	}
+	if req.Header.Get("X-Vault-Token") != testToken {
+		http.Error(rw, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/transit/keys/testkey":
+		keys := make(map[string]interface{})
+		for version, key := range v.keys {
+			der, err := x509.MarshalPKIXPublicKey(key.Public())
+			assert.NoError(v.t, err)
+			keys[strconv.Itoa(version)] = map[string]string{
+				"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			}
+		}
+		v.reply(rw, map[string]interface{}{"data": map[string]interface{}{
+			"type":           "ecdsa-p256",
+			"latest_version": 2,
+			"keys":           keys,
+		}})
+	case req.Method == http.MethodPost && req.URL.Path == "/v1/transit/sign/testkey":
+		assert.Equal(v.t, true, reqBody["prehashed"])
+		assert.Equal(v.t, "sha2-256", reqBody["hash_algorithm"])
+		assert.Equal(v.t, "asn1", reqBody["marshaling_algorithm"])
+		version := int(reqBody["key_version"].(float64))
+		key := v.keys[version]
+		if key == nil {
+			http.Error(rw, `{"errors":["unknown key version"]}`, http.StatusBadRequest)
+			return
+		}
+		digest, err := base64.StdEncoding.DecodeString(reqBody["input"].(string))
+		assert.NoError(v.t, err)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+		assert.NoError(v.t, err)
+		v.reply(rw, map[string]interface{}{"data": map[string]string{
+			"signature": fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString(sig)),
+		}})
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+func (v *fakeVault) reply(rw http.ResponseWriter, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	assert.NoError(v.t, json.NewEncoder(rw).Encode(body))
+}
+
+func openTest(t *testing.T, addr, secret string) token.Token {
+	conf := new(config.Config)
+	tconf := conf.NewToken("vault")
+	tconf.Type = tokenType
+	tconf.Provider = addr + "/"
+	tconf.RoleID = testRoleID
+	tconf.Pin = &secret
+	keyConf := conf.NewKey("mykey")
+	keyConf.Token = "vault"
+	keyConf.ID = "testkey"
+	tok, err := open(conf, "vault", nil)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestSign(t *testing.T) {
+	v, srv := newFakeVault(t)
+	tok := openTest(t, srv.URL, testSecretID)
+	ctx := context.Background()
+	key, err := tok.GetKey(ctx, "mykey")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), key.GetID())
+	pub, ok := key.Public().(*ecdsa.PublicKey)
+	require.True(t, ok)
+	assert.True(t, pub.Equal(v.keys[2].Public()))
+
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := key.SignContext(ctx, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(pub, digest[:], sig))
+	// the client token from the first login is reused
+	_, err = key.SignContext(ctx, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), v.logins.Load())
+}
+
+func TestKeyVersion(t *testing.T) {
+	v, srv := newFakeVault(t)
+	tok := openTest(t, srv.URL, testSecretID)
+	ctx := token.WithKeyID(context.Background(), []byte("1"))
+	key, err := tok.GetKey(ctx, "mykey")
+	require.NoError(t, err)
+	pub := key.Public().(*ecdsa.PublicKey)
+	assert.True(t, pub.Equal(v.keys[1].Public()))
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := key.SignContext(ctx, digest[:], crypto.SHA256)
+	require.NoError(t, err)
+	assert.True(t, ecdsa.VerifyASN1(pub, digest[:], sig))
+
+	_, err = tok.GetKey(token.WithKeyID(ctx, []byte("3")), "mykey")
+	assert.ErrorContains(t, err, "version 3 not found")
+}
+
+func TestAppRoleLoginFailed(t *testing.T) {
+	v, srv := newFakeVault(t)
+	tok := openTest(t, srv.URL, "wrong")
+	_, err := tok.GetKey(context.Background(), "mykey")
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), `key "mykey": vault approle login:`), err.Error())
+	assert.Error(t, tok.Ping(context.Background()))
+	assert.Equal(t, int32(0), v.logins.Load())
+}
+
+func TestRenewNoAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/v1/auth/token/lookup-self":
+			fmt.Fprint(rw, `{"data":{"ttl":3600,"renewable":true}}`)
+		case "/v1/auth/token/renew-self":
+			fmt.Fprint(rw, `{}`)
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	secret := testToken
+	tconf := &config.TokenConfig{Provider: srv.URL, Pin: &secret}
+	c, err := newClient(tconf)
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = c.getToken(ctx)
+	require.NoError(t, err)
+	// due for renewal
+	c.expires = time.Now()
+	_, err = c.getToken(ctx)
+	assert.EqualError(t, err, "vault: renew returned no auth")
+}
@@ -57,7 +57,10 @@ func (t *WorkerToken) request(ctx context.Context, path string, rr workerrpc.Req
 }
 
 func (t *WorkerToken) Ping(ctx context.Context) error {
-	_, err := t.request(ctx, workerrpc.Ping, workerrpc.Request{})
+	rresp, err := t.request(ctx, workerrpc.Ping, workerrpc.Request{})
+	if err == nil {
+		t.observeSessions(rresp)
+	}
 	return err
 }
 
@@ -103,6 +106,10 @@ func (t *WorkerToken) ListKeys(opts token.ListOptions) error {
 	return token.NotImplementedError{Op: "list-keys", Type: tokenType}
 }
 
+func (t *WorkerToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	return nil, token.NotImplementedError{Op: "list-keys", Type: tokenType}
+}
+
 type workerKey struct {
 	token  *WorkerToken
 	kconf  *config.KeyConfig
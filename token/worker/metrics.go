@@ -0,0 +1,74 @@
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package worker
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/sassoftware/relic/v8/internal/workerrpc"
+)
+
+var (
+	metricPkcs11Errors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "token_pkcs11_errors",
+			Help: "PKCS#11 errors returned by worker processes, by return value",
+		},
+		[]string{"token", "code"},
+	)
+	// the pool lives in the worker process, so it is reported back on each
+	// health check ping
+	metricWorkerSessionsInUse = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_sessions_in_use",
+			Help: "Number of pooled PKCS#11 sessions signing in each worker process, as of the last ping",
+		},
+		[]string{"token", "pid"},
+	)
+	metricWorkerSessionsIdle = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_sessions_idle",
+			Help: "Number of idle pooled PKCS#11 sessions in each worker process, as of the last ping",
+		},
+		[]string{"token", "pid"},
+	)
+)
+
+func (t *WorkerToken) observeSessions(rresp *workerrpc.Response) {
+	if rresp.Sessions == nil || rresp.Pid == 0 {
+		return
+	}
+	name := t.tconf.Name()
+	pid := strconv.Itoa(rresp.Pid)
+	metricWorkerSessionsInUse.WithLabelValues(name, pid).Set(float64(rresp.Sessions.InUse))
+	metricWorkerSessionsIdle.WithLabelValues(name, pid).Set(float64(rresp.Sessions.Idle))
+}
+
+func (t *WorkerToken) forgetSessions(pid int) {
+	name := t.tconf.Name()
+	spid := strconv.Itoa(pid)
+	metricWorkerSessionsInUse.DeleteLabelValues(name, spid)
+	metricWorkerSessionsIdle.DeleteLabelValues(name, spid)
+}
+
+func (t *WorkerToken) observePkcs11Error(code uint) {
+	metricPkcs11Errors.WithLabelValues(t.tconf.Name(), fmt.Sprintf("0x%08X", code)).Inc()
+}
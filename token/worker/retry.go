@@ -141,6 +141,9 @@ func (t *WorkerToken) doOnce(req *http.Request, timeout time.Duration) (*workerr
 			Err: errors.New(rresp.Err),
 		}
 	}
+	if rresp.ErrCode != 0 {
+		t.observePkcs11Error(rresp.ErrCode)
+	}
 	return nil, tokenError{Err: rresp.Err, Retryable: rresp.Retryable}
 }
 
@@ -197,6 +197,7 @@ func (t *WorkerToken) removePid(pid int) {
 	t.mu.Lock()
 	delete(t.procs, pid)
 	t.mu.Unlock()
+	t.forgetSessions(pid)
 }
 
 func (t *WorkerToken) Close() error {
@@ -0,0 +1,106 @@
+//go:build yubikey
+// +build yubikey
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package yubikeytoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+
+	"github.com/go-piv/piv-go/v2/piv"
+
+	"github.com/sassoftware/relic/v8/config"
+)
+
+type yubikeyKey struct {
+	token   *yubikeyToken
+	keyConf *config.KeyConfig
+	slot    piv.Slot
+	pub     crypto.PublicKey
+	cert    *x509.Certificate
+	touch   piv.TouchPolicy
+}
+
+func (tok *yubikeyToken) newKey(keyConf *config.KeyConfig, slot piv.Slot, pub crypto.PublicKey, cert *x509.Certificate, touch piv.TouchPolicy) *yubikeyKey {
+	return &yubikeyKey{
+		token:   tok,
+		keyConf: keyConf,
+		slot:    slot,
+		pub:     pub,
+		cert:    cert,
+		touch:   touch,
+	}
+}
+
+func (key *yubikeyKey) Public() crypto.PublicKey {
+	return key.pub
+}
+
+func (key *yubikeyKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	key.token.mu.Lock()
+	defer key.token.mu.Unlock()
+	if key.token.yk == nil {
+		return nil, errors.New("token is closed")
+	}
+	priv, err := key.token.yk.PrivateKey(key.slot, key.pub, piv.KeyAuth{PIN: key.token.pin})
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("PIV key does not support signing")
+	}
+	if key.touch != piv.TouchPolicyNever {
+		key.token.touchPrompt(key.keyConf.Name())
+	}
+	return signer.Sign(rand, digest, opts)
+}
+
+func (key *yubikeyKey) SignContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return key.Sign(rand.Reader, digest, opts)
+}
+
+func (key *yubikeyKey) Config() *config.KeyConfig {
+	return key.keyConf
+}
+
+func (key *yubikeyKey) Certificate() []byte {
+	if key.cert == nil {
+		return nil
+	}
+	return key.cert.Raw
+}
+
+func (key *yubikeyKey) GetID() []byte {
+	return []byte(key.slot.String())
+}
+
+func (key *yubikeyKey) ImportCertificate(cert *x509.Certificate) error {
+	key.token.mu.Lock()
+	defer key.token.mu.Unlock()
+	if err := key.token.yk.SetCertificate(piv.DefaultManagementKey, key.slot, cert); err != nil {
+		return err
+	}
+	key.cert = cert
+	return nil
+}
@@ -0,0 +1,376 @@
+//go:build yubikey
+// +build yubikey
+
+//
+// Copyright (c) SAS Institute Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package yubikeytoken signs using the PIV applet of a YubiKey. It is only
+// built with the "yubikey" build tag because it needs the piv-go module and,
+// on Linux, the PC/SC development headers.
+package yubikeytoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-piv/piv-go/v2/piv"
+
+	"github.com/sassoftware/relic/v8/config"
+	"github.com/sassoftware/relic/v8/lib/passprompt"
+	"github.com/sassoftware/relic/v8/signers/sigerrors"
+	"github.com/sassoftware/relic/v8/token"
+)
+
+const tokenType = "yubikey"
+
+func init() {
+	token.Openers[tokenType] = Open
+	token.Listers[tokenType] = List
+}
+
+type yubikeyToken struct {
+	config    *config.Config
+	tokenConf *config.TokenConfig
+	yk        *piv.YubiKey
+	serial    string
+	pin       string
+	mu        sync.Mutex
+}
+
+// List the YubiKeys attached to the system. The provider argument is not
+// used.
+func List(provider string, output io.Writer) error {
+	cards, err := piv.Cards()
+	if err != nil {
+		return err
+	}
+	var found bool
+	for _, card := range cards {
+		if !isYubiKey(card) {
+			continue
+		}
+		found = true
+		yk, err := piv.Open(card)
+		if err != nil {
+			fmt.Fprintf(output, "%s: error: %s\n", card, err)
+			continue
+		}
+		serial, err := yk.Serial()
+		yk.Close()
+		if err != nil {
+			fmt.Fprintf(output, "%s: error: %s\n", card, err)
+			continue
+		}
+		fmt.Fprintf(output, "%s: serial %d\n", card, serial)
+	}
+	if !found {
+		fmt.Fprintln(output, "no YubiKeys found")
+	}
+	return nil
+}
+
+func isYubiKey(card string) bool {
+	return strings.Contains(strings.ToLower(card), "yubikey")
+}
+
+// Open the YubiKey selected by the token's serial setting, or the only one
+// attached if no serial is configured
+func Open(conf *config.Config, tokenName string, prompt passprompt.PasswordGetter) (token.Token, error) {
+	tconf, err := conf.GetToken(tokenName)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := piv.Cards()
+	if err != nil {
+		return nil, err
+	}
+	tok := &yubikeyToken{
+		config:    conf,
+		tokenConf: tconf,
+	}
+	for _, card := range cards {
+		if !isYubiKey(card) {
+			continue
+		}
+		yk, err := piv.Open(card)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %w", card, err)
+		}
+		serial, err := yk.Serial()
+		if err != nil {
+			yk.Close()
+			return nil, fmt.Errorf("opening %s: %w", card, err)
+		}
+		serialStr := strconv.FormatUint(uint64(serial), 10)
+		if tconf.Serial != "" && tconf.Serial != serialStr {
+			yk.Close()
+			continue
+		}
+		if tok.yk != nil {
+			yk.Close()
+			tok.Close()
+			return nil, fmt.Errorf("multiple YubiKeys found; set tokens.%s.serial to choose one", tokenName)
+		}
+		tok.yk = yk
+		tok.serial = serialStr
+	}
+	if tok.yk == nil {
+		if tconf.Serial != "" {
+			return nil, fmt.Errorf("YubiKey with serial %s not found", tconf.Serial)
+		}
+		return nil, errors.New("no YubiKeys found")
+	}
+	if err := tok.login(prompt); err != nil {
+		tok.Close()
+		return nil, err
+	}
+	return tok, nil
+}
+
+func (tok *yubikeyToken) login(prompt passprompt.PasswordGetter) error {
+	loginFunc := func(pin string) (bool, error) {
+		err := tok.yk.VerifyPIN(pin)
+		var authErr *piv.AuthErr
+		if err == nil {
+			tok.pin = pin
+			return true, nil
+		} else if errors.As(err, &authErr) {
+			if authErr.Retries == 0 {
+				return false, sigerrors.PinLockedError{}
+			}
+			return false, nil
+		}
+		return false, err
+	}
+	initialPrompt := fmt.Sprintf("PIV PIN for YubiKey %s (serial %s): ", tok.tokenConf.Name(), tok.serial)
+	return token.Login(tok.tokenConf, prompt, loginFunc, tok.serial, initialPrompt)
+}
+
+func (tok *yubikeyToken) Ping(ctx context.Context) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	if tok.yk == nil {
+		return errors.New("token is closed")
+	}
+	_, err := tok.yk.Serial()
+	return err
+}
+
+func (tok *yubikeyToken) Close() error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	if tok.yk != nil {
+		tok.yk.Close()
+		tok.yk = nil
+	}
+	return nil
+}
+
+func (tok *yubikeyToken) Config() *config.TokenConfig {
+	return tok.tokenConf
+}
+
+// Parse a PIV slot from its hex key reference: 9a, 9c, 9d, 9e or one of the
+// retired key management slots 82 through 95
+func parseSlot(id string) (piv.Slot, error) {
+	ref, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(id), "0x"), 16, 8)
+	if err == nil {
+		switch ref {
+		case 0x9a:
+			return piv.SlotAuthentication, nil
+		case 0x9c:
+			return piv.SlotSignature, nil
+		case 0x9d:
+			return piv.SlotKeyManagement, nil
+		case 0x9e:
+			return piv.SlotCardAuthentication, nil
+		default:
+			if slot, ok := piv.RetiredKeyManagementSlot(uint32(ref)); ok {
+				return slot, nil
+			}
+		}
+	}
+	return piv.Slot{}, fmt.Errorf("invalid PIV slot %q: expected one of 9a, 9c, 9d, 9e or 82-95", id)
+}
+
+func allSlots() []piv.Slot {
+	slots := []piv.Slot{piv.SlotAuthentication, piv.SlotSignature, piv.SlotKeyManagement, piv.SlotCardAuthentication}
+	for ref := uint32(0x82); ref <= 0x95; ref++ {
+		if slot, ok := piv.RetiredKeyManagementSlot(ref); ok {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// Read the public key and certificate in a slot. The public key comes from
+// the key metadata if the firmware supports it, otherwise from the
+// certificate.
+func (tok *yubikeyToken) readSlot(slot piv.Slot) (crypto.PublicKey, *x509.Certificate, piv.TouchPolicy, error) {
+	cert, err := tok.yk.Certificate(slot)
+	if err != nil && !errors.Is(err, piv.ErrNotFound) {
+		return nil, nil, 0, err
+	}
+	var pub crypto.PublicKey
+	touch := piv.TouchPolicyNever
+	if info, err := tok.yk.KeyInfo(slot); err == nil {
+		pub = info.PublicKey
+		touch = info.TouchPolicy
+	}
+	if pub == nil && cert != nil {
+		pub = cert.PublicKey
+	}
+	if pub == nil {
+		return nil, nil, 0, piv.ErrNotFound
+	}
+	return pub, cert, touch, nil
+}
+
+func (tok *yubikeyToken) ListKeys(opts token.ListOptions) error {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	fmt.Fprintf(opts.Output, "serial: %s\n", tok.serial)
+	for _, slot := range allSlots() {
+		if opts.ID != "" && !strings.EqualFold(opts.ID, slot.String()) {
+			continue
+		}
+		pub, cert, touch, err := tok.readSlot(slot)
+		if errors.Is(err, piv.ErrNotFound) {
+			continue
+		} else if err != nil {
+			fmt.Fprintf(opts.Output, "slot %s:\n error reading key: %s\n", slot, err)
+			continue
+		}
+		var info token.KeyInfo
+		info.SetPublic(pub)
+		fmt.Fprintf(opts.Output, "slot %s:\n type:        %s\n bits:        %d\n", slot, info.Type, info.Bits)
+		if touch != piv.TouchPolicyNever {
+			fmt.Fprintln(opts.Output, " touch:       required")
+		}
+		if cert != nil {
+			fmt.Fprintf(opts.Output, " subject:     %s\n", cert.Subject)
+		}
+		if opts.Values {
+			switch k := pub.(type) {
+			case *rsa.PublicKey:
+				fmt.Fprintf(opts.Output, " n:           0x%x\n e:           %d\n", k.N, k.E)
+			case *ecdsa.PublicKey:
+				fmt.Fprintf(opts.Output, " x:           %x\n y:           %x\n", k.X, k.Y)
+			}
+		}
+	}
+	return nil
+}
+
+func (tok *yubikeyToken) EnumerateKeys() ([]token.KeyInfo, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	var infos []token.KeyInfo
+	for _, slot := range allSlots() {
+		pub, _, _, err := tok.readSlot(slot)
+		if errors.Is(err, piv.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		info := token.KeyInfo{ID: []byte(slot.String())}
+		info.SetPublic(pub)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (tok *yubikeyToken) GetKey(ctx context.Context, keyName string) (token.Key, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" {
+		return nil, fmt.Errorf("key %s must set id to the PIV slot to use, e.g. 9c", keyName)
+	}
+	slot, err := parseSlot(keyConf.ID)
+	if err != nil {
+		return nil, err
+	}
+	pub, cert, touch, err := tok.readSlot(slot)
+	if errors.Is(err, piv.ErrNotFound) {
+		return nil, sigerrors.KeyNotFoundError{}
+	} else if err != nil {
+		return nil, err
+	}
+	return tok.newKey(keyConf, slot, pub, cert, touch), nil
+}
+
+func (tok *yubikeyToken) Import(keyName string, privKey crypto.PrivateKey) (token.Key, error) {
+	return nil, token.NotImplementedError{Op: "import-key", Type: tokenType}
+}
+
+func (tok *yubikeyToken) ImportCertificate(cert *x509.Certificate, labelBase string) error {
+	return token.NotImplementedError{Op: "import-certificate", Type: tokenType}
+}
+
+// Generate a key on the device in the slot named by the key's id. The factory
+// default management key is used to authorize the change.
+func (tok *yubikeyToken) Generate(keyName string, keyType token.KeyType, bits uint) (token.Key, error) {
+	tok.mu.Lock()
+	defer tok.mu.Unlock()
+	keyConf, err := tok.config.GetKey(keyName)
+	if err != nil {
+		return nil, err
+	}
+	if keyConf.ID == "" {
+		return nil, fmt.Errorf("key %s must set id to the PIV slot to use, e.g. 9c", keyName)
+	}
+	slot, err := parseSlot(keyConf.ID)
+	if err != nil {
+		return nil, err
+	}
+	var alg piv.Algorithm
+	switch {
+	case keyType == token.KeyTypeRsa && bits == 2048:
+		alg = piv.AlgorithmRSA2048
+	case keyType == token.KeyTypeEcdsa && bits == 256:
+		alg = piv.AlgorithmEC256
+	default:
+		return nil, token.UnsupportedKeyTypeError{Token: tok.tokenConf.Name(), KeyType: keyType, Bits: bits}
+	}
+	pub, err := tok.yk.GenerateKey(piv.DefaultManagementKey, slot, piv.Key{
+		Algorithm:   alg,
+		PINPolicy:   piv.PINPolicyOnce,
+		TouchPolicy: piv.TouchPolicyNever,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tok.newKey(keyConf, slot, pub, nil, piv.TouchPolicyNever), nil
+}
+
+// Print a prompt so the user knows to tap the device
+func (tok *yubikeyToken) touchPrompt(keyName string) {
+	fmt.Fprintf(os.Stderr, "Touch YubiKey %s (serial %s) to sign with key %s\n", tok.tokenConf.Name(), tok.serial, keyName)
+}